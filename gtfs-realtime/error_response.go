@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/TfGMEnterprise/departures-service/model"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pkg/errors"
+	"net/http"
+)
+
+// Machine-readable error codes returned to clients in the error response body
+const (
+	errorCodeInvalidParameter = "invalidParameter"
+	errorCodeInternalError    = "internalError"
+)
+
+// errorResponse logs the error and converts it into an API Gateway response
+// with the status code. Client errors include the error message in the
+// response body; server errors only include a generic message so that
+// internal details stay in the logs.
+func (g GTFSRealtime) errorResponse(statusCode int, code string, err error) (*events.APIGatewayProxyResponse, error) {
+	g.Logger.Debug("errorResponse")
+
+	output := model.ErrorOutput{
+		Code:    code,
+		Message: err.Error(),
+	}
+
+	if statusCode >= http.StatusInternalServerError {
+		g.Logger.Printf("%+v", err)
+		output.Message = http.StatusText(statusCode)
+	} else {
+		g.Logger.Debugf("%+v", err)
+	}
+
+	outputJSON, err := json.Marshal(output)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal JSON for error response")
+	}
+
+	return &events.APIGatewayProxyResponse{
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"content-type": "application/json",
+		},
+		Body: string(outputJSON),
+	}, nil
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/TfGMEnterprise/departures-service/dlog"
+	"github.com/TfGMEnterprise/departures-service/model"
+	"github.com/TfGMEnterprise/departures-service/repository"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+)
+
+type GTFSRealtime struct {
+	Logger   *dlog.Logger
+	Pool     *redis.Pool
+	ScanSize int
+}
+
+func main() {
+	loggerOptions := []dlog.LoggerOption{
+		dlog.LoggerSetOutput(os.Stderr),
+		dlog.LoggerSetPrefix("gtfs-realtime: "),
+		dlog.LoggerSetFlags(log.Ldate | log.Ltime | log.Lmicroseconds | log.Llongfile),
+	}
+
+	logger := dlog.NewLogger(loggerOptions...)
+
+	logger.Debug("main")
+
+	departuresRedisHost, exists := os.LookupEnv("DEPARTURES_REDIS_HOST")
+	if !exists || departuresRedisHost == "" {
+		logger.Fatal("DEPARTURES_REDIS_HOST not set in environment")
+	}
+
+	g := &GTFSRealtime{
+		Logger: logger,
+		Pool: repository.NewRedisPool([]repository.RedisPoolOption{
+			repository.RedisPoolDial(func() (redis.Conn, error) {
+				return redis.Dial("tcp", departuresRedisHost)
+			}),
+		}...),
+		ScanSize: 1000,
+	}
+
+	defer func() {
+		g.Logger.Debug("close Redis pool")
+		if err := g.Pool.Close(); err != nil {
+			g.Logger.Print("failed to close Redis pool")
+			return
+		}
+		g.Logger.Debug("closed Redis pool")
+	}()
+
+	lambda.Start(g.Handler)
+}
+
+func (g GTFSRealtime) Handler(request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	g.Logger.Debug("Handler")
+
+	format, exists := request.QueryStringParameters["format"]
+	if !exists {
+		format = "protobuf"
+	}
+
+	if format != "protobuf" && format != "json" {
+		return g.errorResponse(http.StatusBadRequest, errorCodeInvalidParameter, errors.Errorf("format value `%s` is not valid", format))
+	}
+
+	now := time.Now()
+
+	departures, err := g.getDepartures(now)
+	if err != nil {
+		return g.errorResponse(http.StatusInternalServerError, errorCodeInternalError, err)
+	}
+
+	feedMessage := g.transformToFeedMessage(now, departures)
+
+	// The JSON form is intended for debugging
+	if format == "json" {
+		feedMessageJSON, err := json.Marshal(feedMessage)
+		if err != nil {
+			return g.errorResponse(http.StatusInternalServerError, errorCodeInternalError, errors.Wrap(err, "cannot marshal JSON from feed message"))
+		}
+
+		return &events.APIGatewayProxyResponse{
+			StatusCode: 200,
+			Headers: map[string]string{
+				"content-type": "application/json",
+			},
+			Body: string(feedMessageJSON),
+		}, nil
+	}
+
+	// API Gateway requires binary data to be base64 encoded
+	return &events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers: map[string]string{
+			"content-type": "application/x-protobuf",
+		},
+		Body:            base64.StdEncoding.EncodeToString(feedMessage.MarshalProto()),
+		IsBase64Encoded: true,
+	}, nil
+}
+
+// getDepartures walks every departures list in the Redis cache and returns
+// the departures that have not expired. Stop area lists are ignored as their
+// departures are duplicates of those cached for each stop. Keys that are not
+// lists and records that cannot be decoded are logged and skipped, so that
+// they do not fail the whole feed.
+func (g GTFSRealtime) getDepartures(now time.Time) ([]model.Departure, error) {
+	g.Logger.Debug("getDepartures")
+
+	var err error = nil
+	conn := g.Pool.Get()
+	defer func() {
+		g.Logger.Debug("close Redis connection")
+		if cErr := conn.Close(); cErr != nil {
+			err = cErr
+			return
+		}
+		g.Logger.Debug("closed Redis connection successfully")
+	}()
+
+	var departures []model.Departure
+
+	cursor := int64(0)
+
+	for {
+		values, sErr := redis.Values(conn.Do("SCAN", cursor, "COUNT", g.ScanSize))
+		if sErr != nil {
+			return nil, errors.Wrap(sErr, "cannot scan departures keys in Redis")
+		}
+
+		var keys []string
+		if _, sErr := redis.Scan(values, &cursor, &keys); sErr != nil {
+			return nil, errors.Wrap(sErr, "cannot read departures keys from Redis")
+		}
+
+		// Pipeline the requests for each page of keys
+		for _, key := range keys {
+			if sErr := conn.Send("LRANGE", key, 0, -1); sErr != nil {
+				return nil, errors.Wrapf(sErr, "cannot get departures for `%s` from Redis", key)
+			}
+		}
+
+		if sErr := conn.Flush(); sErr != nil {
+			return nil, errors.Wrap(sErr, "cannot flush Redis connection")
+		}
+
+		for _, key := range keys {
+			cachedRecords, rErr := redis.Strings(conn.Receive())
+			if _, isReplyError := rErr.(redis.Error); isReplyError {
+				g.Logger.Printf("skipping `%s` as its departures cannot be read: %v", key, rErr)
+				continue
+			}
+
+			if rErr != nil {
+				return nil, errors.Wrapf(rErr, "cannot get departures for `%s` from Redis", key)
+			}
+
+			for _, cachedRecord := range cachedRecords {
+				_, departure, uErr := model.DecodeCachedDeparture([]byte(cachedRecord))
+				if uErr != nil {
+					g.Logger.Printf("skipping cached record for `%s` as it cannot be unmarshalled: %v", key, uErr)
+					continue
+				}
+
+				if departure.LocationAtcocode != key {
+					continue
+				}
+
+				if departure.IsExpired(now) {
+					continue
+				}
+
+				departures = append(departures, *departure)
+			}
+		}
+
+		if cursor == 0 {
+			break
+		}
+	}
+
+	g.Logger.Debugf("got %d departure(s) from Redis", len(departures))
+
+	return departures, err
+}
+
+// transformToFeedMessage groups departures by journey reference into trip
+// updates, each with a stop time update for every stop on the journey
+func (g GTFSRealtime) transformToFeedMessage(now time.Time, departures []model.Departure) *model.FeedMessage {
+	g.Logger.Debug("transformToFeedMessage")
+
+	sort.Sort(model.ByDepartureTime(departures))
+
+	feedMessage := model.FeedMessage{
+		Header: model.FeedHeader{
+			GTFSRealtimeVersion: model.GTFSRealtimeVersion,
+			Incrementality:      model.FullDataset,
+			Timestamp:           uint64(now.Unix()),
+		},
+	}
+
+	tripUpdates := make(map[string]*model.TripUpdate)
+
+	var journeyRefs []string
+
+	for _, departure := range departures {
+		stopTimeUpdate := g.transformToStopTimeUpdate(now, departure)
+
+		tripUpdate, exists := tripUpdates[departure.JourneyRef]
+		if !exists {
+			tripUpdate = &model.TripUpdate{
+				Trip: model.TripDescriptor{
+					TripID:  departure.JourneyRef,
+					RouteID: departure.ServiceNumber,
+				},
+			}
+			tripUpdates[departure.JourneyRef] = tripUpdate
+			journeyRefs = append(journeyRefs, departure.JourneyRef)
+		}
+
+		tripUpdate.StopTimeUpdate = append(tripUpdate.StopTimeUpdate, *stopTimeUpdate)
+
+		if !departure.RecordedAtTime.IsZero() && uint64(departure.RecordedAtTime.Unix()) > tripUpdate.Timestamp {
+			tripUpdate.Timestamp = uint64(departure.RecordedAtTime.Unix())
+		}
+	}
+
+	for _, journeyRef := range journeyRefs {
+		feedMessage.Entity = append(feedMessage.Entity, model.FeedEntity{
+			ID:         journeyRef,
+			TripUpdate: tripUpdates[journeyRef],
+		})
+	}
+
+	return &feedMessage
+}
+
+func (g GTFSRealtime) transformToStopTimeUpdate(now time.Time, departure model.Departure) *model.StopTimeUpdate {
+	g.Logger.Debugf("transformToStopTimeUpdate for %s at %s", departure.JourneyRef, departure.LocationAtcocode)
+
+	stopTimeUpdate := model.StopTimeUpdate{
+		StopID: departure.LocationAtcocode,
+	}
+
+	aimedDepartureTime := departure.AimedDepartureTime
+	expectedDepartureTime := departure.ExpectedDepartureTime
+
+	// Rail departures carry their real-time information in the departure status
+	if departure.DepartureStatus != nil {
+		switch status := *departure.DepartureStatus; {
+		case status == "Cancelled":
+			stopTimeUpdate.ScheduleRelationship = model.StopTimeSkipped
+			return &stopTimeUpdate
+		case status == "On time":
+			expectedDepartureTime = &aimedDepartureTime
+		case regexp.MustCompile("^[0-9]{2}:[0-9]{2}$").MatchString(status):
+			// A time that cannot be converted is treated as having no real-time
+			// information rather than failing the feed
+			convertedDepartureTime, err := model.ConvertDepartureTime(&now, aimedDepartureTime.Location(), status)
+			if err != nil {
+				g.Logger.Printf("cannot convert departure status of `%s` at `%s` to expected departure time: %v", departure.JourneyRef, departure.LocationAtcocode, err)
+				break
+			}
+			expectedDepartureTime = convertedDepartureTime
+		}
+	}
+
+	if expectedDepartureTime == nil {
+		stopTimeUpdate.ScheduleRelationship = model.StopTimeNoData
+		return &stopTimeUpdate
+	}
+
+	delay := int32(expectedDepartureTime.Sub(aimedDepartureTime).Seconds())
+
+	stopTimeUpdate.Departure = &model.StopTimeEvent{
+		Delay: &delay,
+		Time:  expectedDepartureTime.Unix(),
+	}
+
+	return &stopTimeUpdate
+}
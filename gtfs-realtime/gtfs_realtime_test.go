@@ -0,0 +1,367 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/TfGMEnterprise/departures-service/dlog"
+	"github.com/TfGMEnterprise/departures-service/model"
+	"github.com/TfGMEnterprise/departures-service/repository"
+	"github.com/TfGMEnterprise/departures-service/test_helpers"
+	"github.com/alicebob/miniredis"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/fortytw2/leaktest"
+	"github.com/gomodule/redigo/redis"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func pushDepartures(t *testing.T, s *miniredis.Miniredis, key string, departures ...model.Departure) {
+	t.Helper()
+
+	for _, departure := range departures {
+		departureJSON, err := json.Marshal(departure)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := s.Push(key, string(departureJSON)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func assertErrorResponse(t *testing.T, got *events.APIGatewayProxyResponse, statusCode int, code string, message string) {
+	t.Helper()
+
+	if got.StatusCode != statusCode {
+		t.Errorf("wrong status code: got %d, wanted %d", got.StatusCode, statusCode)
+	}
+
+	test_helpers.AssertString(t, got.Headers["content-type"], "application/json")
+
+	errorOutput := model.ErrorOutput{}
+	if err := json.Unmarshal([]byte(got.Body), &errorOutput); err != nil {
+		t.Fatal(err)
+	}
+
+	test_helpers.AssertString(t, errorOutput.Code, code)
+	test_helpers.AssertString(t, errorOutput.Message, message)
+}
+
+func TestGTFSRealtime_Handler(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	logger := dlog.NewLogger([]dlog.LoggerOption{
+		dlog.LoggerSetOutput(ioutil.Discard),
+	}...)
+
+	now := time.Now().Truncate(time.Second)
+
+	journey1Stop1 := model.Departure{
+		RecordedAtTime:        test_helpers.AdjustTime(now, "-20s"),
+		JourneyType:           model.Bus,
+		JourneyRef:            "123_I_1",
+		AimedDepartureTime:    test_helpers.AdjustTime(now, "2m"),
+		ExpectedDepartureTime: aws.Time(test_helpers.AdjustTime(now, "3m")),
+		LocationAtcocode:      "1800BNIN0C1",
+		ServiceNumber:         "123",
+	}
+
+	journey1Stop2 := model.Departure{
+		RecordedAtTime:        test_helpers.AdjustTime(now, "-10s"),
+		JourneyType:           model.Bus,
+		JourneyRef:            "123_I_1",
+		AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
+		ExpectedDepartureTime: aws.Time(test_helpers.AdjustTime(now, "11m")),
+		LocationAtcocode:      "1800WA12481",
+		ServiceNumber:         "123",
+	}
+
+	journey2Stop1 := model.Departure{
+		RecordedAtTime:     test_helpers.AdjustTime(now, "-10s"),
+		JourneyType:        model.Bus,
+		JourneyRef:         "456_O_1",
+		AimedDepartureTime: test_helpers.AdjustTime(now, "5m"),
+		LocationAtcocode:   "1800BNIN0C1",
+		ServiceNumber:      "456",
+	}
+
+	expired := model.Departure{
+		JourneyType:        model.Bus,
+		JourneyRef:         "789_O_1",
+		AimedDepartureTime: test_helpers.AdjustTime(now, "-5m"),
+		LocationAtcocode:   "1800WA12481",
+		ServiceNumber:      "789",
+	}
+
+	train := model.Departure{
+		RecordedAtTime:     now,
+		JourneyType:        model.Train,
+		JourneyRef:         "Service1",
+		AimedDepartureTime: test_helpers.AdjustTime(now, "15m"),
+		DepartureStatus:    aws.String("Cancelled"),
+		LocationAtcocode:   "9100MNCRPIC",
+	}
+
+	setup := func(t *testing.T) (*miniredis.Miniredis, GTFSRealtime) {
+		t.Helper()
+
+		s, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pushDepartures(t, s, "1800BNIN0C1", journey1Stop1, journey2Stop1)
+		pushDepartures(t, s, "1800WA12481", expired, journey1Stop2)
+		// Stop area departures duplicate the departures for each stop
+		pushDepartures(t, s, "1800BNIN", journey1Stop1, journey2Stop1)
+		pushDepartures(t, s, "9100MNCRPIC", train)
+
+		g := GTFSRealtime{
+			Logger: logger,
+			Pool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", s.Addr())
+				}),
+			}...),
+			ScanSize: 2,
+		}
+
+		return s, g
+	}
+
+	t.Run("returns trip updates in the JSON debug format", func(t *testing.T) {
+		s, g := setup(t)
+		defer s.Close()
+		defer g.Pool.Close()
+
+		got, err := g.Handler(events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{
+				"format": "json",
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test_helpers.AssertString(t, got.Headers["content-type"], "application/json")
+
+		feedMessage := model.FeedMessage{}
+		if err := json.Unmarshal([]byte(got.Body), &feedMessage); err != nil {
+			t.Fatal(err)
+		}
+
+		test_helpers.AssertString(t, feedMessage.Header.GTFSRealtimeVersion, "2.0")
+
+		if len(feedMessage.Entity) != 3 {
+			t.Fatalf("got %d entities, want %d", len(feedMessage.Entity), 3)
+		}
+
+		journey1 := feedMessage.Entity[0].TripUpdate
+		test_helpers.AssertString(t, journey1.Trip.TripID, "123_I_1")
+		test_helpers.AssertString(t, journey1.Trip.RouteID, "123")
+
+		if journey1.Timestamp != uint64(test_helpers.AdjustTime(now, "-10s").Unix()) {
+			t.Errorf("trip update timestamp should be the latest recorded at time: got %d", journey1.Timestamp)
+		}
+
+		if len(journey1.StopTimeUpdate) != 2 {
+			t.Fatalf("got %d stop time updates, want %d", len(journey1.StopTimeUpdate), 2)
+		}
+
+		test_helpers.AssertString(t, journey1.StopTimeUpdate[0].StopID, "1800BNIN0C1")
+		test_helpers.AssertString(t, journey1.StopTimeUpdate[1].StopID, "1800WA12481")
+
+		departure := journey1.StopTimeUpdate[0].Departure
+		if departure == nil || departure.Time != test_helpers.AdjustTime(now, "3m").Unix() || *departure.Delay != 60 {
+			t.Errorf("unexpected departure stop time event: %#v", departure)
+		}
+
+		journey2 := feedMessage.Entity[1].TripUpdate
+		test_helpers.AssertString(t, journey2.Trip.TripID, "456_O_1")
+
+		if journey2.StopTimeUpdate[0].ScheduleRelationship != model.StopTimeNoData || journey2.StopTimeUpdate[0].Departure != nil {
+			t.Errorf("scheduled departures should have no data: %#v", journey2.StopTimeUpdate[0])
+		}
+
+		journey3 := feedMessage.Entity[2].TripUpdate
+		test_helpers.AssertString(t, journey3.Trip.TripID, "Service1")
+
+		if journey3.StopTimeUpdate[0].ScheduleRelationship != model.StopTimeSkipped {
+			t.Errorf("cancelled departures should be skipped: %#v", journey3.StopTimeUpdate[0])
+		}
+	})
+
+	t.Run("has no data for an estimated departure time outside the window", func(t *testing.T) {
+		s, g := setup(t)
+		defer s.Close()
+		defer g.Pool.Close()
+
+		aimedDepartureTime := test_helpers.AdjustTime(now, "15m")
+
+		pushDepartures(t, s, "9100MNCROXR", model.Departure{
+			RecordedAtTime:     now,
+			JourneyType:        model.Train,
+			JourneyRef:         "Service2",
+			AimedDepartureTime: aimedDepartureTime,
+			DepartureStatus:    aws.String(aimedDepartureTime.Add(6 * time.Hour).Format("15:04")),
+			LocationAtcocode:   "9100MNCROXR",
+		})
+
+		got, err := g.Handler(events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{
+				"format": "json",
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		feedMessage := model.FeedMessage{}
+		if err := json.Unmarshal([]byte(got.Body), &feedMessage); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(feedMessage.Entity) != 4 {
+			t.Fatalf("got %d entities, want %d", len(feedMessage.Entity), 4)
+		}
+
+		for _, entity := range feedMessage.Entity {
+			if entity.ID != "Service2" {
+				continue
+			}
+
+			if entity.TripUpdate.StopTimeUpdate[0].ScheduleRelationship != model.StopTimeNoData || entity.TripUpdate.StopTimeUpdate[0].Departure != nil {
+				t.Errorf("departures with an estimated time outside the window should have no data: %#v", entity.TripUpdate.StopTimeUpdate[0])
+			}
+		}
+	})
+
+	t.Run("returns a base64 encoded protocol buffer by default", func(t *testing.T) {
+		s, g := setup(t)
+		defer s.Close()
+		defer g.Pool.Close()
+
+		got, err := g.Handler(events.APIGatewayProxyRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test_helpers.AssertString(t, got.Headers["content-type"], "application/x-protobuf")
+		test_helpers.AssertBoolean(t, got.IsBase64Encoded, true)
+
+		feedMessageProto, err := base64.StdEncoding.DecodeString(got.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		feedMessage := model.FeedMessage{}
+		if err := json.Unmarshal(test_helpers.DecodeGTFSRealtimeFeed(t, feedMessageProto), &feedMessage); err != nil {
+			t.Fatal(err)
+		}
+
+		// The JSON debug format is served by the same handler from the same feed
+		debug, err := g.Handler(events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{
+				"format": "json",
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		debugFeedMessage := model.FeedMessage{}
+		if err := json.Unmarshal([]byte(debug.Body), &debugFeedMessage); err != nil {
+			t.Fatal(err)
+		}
+
+		// The feeds are created at different times
+		feedMessage.Header.Timestamp = 0
+		debugFeedMessage.Header.Timestamp = 0
+
+		if len(feedMessage.Entity) != 3 {
+			t.Errorf("got %d entities, want %d", len(feedMessage.Entity), 3)
+		}
+
+		if !reflect.DeepEqual(feedMessage, debugFeedMessage) {
+			t.Errorf("protocol buffer feed %#v does not match JSON debug feed %#v", feedMessage, debugFeedMessage)
+		}
+	})
+
+	t.Run("skips records and keys that cannot be read", func(t *testing.T) {
+		s, g := setup(t)
+		defer s.Close()
+		defer g.Pool.Close()
+
+		if _, err := s.Push("1800WA12481", "not a departure"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := s.Set("1800NE43431", "not a list"); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := g.Handler(events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{
+				"format": "json",
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got.StatusCode != 200 {
+			t.Fatalf("wrong status code: got %d, wanted %d", got.StatusCode, 200)
+		}
+
+		feedMessage := model.FeedMessage{}
+		if err := json.Unmarshal([]byte(got.Body), &feedMessage); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(feedMessage.Entity) != 3 {
+			t.Fatalf("got %d entities, want %d", len(feedMessage.Entity), 3)
+		}
+	})
+
+	t.Run("returns an error response if Redis cannot be read", func(t *testing.T) {
+		g := GTFSRealtime{
+			Logger: logger,
+			Pool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return nil, errors.New("Redis is unavailable")
+				}),
+			}...),
+			ScanSize: 2,
+		}
+		defer g.Pool.Close()
+
+		got, err := g.Handler(events.APIGatewayProxyRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertErrorResponse(t, got, 500, "internalError", "Internal Server Error")
+	})
+
+	t.Run("returns an error response for an unknown format", func(t *testing.T) {
+		g := GTFSRealtime{
+			Logger: logger,
+		}
+
+		got, err := g.Handler(events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{
+				"format": "xml",
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertErrorResponse(t, got, 400, "invalidParameter", "format value `xml` is not valid")
+	})
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"github.com/TfGMEnterprise/departures-service/dlog"
 	"github.com/TfGMEnterprise/departures-service/model"
 	"github.com/TfGMEnterprise/departures-service/repository"
@@ -11,17 +10,25 @@ import (
 	"github.com/pkg/errors"
 	"log"
 	"os"
-	"sort"
 	"sync"
 	"time"
 )
 
+// producerName identifies the ingester in the envelope of each cached departure
+const producerName = "ingester"
+
+// maxUpdateAttempts is how many times the departures for a location are read
+// and written before giving up, if they keep changing while being updated
+const maxUpdateAttempts = 5
+
 type Ingester struct {
 	Logger               *dlog.Logger
 	DeparturesPool       *redis.Pool
 	LocalityNamesPool    *redis.Pool
 	StopsInAreaPool      *redis.Pool
 	CircularServicesPool *redis.Pool
+	// Clock returns the current time; time.Now is used if it is not set
+	Clock func() time.Time
 	IngesterInterface
 	circularServices map[string]*string
 	localityNames    map[string]*string
@@ -93,6 +100,7 @@ func main() {
 		LocalityNamesPool:    repository.NewRedisPool(localityNamesPoolOptions...),
 		StopsInAreaPool:      repository.NewRedisPool(stopsInAreaPoolOptions...),
 		CircularServicesPool: repository.NewRedisPool(circularServicesPoolOptions...),
+		Clock:                time.Now,
 		circularServices:     make(map[string]*string),
 		localityNames:        make(map[string]*string),
 		stopsInArea:          make(map[string]*string),
@@ -137,6 +145,15 @@ func main() {
 	lambda.Start(in.Handler)
 }
 
+// now returns the current time from the ingester clock
+func (in Ingester) now() time.Time {
+	if in.Clock == nil {
+		return time.Now()
+	}
+
+	return in.Clock()
+}
+
 func (in Ingester) Handler(event events.SNSEvent) error {
 	in.Logger.Debug("Handler")
 
@@ -153,79 +170,45 @@ func (in Ingester) Handler(event events.SNSEvent) error {
 		go func(done <-chan struct{}, errs chan error, records events.SNSEventRecord) {
 			defer wg.Done()
 
-			newDepartures := model.Internal{}
+			envelope, newDepartures, err := model.DecodeDeparturesMessage([]byte(records.SNS.Message))
+			if undecodable, ok := err.(*model.UndecodableDeparturesError); ok {
+				in.Logger.Printf("quarantined new departures: %v", undecodable)
 
-			err := json.Unmarshal([]byte(records.SNS.Message), &newDepartures)
-			if err != nil {
+				// The journeys that could not be decoded are unknown, so the
+				// message cannot show that the others have stopped calling
+				envelope.Snapshot = nil
+			} else if err != nil {
 				errs <- errors.Wrap(err, "could not unmarshal new departures")
 				return
 			}
 
-			if err := in.removeExpiredDepartures(time.Now(), &newDepartures); err != nil {
-				errs <- errors.Wrap(err, "could not remove expired departures from event data")
-				return
-			}
+			// A journey listed in a snapshot keeps its cached record if its new
+			// record is invalid, so the listed journeys are taken first
+			listed := append([]model.Departure(nil), newDepartures.Departures...)
 
-			if err := in.updateDestinationNames(&newDepartures); err != nil {
+			in.quarantineInvalidDepartures(newDepartures)
+
+			in.removeExpiredDepartures(in.now(), newDepartures, model.DeparturesBoard, model.ArrivalsBoard)
+
+			if err := in.updateDestinationNames(newDepartures); err != nil {
 				errs <- errors.Wrap(err, "cannot update destination names")
 				return
 			}
 
-			stopsDone := make(chan struct{})
-			stopAreasDone := make(chan struct{})
-
-			// Cache departures for stops
-			go func(done <-chan struct{}, errs chan error, departures model.Internal) {
-				defer close(stopsDone)
-
-				groupedByStop := in.groupByStop(departures)
-
-				swg := sync.WaitGroup{}
-
-				for locationAtcocode, newDeparturesForLocation := range groupedByStop {
-					swg.Add(1)
-
-					go func(done <-chan struct{}, errs chan error, locationAtcocode string, newDeparturesForLocation []model.Departure) {
-						defer swg.Done()
-
-						if err := in.ingestLocation(locationAtcocode, &newDeparturesForLocation); err != nil {
-							errs <- err
-						}
-					}(done, errs, locationAtcocode, newDeparturesForLocation)
-				}
-
-				swg.Wait()
-			}(done, errs, newDepartures)
-
-			// Cache departures for stop areas
-			go func(done <-chan struct{}, errs chan error, departures model.Internal) {
-				defer close(stopAreasDone)
-
-				groupedByStopArea, err := in.groupByStopArea(departures)
-				if err != nil {
-					errs <- err
-					return
-				}
-
-				swg := sync.WaitGroup{}
-
-				for locationAtcocode, newDeparturesForLocation := range groupedByStopArea {
-					swg.Add(1)
-
-					go func(done <-chan struct{}, errs chan error, locationAtcocode string, newDeparturesForLocation []model.Departure) {
-						defer swg.Done()
+			if err := in.updateOriginNames(newDepartures); err != nil {
+				errs <- errors.Wrap(err, "cannot update origin names")
+				return
+			}
 
-						if err := in.ingestLocation(locationAtcocode, &newDeparturesForLocation); err != nil {
-							errs <- err
-						}
-					}(done, errs, locationAtcocode, newDeparturesForLocation)
-				}
+			// Journeys that call at a stop appear on both boards; those that
+			// start or terminate there appear on one
+			for _, board := range []model.BoardType{model.DeparturesBoard, model.ArrivalsBoard} {
+				boardDepartures := model.Internal{Departures: board.Filter(newDepartures.Departures)}
 
-				swg.Wait()
-			}(done, errs, newDepartures)
+				in.removeExpiredDepartures(in.now(), &boardDepartures, board)
 
-			<-stopsDone
-			<-stopAreasDone
+				in.ingestBoard(board, envelope.SourceFeed, boardDepartures, in.newSnapshot(board, envelope, listed), errs)
+			}
 
 			select {
 			case <-done:
@@ -260,6 +243,132 @@ func (in Ingester) Handler(event events.SNSEvent) error {
 	return nil
 }
 
+// ingestBoard caches the board for each stop and stop area the departures are
+// for, and for each stop the snapshot covers and its stop area, sending any
+// errors to errs
+func (in Ingester) ingestBoard(board model.BoardType, sourceFeed string, departures model.Internal, snap *snapshot, errs chan error) {
+	in.Logger.Debugf("ingestBoard: %s", board)
+
+	// The location of a snapshot is cached first, as the stops cached for it
+	// are covered too and are read while it is updated
+	if snap != nil {
+		var err error
+		if snap, err = in.ingestSnapshotLocation(board, sourceFeed, departures, snap); err != nil {
+			errs <- err
+			return
+		}
+	}
+
+	stopsDone := make(chan struct{})
+	stopAreasDone := make(chan struct{})
+
+	// Cache departures for stops
+	go func(errs chan error, departures model.Internal) {
+		defer close(stopsDone)
+
+		groupedByStop := in.groupByStop(departures)
+
+		// A covered stop with no journeys left is reconciled too
+		for stop := range snap.coveredStops() {
+			if _, exists := groupedByStop[stop]; !exists {
+				groupedByStop[stop] = nil
+			}
+		}
+
+		swg := sync.WaitGroup{}
+
+		for locationAtcocode, newDeparturesForLocation := range groupedByStop {
+			if snap.isLocation(locationAtcocode) {
+				continue
+			}
+
+			swg.Add(1)
+
+			go func(errs chan error, locationAtcocode string, newDeparturesForLocation []model.Departure) {
+				defer swg.Done()
+
+				if _, err := in.ingestLocation(board, locationAtcocode, sourceFeed, &newDeparturesForLocation, snap); err != nil {
+					errs <- err
+				}
+			}(errs, locationAtcocode, newDeparturesForLocation)
+		}
+
+		swg.Wait()
+	}(errs, departures)
+
+	// Cache departures for stop areas
+	go func(errs chan error, departures model.Internal) {
+		defer close(stopAreasDone)
+
+		groupedByStopArea, err := in.groupByStopArea(departures)
+		if err != nil {
+			errs <- err
+			return
+		}
+
+		for stop := range snap.coveredStops() {
+			stopArea, err := in.getStopArea(stop)
+			if err != nil {
+				errs <- errors.Wrapf(err, "cannot get stop area for %s", stop)
+				return
+			}
+
+			if stopArea == nil {
+				continue
+			}
+
+			if _, exists := groupedByStopArea[*stopArea]; !exists {
+				groupedByStopArea[*stopArea] = nil
+			}
+		}
+
+		swg := sync.WaitGroup{}
+
+		for locationAtcocode, newDeparturesForLocation := range groupedByStopArea {
+			if snap.isLocation(locationAtcocode) {
+				continue
+			}
+
+			swg.Add(1)
+
+			go func(errs chan error, locationAtcocode string, newDeparturesForLocation []model.Departure) {
+				defer swg.Done()
+
+				if _, err := in.ingestLocation(board, locationAtcocode, sourceFeed, &newDeparturesForLocation, snap); err != nil {
+					errs <- err
+				}
+			}(errs, locationAtcocode, newDeparturesForLocation)
+		}
+
+		swg.Wait()
+	}(errs, departures)
+
+	<-stopsDone
+	<-stopAreasDone
+}
+
+// ingestSnapshotLocation caches the board for the location of the snapshot
+// with the departures that are at the location or in it, and returns the
+// snapshot covering the stops cached for the location
+func (in Ingester) ingestSnapshotLocation(board model.BoardType, sourceFeed string, departures model.Internal, snap *snapshot) (*snapshot, error) {
+	in.Logger.Debugf("ingestSnapshotLocation: `%s` (%s)", snap.location, board)
+
+	var newDepartures []model.Departure
+
+	for _, departure := range departures.Departures {
+		isInLocation, err := in.isInLocation(departure.LocationAtcocode, snap.location)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot get stop area for %s", departure.LocationAtcocode)
+		}
+
+		if isInLocation {
+			newDepartures = append(newDepartures, departure)
+		}
+	}
+
+	return in.ingestLocation(board, snap.location, sourceFeed, &newDepartures, snap)
+}
+
 func (in Ingester) updateDestinationNames(departures *model.Internal) error {
 	in.Logger.Debug("updateDestinationNames")
 
@@ -293,6 +402,29 @@ func (in Ingester) updateDestinationNames(departures *model.Internal) error {
 	return nil
 }
 
+// updateOriginNames replaces the origin of each arrival with the locality
+// name of the stop the journey started from, where there is one
+func (in Ingester) updateOriginNames(departures *model.Internal) error {
+	in.Logger.Debug("updateOriginNames")
+
+	for i, departure := range departures.Departures {
+		if !departure.HasArrival() || departure.OriginAtcocode == "" {
+			continue
+		}
+
+		localityName, err := in.getLocalityName(departure.OriginAtcocode)
+		if err != nil {
+			return errors.Wrapf(err, "cannot get locality name for ATCO code %s", departure.OriginAtcocode)
+		}
+
+		if localityName != nil {
+			departures.Departures[i].Origin = *localityName
+		}
+	}
+
+	return nil
+}
+
 func (in Ingester) getCircularServiceDestination(operatorCode string, serviceNumber string) (*string, error) {
 	in.Logger.Debugf("getCircularServiceDescription for %s %s", operatorCode, serviceNumber)
 
@@ -406,7 +538,7 @@ func (in Ingester) getStopArea(atcocode string) (*string, error) {
 	in.Logger.Debugf("getStopArea for %s", atcocode)
 
 	if val, exists := in.stopsInArea[atcocode]; exists {
-		in.Logger.Debugf("got stop area `%s` for `%s` from local cache", *val, atcocode)
+		in.Logger.Debugf("got stop area `%v` for `%s` from local cache", val, atcocode)
 		return val, nil
 	}
 
@@ -463,31 +595,41 @@ func (in Ingester) appendDepartureToStopArea(groupedByStopArea map[string][]mode
 	return groupedByStopArea, nil
 }
 
-func (in Ingester) ingestLocation(locationAtcocode string, newDepartures *[]model.Departure) error {
-	in.Logger.Debugf("ingestLocation: `%s`", locationAtcocode)
+// ingestLocation merges the new departures with the board cached for the
+// location, and returns the snapshot that was applied. Other invocations, and
+// the stop and stop area goroutines, may update the same key at the same
+// time, so the update is retried if the key changes between reading and
+// writing it.
+func (in Ingester) ingestLocation(board model.BoardType, locationAtcocode string, sourceFeed string, newDepartures *[]model.Departure, snap *snapshot) (*snapshot, error) {
+	in.Logger.Debugf("ingestLocation: `%s` (%s)", locationAtcocode, board)
 
-	departures, err := in.getDeparturesFromCache(locationAtcocode)
-	if err != nil {
-		return err
-	}
-
-	in.combineCachedAndNewDepartures(departures, newDepartures)
+	key := board.Key(locationAtcocode)
 
-	if err := in.removeExpiredDepartures(time.Now(), departures); err != nil {
-		return errors.Wrap(err, "could not remove expired departures from combined data")
-	}
+	for attempt := 1; attempt <= maxUpdateAttempts; attempt++ {
+		applied, updated, err := in.updateLocation(board, locationAtcocode, sourceFeed, newDepartures, snap)
+		if err != nil {
+			return nil, err
+		}
 
-	sort.Sort(model.ByDepartureTime(departures.Departures))
+		if updated {
+			return applied, nil
+		}
 
-	if err := in.updateCachedData(locationAtcocode, departures); err != nil {
-		return err
+		in.Logger.Printf("departures for `%s` changed while being updated (attempt %d of %d)", key, attempt, maxUpdateAttempts)
 	}
 
-	return nil
+	return nil, errors.Errorf("cannot update departures for `%s`: they changed during each of %d attempts", key, maxUpdateAttempts)
 }
 
-func (in Ingester) getDeparturesFromCache(locationAtcocode string) (*model.Internal, error) {
-	in.Logger.Debugf("getDeparturesFromCache for location `%s`", locationAtcocode)
+// updateLocation reads, merges and writes the departures for the location on
+// a single connection, watching its key so that the write is abandoned if the
+// key changes after it is read. If it is the location of the snapshot, the
+// snapshot applied also covers the stops read for it. It returns the snapshot
+// applied, and false if the write was abandoned.
+func (in Ingester) updateLocation(board model.BoardType, locationAtcocode string, sourceFeed string, newDepartures *[]model.Departure, snap *snapshot) (*snapshot, bool, error) {
+	key := board.Key(locationAtcocode)
+
+	in.Logger.Debugf("updateLocation: `%s`", key)
 
 	var err error = nil
 	conn := in.DeparturesPool.Get()
@@ -500,6 +642,39 @@ func (in Ingester) getDeparturesFromCache(locationAtcocode string) (*model.Inter
 		in.Logger.Debug("closed Redis connection successfully")
 	}()
 
+	if _, err := conn.Do("WATCH", key); err != nil {
+		return nil, false, errors.Wrapf(err, "cannot watch key `%s` in Redis database", key)
+	}
+
+	departures, err := in.readCachedDepartures(conn, key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if snap.isLocation(locationAtcocode) {
+		snap = in.coverCachedStops(snap, departures)
+	}
+
+	in.quarantineInvalidDepartures(departures)
+
+	in.removeMissingDepartures(board, departures, snap)
+
+	in.combineCachedAndNewDepartures(departures, newDepartures)
+
+	in.removeExpiredDepartures(in.now(), departures, board)
+
+	board.Sort(departures.Departures)
+
+	updated, err := in.updateCachedData(conn, key, sourceFeed, departures)
+
+	return snap, updated, err
+}
+
+// readCachedDepartures reads the departures cached under the key on the
+// connection, quarantining records that cannot be decoded
+func (in Ingester) readCachedDepartures(conn redis.Conn, locationAtcocode string) (*model.Internal, error) {
+	in.Logger.Debugf("readCachedDepartures for location `%s`", locationAtcocode)
+
 	cachedRecordsLength, err := conn.Do("LLEN", locationAtcocode)
 	if err != nil && err != redis.ErrNil {
 		return nil, errors.Wrapf(err, "cannot get cached record length for location `%s` from Redis", locationAtcocode)
@@ -519,14 +694,19 @@ func (in Ingester) getDeparturesFromCache(locationAtcocode string) (*model.Inter
 	}
 
 	for _, departure := range cachedRecords {
-		unmarshalledDeparture := model.Departure{}
-		if err := json.Unmarshal([]byte(departure), &unmarshalledDeparture); err != nil {
-			return nil, errors.Wrapf(err, "cannot unmarshal cached record for location `%s` from Redis", locationAtcocode)
+		_, unmarshalledDeparture, err := model.DecodeCachedDeparture([]byte(departure))
+		if _, ok := err.(*model.UnsupportedSchemaVersionError); ok {
+			// Leave records written by a newer ingester untouched
+			return nil, errors.Wrapf(err, "cannot read cached record for location `%s` from Redis", locationAtcocode)
 		}
-		cachedDepartures.Departures = append(cachedDepartures.Departures, unmarshalledDeparture)
+		if err != nil {
+			in.Logger.Printf("quarantined cached record for location `%s`: %v: %s", locationAtcocode, err, departure)
+			continue
+		}
+		cachedDepartures.Departures = append(cachedDepartures.Departures, *unmarshalledDeparture)
 	}
 
-	return &cachedDepartures, err
+	return &cachedDepartures, nil
 }
 
 func (in Ingester) combineCachedAndNewDepartures(departures *model.Internal, newDepartures *[]model.Departure) {
@@ -559,85 +739,120 @@ func (in Ingester) combineCachedAndNewDepartures(departures *model.Internal, new
 	}
 }
 
-func (in Ingester) removeExpiredDepartures(now time.Time, departures *model.Internal) error {
-	in.Logger.Debug("removeExpiredDepartures")
+// removeMissingDepartures removes the cached departures that the snapshot
+// replaces but does not list; a stop area may hold departures for stops the
+// snapshot does not cover, which are left alone
+func (in Ingester) removeMissingDepartures(board model.BoardType, departures *model.Internal, snap *snapshot) {
+	in.Logger.Debug("removeMissingDepartures")
+
+	if snap == nil {
+		return
+	}
 
 	i := 0
 	for _, departure := range departures.Departures {
-		if departure.ExpectedDepartureTime != nil {
-			expectedDepartureTime, err := time.Parse(time.RFC3339, *departure.ExpectedDepartureTime)
-			if err != nil {
-				return errors.Wrapf(err, "cannot parse expected departure time `%#v`", departure.ExpectedDepartureTime)
-			}
+		if snap.replaces(board, departure) && !snap.lists(departure) {
+			in.Logger.Debugf("departure %s at %s is missing from the snapshot; removing", departure.JourneyRef, departure.LocationAtcocode)
+			continue
+		}
 
-			if !expectedDepartureTime.Before(now) {
-				departures.Departures[i] = departure
-				i++
-			}
-		} else {
-			aimedDepartureTime, err := time.Parse(time.RFC3339, departure.AimedDepartureTime)
-			if err != nil {
-				return errors.Wrapf(err, "cannot parse aimed departure time `%#v`", departure.AimedDepartureTime)
-			}
+		departures.Departures[i] = departure
+		i++
+	}
 
-			if !aimedDepartureTime.Before(now) {
-				departures.Departures[i] = departure
-				i++
-			}
+	in.Logger.Debugf("removed %d missing departures", len(departures.Departures)-i)
+
+	departures.Departures = departures.Departures[:i]
+}
+
+// quarantineInvalidDepartures removes and logs any departures that fail
+// validation so that a single malformed record cannot fail the whole batch
+func (in Ingester) quarantineInvalidDepartures(departures *model.Internal) {
+	in.Logger.Debug("quarantineInvalidDepartures")
+
+	for _, err := range departures.RemoveInvalidDepartures() {
+		in.Logger.Printf("quarantined departure: %v", err)
+	}
+}
+
+// removeExpiredDepartures removes the departures that are not on any of the
+// boards, or that have expired on each board they are on; on the arrivals
+// board, this is by the arrival time. Cancelled departures are kept for
+// model.CancelledRetention so that the presenter can show them.
+func (in Ingester) removeExpiredDepartures(now time.Time, departures *model.Internal, boards ...model.BoardType) {
+	in.Logger.Debug("removeExpiredDepartures")
+
+	i := 0
+	for _, departure := range departures.Departures {
+		if !in.isOnBoard(now, departure, boards) {
+			continue
 		}
+
+		departures.Departures[i] = departure
+		i++
 	}
 
 	in.Logger.Debugf("removed %d expired departures", len(departures.Departures)-i)
 
 	departures.Departures = departures.Departures[:i]
-
-	return nil
 }
 
-func (in Ingester) updateCachedData(locationAtcocode string, departures *model.Internal) error {
-	in.Logger.Debugf("updateCachedData for location `%s` (total %d departure(s))", locationAtcocode, len(departures.Departures))
-
-	var err error = nil
-	conn := in.DeparturesPool.Get()
+// isOnBoard returns true if the departure is on one of the boards and has not
+// expired on that board
+func (in Ingester) isOnBoard(now time.Time, departure model.Departure, boards []model.BoardType) bool {
+	for _, board := range boards {
+		if !board.Includes(departure) {
+			continue
+		}
 
-	defer func() {
-		in.Logger.Debug("close Redis connection")
-		if cerr := conn.Close(); cerr != nil {
-			err = cerr
-			return
+		if !board.IsExpiredAfter(departure, now, model.CancelledRetention) {
+			return true
 		}
-		in.Logger.Debug("closed Redis connection successfully")
-	}()
+	}
+
+	return false
+}
+
+// updateCachedData replaces the departures cached under the key in a
+// transaction on the connection, which is abandoned if a key watched on the
+// connection has changed. It returns false if the transaction was abandoned.
+func (in Ingester) updateCachedData(conn redis.Conn, locationAtcocode string, sourceFeed string, departures *model.Internal) (bool, error) {
+	in.Logger.Debugf("updateCachedData for location `%s` (total %d departure(s))", locationAtcocode, len(departures.Departures))
 
 	if err := conn.Send("MULTI"); err != nil {
-		return errors.Wrapf(err, "cannot initiate MULTI Redis transaction for location `%s`", locationAtcocode)
+		return false, errors.Wrapf(err, "cannot initiate MULTI Redis transaction for location `%s`", locationAtcocode)
 	}
 
 	if err := conn.Send("DEL", locationAtcocode); err != nil {
-		return errors.Wrapf(err, "cannot delete key `%s` in Redis database", locationAtcocode)
+		return false, errors.Wrapf(err, "cannot delete key `%s` in Redis database", locationAtcocode)
 	}
 
 	args := make([]interface{}, len(departures.Departures)+1)
 
 	args[0] = locationAtcocode
 
+	envelope := model.NewEnvelope(producerName, sourceFeed, in.now(), "")
+
 	for i, departure := range departures.Departures {
-		departureJSON, err := json.Marshal(departure)
+		departureJSON, err := model.EncodeCachedDeparture(envelope, departure)
 		if err != nil {
-			return errors.Wrapf(err, "cannot marshal JSON for departure `%s` at location `%s`", departure.JourneyRef, locationAtcocode)
+			return false, errors.Wrapf(err, "cannot marshal JSON for departure `%s` at location `%s`", departure.JourneyRef, locationAtcocode)
 		}
 		args[i+1] = departureJSON
 	}
 
 	if len(args) > 1 {
 		if err := conn.Send("RPUSH", args...); err != nil {
-			return errors.Wrapf(err, "cannot store departures in Redis cache for location `%s`", locationAtcocode)
+			return false, errors.Wrapf(err, "cannot store departures in Redis cache for location `%s`", locationAtcocode)
 		}
 	}
 
-	if _, err := conn.Do("EXEC"); err != nil {
-		return errors.Wrapf(err, "cannot execute Redis transaction for location `%s`", locationAtcocode)
+	// EXEC replies with no results if a watched key changed; the transaction
+	// always includes DEL, so it has at least one result otherwise
+	replies, err := redis.Values(conn.Do("EXEC"))
+	if err != nil && err != redis.ErrNil {
+		return false, errors.Wrapf(err, "cannot execute Redis transaction for location `%s`", locationAtcocode)
 	}
 
-	return err
+	return len(replies) > 0, nil
 }
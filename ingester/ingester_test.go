@@ -8,10 +8,12 @@ import (
 	"github.com/TfGMEnterprise/departures-service/test_helpers"
 	"github.com/alicebob/miniredis"
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/fortytw2/leaktest"
 	"github.com/gomodule/redigo/redis"
 	"io/ioutil"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -20,6 +22,7 @@ const (
 	locationAtcocode      = "1800BNIN0C1"
 	extraLocationAtcocode = "1800BNIN0D1"
 	stopAreaAtcocode      = "1800BNIN"
+	sourceFeedName        = "optis-siri-sm"
 )
 
 var (
@@ -32,10 +35,10 @@ func buildJSONDeparture(t *testing.T, recordedAtTime time.Time, journeyRef int,
 	t.Helper()
 
 	departure := model.Departure{
-		RecordedAtTime:      recordedAtTime.Format(time.RFC3339),
+		RecordedAtTime:      recordedAtTime,
 		JourneyType:         model.Bus,
 		JourneyRef:          serviceNumber + `_direction_` + recordedAtTime.Format("2006-01-02") + `_` + strconv.Itoa(journeyRef),
-		AimedDepartureTime:  aimedDepartureTime.Format(time.RFC3339),
+		AimedDepartureTime:  aimedDepartureTime,
 		LocationAtcocode:    locationAtcocode,
 		DestinationAtcocode: destinationAtcocode,
 		Destination:         destinationName,
@@ -44,16 +47,14 @@ func buildJSONDeparture(t *testing.T, recordedAtTime time.Time, journeyRef int,
 	}
 
 	if expectedDepartureTime != nil {
-		expectedDepartureTimeRef := expectedDepartureTime.Format(time.RFC3339)
-		expectedDepartureTimeStr := &expectedDepartureTimeRef
-		departure.ExpectedDepartureTime = expectedDepartureTimeStr
+		departure.ExpectedDepartureTime = expectedDepartureTime
 	}
 
 	if stand != nil {
 		departure.Stand = stand
 	}
 
-	departureJSON, err := json.Marshal(departure)
+	departureJSON, err := model.EncodeCachedDeparture(model.NewEnvelope(producerName, sourceFeedName, now, ""), departure)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -64,6 +65,26 @@ func buildJSONDeparture(t *testing.T, recordedAtTime time.Time, journeyRef int,
 func buildSnsEvent(t *testing.T, jsonDeps ...[]byte) events.SNSEvent {
 	t.Helper()
 
+	return buildSnsEventWithEnvelope(t, model.NewEnvelope("optis-poller", sourceFeedName, now, locationAtcocode), jsonDeps...)
+}
+
+// buildSnapshotSnsEvent builds an event for a message listing every journey at
+// the location for the next hour and a half
+func buildSnapshotSnsEvent(t *testing.T, location string, jsonDeps ...[]byte) events.SNSEvent {
+	t.Helper()
+
+	envelope := model.NewEnvelope("optis-poller", sourceFeedName, now, location)
+	envelope.Snapshot = &model.Snapshot{
+		From:  now,
+		Until: test_helpers.AdjustTime(now, "1h30m"),
+	}
+
+	return buildSnsEventWithEnvelope(t, envelope, jsonDeps...)
+}
+
+func buildSnsEventWithEnvelope(t *testing.T, envelope model.Envelope, jsonDeps ...[]byte) events.SNSEvent {
+	t.Helper()
+
 	departures := model.Internal{}
 	for i := 0; i < len(jsonDeps); i++ {
 		dep := model.Departure{}
@@ -73,7 +94,7 @@ func buildSnsEvent(t *testing.T, jsonDeps ...[]byte) events.SNSEvent {
 		departures.Departures = append(departures.Departures, dep)
 	}
 
-	departuresJSON, err := json.Marshal(&departures)
+	departuresJSON, err := model.EncodeDeparturesMessage(envelope, departures)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -175,6 +196,7 @@ func TestIngester_Handler(t *testing.T) {
 					return redis.Dial("tcp", circularServicesDB.Addr())
 				}),
 			}...),
+			Clock:            func() time.Time { return now },
 			circularServices: make(map[string]*string),
 			localityNames:    make(map[string]*string),
 			stopsInArea:      make(map[string]*string),
@@ -259,6 +281,7 @@ func TestIngester_Handler(t *testing.T) {
 					return redis.Dial("tcp", circularServicesDB.Addr())
 				}),
 			}...),
+			Clock:            func() time.Time { return now },
 			circularServices: make(map[string]*string),
 			localityNames:    make(map[string]*string),
 			stopsInArea:      make(map[string]*string),
@@ -358,6 +381,7 @@ func TestIngester_Handler(t *testing.T) {
 					return redis.Dial("tcp", circularServicesDB.Addr())
 				}),
 			}...),
+			Clock:            func() time.Time { return now },
 			circularServices: make(map[string]*string),
 			localityNames:    make(map[string]*string),
 			stopsInArea:      make(map[string]*string),
@@ -430,6 +454,7 @@ func TestIngester_Handler(t *testing.T) {
 					return redis.Dial("tcp", circularServicesDB.Addr())
 				}),
 			}...),
+			Clock:            func() time.Time { return now },
 			circularServices: make(map[string]*string),
 			localityNames:    make(map[string]*string),
 			stopsInArea:      make(map[string]*string),
@@ -599,6 +624,7 @@ func TestIngester_Handler(t *testing.T) {
 					return redis.Dial("tcp", circularServicesDB.Addr())
 				}),
 			}...),
+			Clock:            func() time.Time { return now },
 			circularServices: make(map[string]*string),
 			localityNames:    make(map[string]*string),
 			stopsInArea:      make(map[string]*string),
@@ -690,6 +716,7 @@ func TestIngester_Handler(t *testing.T) {
 					return redis.Dial("tcp", circularServicesDB.Addr())
 				}),
 			}...),
+			Clock:            func() time.Time { return now },
 			circularServices: make(map[string]*string),
 			localityNames:    make(map[string]*string),
 			stopsInArea:      make(map[string]*string),
@@ -762,6 +789,7 @@ func TestIngester_Handler(t *testing.T) {
 					return redis.Dial("tcp", circularServicesDB.Addr())
 				}),
 			}...),
+			Clock:            func() time.Time { return now },
 			circularServices: make(map[string]*string),
 			localityNames:    make(map[string]*string),
 			stopsInArea:      make(map[string]*string),
@@ -858,6 +886,7 @@ func TestIngester_Handler(t *testing.T) {
 					return redis.Dial("tcp", circularServicesDB.Addr())
 				}),
 			}...),
+			Clock:            func() time.Time { return now },
 			circularServices: make(map[string]*string),
 			localityNames:    make(map[string]*string),
 			stopsInArea:      make(map[string]*string),
@@ -928,6 +957,7 @@ func TestIngester_Handler(t *testing.T) {
 					return redis.Dial("tcp", circularServicesDB.Addr())
 				}),
 			}...),
+			Clock:            func() time.Time { return now },
 			circularServices: make(map[string]*string),
 			localityNames:    make(map[string]*string),
 			stopsInArea:      make(map[string]*string),
@@ -991,6 +1021,169 @@ func TestIngester_Handler(t *testing.T) {
 					return redis.Dial("tcp", "")
 				}),
 			}...),
+			Clock:            func() time.Time { return now },
+			circularServices: make(map[string]*string),
+			localityNames:    make(map[string]*string),
+			stopsInArea:      make(map[string]*string),
+		}
+
+		event := buildSnsEvent(t, newDeparture1)
+
+		if err := in.Handler(event); err == nil {
+			t.Error("Should return an error!")
+		}
+	})
+
+	t.Run("quarantines invalid departures without failing the batch", func(t *testing.T) {
+		cachedDeparture1 := buildJSONDeparture(t, test_helpers.AdjustTime(now, "-3m"), 1234, test_helpers.AdjustTime(now, "3m"), nil, locationAtcocode, &locationStand, "1800WA12481", "Hobbiton", "534", "ANWE")
+		cachedDeparture2 := `{"journeyRef":"534_direction_1235","aimedDepartureTime":"tomorrow","locationAtcocode":"` + locationAtcocode + `"}`
+		cachedDeparture3 := `{"journeyRef":`
+
+		newDeparture1 := buildJSONDeparture(t, test_helpers.AdjustTime(now, "0s"), 1236, test_helpers.AdjustTime(now, "2m"), nil, locationAtcocode, &locationStand, "1800WA12481", "Hobbiton", "525", "VISB")
+		newDeparture2 := []byte(`{"journeyRef":"525_direction_1237","aimedDepartureTime":"` + test_helpers.AdjustTime(now, "4m").Format(time.RFC3339) + `","expectedDepartureTime":"soon","locationAtcocode":"` + locationAtcocode + `","serviceNumber":"525"}`)
+
+		localityNamesDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer localityNamesDB.Close()
+
+		if err := localityNamesDB.Set("1800WA12481", "Hobbiton"); err != nil {
+			t.Fatal(err)
+		}
+
+		departuresDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer departuresDB.Close()
+
+		if _, err := departuresDB.Push(locationAtcocode, []string{string(cachedDeparture1), cachedDeparture2, cachedDeparture3}...); err != nil {
+			t.Fatal(err)
+		}
+
+		stopsInAreaDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stopsInAreaDB.Close()
+
+		circularServicesDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer circularServicesDB.Close()
+
+		in := Ingester{
+			Logger: dlog.NewLogger([]dlog.LoggerOption{
+				dlog.LoggerSetOutput(ioutil.Discard),
+			}...),
+			DeparturesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", departuresDB.Addr())
+				}),
+			}...),
+			LocalityNamesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", localityNamesDB.Addr())
+				}),
+			}...),
+			StopsInAreaPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", stopsInAreaDB.Addr())
+				}),
+			}...),
+			CircularServicesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", circularServicesDB.Addr())
+				}),
+			}...),
+			Clock:            func() time.Time { return now },
+			circularServices: make(map[string]*string),
+			localityNames:    make(map[string]*string),
+			stopsInArea:      make(map[string]*string),
+		}
+
+		event := events.SNSEvent{
+			Records: []events.SNSEventRecord{
+				{
+					SNS: events.SNSEntity{
+						Message: `{"schemaVersion":1,"sourceFeed":"` + sourceFeedName + `","departures":[` + string(newDeparture1) + `,` + string(newDeparture2) + `]}`,
+					},
+				},
+			},
+		}
+
+		if err := in.Handler(event); err != nil {
+			t.Error(err)
+			return
+		}
+
+		departuresDB.CheckList(t, locationAtcocode, []string{string(newDeparture1), string(cachedDeparture1)}...)
+	})
+
+	t.Run("leaves cached departures written with a newer schema version untouched", func(t *testing.T) {
+		cachedDeparture1 := `{"schemaVersion":2,"producer":"ingester","journeyRef":"534_direction_1234","locationAtcocode":"` + locationAtcocode + `"}`
+
+		newDeparture1 := buildJSONDeparture(t, test_helpers.AdjustTime(now, "0s"), 1236, test_helpers.AdjustTime(now, "2m"), nil, locationAtcocode, &locationStand, "1800WA12481", "Hobbiton", "525", "VISB")
+
+		localityNamesDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer localityNamesDB.Close()
+
+		if err := localityNamesDB.Set("1800WA12481", "Hobbiton"); err != nil {
+			t.Fatal(err)
+		}
+
+		departuresDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer departuresDB.Close()
+
+		if _, err := departuresDB.Push(locationAtcocode, cachedDeparture1); err != nil {
+			t.Fatal(err)
+		}
+
+		stopsInAreaDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stopsInAreaDB.Close()
+
+		circularServicesDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer circularServicesDB.Close()
+
+		in := Ingester{
+			Logger: dlog.NewLogger([]dlog.LoggerOption{
+				dlog.LoggerSetOutput(ioutil.Discard),
+			}...),
+			DeparturesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", departuresDB.Addr())
+				}),
+			}...),
+			LocalityNamesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", localityNamesDB.Addr())
+				}),
+			}...),
+			StopsInAreaPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", stopsInAreaDB.Addr())
+				}),
+			}...),
+			CircularServicesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", circularServicesDB.Addr())
+				}),
+			}...),
+			Clock:            func() time.Time { return now },
 			circularServices: make(map[string]*string),
 			localityNames:    make(map[string]*string),
 			stopsInArea:      make(map[string]*string),
@@ -1001,5 +1194,867 @@ func TestIngester_Handler(t *testing.T) {
 		if err := in.Handler(event); err == nil {
 			t.Error("Should return an error!")
 		}
+
+		departuresDB.CheckList(t, locationAtcocode, cachedDeparture1)
+	})
+
+	t.Run("accepts departures messages published without an envelope", func(t *testing.T) {
+		newDeparture1 := buildJSONDeparture(t, test_helpers.AdjustTime(now, "0s"), 1236, test_helpers.AdjustTime(now, "2m"), nil, locationAtcocode, &locationStand, "1800WA12481", "Hobbiton", "525", "VISB")
+
+		dep := model.Departure{}
+		if err := json.Unmarshal(newDeparture1, &dep); err != nil {
+			t.Fatal(err)
+		}
+
+		departuresJSON, err := json.Marshal(model.Internal{Departures: []model.Departure{dep}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		newDeparture1Expectation, err := model.EncodeCachedDeparture(model.NewEnvelope(producerName, "", now, ""), dep)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		localityNamesDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer localityNamesDB.Close()
+
+		if err := localityNamesDB.Set("1800WA12481", "Hobbiton"); err != nil {
+			t.Fatal(err)
+		}
+
+		departuresDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer departuresDB.Close()
+
+		stopsInAreaDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stopsInAreaDB.Close()
+
+		circularServicesDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer circularServicesDB.Close()
+
+		in := Ingester{
+			Logger: dlog.NewLogger([]dlog.LoggerOption{
+				dlog.LoggerSetOutput(ioutil.Discard),
+			}...),
+			DeparturesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", departuresDB.Addr())
+				}),
+			}...),
+			LocalityNamesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", localityNamesDB.Addr())
+				}),
+			}...),
+			StopsInAreaPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", stopsInAreaDB.Addr())
+				}),
+			}...),
+			CircularServicesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", circularServicesDB.Addr())
+				}),
+			}...),
+			Clock:            func() time.Time { return now },
+			circularServices: make(map[string]*string),
+			localityNames:    make(map[string]*string),
+			stopsInArea:      make(map[string]*string),
+		}
+
+		event := events.SNSEvent{
+			Records: []events.SNSEventRecord{
+				{
+					SNS: events.SNSEntity{
+						Message: string(departuresJSON),
+					},
+				},
+			},
+		}
+
+		if err := in.Handler(event); err != nil {
+			t.Error(err)
+			return
+		}
+
+		departuresDB.CheckList(t, locationAtcocode, string(newDeparture1Expectation))
+	})
+
+	t.Run("caches arrivals under a separate key", func(t *testing.T) {
+		encode := func(departure model.Departure) []byte {
+			departureJSON, err := model.EncodeCachedDeparture(model.NewEnvelope(producerName, sourceFeedName, now, ""), departure)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return departureJSON
+		}
+
+		expectedArrivalTime := test_helpers.AdjustTime(now, "3m")
+
+		callingAt := model.Departure{
+			RecordedAtTime:      now,
+			JourneyType:         model.Bus,
+			JourneyRef:          "534_direction_1234",
+			AimedDepartureTime:  test_helpers.AdjustTime(now, "5m"),
+			AimedArrivalTime:    test_helpers.AdjustTime(now, "4m"),
+			LocationAtcocode:    locationAtcocode,
+			OriginAtcocode:      "1800WA12481",
+			Origin:              "Turning Circle",
+			DestinationAtcocode: "1800BR00011",
+			Destination:         "Bree",
+			ServiceNumber:       "534",
+			OperatorCode:        "ANWE",
+		}
+
+		terminating := model.Departure{
+			RecordedAtTime:      now,
+			JourneyType:         model.Bus,
+			JourneyRef:          "535_direction_1235",
+			AimedArrivalTime:    test_helpers.AdjustTime(now, "2m"),
+			ExpectedArrivalTime: &expectedArrivalTime,
+			LocationAtcocode:    locationAtcocode,
+			OriginAtcocode:      "1800BR00011",
+			Origin:              "Bree",
+			DestinationAtcocode: "1800BR00021",
+			Destination:         "Hobbiton Interchange",
+			ServiceNumber:       "535",
+			OperatorCode:        "ANWE",
+		}
+
+		arrived := model.Departure{
+			RecordedAtTime:      now,
+			JourneyType:         model.Bus,
+			JourneyRef:          "536_direction_1236",
+			AimedDepartureTime:  test_helpers.AdjustTime(now, "1m"),
+			AimedArrivalTime:    test_helpers.AdjustTime(now, "-1m"),
+			LocationAtcocode:    locationAtcocode,
+			DestinationAtcocode: "1800BR00011",
+			Destination:         "Bree",
+			ServiceNumber:       "536",
+			OperatorCode:        "ANWE",
+		}
+
+		callingAtExpectation := callingAt
+		callingAtExpectation.Origin = "Hobbiton"
+
+		localityNamesDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer localityNamesDB.Close()
+
+		if err := localityNamesDB.Set("1800WA12481", "Hobbiton"); err != nil {
+			t.Fatal(err)
+		}
+
+		departuresDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer departuresDB.Close()
+
+		stopsInAreaDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stopsInAreaDB.Close()
+
+		circularServicesDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer circularServicesDB.Close()
+
+		in := Ingester{
+			Logger: dlog.NewLogger([]dlog.LoggerOption{
+				dlog.LoggerSetOutput(ioutil.Discard),
+			}...),
+			DeparturesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", departuresDB.Addr())
+				}),
+			}...),
+			LocalityNamesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", localityNamesDB.Addr())
+				}),
+			}...),
+			StopsInAreaPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", stopsInAreaDB.Addr())
+				}),
+			}...),
+			CircularServicesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", circularServicesDB.Addr())
+				}),
+			}...),
+			Clock:            func() time.Time { return now },
+			circularServices: make(map[string]*string),
+			localityNames:    make(map[string]*string),
+			stopsInArea:      make(map[string]*string),
+		}
+
+		event := buildSnsEvent(t, encode(callingAt), encode(terminating), encode(arrived))
+
+		if err := in.Handler(event); err != nil {
+			t.Error(err)
+			return
+		}
+
+		departuresDB.CheckList(t, locationAtcocode, string(encode(arrived)), string(encode(callingAtExpectation)))
+		departuresDB.CheckList(t, model.ArrivalsKeyPrefix+locationAtcocode, string(encode(terminating)), string(encode(callingAtExpectation)))
+	})
+
+	t.Run("keeps cancelled departures for the retention period", func(t *testing.T) {
+		encode := func(departure model.Departure) []byte {
+			departureJSON, err := model.EncodeCachedDeparture(model.NewEnvelope(producerName, sourceFeedName, now, ""), departure)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return departureJSON
+		}
+
+		cancelled := func(journeyRef string, aimedDepartureTime time.Time) model.Departure {
+			return model.Departure{
+				RecordedAtTime:      test_helpers.AdjustTime(now, "-40m"),
+				JourneyType:         model.Bus,
+				JourneyRef:          journeyRef,
+				AimedDepartureTime:  aimedDepartureTime,
+				DepartureStatus:     aws.String(model.CancelledStatus),
+				LocationAtcocode:    locationAtcocode,
+				DestinationAtcocode: "1800WA12481",
+				Destination:         "Hobbiton",
+				ServiceNumber:       "534",
+				OperatorCode:        "ANWE",
+			}
+		}
+
+		recentlyCancelled := cancelled("534_direction_1234", test_helpers.AdjustTime(now, "-10m"))
+		longCancelled := cancelled("534_direction_1235", now.Add(-model.CancelledRetention-time.Minute))
+
+		newDeparture := buildJSONDeparture(t, now, 1236, test_helpers.AdjustTime(now, "3m"), nil, locationAtcocode, nil, "1800WA12481", "Hobbiton", "534", "ANWE")
+
+		localityNamesDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer localityNamesDB.Close()
+
+		if err := localityNamesDB.Set("1800WA12481", "Hobbiton"); err != nil {
+			t.Fatal(err)
+		}
+
+		departuresDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer departuresDB.Close()
+
+		if _, err := departuresDB.Push(locationAtcocode, string(encode(longCancelled)), string(encode(recentlyCancelled))); err != nil {
+			t.Fatal(err)
+		}
+
+		stopsInAreaDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stopsInAreaDB.Close()
+
+		circularServicesDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer circularServicesDB.Close()
+
+		in := Ingester{
+			Logger: dlog.NewLogger([]dlog.LoggerOption{
+				dlog.LoggerSetOutput(ioutil.Discard),
+			}...),
+			DeparturesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", departuresDB.Addr())
+				}),
+			}...),
+			LocalityNamesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", localityNamesDB.Addr())
+				}),
+			}...),
+			StopsInAreaPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", stopsInAreaDB.Addr())
+				}),
+			}...),
+			CircularServicesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", circularServicesDB.Addr())
+				}),
+			}...),
+			Clock:            func() time.Time { return now },
+			circularServices: make(map[string]*string),
+			localityNames:    make(map[string]*string),
+			stopsInArea:      make(map[string]*string),
+		}
+
+		event := buildSnsEvent(t, newDeparture)
+
+		if err := in.Handler(event); err != nil {
+			t.Error(err)
+			return
+		}
+
+		departuresDB.CheckList(t, locationAtcocode, string(encode(recentlyCancelled)), string(newDeparture))
+	})
+
+	t.Run("removes journeys missing from a snapshot of a stop area", func(t *testing.T) {
+		cachedMissing := buildJSONDeparture(t, test_helpers.AdjustTime(now, "-3m"), 1234, test_helpers.AdjustTime(now, "5m"), nil, locationAtcocode, &locationStand, "1800WA12481", "Hobbiton", "534", "ANWE")
+		cachedListed := buildJSONDeparture(t, test_helpers.AdjustTime(now, "-3m"), 1235, test_helpers.AdjustTime(now, "6m"), nil, locationAtcocode, &locationStand, "1800WA12481", "Hobbiton", "534", "ANWE")
+		cachedExtraMissing := buildJSONDeparture(t, test_helpers.AdjustTime(now, "-3m"), 1236, test_helpers.AdjustTime(now, "7m"), nil, extraLocationAtcocode, &extraLocationStand, "1800WA12481", "Hobbiton", "534", "ANWE")
+		cachedLater := buildJSONDeparture(t, test_helpers.AdjustTime(now, "-3m"), 1237, test_helpers.AdjustTime(now, "2h"), nil, locationAtcocode, &locationStand, "1800WA12481", "Hobbiton", "534", "ANWE")
+
+		newListedExpectedDepartureTime := test_helpers.AdjustTime(now, "8m")
+		newListed := buildJSONDeparture(t, now, 1235, test_helpers.AdjustTime(now, "6m"), &newListedExpectedDepartureTime, locationAtcocode, &locationStand, "1800WA12481", "Hobbiton", "534", "ANWE")
+
+		localityNamesDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer localityNamesDB.Close()
+
+		if err := localityNamesDB.Set("1800WA12481", "Hobbiton"); err != nil {
+			t.Fatal(err)
+		}
+
+		departuresDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer departuresDB.Close()
+
+		if _, err := departuresDB.Push(locationAtcocode, string(cachedMissing), string(cachedListed), string(cachedLater)); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := departuresDB.Push(extraLocationAtcocode, string(cachedExtraMissing)); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := departuresDB.Push(stopAreaAtcocode, string(cachedMissing), string(cachedListed), string(cachedExtraMissing), string(cachedLater)); err != nil {
+			t.Fatal(err)
+		}
+
+		stopsInAreaDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stopsInAreaDB.Close()
+
+		if err := stopsInAreaDB.Set(locationAtcocode, stopAreaAtcocode); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := stopsInAreaDB.Set(extraLocationAtcocode, stopAreaAtcocode); err != nil {
+			t.Fatal(err)
+		}
+
+		circularServicesDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer circularServicesDB.Close()
+
+		in := Ingester{
+			Logger: dlog.NewLogger([]dlog.LoggerOption{
+				dlog.LoggerSetOutput(ioutil.Discard),
+			}...),
+			DeparturesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", departuresDB.Addr())
+				}),
+			}...),
+			LocalityNamesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", localityNamesDB.Addr())
+				}),
+			}...),
+			StopsInAreaPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", stopsInAreaDB.Addr())
+				}),
+			}...),
+			CircularServicesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", circularServicesDB.Addr())
+				}),
+			}...),
+			Clock:            func() time.Time { return now },
+			circularServices: make(map[string]*string),
+			localityNames:    make(map[string]*string),
+			stopsInArea:      make(map[string]*string),
+		}
+
+		event := buildSnapshotSnsEvent(t, stopAreaAtcocode, newListed)
+
+		if err := in.Handler(event); err != nil {
+			t.Error(err)
+			return
+		}
+
+		// The journey beyond the snapshot is merged, and the stop with no
+		// journeys left is emptied
+		departuresDB.CheckList(t, locationAtcocode, string(newListed), string(cachedLater))
+		departuresDB.CheckList(t, stopAreaAtcocode, string(newListed), string(cachedLater))
+
+		if departuresDB.Exists(extraLocationAtcocode) {
+			t.Errorf("expected the departures for `%s` to be removed", extraLocationAtcocode)
+		}
+	})
+
+	t.Run("leaves other stops in the stop area alone for a snapshot of a stop", func(t *testing.T) {
+		cachedMissing := buildJSONDeparture(t, test_helpers.AdjustTime(now, "-3m"), 1234, test_helpers.AdjustTime(now, "5m"), nil, locationAtcocode, &locationStand, "1800WA12481", "Hobbiton", "534", "ANWE")
+		cachedListed := buildJSONDeparture(t, test_helpers.AdjustTime(now, "-3m"), 1235, test_helpers.AdjustTime(now, "6m"), nil, locationAtcocode, &locationStand, "1800WA12481", "Hobbiton", "534", "ANWE")
+		cachedExtraMissing := buildJSONDeparture(t, test_helpers.AdjustTime(now, "-3m"), 1236, test_helpers.AdjustTime(now, "7m"), nil, extraLocationAtcocode, &extraLocationStand, "1800WA12481", "Hobbiton", "534", "ANWE")
+		cachedLater := buildJSONDeparture(t, test_helpers.AdjustTime(now, "-3m"), 1237, test_helpers.AdjustTime(now, "2h"), nil, locationAtcocode, &locationStand, "1800WA12481", "Hobbiton", "534", "ANWE")
+
+		newListedExpectedDepartureTime := test_helpers.AdjustTime(now, "8m")
+		newListed := buildJSONDeparture(t, now, 1235, test_helpers.AdjustTime(now, "6m"), &newListedExpectedDepartureTime, locationAtcocode, &locationStand, "1800WA12481", "Hobbiton", "534", "ANWE")
+
+		localityNamesDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer localityNamesDB.Close()
+
+		if err := localityNamesDB.Set("1800WA12481", "Hobbiton"); err != nil {
+			t.Fatal(err)
+		}
+
+		departuresDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer departuresDB.Close()
+
+		if _, err := departuresDB.Push(locationAtcocode, string(cachedMissing), string(cachedListed), string(cachedLater)); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := departuresDB.Push(extraLocationAtcocode, string(cachedExtraMissing)); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := departuresDB.Push(stopAreaAtcocode, string(cachedMissing), string(cachedListed), string(cachedExtraMissing), string(cachedLater)); err != nil {
+			t.Fatal(err)
+		}
+
+		stopsInAreaDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stopsInAreaDB.Close()
+
+		if err := stopsInAreaDB.Set(locationAtcocode, stopAreaAtcocode); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := stopsInAreaDB.Set(extraLocationAtcocode, stopAreaAtcocode); err != nil {
+			t.Fatal(err)
+		}
+
+		circularServicesDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer circularServicesDB.Close()
+
+		in := Ingester{
+			Logger: dlog.NewLogger([]dlog.LoggerOption{
+				dlog.LoggerSetOutput(ioutil.Discard),
+			}...),
+			DeparturesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", departuresDB.Addr())
+				}),
+			}...),
+			LocalityNamesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", localityNamesDB.Addr())
+				}),
+			}...),
+			StopsInAreaPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", stopsInAreaDB.Addr())
+				}),
+			}...),
+			CircularServicesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", circularServicesDB.Addr())
+				}),
+			}...),
+			Clock:            func() time.Time { return now },
+			circularServices: make(map[string]*string),
+			localityNames:    make(map[string]*string),
+			stopsInArea:      make(map[string]*string),
+		}
+
+		event := buildSnapshotSnsEvent(t, locationAtcocode, newListed)
+
+		if err := in.Handler(event); err != nil {
+			t.Error(err)
+			return
+		}
+
+		departuresDB.CheckList(t, locationAtcocode, string(newListed), string(cachedLater))
+		departuresDB.CheckList(t, extraLocationAtcocode, string(cachedExtraMissing))
+		departuresDB.CheckList(t, stopAreaAtcocode, string(cachedExtraMissing), string(newListed), string(cachedLater))
+	})
+
+	t.Run("merges journeys with the cache if the message is not a snapshot", func(t *testing.T) {
+		cachedMissing := buildJSONDeparture(t, test_helpers.AdjustTime(now, "-3m"), 1234, test_helpers.AdjustTime(now, "5m"), nil, locationAtcocode, &locationStand, "1800WA12481", "Hobbiton", "534", "ANWE")
+		cachedListed := buildJSONDeparture(t, test_helpers.AdjustTime(now, "-3m"), 1235, test_helpers.AdjustTime(now, "6m"), nil, locationAtcocode, &locationStand, "1800WA12481", "Hobbiton", "534", "ANWE")
+		cachedExtraMissing := buildJSONDeparture(t, test_helpers.AdjustTime(now, "-3m"), 1236, test_helpers.AdjustTime(now, "7m"), nil, extraLocationAtcocode, &extraLocationStand, "1800WA12481", "Hobbiton", "534", "ANWE")
+		cachedLater := buildJSONDeparture(t, test_helpers.AdjustTime(now, "-3m"), 1237, test_helpers.AdjustTime(now, "2h"), nil, locationAtcocode, &locationStand, "1800WA12481", "Hobbiton", "534", "ANWE")
+
+		newListedExpectedDepartureTime := test_helpers.AdjustTime(now, "8m")
+		newListed := buildJSONDeparture(t, now, 1235, test_helpers.AdjustTime(now, "6m"), &newListedExpectedDepartureTime, locationAtcocode, &locationStand, "1800WA12481", "Hobbiton", "534", "ANWE")
+
+		localityNamesDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer localityNamesDB.Close()
+
+		if err := localityNamesDB.Set("1800WA12481", "Hobbiton"); err != nil {
+			t.Fatal(err)
+		}
+
+		departuresDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer departuresDB.Close()
+
+		if _, err := departuresDB.Push(locationAtcocode, string(cachedMissing), string(cachedListed), string(cachedLater)); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := departuresDB.Push(extraLocationAtcocode, string(cachedExtraMissing)); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := departuresDB.Push(stopAreaAtcocode, string(cachedMissing), string(cachedListed), string(cachedExtraMissing), string(cachedLater)); err != nil {
+			t.Fatal(err)
+		}
+
+		stopsInAreaDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stopsInAreaDB.Close()
+
+		if err := stopsInAreaDB.Set(locationAtcocode, stopAreaAtcocode); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := stopsInAreaDB.Set(extraLocationAtcocode, stopAreaAtcocode); err != nil {
+			t.Fatal(err)
+		}
+
+		circularServicesDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer circularServicesDB.Close()
+
+		in := Ingester{
+			Logger: dlog.NewLogger([]dlog.LoggerOption{
+				dlog.LoggerSetOutput(ioutil.Discard),
+			}...),
+			DeparturesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", departuresDB.Addr())
+				}),
+			}...),
+			LocalityNamesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", localityNamesDB.Addr())
+				}),
+			}...),
+			StopsInAreaPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", stopsInAreaDB.Addr())
+				}),
+			}...),
+			CircularServicesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", circularServicesDB.Addr())
+				}),
+			}...),
+			Clock:            func() time.Time { return now },
+			circularServices: make(map[string]*string),
+			localityNames:    make(map[string]*string),
+			stopsInArea:      make(map[string]*string),
+		}
+
+		event := buildSnsEvent(t, newListed)
+
+		if err := in.Handler(event); err != nil {
+			t.Error(err)
+			return
+		}
+
+		departuresDB.CheckList(t, locationAtcocode, string(cachedMissing), string(newListed), string(cachedLater))
+	})
+
+	t.Run("merges journeys with the cache if a snapshot has departures that cannot be decoded", func(t *testing.T) {
+		cachedMissing := buildJSONDeparture(t, test_helpers.AdjustTime(now, "-3m"), 1234, test_helpers.AdjustTime(now, "5m"), nil, locationAtcocode, &locationStand, "1800WA12481", "Hobbiton", "534", "ANWE")
+		cachedListed := buildJSONDeparture(t, test_helpers.AdjustTime(now, "-3m"), 1235, test_helpers.AdjustTime(now, "6m"), nil, locationAtcocode, &locationStand, "1800WA12481", "Hobbiton", "534", "ANWE")
+		cachedExtraMissing := buildJSONDeparture(t, test_helpers.AdjustTime(now, "-3m"), 1236, test_helpers.AdjustTime(now, "7m"), nil, extraLocationAtcocode, &extraLocationStand, "1800WA12481", "Hobbiton", "534", "ANWE")
+		cachedLater := buildJSONDeparture(t, test_helpers.AdjustTime(now, "-3m"), 1237, test_helpers.AdjustTime(now, "2h"), nil, locationAtcocode, &locationStand, "1800WA12481", "Hobbiton", "534", "ANWE")
+
+		newListedExpectedDepartureTime := test_helpers.AdjustTime(now, "8m")
+		newListed := buildJSONDeparture(t, now, 1235, test_helpers.AdjustTime(now, "6m"), &newListedExpectedDepartureTime, locationAtcocode, &locationStand, "1800WA12481", "Hobbiton", "534", "ANWE")
+
+		localityNamesDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer localityNamesDB.Close()
+
+		if err := localityNamesDB.Set("1800WA12481", "Hobbiton"); err != nil {
+			t.Fatal(err)
+		}
+
+		departuresDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer departuresDB.Close()
+
+		if _, err := departuresDB.Push(locationAtcocode, string(cachedMissing), string(cachedListed), string(cachedLater)); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := departuresDB.Push(extraLocationAtcocode, string(cachedExtraMissing)); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := departuresDB.Push(stopAreaAtcocode, string(cachedMissing), string(cachedListed), string(cachedExtraMissing), string(cachedLater)); err != nil {
+			t.Fatal(err)
+		}
+
+		stopsInAreaDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stopsInAreaDB.Close()
+
+		if err := stopsInAreaDB.Set(locationAtcocode, stopAreaAtcocode); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := stopsInAreaDB.Set(extraLocationAtcocode, stopAreaAtcocode); err != nil {
+			t.Fatal(err)
+		}
+
+		circularServicesDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer circularServicesDB.Close()
+
+		in := Ingester{
+			Logger: dlog.NewLogger([]dlog.LoggerOption{
+				dlog.LoggerSetOutput(ioutil.Discard),
+			}...),
+			DeparturesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", departuresDB.Addr())
+				}),
+			}...),
+			LocalityNamesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", localityNamesDB.Addr())
+				}),
+			}...),
+			StopsInAreaPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", stopsInAreaDB.Addr())
+				}),
+			}...),
+			CircularServicesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", circularServicesDB.Addr())
+				}),
+			}...),
+			Clock:            func() time.Time { return now },
+			circularServices: make(map[string]*string),
+			localityNames:    make(map[string]*string),
+			stopsInArea:      make(map[string]*string),
+		}
+
+		event := buildSnapshotSnsEvent(t, locationAtcocode, newListed)
+		event.Records[0].SNS.Message = strings.Replace(event.Records[0].SNS.Message, `"departures":[`, `"departures":[{"journeyRef":1234},`, 1)
+
+		if err := in.Handler(event); err != nil {
+			t.Error(err)
+			return
+		}
+
+		departuresDB.CheckList(t, locationAtcocode, string(cachedMissing), string(newListed), string(cachedLater))
+	})
+}
+
+// interferingConn runs interfere before each transaction is started on the
+// connection, standing in for another invocation updating the cache between
+// the departures being read and written
+type interferingConn struct {
+	redis.Conn
+	interfere func()
+}
+
+func (c interferingConn) Send(commandName string, args ...interface{}) error {
+	if commandName == "MULTI" {
+		c.interfere()
+	}
+
+	return c.Conn.Send(commandName, args...)
+}
+
+func TestIngester_updateLocation(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	// The locality names, stops in area and circular services are read from
+	// the same database
+	newIngester := func(departuresDB *miniredis.Miniredis, lookupsDB *miniredis.Miniredis, interfere func()) Ingester {
+		dialLookups := repository.RedisPoolDial(func() (redis.Conn, error) {
+			return redis.Dial("tcp", lookupsDB.Addr())
+		})
+
+		return Ingester{
+			Logger: dlog.NewLogger([]dlog.LoggerOption{
+				dlog.LoggerSetOutput(ioutil.Discard),
+			}...),
+			DeparturesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					conn, err := redis.Dial("tcp", departuresDB.Addr())
+					if err != nil || interfere == nil {
+						return conn, err
+					}
+
+					return interferingConn{Conn: conn, interfere: interfere}, nil
+				}),
+			}...),
+			LocalityNamesPool:    repository.NewRedisPool(dialLookups),
+			StopsInAreaPool:      repository.NewRedisPool(dialLookups),
+			CircularServicesPool: repository.NewRedisPool(dialLookups),
+			Clock:                func() time.Time { return now },
+			circularServices:     make(map[string]*string),
+			localityNames:        make(map[string]*string),
+			stopsInArea:          make(map[string]*string),
+		}
+	}
+
+	t.Run("keeps departures cached while the location is being updated", func(t *testing.T) {
+		departure := buildJSONDeparture(t, now, 1234, test_helpers.AdjustTime(now, "5m"), nil, locationAtcocode, &locationStand, "1800WA12481", "Hobbiton", "534", "ANWE")
+		concurrentDeparture := buildJSONDeparture(t, now, 1235, test_helpers.AdjustTime(now, "6m"), nil, locationAtcocode, &locationStand, "1800WA12481", "Hobbiton", "534", "ANWE")
+
+		departuresDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer departuresDB.Close()
+
+		lookupsDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer lookupsDB.Close()
+
+		if err := lookupsDB.Set("1800WA12481", "Hobbiton"); err != nil {
+			t.Fatal(err)
+		}
+
+		concurrent := newIngester(departuresDB, lookupsDB, nil)
+
+		var concurrentErr error
+		interfered := false
+
+		in := newIngester(departuresDB, lookupsDB, func() {
+			if interfered {
+				return
+			}
+			interfered = true
+
+			concurrentErr = concurrent.Handler(buildSnsEvent(t, concurrentDeparture))
+		})
+
+		if err := in.Handler(buildSnsEvent(t, departure)); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if concurrentErr != nil {
+			t.Error(concurrentErr)
+			return
+		}
+
+		test_helpers.AssertBoolean(t, interfered, true)
+
+		departuresDB.CheckList(t, locationAtcocode, string(departure), string(concurrentDeparture))
+	})
+
+	t.Run("returns an error if the location changes on every attempt", func(t *testing.T) {
+		departure := buildJSONDeparture(t, now, 1234, test_helpers.AdjustTime(now, "5m"), nil, locationAtcocode, &locationStand, "1800WA12481", "Hobbiton", "534", "ANWE")
+		concurrentDeparture := buildJSONDeparture(t, now, 1235, test_helpers.AdjustTime(now, "6m"), nil, locationAtcocode, &locationStand, "1800WA12481", "Hobbiton", "534", "ANWE")
+
+		departuresDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer departuresDB.Close()
+
+		lookupsDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer lookupsDB.Close()
+
+		if err := lookupsDB.Set("1800WA12481", "Hobbiton"); err != nil {
+			t.Fatal(err)
+		}
+
+		attempts := 0
+
+		in := newIngester(departuresDB, lookupsDB, func() {
+			attempts++
+
+			if _, err := departuresDB.Push(locationAtcocode, string(concurrentDeparture)); err != nil {
+				t.Error(err)
+			}
+		})
+
+		if err := in.Handler(buildSnsEvent(t, departure)); err == nil {
+			t.Error("expected an error when the location changes on every attempt")
+		}
+
+		if attempts != maxUpdateAttempts {
+			t.Errorf("got %d attempts, want %d", attempts, maxUpdateAttempts)
+		}
 	})
 }
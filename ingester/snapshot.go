@@ -0,0 +1,130 @@
+package main
+
+import (
+	"github.com/TfGMEnterprise/departures-service/model"
+)
+
+// snapshot is the part of a board that a departures message with a
+// model.Snapshot replaces: the departures at the stops it covers whose time on
+// the board is in the period of the snapshot. A nil snapshot replaces nothing,
+// so the message is merged with the cache.
+type snapshot struct {
+	model.Snapshot
+	// location is the ATCO code of the stop or stop area of the message
+	location string
+	// stops are the ATCO codes of the stops covered
+	stops map[string]bool
+	// journeys are the journeys listed, keyed by stop and journey reference
+	journeys map[string]bool
+}
+
+// newSnapshot returns the part of the board that the message replaces, or nil
+// if the message is not a snapshot. The stops covered are those with listed
+// journeys until the stops cached for the location are added with
+// coverCachedStops.
+func (in Ingester) newSnapshot(board model.BoardType, envelope *model.Envelope, listed []model.Departure) *snapshot {
+	in.Logger.Debugf("newSnapshot (%s)", board)
+
+	if envelope.Snapshot == nil || envelope.Location == "" {
+		return nil
+	}
+
+	snap := &snapshot{
+		Snapshot: *envelope.Snapshot,
+		location: envelope.Location,
+		stops:    make(map[string]bool),
+		journeys: make(map[string]bool),
+	}
+
+	for _, departure := range listed {
+		snap.stops[departure.LocationAtcocode] = true
+		snap.journeys[snapshotJourneyKey(departure)] = true
+	}
+
+	return snap
+}
+
+// coverCachedStops returns a copy of the snapshot that also covers the stops
+// of the departures cached for its location that are the location or in it,
+// as a stop may have no journeys left. The departures must be read under the
+// same watch as the location is written with, so that the stops cannot change
+// in between.
+func (in Ingester) coverCachedStops(snap *snapshot, cached *model.Internal) *snapshot {
+	in.Logger.Debugf("coverCachedStops for `%s`", snap.location)
+
+	covered := *snap
+	covered.stops = make(map[string]bool, len(snap.stops))
+
+	for stop := range snap.stops {
+		covered.stops[stop] = true
+	}
+
+	for _, departure := range cached.Departures {
+		if covered.stops[departure.LocationAtcocode] {
+			continue
+		}
+
+		isCovered, err := in.isInLocation(departure.LocationAtcocode, snap.location)
+		if err != nil {
+			in.Logger.Printf("cannot tell whether `%s` is in `%s`; it is not covered: %v", departure.LocationAtcocode, snap.location, err)
+			continue
+		}
+
+		if isCovered {
+			covered.stops[departure.LocationAtcocode] = true
+		}
+	}
+
+	return &covered
+}
+
+// isInLocation returns true if the stop is the location or is in the stop
+// area of the location
+func (in Ingester) isInLocation(stop string, location string) (bool, error) {
+	if stop == location {
+		return true, nil
+	}
+
+	stopArea, err := in.getStopArea(stop)
+	if err != nil {
+		return false, err
+	}
+
+	return stopArea != nil && *stopArea == location, nil
+}
+
+// isLocation returns true if the ATCO code is the location of the snapshot
+func (s *snapshot) isLocation(atcocode string) bool {
+	return s != nil && s.location == atcocode
+}
+
+// coveredStops returns the stops the snapshot covers, or none if it is nil
+func (s *snapshot) coveredStops() map[string]bool {
+	if s == nil {
+		return nil
+	}
+
+	return s.stops
+}
+
+// replaces returns true if the departure is at a covered stop and its time on
+// the board is in the period of the snapshot
+func (s *snapshot) replaces(board model.BoardType, departure model.Departure) bool {
+	if s == nil || !s.stops[departure.LocationAtcocode] {
+		return false
+	}
+
+	departureTime, _ := board.View(departure).DepartureTime()
+
+	return s.Covers(departureTime)
+}
+
+// lists returns true if the journey is listed in the snapshot at the stop of
+// the departure
+func (s *snapshot) lists(departure model.Departure) bool {
+	return s != nil && s.journeys[snapshotJourneyKey(departure)]
+}
+
+func snapshotJourneyKey(departure model.Departure) string {
+	return departure.LocationAtcocode + " " + departure.JourneyRef
+}
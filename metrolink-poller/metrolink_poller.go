@@ -0,0 +1,276 @@
+package main
+
+import (
+	"github.com/TfGMEnterprise/departures-service/dlog"
+	"github.com/TfGMEnterprise/departures-service/model"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// producerName identifies the poller in the envelope of each published message
+	producerName = "metrolink-poller"
+
+	// sourceFeed identifies the TfGM Metrolink departures feed in the envelope
+	// of each published message
+	sourceFeed = "tfgm-metrolink"
+
+	// terminatesHere is the destination shown for trams that terminate at the
+	// platform; they are arrivals rather than departures
+	terminatesHere = "Terminates Here"
+
+	// snapshotPeriod is how long after the poll each message lists every tram
+	// at its platform for; displays only show trams due well within it
+	snapshotPeriod = 24 * time.Hour
+
+	// journeyRefRounding is the period the departure time of a tram is rounded
+	// to in its journey reference, so that the reference is unchanged while
+	// the wait shown for the tram changes by a minute or two between polls
+	journeyRefRounding = 5 * time.Minute
+)
+
+type MetrolinkPoller struct {
+	Logger          *dlog.Logger
+	Client          *http.Client
+	MetrolinkURL    string
+	MetrolinkAPIKey string
+	SNSClient       snsiface.SNSAPI
+	SNSTopicARN     *string
+	// Clock returns the current time; time.Now is used if it is not set
+	Clock func() time.Time
+}
+
+func main() {
+	loggerOptions := []dlog.LoggerOption{
+		dlog.LoggerSetOutput(os.Stderr),
+		dlog.LoggerSetPrefix("metrolink-poller: "),
+		dlog.LoggerSetFlags(log.Ldate | log.Ltime | log.Lmicroseconds | log.Llongfile),
+	}
+
+	logger := dlog.NewLogger(loggerOptions...)
+
+	logger.Debug("main")
+
+	metrolinkURL, exists := os.LookupEnv("METROLINK_URL")
+	if !exists || metrolinkURL == "" {
+		logger.Fatal("METROLINK_URL not set in environment")
+	}
+
+	metrolinkAPIKey, exists := os.LookupEnv("METROLINK_API_KEY")
+	if !exists || metrolinkAPIKey == "" {
+		logger.Fatal("METROLINK_API_KEY not set in environment")
+	}
+
+	metrolinkTimeoutStr, exists := os.LookupEnv("METROLINK_TIMEOUT")
+	if !exists || metrolinkTimeoutStr == "" {
+		metrolinkTimeoutStr = "30"
+	}
+
+	metrolinkTimeout, err := strconv.Atoi(metrolinkTimeoutStr)
+	if err != nil {
+		logger.Fatal("METROLINK_TIMEOUT value is invalid")
+	}
+
+	if metrolinkTimeout <= 0 {
+		logger.Fatal("METROLINK_TIMEOUT value must be greater than 0")
+	}
+
+	snsTopicURN, exists := os.LookupEnv("AWS_SNS_TOPIC_ARN")
+	if !exists || snsTopicURN == "" {
+		logger.Fatal("AWS_SNS_TOPIC_ARN not set in environment")
+	}
+
+	sess := session.Must(session.NewSession())
+
+	snsClient := *sns.New(sess)
+
+	mp := MetrolinkPoller{
+		Logger: logger,
+		Client: &http.Client{
+			Timeout: time.Second * time.Duration(metrolinkTimeout),
+		},
+		MetrolinkURL:    metrolinkURL,
+		MetrolinkAPIKey: metrolinkAPIKey,
+		SNSClient:       &snsClient,
+		SNSTopicARN:     &snsTopicURN,
+		Clock:           time.Now,
+	}
+
+	lambda.Start(mp.Handler)
+}
+
+// now returns the current time from the poller clock
+func (mp *MetrolinkPoller) now() time.Time {
+	if mp.Clock == nil {
+		return time.Now()
+	}
+
+	return mp.Clock()
+}
+
+// Handler requests the departures for every Metrolink platform and publishes
+// a message to SNS for each platform. Each message is a snapshot of the
+// platform, so trams no longer shown, including on a platform with no trams,
+// are removed from the cache.
+func (mp *MetrolinkPoller) Handler() error {
+	mp.Logger.Debug("Handler")
+
+	feed, err := mp.request()
+	if err != nil {
+		return errors.Wrap(err, "request to Metrolink failed")
+	}
+
+	groupedByPlatform := mp.transform(feed)
+
+	platforms := make([]string, 0, len(groupedByPlatform))
+	for atcocode := range groupedByPlatform {
+		platforms = append(platforms, atcocode)
+	}
+	sort.Strings(platforms)
+
+	generatedAt := mp.now()
+
+	// Trams shown before the poll have departed, so only the departures from
+	// the time of the poll are replaced
+	snapshot := model.Snapshot{
+		From:  generatedAt,
+		Until: generatedAt.Add(snapshotPeriod),
+	}
+
+	for _, atcocode := range platforms {
+		envelope := model.NewEnvelope(producerName, sourceFeed, generatedAt, atcocode)
+		envelope.Snapshot = &snapshot
+
+		departuresJSON, err := model.EncodeDeparturesMessage(envelope, groupedByPlatform[atcocode])
+		if err != nil {
+			return errors.Wrapf(err, "cannot marshal JSON from departures for `%s`", atcocode)
+		}
+
+		if _, err := mp.SNSClient.Publish(&sns.PublishInput{
+			Message:  aws.String(string(departuresJSON)),
+			TopicArn: mp.SNSTopicARN,
+		}); err != nil {
+			return errors.Wrapf(err, "cannot publish message to SNS topic `%s`", *mp.SNSTopicARN)
+		}
+	}
+
+	return nil
+}
+
+// request gets the departures feed from the Metrolink API
+func (mp *MetrolinkPoller) request() (*model.MetrolinkDepartures, error) {
+	mp.Logger.Debugf("request Metrolink departures from %s", mp.MetrolinkURL)
+
+	req, err := http.NewRequest("GET", mp.MetrolinkURL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create Metrolink HTTP request")
+	}
+
+	req.Header.Set("Ocp-Apim-Subscription-Key", mp.MetrolinkAPIKey)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := mp.Client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot make Metrolink HTTP request to %s", mp.MetrolinkURL)
+	}
+
+	defer func() {
+		if cErr := resp.Body.Close(); cErr != nil {
+			mp.Logger.Printf("cannot close connection to %s: %v", mp.MetrolinkURL, cErr)
+		}
+	}()
+
+	if resp.StatusCode >= 400 {
+		return nil, errors.Errorf("error response from %s - status code %d", mp.MetrolinkURL, resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot read response from %s", mp.MetrolinkURL)
+	}
+
+	feed, err := model.ParseMetrolinkDepartures(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot unmarshal Metrolink departures")
+	}
+
+	return feed, nil
+}
+
+// transform converts the trams on each display into tram departures, grouped
+// by the ATCO code of the platform. Every platform is included, even if it has
+// no trams. Where more than one display shows the same platform, only the
+// first is used.
+func (mp *MetrolinkPoller) transform(feed *model.MetrolinkDepartures) map[string]model.Internal {
+	mp.Logger.Debug("transform")
+
+	groupedByPlatform := make(map[string]model.Internal)
+	seen := make(map[string]bool)
+
+	for _, pid := range feed.Value {
+		if pid.AtcoCode == "" || seen[pid.AtcoCode] {
+			continue
+		}
+		seen[pid.AtcoCode] = true
+
+		departures := model.Internal{}
+		journeyRefs := make(map[string]bool)
+
+		for _, tram := range pid.Trams() {
+			if tram.Destination == terminatesHere {
+				continue
+			}
+
+			departureTime := pid.LastUpdated.Add(time.Duration(tram.WaitMinutes) * time.Minute)
+
+			// Trams due close together on the same line to the same destination
+			// fall back to their position on the display to stay distinct
+			journeyRef := tramJourneyRef(pid, tram, departureTime)
+			if journeyRefs[journeyRef] {
+				journeyRef += "_" + strconv.Itoa(tram.Slot)
+			}
+			journeyRefs[journeyRef] = true
+
+			departure := model.Departure{
+				RecordedAtTime:        pid.LastUpdated,
+				JourneyType:           model.Tram,
+				JourneyRef:            journeyRef,
+				AimedDepartureTime:    departureTime,
+				ExpectedDepartureTime: &departureTime,
+				LocationAtcocode:      pid.AtcoCode,
+				Destination:           tram.Destination,
+				ServiceNumber:         "Metrolink",
+			}
+
+			if tram.Status != "" {
+				status := tram.Status
+				departure.DepartureStatus = &status
+			}
+
+			departures.Departures = append(departures.Departures, departure)
+		}
+
+		groupedByPlatform[pid.AtcoCode] = departures
+	}
+
+	return groupedByPlatform
+}
+
+// tramJourneyRef returns a reference for a tram that stays the same as the
+// tram moves up the display between polls, as the feed has no journey
+// identifiers. It is made up of the platform, line and destination, and the
+// departure time in UTC rounded to journeyRefRounding.
+func tramJourneyRef(pid model.MetrolinkPID, tram model.MetrolinkTram, departureTime time.Time) string {
+	return pid.AtcoCode + "_" + pid.Line + "_" + tram.Destination + "_" + departureTime.Round(journeyRefRounding).UTC().Format("20060102T1504")
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"github.com/TfGMEnterprise/departures-service/dlog"
+	"github.com/TfGMEnterprise/departures-service/model"
+	"github.com/TfGMEnterprise/departures-service/test_helpers"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/fortytw2/leaktest"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const (
+	metrolinkAPIKey = "abc123"
+	snsTopicArn     = "arn:aws:sns:mars-north-8:123456789012:metrolink-departures"
+)
+
+var now = time.Date(2019, 7, 30, 14, 12, 40, 0, time.UTC)
+
+type MockSNSClient struct {
+	snsiface.SNSAPI
+	Messages []string
+	Err      error
+}
+
+func (ms *MockSNSClient) Publish(input *sns.PublishInput) (*sns.PublishOutput, error) {
+	if ms.Err != nil {
+		return nil, ms.Err
+	}
+
+	ms.Messages = append(ms.Messages, *input.Message)
+
+	return &sns.PublishOutput{MessageId: aws.String("ABC-123")}, nil
+}
+
+// createMetrolinkStub serves the fixtures in turn for each request, serving
+// the last fixture once the others have been served
+func createMetrolinkStub(t *testing.T, statusCode int, fixtures ...string) *httptest.Server {
+	t.Helper()
+
+	requests := 0
+
+	metrolinkHandler := func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Ocp-Apim-Subscription-Key") != metrolinkAPIKey {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		fixture := fixtures[len(fixtures)-1]
+		if requests < len(fixtures) {
+			fixture = fixtures[requests]
+		}
+		requests++
+
+		feed, err := ioutil.ReadFile(fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		if _, err := w.Write(feed); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return httptest.NewServer(http.HandlerFunc(metrolinkHandler))
+}
+
+func TestMetrolinkPoller_Handler(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	logger := dlog.NewLogger([]dlog.LoggerOption{
+		dlog.LoggerSetOutput(ioutil.Discard),
+	}...)
+
+	t.Run("publishes the departures for each platform", func(t *testing.T) {
+		metrolinkStub := createMetrolinkStub(t, http.StatusOK, "../test_resources/MetrolinkDepartures.json")
+		defer metrolinkStub.Close()
+
+		mockedSNSClient := &MockSNSClient{}
+
+		mp := MetrolinkPoller{
+			Logger:          logger,
+			Client:          metrolinkStub.Client(),
+			MetrolinkURL:    metrolinkStub.URL,
+			MetrolinkAPIKey: metrolinkAPIKey,
+			SNSClient:       mockedSNSClient,
+			SNSTopicARN:     aws.String(snsTopicArn),
+			Clock:           func() time.Time { return now },
+		}
+
+		if err := mp.Handler(); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(mockedSNSClient.Messages) != 3 {
+			t.Fatalf("got %d messages, want %d", len(mockedSNSClient.Messages), 3)
+		}
+
+		envelope := `"schemaVersion":1,"producer":"metrolink-poller","sourceFeed":"tfgm-metrolink","generatedAt":"2019-07-30T14:12:40Z"`
+		snapshot := `"snapshot":{"from":"2019-07-30T14:12:40Z","until":"2019-07-31T14:12:40Z"}`
+
+		test_helpers.AssertString(t, mockedSNSClient.Messages[0], `{`+envelope+`,"location":"9400ZZMAALT1",`+snapshot+`,"departures":null}`)
+
+		test_helpers.AssertString(t, mockedSNSClient.Messages[1], `{`+envelope+`,"location":"9400ZZMAMCU1",`+snapshot+`,"departures":[`+
+			`{"recordedAtTime":"2019-07-30T14:12:37Z","journeyType":"tram","journeyRef":"9400ZZMAMCU1_Eccles_Eccles_20190730T1415","aimedDepartureTime":"2019-07-30T14:12:37Z","expectedDepartureTime":"2019-07-30T14:12:37Z","departureStatus":"Departing","locationAtcocode":"9400ZZMAMCU1","destination":"Eccles","serviceNumber":"Metrolink"}`+
+			`]}`)
+
+		test_helpers.AssertString(t, mockedSNSClient.Messages[2], `{`+envelope+`,"location":"9400ZZMAMCU2",`+snapshot+`,"departures":[`+
+			`{"recordedAtTime":"2019-07-30T14:12:37Z","journeyType":"tram","journeyRef":"9400ZZMAMCU2_Eccles_Piccadilly_20190730T1415","aimedDepartureTime":"2019-07-30T14:15:37Z","expectedDepartureTime":"2019-07-30T14:15:37Z","departureStatus":"Due","locationAtcocode":"9400ZZMAMCU2","destination":"Piccadilly","serviceNumber":"Metrolink"},`+
+			`{"recordedAtTime":"2019-07-30T14:12:37Z","journeyType":"tram","journeyRef":"9400ZZMAMCU2_Eccles_Etihad Campus_20190730T1425","aimedDepartureTime":"2019-07-30T14:23:37Z","expectedDepartureTime":"2019-07-30T14:23:37Z","departureStatus":"Due","locationAtcocode":"9400ZZMAMCU2","destination":"Etihad Campus","serviceNumber":"Metrolink"},`+
+			`{"recordedAtTime":"2019-07-30T14:12:37Z","journeyType":"tram","journeyRef":"9400ZZMAMCU2_Eccles_Piccadilly_20190730T1430","aimedDepartureTime":"2019-07-30T14:27:37Z","expectedDepartureTime":"2019-07-30T14:27:37Z","departureStatus":"Due","locationAtcocode":"9400ZZMAMCU2","destination":"Piccadilly","serviceNumber":"Metrolink"}`+
+			`]}`)
+	})
+
+	t.Run("publishes a snapshot of each platform when it shows fewer trams", func(t *testing.T) {
+		metrolinkStub := createMetrolinkStub(t, http.StatusOK, "../test_resources/MetrolinkDepartures.json", "../test_resources/MetrolinkDeparturesLater.json")
+		defer metrolinkStub.Close()
+
+		mockedSNSClient := &MockSNSClient{}
+
+		pollTime := now
+
+		mp := MetrolinkPoller{
+			Logger:          logger,
+			Client:          metrolinkStub.Client(),
+			MetrolinkURL:    metrolinkStub.URL,
+			MetrolinkAPIKey: metrolinkAPIKey,
+			SNSClient:       mockedSNSClient,
+			SNSTopicARN:     aws.String(snsTopicArn),
+			Clock:           func() time.Time { return pollTime },
+		}
+
+		if err := mp.Handler(); err != nil {
+			t.Fatal(err)
+		}
+
+		pollTime = test_helpers.AdjustTime(now, "2m")
+		mockedSNSClient.Messages = nil
+
+		if err := mp.Handler(); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(mockedSNSClient.Messages) != 3 {
+			t.Fatalf("got %d messages, want %d", len(mockedSNSClient.Messages), 3)
+		}
+
+		envelope := `"schemaVersion":1,"producer":"metrolink-poller","sourceFeed":"tfgm-metrolink","generatedAt":"2019-07-30T14:14:40Z"`
+		snapshot := `"snapshot":{"from":"2019-07-30T14:14:40Z","until":"2019-07-31T14:14:40Z"}`
+
+		// A platform with no trams left is still published, so that the
+		// trams cached for it are removed
+		test_helpers.AssertString(t, mockedSNSClient.Messages[1], `{`+envelope+`,"location":"9400ZZMAMCU1",`+snapshot+`,"departures":null}`)
+
+		// The tram shown in the third position on the first poll is not listed,
+		// so the snapshot removes it rather than leaving it cached alongside
+		// the trams that have moved up the display, which keep their journeyRef
+		test_helpers.AssertString(t, mockedSNSClient.Messages[2], `{`+envelope+`,"location":"9400ZZMAMCU2",`+snapshot+`,"departures":[`+
+			`{"recordedAtTime":"2019-07-30T14:14:37Z","journeyType":"tram","journeyRef":"9400ZZMAMCU2_Eccles_Piccadilly_20190730T1415","aimedDepartureTime":"2019-07-30T14:15:37Z","expectedDepartureTime":"2019-07-30T14:15:37Z","departureStatus":"Due","locationAtcocode":"9400ZZMAMCU2","destination":"Piccadilly","serviceNumber":"Metrolink"},`+
+			`{"recordedAtTime":"2019-07-30T14:14:37Z","journeyType":"tram","journeyRef":"9400ZZMAMCU2_Eccles_Piccadilly_20190730T1430","aimedDepartureTime":"2019-07-30T14:27:37Z","expectedDepartureTime":"2019-07-30T14:27:37Z","departureStatus":"Due","locationAtcocode":"9400ZZMAMCU2","destination":"Piccadilly","serviceNumber":"Metrolink"}`+
+			`]}`)
+	})
+
+	t.Run("returns an error if the feed cannot be requested", func(t *testing.T) {
+		metrolinkStub := createMetrolinkStub(t, http.StatusInternalServerError, "../test_resources/MetrolinkDepartures.json")
+		defer metrolinkStub.Close()
+
+		mockedSNSClient := &MockSNSClient{}
+
+		mp := MetrolinkPoller{
+			Logger:          logger,
+			Client:          metrolinkStub.Client(),
+			MetrolinkURL:    metrolinkStub.URL,
+			MetrolinkAPIKey: metrolinkAPIKey,
+			SNSClient:       mockedSNSClient,
+			SNSTopicARN:     aws.String(snsTopicArn),
+		}
+
+		if err := mp.Handler(); err == nil {
+			t.Error("Should return an error!")
+		}
+
+		if len(mockedSNSClient.Messages) != 0 {
+			t.Errorf("got %d messages, want %d", len(mockedSNSClient.Messages), 0)
+		}
+	})
+
+	t.Run("returns an error if a message cannot be published", func(t *testing.T) {
+		metrolinkStub := createMetrolinkStub(t, http.StatusOK, "../test_resources/MetrolinkDepartures.json")
+		defer metrolinkStub.Close()
+
+		mp := MetrolinkPoller{
+			Logger:          logger,
+			Client:          metrolinkStub.Client(),
+			MetrolinkURL:    metrolinkStub.URL,
+			MetrolinkAPIKey: metrolinkAPIKey,
+			SNSClient:       &MockSNSClient{Err: errors.New("SNS is unavailable")},
+			SNSTopicARN:     aws.String(snsTopicArn),
+		}
+
+		if err := mp.Handler(); err == nil {
+			t.Error("Should return an error!")
+		}
+	})
+}
+
+func TestMetrolinkPoller_transform(t *testing.T) {
+	logger := dlog.NewLogger([]dlog.LoggerOption{
+		dlog.LoggerSetOutput(ioutil.Discard),
+	}...)
+
+	mp := MetrolinkPoller{
+		Logger: logger,
+	}
+
+	t.Run("keeps trams due close together to the same destination distinct", func(t *testing.T) {
+		feed := &model.MetrolinkDepartures{
+			Value: []model.MetrolinkPID{
+				{
+					Line:        "Eccles",
+					AtcoCode:    "9400ZZMAMCU2",
+					Dest0:       "Piccadilly",
+					Wait0:       "2",
+					Dest1:       "Piccadilly",
+					Wait1:       "3",
+					LastUpdated: test_helpers.ParseTime(t, "2019-07-30T14:12:37Z"),
+				},
+			},
+		}
+
+		departures := mp.transform(feed)["9400ZZMAMCU2"].Departures
+
+		if len(departures) != 2 {
+			t.Fatalf("got %d departures, want %d", len(departures), 2)
+		}
+
+		test_helpers.AssertString(t, departures[0].JourneyRef, "9400ZZMAMCU2_Eccles_Piccadilly_20190730T1415")
+		test_helpers.AssertString(t, departures[1].JourneyRef, "9400ZZMAMCU2_Eccles_Piccadilly_20190730T1415_1")
+	})
+}
@@ -0,0 +1,97 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// BoardType identifies whether a board lists the departures from a location
+// or the arrivals at it
+type BoardType string
+
+const (
+	DeparturesBoard BoardType = "departures"
+	ArrivalsBoard   BoardType = "arrivals"
+)
+
+// ArrivalsKeyPrefix is prepended to the ATCO code of a location to form the
+// key of its arrivals in the departures cache; departures are stored under
+// the ATCO code alone
+const ArrivalsKeyPrefix = "arrivals:"
+
+// ParseBoardType reads a board type, which is the departures board if value
+// is empty
+func ParseBoardType(value string) (BoardType, error) {
+	switch BoardType(value) {
+	case "", DeparturesBoard:
+		return DeparturesBoard, nil
+	case ArrivalsBoard:
+		return ArrivalsBoard, nil
+	}
+
+	return "", fmt.Errorf("board type `%s` is not recognised", value)
+}
+
+// Key returns the key of the board for the location in the departures cache
+func (b BoardType) Key(locationAtcocode string) string {
+	if b == ArrivalsBoard {
+		return ArrivalsKeyPrefix + locationAtcocode
+	}
+
+	return locationAtcocode
+}
+
+// Includes returns true if the journey is shown on the board
+func (b BoardType) Includes(d Departure) bool {
+	if b == ArrivalsBoard {
+		return d.HasArrival()
+	}
+
+	return d.HasDeparture()
+}
+
+// Filter returns the journeys shown on the board
+func (b BoardType) Filter(departures []Departure) []Departure {
+	var filtered []Departure
+
+	for _, departure := range departures {
+		if b.Includes(departure) {
+			filtered = append(filtered, departure)
+		}
+	}
+
+	return filtered
+}
+
+// View returns the journey as shown on the board; the arrivals board shows the
+// arrival time and status in place of the departure time and status
+func (b BoardType) View(d Departure) Departure {
+	if b == ArrivalsBoard {
+		return d.AsArrival()
+	}
+
+	return d
+}
+
+// IsExpired returns true if the time the journey is shown at on the board has
+// passed
+func (b BoardType) IsExpired(d Departure, now time.Time) bool {
+	return b.View(d).IsExpired(now)
+}
+
+// IsExpiredAfter returns true if the journey has expired on the board, keeping
+// cancelled journeys for the period after their aimed time
+func (b BoardType) IsExpiredAfter(d Departure, now time.Time, cancelledPeriod time.Duration) bool {
+	return b.View(d).IsExpiredAfter(now, cancelledPeriod)
+}
+
+// Sort orders the journeys by the time they are shown at on the board
+func (b BoardType) Sort(departures []Departure) {
+	if b == ArrivalsBoard {
+		sort.Sort(ByArrivalTime(departures))
+		return
+	}
+
+	sort.Sort(ByDepartureTime(departures))
+}
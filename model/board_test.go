@@ -0,0 +1,73 @@
+package model
+
+import (
+	"github.com/TfGMEnterprise/departures-service/test_helpers"
+	"testing"
+)
+
+func TestParseBoardType(t *testing.T) {
+	tests := map[string]BoardType{
+		"":           DeparturesBoard,
+		"departures": DeparturesBoard,
+		"arrivals":   ArrivalsBoard,
+	}
+
+	for value, want := range tests {
+		got, err := ParseBoardType(value)
+		if err != nil {
+			t.Errorf("got error `%v` for `%s`", err, value)
+			continue
+		}
+
+		test_helpers.AssertString(t, string(got), string(want))
+	}
+
+	if _, err := ParseBoardType("connections"); err == nil {
+		t.Error("expected an error for an unrecognised board type")
+	}
+}
+
+func TestBoardType_Key(t *testing.T) {
+	test_helpers.AssertString(t, DeparturesBoard.Key("1800BNIN0C1"), "1800BNIN0C1")
+	test_helpers.AssertString(t, ArrivalsBoard.Key("1800BNIN0C1"), "arrivals:1800BNIN0C1")
+}
+
+func TestBoardType_Filter(t *testing.T) {
+	departures := []Departure{
+		{JourneyRef: "departs", AimedDepartureTime: test_helpers.ParseTime(t, "2019-07-18T14:26:00+01:00")},
+		{JourneyRef: "arrives", AimedArrivalTime: test_helpers.ParseTime(t, "2019-07-18T14:20:00+01:00")},
+		{JourneyRef: "calls", AimedArrivalTime: test_helpers.ParseTime(t, "2019-07-18T14:24:00+01:00"), AimedDepartureTime: test_helpers.ParseTime(t, "2019-07-18T14:25:00+01:00")},
+	}
+
+	assertRefs := func(t *testing.T, got []Departure, want ...string) {
+		t.Helper()
+
+		if len(got) != len(want) {
+			t.Fatalf("got %d journeys, want %d", len(got), len(want))
+		}
+
+		for i, ref := range want {
+			test_helpers.AssertString(t, got[i].JourneyRef, ref)
+		}
+	}
+
+	assertRefs(t, DeparturesBoard.Filter(departures), "departs", "calls")
+	assertRefs(t, ArrivalsBoard.Filter(departures), "arrives", "calls")
+
+	sorted := ArrivalsBoard.Filter(departures)
+	ArrivalsBoard.Sort(sorted)
+	assertRefs(t, sorted, "arrives", "calls")
+}
+
+func TestBoardType_IsExpired(t *testing.T) {
+	now := test_helpers.ParseTime(t, "2019-07-18T14:23:00+01:00")
+
+	dep := Departure{
+		JourneyRef:         "calls",
+		AimedArrivalTime:   test_helpers.ParseTime(t, "2019-07-18T14:22:00+01:00"),
+		AimedDepartureTime: test_helpers.ParseTime(t, "2019-07-18T14:25:00+01:00"),
+	}
+
+	test_helpers.AssertBoolean(t, ArrivalsBoard.IsExpired(dep, now), true)
+	test_helpers.AssertBoolean(t, DeparturesBoard.IsExpired(dep, now), false)
+}
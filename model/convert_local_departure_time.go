@@ -8,14 +8,77 @@ import (
 	"time"
 )
 
+// AmbiguousTimePolicy chooses between the two instants a local clock time
+// refers to when the clocks go back
+type AmbiguousTimePolicy int
+
+const (
+	// PreferNearest chooses the instant nearest to now; if both are equally
+	// near, the earlier is chosen
+	PreferNearest AmbiguousTimePolicy = iota
+	// PreferEarlier chooses the earlier instant, before the clocks go back
+	PreferEarlier
+	// PreferLater chooses the later instant, after the clocks go back
+	PreferLater
+)
+
+// NonExistentTimePolicy decides how to treat a local clock time skipped when
+// the clocks go forward
+type NonExistentTimePolicy int
+
+const (
+	// ShiftForward moves the time forward by the length of the gap, so 01:30
+	// becomes 02:30 when the clocks go forward at 01:00
+	ShiftForward NonExistentTimePolicy = iota
+	// RejectNonExistent returns an error
+	RejectNonExistent
+)
+
+// DepartureTimeWindow bounds how far before and after now a local clock time
+// may be, and how times around a daylight saving change are treated. Past and
+// Future must together be less than 24 hours so that each clock time refers to
+// at most one day.
+type DepartureTimeWindow struct {
+	Past        time.Duration
+	Future      time.Duration
+	Ambiguous   AmbiguousTimePolicy
+	NonExistent NonExistentTimePolicy
+}
+
+// DefaultDepartureTimeWindow accepts times up to two hours either side of now,
+// which covers the departures National Rail provides by default
+var DefaultDepartureTimeWindow = DepartureTimeWindow{
+	Past:   2 * time.Hour,
+	Future: 2 * time.Hour,
+}
+
+var localTimeRegexp = regexp.MustCompile("^[0-9]{2}:[0-9]{2}$")
+
+// ConvertDepartureTime converts a local HH:MM clock time to the instant within
+// the default window around now
 func ConvertDepartureTime(now *time.Time, localLocation *time.Location, localTime string) (*time.Time, error) {
 	if now == nil {
 		return nil, errors.New("now must be set")
 	}
 
-	re := regexp.MustCompile("^[0-9]{2}:[0-9]{2}$")
-	if !re.MatchString(localTime) {
-		return nil, errors.New("timeType must be set")
+	return ConvertDepartureTimeWithin(*now, localLocation, localTime, DefaultDepartureTimeWindow)
+}
+
+// ConvertDepartureTimeWithin converts a local HH:MM clock time to the instant
+// within the window around now. The clock time may fall on the previous,
+// current or following day. An error is returned if no instant with the clock
+// time falls within the window.
+func ConvertDepartureTimeWithin(now time.Time, localLocation *time.Location, localTime string, window DepartureTimeWindow) (*time.Time, error) {
+	if localLocation == nil {
+		return nil, errors.New("localLocation must be set")
+	}
+
+	if window.Past < 0 || window.Future < 0 || window.Past+window.Future >= 24*time.Hour {
+		return nil, errors.Errorf("departure time window of %s before and %s after now is invalid", window.Past, window.Future)
+	}
+
+	if !localTimeRegexp.MatchString(localTime) {
+		return nil, errors.Errorf("departure time `%s` is not in HH:MM format", localTime)
 	}
 
 	hm := strings.Split(localTime, ":")
@@ -29,29 +92,127 @@ func ConvertDepartureTime(now *time.Time, localLocation *time.Location, localTim
 		return nil, errors.Wrap(err, "could not parse mins from departure time")
 	}
 
-	// National rail provides departures up to two hours into the future.
-	// We initially assume that the departure is for the current day
-	departingToday := time.Date(now.Year(), now.Month(), now.Day(), hours, mins, 0, 0, localLocation)
+	if hours > 23 || mins > 59 {
+		return nil, errors.Errorf("departure time `%s` is not a valid clock time", localTime)
+	}
+
+	earliest := now.Add(-window.Past)
+	latest := now.Add(window.Future)
+
+	// The window is less than a day long, so only the days either side of the
+	// local date of now need to be considered
+	localNow := now.In(localLocation)
+
+	var candidates []time.Time
+
+	for day := -1; day <= 1; day++ {
+		instants, exists := resolveLocalTime(localNow.Year(), localNow.Month(), localNow.Day()+day, hours, mins, localLocation)
+
+		if len(instants) == 2 {
+			instants = chooseAmbiguousInstant(instants, window.Ambiguous)
+		}
+
+		for _, instant := range instants {
+			if instant.Before(earliest) || instant.After(latest) {
+				continue
+			}
+
+			if !exists && window.NonExistent == RejectNonExistent {
+				return nil, errors.Errorf("departure time `%s` does not exist on %s in %s", localTime, instant.Format("2006-01-02"), localLocation)
+			}
+
+			candidates = append(candidates, instant)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil, errors.Errorf("departure time `%s` is not between %s and %s", localTime, earliest.In(localLocation).Format(time.RFC3339), latest.In(localLocation).Format(time.RFC3339))
+	}
+
+	departureTime := nearestInstant(now, candidates)
+	return &departureTime, nil
+}
+
+// resolveLocalTime returns the instants at which the local clock shows the
+// time on the date: two if the time was repeated when the clocks went back,
+// and one otherwise. If the time was skipped when the clocks went forward, it
+// is moved forward by the length of the gap and exists is false.
+func resolveLocalTime(year int, month time.Month, day int, hours int, mins int, localLocation *time.Location) (instants []time.Time, exists bool) {
+	wall := time.Date(year, month, day, hours, mins, 0, 0, time.UTC)
 
-	// If subtracting the departure time based on today's date from the
-	// current time results in a departure that is more than two hours in the
-	// future, it is very likely that the departure is for the following day.
+	// A location changes its offset at most once within a day, so the offsets
+	// half a day either side of the clock time are the only ones it can have
+	_, offsetBefore := wall.Add(-12 * time.Hour).In(localLocation).Zone()
+	_, offsetAfter := wall.Add(12 * time.Hour).In(localLocation).Zone()
 
-	if now.Sub(departingToday) > 2*time.Hour {
-		// We create a new time here rather than adding a duration to prevent
-		// issues that may arise with daylight savings time changes.
-		departingTomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, hours, mins, 0, 0, localLocation)
-		return &departingTomorrow, nil
+	for _, offset := range []int{offsetBefore, offsetAfter} {
+		instant := wall.Add(-time.Duration(offset) * time.Second).In(localLocation)
+		if !sameClockTime(instant, wall) {
+			continue
+		}
+
+		if len(instants) == 1 && instants[0].Equal(instant) {
+			continue
+		}
+
+		instants = append(instants, instant)
+	}
+
+	if len(instants) > 0 {
+		return instants, true
 	}
 
-	// Similarly, if subtracting the current time from the departure time based
-	// on today's date results in a duration that is more than two hours into
-	// the future, it is very likely that the departure is for the previous day.
-	if departingToday.Sub(*now) > 2*time.Hour {
-		// Again, look out for daylight savings time changes.
-		departingYesterday := time.Date(now.Year(), now.Month(), now.Day()-1, hours, mins, 0, 0, localLocation)
-		return &departingYesterday, nil
+	// Read the clock time with the offset in force before the clocks went
+	// forward, which moves it forward by the length of the gap
+	return []time.Time{wall.Add(-time.Duration(offsetBefore) * time.Second).In(localLocation)}, false
+}
+
+// chooseAmbiguousInstant chooses one of the two instants for a repeated clock
+// time using the policy. The nearest policy keeps both, so that the nearer of
+// those within the window is chosen with the candidates from other days.
+func chooseAmbiguousInstant(instants []time.Time, policy AmbiguousTimePolicy) []time.Time {
+	earlier, later := instants[0], instants[1]
+	if later.Before(earlier) {
+		earlier, later = later, earlier
+	}
+
+	switch policy {
+	case PreferEarlier:
+		return []time.Time{earlier}
+	case PreferLater:
+		return []time.Time{later}
+	default:
+		return instants
+	}
+}
+
+// nearestInstant returns the instant nearest to now, or the earliest of
+// equally near instants
+func nearestInstant(now time.Time, instants []time.Time) time.Time {
+	nearest := instants[0]
+
+	for _, instant := range instants[1:] {
+		distance, nearestDistance := absDuration(instant.Sub(now)), absDuration(nearest.Sub(now))
+		if distance < nearestDistance || (distance == nearestDistance && instant.Before(nearest)) {
+			nearest = instant
+		}
+	}
+
+	return nearest
+}
+
+func sameClockTime(instant time.Time, wall time.Time) bool {
+	return instant.Year() == wall.Year() &&
+		instant.Month() == wall.Month() &&
+		instant.Day() == wall.Day() &&
+		instant.Hour() == wall.Hour() &&
+		instant.Minute() == wall.Minute()
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
 	}
 
-	return &departingToday, nil
+	return d
 }
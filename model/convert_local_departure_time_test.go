@@ -81,3 +81,198 @@ func TestConvertDepartureTime(t *testing.T) {
 		}
 	})
 }
+
+func TestConvertDepartureTimeWithin(t *testing.T) {
+	localLocation, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		now       time.Time
+		localTime string
+		window    DepartureTimeWindow
+		want      time.Time
+	}{
+		{
+			name:      "departure beyond two hours in a long window",
+			now:       time.Date(2026, 7, 1, 11, 0, 0, 0, time.UTC),
+			localTime: "22:30",
+			window:    DepartureTimeWindow{Past: time.Hour, Future: 12 * time.Hour},
+			want:      time.Date(2026, 7, 1, 21, 30, 0, 0, time.UTC),
+		},
+		{
+			name:      "local date differs from UTC date",
+			now:       time.Date(2026, 7, 1, 23, 30, 0, 0, time.UTC),
+			localTime: "01:00",
+			window:    DefaultDepartureTimeWindow,
+			want:      time.Date(2026, 7, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "non-existent time is shifted forward",
+			now:       time.Date(2026, 3, 29, 0, 50, 0, 0, time.UTC),
+			localTime: "01:30",
+			window:    DefaultDepartureTimeWindow,
+			want:      time.Date(2026, 3, 29, 1, 30, 0, 0, time.UTC),
+		},
+		{
+			name:      "ambiguous time prefers the nearest",
+			now:       time.Date(2026, 10, 25, 0, 45, 0, 0, time.UTC),
+			localTime: "01:30",
+			window:    DefaultDepartureTimeWindow,
+			want:      time.Date(2026, 10, 25, 0, 30, 0, 0, time.UTC),
+		},
+		{
+			name:      "ambiguous time prefers the later",
+			now:       time.Date(2026, 10, 25, 0, 45, 0, 0, time.UTC),
+			localTime: "01:30",
+			window:    DepartureTimeWindow{Past: 2 * time.Hour, Future: 2 * time.Hour, Ambiguous: PreferLater},
+			want:      time.Date(2026, 10, 25, 1, 30, 0, 0, time.UTC),
+		},
+		{
+			name:      "ambiguous time prefers the earlier",
+			now:       time.Date(2026, 10, 25, 1, 15, 0, 0, time.UTC),
+			localTime: "01:30",
+			window:    DepartureTimeWindow{Past: 2 * time.Hour, Future: 2 * time.Hour, Ambiguous: PreferEarlier},
+			want:      time.Date(2026, 10, 25, 0, 30, 0, 0, time.UTC),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ConvertDepartureTimeWithin(test.now, localLocation, test.localTime, test.window)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !got.Equal(test.want) {
+				t.Errorf("got %s, want %s", got.Format(time.RFC3339), test.want.Format(time.RFC3339))
+			}
+		})
+	}
+
+	t.Run("rejects a non-existent time", func(t *testing.T) {
+		window := DepartureTimeWindow{Past: 2 * time.Hour, Future: 2 * time.Hour, NonExistent: RejectNonExistent}
+
+		if _, err := ConvertDepartureTimeWithin(time.Date(2026, 3, 29, 0, 50, 0, 0, time.UTC), localLocation, "01:30", window); err == nil {
+			t.Error("Should return an error!")
+		}
+	})
+
+	t.Run("returns an error outside the window", func(t *testing.T) {
+		if _, err := ConvertDepartureTimeWithin(time.Date(2026, 7, 1, 11, 0, 0, 0, time.UTC), localLocation, "16:00", DefaultDepartureTimeWindow); err == nil {
+			t.Error("Should return an error!")
+		}
+	})
+
+	t.Run("returns an error for a window of a day or more", func(t *testing.T) {
+		window := DepartureTimeWindow{Past: 12 * time.Hour, Future: 12 * time.Hour}
+
+		if _, err := ConvertDepartureTimeWithin(time.Date(2026, 7, 1, 11, 0, 0, 0, time.UTC), localLocation, "12:00", window); err == nil {
+			t.Error("Should return an error!")
+		}
+	})
+
+	t.Run("returns an error for an invalid clock time", func(t *testing.T) {
+		if _, err := ConvertDepartureTimeWithin(time.Date(2026, 7, 1, 11, 0, 0, 0, time.UTC), localLocation, "24:10", DefaultDepartureTimeWindow); err == nil {
+			t.Error("Should return an error!")
+		}
+	})
+}
+
+// TestConvertDepartureTimeWithin_transitions checks every clock time against
+// every five minutes of the nights the clocks change in 2026. The expected
+// instant is found by walking each minute of the window and reading the local
+// clock.
+func TestConvertDepartureTimeWithin_transitions(t *testing.T) {
+	localLocation, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The clocks go forward at 01:00 GMT on 29 March 2026, so 01:00 to 01:59 do
+	// not exist; they go back at 01:00 GMT on 25 October 2026, so 01:00 to 01:59
+	// happen twice
+	springForward := time.Date(2026, 3, 29, 1, 0, 0, 0, time.UTC)
+	fallBack := time.Date(2026, 10, 25, 1, 0, 0, 0, time.UTC)
+
+	windows := map[string]DepartureTimeWindow{
+		"default":        DefaultDepartureTimeWindow,
+		"long":           {Past: time.Hour, Future: 12 * time.Hour},
+		"prefer earlier": {Past: 2 * time.Hour, Future: 2 * time.Hour, Ambiguous: PreferEarlier},
+		"prefer later":   {Past: 2 * time.Hour, Future: 2 * time.Hour, Ambiguous: PreferLater},
+		"reject":         {Past: 2 * time.Hour, Future: 2 * time.Hour, NonExistent: RejectNonExistent},
+	}
+
+	for name, window := range windows {
+		for _, transition := range []time.Time{springForward, fallBack} {
+			t.Run(name+" "+transition.Format("2006-01-02"), func(t *testing.T) {
+				for now := transition.Add(-4 * time.Hour); !now.After(transition.Add(4 * time.Hour)); now = now.Add(5 * time.Minute) {
+					checkEveryClockTime(t, localLocation, now, window, springForward, fallBack)
+				}
+			})
+		}
+	}
+}
+
+func checkEveryClockTime(t *testing.T, localLocation *time.Location, now time.Time, window DepartureTimeWindow, springForward time.Time, fallBack time.Time) {
+	t.Helper()
+
+	// Find every instant in the window, keyed by the local clock time, leaving
+	// out the instant the policy does not choose for a repeated clock time
+	instants := make(map[string][]time.Time)
+
+	for instant := now.Add(-window.Past); !instant.After(now.Add(window.Future)); instant = instant.Add(time.Minute) {
+		repeatedEarlier := !instant.Before(fallBack.Add(-time.Hour)) && instant.Before(fallBack)
+		repeatedLater := !instant.Before(fallBack) && instant.Before(fallBack.Add(time.Hour))
+
+		if (window.Ambiguous == PreferEarlier && repeatedLater) || (window.Ambiguous == PreferLater && repeatedEarlier) {
+			continue
+		}
+
+		clockTime := instant.In(localLocation).Format("15:04")
+		instants[clockTime] = append(instants[clockTime], instant)
+	}
+
+	for minute := 0; minute < 24*60; minute++ {
+		hours, mins := minute/60, minute%60
+		clockTime := time.Date(2000, 1, 1, hours, mins, 0, 0, time.UTC).Format("15:04")
+
+		got, err := ConvertDepartureTimeWithin(now, localLocation, clockTime, window)
+
+		var want *time.Time
+		if candidates, ok := instants[clockTime]; ok {
+			nearest := nearestInstant(now, candidates)
+			want = &nearest
+		} else if hours == 1 {
+			// A skipped clock time is read with the offset before the clocks
+			// went forward
+			shifted := springForward.Add(time.Duration(mins) * time.Minute)
+			if !shifted.Before(now.Add(-window.Past)) && !shifted.After(now.Add(window.Future)) {
+				if window.NonExistent == RejectNonExistent {
+					if err == nil {
+						t.Fatalf("now %s, %s: got %s, want an error", now.Format(time.RFC3339), clockTime, got.Format(time.RFC3339))
+					}
+					continue
+				}
+				want = &shifted
+			}
+		}
+
+		if want == nil {
+			if err == nil {
+				t.Fatalf("now %s, %s: got %s, want an error", now.Format(time.RFC3339), clockTime, got.Format(time.RFC3339))
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("now %s, %s: %v", now.Format(time.RFC3339), clockTime, err)
+		}
+
+		if !got.Equal(*want) {
+			t.Fatalf("now %s, %s: got %s, want %s", now.Format(time.RFC3339), clockTime, got.Format(time.RFC3339), want.Format(time.RFC3339))
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// departureJSON is the wire format for a Departure, with timestamps held as
+// RFC3339 strings so that cached records written before the timestamps were
+// typed still decode
+type departureJSON struct {
+	RecordedAtTime        string      `json:"recordedAtTime,omitempty"`
+	JourneyType           JourneyType `json:"journeyType,omitempty"`
+	JourneyRef            string      `json:"journeyRef,omitempty"`
+	AimedDepartureTime    string      `json:"aimedDepartureTime,omitempty"`
+	ExpectedDepartureTime *string     `json:"expectedDepartureTime,omitempty"`
+	DepartureStatus       *string     `json:"departureStatus,omitempty"`
+	AimedArrivalTime      string      `json:"aimedArrivalTime,omitempty"`
+	ExpectedArrivalTime   *string     `json:"expectedArrivalTime,omitempty"`
+	ArrivalStatus         *string     `json:"arrivalStatus,omitempty"`
+	LocationAtcocode      string      `json:"locationAtcocode,omitempty"`
+	Stand                 *string     `json:"stand,omitempty"`
+	OriginAtcocode        string      `json:"originAtcocode,omitempty"`
+	Origin                string      `json:"origin,omitempty"`
+	DestinationAtcocode   string      `json:"destinationAtcocode,omitempty"`
+	Destination           string      `json:"destination,omitempty"`
+	ServiceNumber         string      `json:"serviceNumber,omitempty"`
+	OperatorCode          string      `json:"operatorCode,omitempty"`
+}
+
+func (d Departure) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.toJSON())
+}
+
+func (d Departure) toJSON() departureJSON {
+	dj := departureJSON{
+		RecordedAtTime:      formatTimestamp(d.RecordedAtTime),
+		JourneyType:         d.JourneyType,
+		JourneyRef:          d.JourneyRef,
+		AimedDepartureTime:  formatTimestamp(d.AimedDepartureTime),
+		DepartureStatus:     d.DepartureStatus,
+		AimedArrivalTime:    formatTimestamp(d.AimedArrivalTime),
+		ArrivalStatus:       d.ArrivalStatus,
+		LocationAtcocode:    d.LocationAtcocode,
+		Stand:               d.Stand,
+		OriginAtcocode:      d.OriginAtcocode,
+		Origin:              d.Origin,
+		DestinationAtcocode: d.DestinationAtcocode,
+		Destination:         d.Destination,
+		ServiceNumber:       d.ServiceNumber,
+		OperatorCode:        d.OperatorCode,
+	}
+
+	if d.ExpectedDepartureTime != nil {
+		expectedDepartureTime := formatTimestamp(*d.ExpectedDepartureTime)
+		dj.ExpectedDepartureTime = &expectedDepartureTime
+	}
+
+	if d.ExpectedArrivalTime != nil {
+		expectedArrivalTime := formatTimestamp(*d.ExpectedArrivalTime)
+		dj.ExpectedArrivalTime = &expectedArrivalTime
+	}
+
+	return dj
+}
+
+// UnmarshalJSON decodes a departure, returning a *ValidationError listing every
+// timestamp that is not RFC3339. The remaining fields are still decoded so that
+// the departure can be identified.
+func (d *Departure) UnmarshalJSON(data []byte) error {
+	dj := departureJSON{}
+	if err := json.Unmarshal(data, &dj); err != nil {
+		return err
+	}
+
+	*d = Departure{
+		JourneyType:         dj.JourneyType,
+		JourneyRef:          dj.JourneyRef,
+		DepartureStatus:     dj.DepartureStatus,
+		ArrivalStatus:       dj.ArrivalStatus,
+		LocationAtcocode:    dj.LocationAtcocode,
+		Stand:               dj.Stand,
+		OriginAtcocode:      dj.OriginAtcocode,
+		Origin:              dj.Origin,
+		DestinationAtcocode: dj.DestinationAtcocode,
+		Destination:         dj.Destination,
+		ServiceNumber:       dj.ServiceNumber,
+		OperatorCode:        dj.OperatorCode,
+	}
+
+	var problems []string
+	var err error
+
+	if d.RecordedAtTime, err = parseTimestamp(dj.RecordedAtTime); err != nil {
+		problems = append(problems, fmt.Sprintf("recordedAtTime `%s` is not an RFC3339 timestamp", dj.RecordedAtTime))
+	}
+
+	if d.AimedDepartureTime, err = parseTimestamp(dj.AimedDepartureTime); err != nil {
+		problems = append(problems, fmt.Sprintf("aimedDepartureTime `%s` is not an RFC3339 timestamp", dj.AimedDepartureTime))
+	}
+
+	if dj.ExpectedDepartureTime != nil {
+		expectedDepartureTime, err := time.Parse(time.RFC3339, *dj.ExpectedDepartureTime)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("expectedDepartureTime `%s` is not an RFC3339 timestamp", *dj.ExpectedDepartureTime))
+		} else {
+			d.ExpectedDepartureTime = &expectedDepartureTime
+		}
+	}
+
+	if d.AimedArrivalTime, err = parseTimestamp(dj.AimedArrivalTime); err != nil {
+		problems = append(problems, fmt.Sprintf("aimedArrivalTime `%s` is not an RFC3339 timestamp", dj.AimedArrivalTime))
+	}
+
+	if dj.ExpectedArrivalTime != nil {
+		expectedArrivalTime, err := time.Parse(time.RFC3339, *dj.ExpectedArrivalTime)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("expectedArrivalTime `%s` is not an RFC3339 timestamp", *dj.ExpectedArrivalTime))
+		} else {
+			d.ExpectedArrivalTime = &expectedArrivalTime
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{
+			JourneyRef:       d.JourneyRef,
+			LocationAtcocode: d.LocationAtcocode,
+			Problems:         problems,
+		}
+	}
+
+	return nil
+}
+
+// UndecodableDeparturesError lists the departures in an array that could not
+// be decoded; Internal.UnmarshalJSON returns it with the rest decoded
+type UndecodableDeparturesError struct {
+	// Indexes are the positions in the array of the departures skipped
+	Indexes []int
+	// Errors are the reasons for skipping each departure, in the same order
+	Errors []error
+}
+
+func (e *UndecodableDeparturesError) Error() string {
+	reasons := make([]string, len(e.Indexes))
+	for i, index := range e.Indexes {
+		reasons[i] = fmt.Sprintf("departure %d: %v", index, e.Errors[i])
+	}
+
+	return fmt.Sprintf("cannot decode %d departure(s): %s", len(e.Indexes), strings.Join(reasons, "; "))
+}
+
+// UnmarshalJSON decodes each departure separately so that one undecodable
+// departure does not prevent the rest from being read. If any cannot be
+// decoded, the rest are kept and an *UndecodableDeparturesError is returned.
+func (a *Internal) UnmarshalJSON(data []byte) error {
+	internal := struct {
+		Departures []json.RawMessage `json:"departures"`
+	}{}
+
+	if err := json.Unmarshal(data, &internal); err != nil {
+		return err
+	}
+
+	a.Departures = nil
+
+	if internal.Departures != nil {
+		a.Departures = make([]Departure, 0, len(internal.Departures))
+	}
+
+	var undecodable *UndecodableDeparturesError
+
+	for i, rawDeparture := range internal.Departures {
+		departure := Departure{}
+		if err := json.Unmarshal(rawDeparture, &departure); err != nil {
+			if undecodable == nil {
+				undecodable = &UndecodableDeparturesError{}
+			}
+			undecodable.Indexes = append(undecodable.Indexes, i)
+			undecodable.Errors = append(undecodable.Errors, err)
+			continue
+		}
+
+		a.Departures = append(a.Departures, departure)
+	}
+
+	if undecodable != nil {
+		return undecodable
+	}
+
+	return nil
+}
+
+// formatTimestamp formats t as RFC3339, or as an empty string if t is zero so
+// that it is omitted from the output
+func formatTimestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+func parseTimestamp(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
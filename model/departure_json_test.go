@@ -0,0 +1,147 @@
+package model
+
+import (
+	"encoding/json"
+	"github.com/TfGMEnterprise/departures-service/test_helpers"
+	"github.com/aws/aws-sdk-go/aws"
+	"testing"
+)
+
+func TestDeparture_MarshalJSON(t *testing.T) {
+	t.Run("writes timestamps as RFC3339 strings", func(t *testing.T) {
+		dep := Departure{
+			RecordedAtTime:        test_helpers.ParseTime(t, "2019-05-08T23:29:46+01:00"),
+			JourneyType:           Bus,
+			JourneyRef:            "2019-05-08_1234",
+			AimedDepartureTime:    test_helpers.ParseTime(t, "2019-05-08T23:34:00+01:00"),
+			ExpectedDepartureTime: aws.Time(test_helpers.ParseTime(t, "2019-05-08T23:35:24+01:00")),
+			LocationAtcocode:      "1800BNIN0C1",
+			ServiceNumber:         "123",
+		}
+
+		got, err := json.Marshal(dep)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test_helpers.AssertString(t, string(got), `{"recordedAtTime":"2019-05-08T23:29:46+01:00","journeyType":"bus","journeyRef":"2019-05-08_1234","aimedDepartureTime":"2019-05-08T23:34:00+01:00","expectedDepartureTime":"2019-05-08T23:35:24+01:00","locationAtcocode":"1800BNIN0C1","serviceNumber":"123"}`)
+	})
+
+	t.Run("writes arrival times and the origin", func(t *testing.T) {
+		dep := Departure{
+			JourneyType:         Bus,
+			JourneyRef:          "2019-05-08_1234",
+			AimedArrivalTime:    test_helpers.ParseTime(t, "2019-05-08T23:34:00+01:00"),
+			ExpectedArrivalTime: aws.Time(test_helpers.ParseTime(t, "2019-05-08T23:35:24+01:00")),
+			LocationAtcocode:    "1800BNIN0C1",
+			OriginAtcocode:      "1800HN00011",
+			Origin:              "Hobbiton",
+		}
+
+		got, err := json.Marshal(dep)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test_helpers.AssertString(t, string(got), `{"journeyType":"bus","journeyRef":"2019-05-08_1234","aimedArrivalTime":"2019-05-08T23:34:00+01:00","expectedArrivalTime":"2019-05-08T23:35:24+01:00","locationAtcocode":"1800BNIN0C1","originAtcocode":"1800HN00011","origin":"Hobbiton"}`)
+
+		var roundTripped Departure
+		if err := json.Unmarshal(got, &roundTripped); err != nil {
+			t.Fatal(err)
+		}
+
+		if !roundTripped.AimedArrivalTime.Equal(dep.AimedArrivalTime) || roundTripped.ExpectedArrivalTime == nil || !roundTripped.ExpectedArrivalTime.Equal(*dep.ExpectedArrivalTime) {
+			t.Errorf("got arrival times %v and %v, want %v and %v", roundTripped.AimedArrivalTime, roundTripped.ExpectedArrivalTime, dep.AimedArrivalTime, *dep.ExpectedArrivalTime)
+		}
+	})
+
+	t.Run("omits timestamps that are not set", func(t *testing.T) {
+		got, err := json.Marshal(Departure{JourneyRef: "2019-05-08_1234"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test_helpers.AssertString(t, string(got), `{"journeyRef":"2019-05-08_1234"}`)
+	})
+}
+
+func TestDeparture_UnmarshalJSON(t *testing.T) {
+	t.Run("reads a cached record in the existing format", func(t *testing.T) {
+		cached := `{"recordedAtTime":"2019-05-08T23:29:46+01:00","journeyRef":"2019-05-08_1235","aimedDepartureTime":"2019-05-08T23:37:00+01:00","expectedDepartureTime":null,"locationAtcocode":"1800BNIN0D1","serviceNumber":"456"}`
+
+		dep := Departure{}
+		if err := json.Unmarshal([]byte(cached), &dep); err != nil {
+			t.Fatal(err)
+		}
+
+		test_helpers.AssertBoolean(t, dep.RecordedAtTime.Equal(test_helpers.ParseTime(t, "2019-05-08T23:29:46+01:00")), true)
+		test_helpers.AssertBoolean(t, dep.AimedDepartureTime.Equal(test_helpers.ParseTime(t, "2019-05-08T23:37:00+01:00")), true)
+		test_helpers.AssertBoolean(t, dep.ExpectedDepartureTime == nil, true)
+		test_helpers.AssertString(t, dep.ServiceNumber, "456")
+
+		got, err := json.Marshal(dep)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test_helpers.AssertString(t, string(got), `{"recordedAtTime":"2019-05-08T23:29:46+01:00","journeyRef":"2019-05-08_1235","aimedDepartureTime":"2019-05-08T23:37:00+01:00","locationAtcocode":"1800BNIN0D1","serviceNumber":"456"}`)
+	})
+
+	t.Run("reports every timestamp that is not RFC3339", func(t *testing.T) {
+		invalid := `{"recordedAtTime":"yesterday","journeyRef":"2019-05-08_1235","aimedDepartureTime":"14:26","expectedDepartureTime":"","locationAtcocode":"1800BNIN0D1"}`
+
+		dep := Departure{}
+		err := json.Unmarshal([]byte(invalid), &dep)
+
+		validationErr, ok := err.(*ValidationError)
+		if !ok {
+			t.Fatalf("got `%T`, want `%T`", err, &ValidationError{})
+		}
+
+		want := []string{
+			"recordedAtTime `yesterday` is not an RFC3339 timestamp",
+			"aimedDepartureTime `14:26` is not an RFC3339 timestamp",
+			"expectedDepartureTime `` is not an RFC3339 timestamp",
+		}
+
+		if len(validationErr.Problems) != len(want) {
+			t.Fatalf("got %d problems `%v`, want %d", len(validationErr.Problems), validationErr.Problems, len(want))
+		}
+
+		for i, problem := range want {
+			test_helpers.AssertString(t, validationErr.Problems[i], problem)
+		}
+
+		test_helpers.AssertString(t, validationErr.JourneyRef, "2019-05-08_1235")
+	})
+}
+
+func TestInternal_UnmarshalJSON(t *testing.T) {
+	payload := `{"departures":[{"journeyRef":"1","aimedDepartureTime":"2019-05-08T23:37:00+01:00","locationAtcocode":"1800BNIN0D1"},{"journeyRef":"2","aimedDepartureTime":"soon","locationAtcocode":"1800BNIN0D1"},{"journeyRef":3}]}`
+
+	departures := Internal{}
+	err := json.Unmarshal([]byte(payload), &departures)
+
+	undecodable, ok := err.(*UndecodableDeparturesError)
+	if !ok {
+		t.Fatalf("got error %v, want an *UndecodableDeparturesError", err)
+	}
+
+	if len(undecodable.Indexes) != 2 || undecodable.Indexes[0] != 1 || undecodable.Indexes[1] != 2 {
+		t.Errorf("got indexes %v, want %v", undecodable.Indexes, []int{1, 2})
+	}
+
+	if len(undecodable.Errors) != 2 {
+		t.Errorf("got %d errors, want %d", len(undecodable.Errors), 2)
+	}
+
+	if len(departures.Departures) != 1 {
+		t.Fatalf("got %d departures, want %d", len(departures.Departures), 1)
+	}
+
+	test_helpers.AssertString(t, departures.Departures[0].JourneyRef, "1")
+
+	if errs := departures.RemoveInvalidDepartures(); len(errs) != 0 {
+		t.Errorf("got %d validation errors, want %d", len(errs), 0)
+	}
+}
@@ -0,0 +1,148 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// CurrentSchemaVersion is the newest departures schema version this build can
+// read, and the version it writes
+const CurrentSchemaVersion = 1
+
+// legacySchemaVersion is the version given to messages written before the
+// envelope was introduced, which carry no version
+const legacySchemaVersion = 0
+
+// Envelope carries the schema version and provenance of a departures message
+// published to SNS or a departure stored in the departures cache. Its fields are
+// written alongside the fields of the message itself, so readers that predate
+// the envelope ignore them and continue to work.
+type Envelope struct {
+	SchemaVersion int        `json:"schemaVersion"`
+	Producer      string     `json:"producer,omitempty"`
+	SourceFeed    string     `json:"sourceFeed,omitempty"`
+	GeneratedAt   *time.Time `json:"generatedAt,omitempty"`
+	Location      string     `json:"location,omitempty"`
+	// Snapshot is set on messages that list every journey at the location in
+	// a period; it is not set on cached departures
+	Snapshot *Snapshot `json:"snapshot,omitempty"`
+}
+
+// Snapshot marks a departures message as complete for the stops it covers
+// from From until Until: a journey at one of those stops in that period that
+// is missing from the message no longer calls there. The stops covered are the
+// location of the envelope and, if it is a stop area, every stop in the area.
+type Snapshot struct {
+	From  time.Time `json:"from"`
+	Until time.Time `json:"until"`
+}
+
+// Covers returns true if the time is in the period of the snapshot; Until is
+// not included
+func (s Snapshot) Covers(t time.Time) bool {
+	return !t.Before(s.From) && t.Before(s.Until)
+}
+
+// UnsupportedSchemaVersionError is returned when decoding a message written
+// with a newer schema version than this build can read
+type UnsupportedSchemaVersionError struct {
+	SchemaVersion int
+}
+
+func (e *UnsupportedSchemaVersionError) Error() string {
+	return fmt.Sprintf("unsupported departures schema version %d: this build reads versions up to %d", e.SchemaVersion, CurrentSchemaVersion)
+}
+
+// NewEnvelope creates an envelope for the current schema version
+func NewEnvelope(producer string, sourceFeed string, generatedAt time.Time, location string) Envelope {
+	return Envelope{
+		SchemaVersion: CurrentSchemaVersion,
+		Producer:      producer,
+		SourceFeed:    sourceFeed,
+		GeneratedAt:   &generatedAt,
+		Location:      location,
+	}
+}
+
+// EncodeDeparturesMessage marshals departures for publishing to SNS, with the
+// envelope fields alongside the `departures` array
+func EncodeDeparturesMessage(envelope Envelope, departures Internal) ([]byte, error) {
+	return json.Marshal(struct {
+		Envelope
+		Departures []Departure `json:"departures"`
+	}{
+		Envelope:   envelope,
+		Departures: departures.Departures,
+	})
+}
+
+// DecodeDeparturesMessage unmarshals departures published to SNS, upgrading
+// messages written before the envelope was introduced. If some departures
+// cannot be decoded, the envelope and the rest of the departures are returned
+// with an *UndecodableDeparturesError.
+func DecodeDeparturesMessage(data []byte) (*Envelope, *Internal, error) {
+	envelope, err := decodeEnvelope(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	departures := Internal{}
+	err = json.Unmarshal(data, &departures)
+	if _, ok := err.(*UndecodableDeparturesError); ok {
+		return envelope, &departures, err
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return envelope, &departures, nil
+}
+
+// EncodeCachedDeparture marshals a departure for storing in the departures
+// cache, with the envelope fields alongside the departure fields
+func EncodeCachedDeparture(envelope Envelope, departure Departure) ([]byte, error) {
+	return json.Marshal(struct {
+		Envelope
+		departureJSON
+	}{
+		Envelope:      envelope,
+		departureJSON: departure.toJSON(),
+	})
+}
+
+// DecodeCachedDeparture unmarshals a departure from the departures cache,
+// upgrading departures cached before the envelope was introduced
+func DecodeCachedDeparture(data []byte) (*Envelope, *Departure, error) {
+	envelope, err := decodeEnvelope(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	departure := Departure{}
+	if err := json.Unmarshal(data, &departure); err != nil {
+		return nil, nil, err
+	}
+
+	return envelope, &departure, nil
+}
+
+func decodeEnvelope(data []byte) (*Envelope, error) {
+	envelope := Envelope{}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+
+	if envelope.SchemaVersion > CurrentSchemaVersion || envelope.SchemaVersion < legacySchemaVersion {
+		return nil, &UnsupportedSchemaVersionError{SchemaVersion: envelope.SchemaVersion}
+	}
+
+	if envelope.SchemaVersion == legacySchemaVersion {
+		// Version 1 added the envelope fields without changing the message
+		// fields, so there is nothing else to convert
+		envelope.SchemaVersion = 1
+	}
+
+	return &envelope, nil
+}
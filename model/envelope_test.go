@@ -0,0 +1,173 @@
+package model
+
+import (
+	"github.com/TfGMEnterprise/departures-service/test_helpers"
+	"testing"
+)
+
+func TestDecodeDeparturesMessage(t *testing.T) {
+	t.Run("upgrades a message published without an envelope", func(t *testing.T) {
+		message := `{"departures":[{"journeyRef":"1","aimedDepartureTime":"2019-05-08T23:37:00+01:00","locationAtcocode":"1800BNIN0D1"}]}`
+
+		envelope, departures, err := DecodeDeparturesMessage([]byte(message))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if envelope.SchemaVersion != CurrentSchemaVersion {
+			t.Errorf("got `%d`, want `%d`", envelope.SchemaVersion, CurrentSchemaVersion)
+		}
+
+		test_helpers.AssertString(t, envelope.Producer, "")
+		test_helpers.AssertBoolean(t, envelope.GeneratedAt == nil, true)
+
+		if len(departures.Departures) != 1 {
+			t.Fatalf("got %d departures, want %d", len(departures.Departures), 1)
+		}
+
+		test_helpers.AssertString(t, departures.Departures[0].JourneyRef, "1")
+	})
+
+	t.Run("reads back an encoded message", func(t *testing.T) {
+		generatedAt := test_helpers.ParseTime(t, "2019-05-08T23:30:00+01:00")
+
+		message, err := EncodeDeparturesMessage(NewEnvelope("optis-poller", "optis-siri-sm", generatedAt, "1800BNIN"), Internal{
+			Departures: []Departure{
+				{JourneyRef: "1", AimedDepartureTime: test_helpers.ParseTime(t, "2019-05-08T23:37:00+01:00"), LocationAtcocode: "1800BNIN0D1"},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test_helpers.AssertString(t, string(message), `{"schemaVersion":1,"producer":"optis-poller","sourceFeed":"optis-siri-sm","generatedAt":"2019-05-08T23:30:00+01:00","location":"1800BNIN","departures":[{"journeyRef":"1","aimedDepartureTime":"2019-05-08T23:37:00+01:00","locationAtcocode":"1800BNIN0D1"}]}`)
+
+		envelope, departures, err := DecodeDeparturesMessage(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test_helpers.AssertString(t, envelope.Producer, "optis-poller")
+		test_helpers.AssertString(t, envelope.SourceFeed, "optis-siri-sm")
+		test_helpers.AssertString(t, envelope.Location, "1800BNIN")
+		test_helpers.AssertBoolean(t, envelope.GeneratedAt.Equal(generatedAt), true)
+		test_helpers.AssertString(t, departures.Departures[0].JourneyRef, "1")
+	})
+
+	t.Run("reads back a snapshot", func(t *testing.T) {
+		generatedAt := test_helpers.ParseTime(t, "2019-05-08T23:30:00+01:00")
+
+		envelope := NewEnvelope("optis-poller", "optis-siri-sm", generatedAt, "1800BNIN")
+		envelope.Snapshot = &Snapshot{
+			From:  generatedAt,
+			Until: test_helpers.ParseTime(t, "2019-05-09T01:30:00+01:00"),
+		}
+
+		message, err := EncodeDeparturesMessage(envelope, Internal{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test_helpers.AssertString(t, string(message), `{"schemaVersion":1,"producer":"optis-poller","sourceFeed":"optis-siri-sm","generatedAt":"2019-05-08T23:30:00+01:00","location":"1800BNIN","snapshot":{"from":"2019-05-08T23:30:00+01:00","until":"2019-05-09T01:30:00+01:00"},"departures":null}`)
+
+		decoded, _, err := DecodeDeparturesMessage(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if decoded.Snapshot == nil {
+			t.Fatal("expected a snapshot")
+		}
+
+		test_helpers.AssertBoolean(t, decoded.Snapshot.Covers(generatedAt), true)
+		test_helpers.AssertBoolean(t, decoded.Snapshot.Covers(test_helpers.ParseTime(t, "2019-05-09T01:29:59+01:00")), true)
+		test_helpers.AssertBoolean(t, decoded.Snapshot.Covers(test_helpers.ParseTime(t, "2019-05-09T01:30:00+01:00")), false)
+		test_helpers.AssertBoolean(t, decoded.Snapshot.Covers(test_helpers.ParseTime(t, "2019-05-08T23:29:59+01:00")), false)
+	})
+
+	t.Run("returns the departures that can be decoded with the ones that cannot", func(t *testing.T) {
+		message := `{"schemaVersion":1,"producer":"optis-poller","departures":[{"journeyRef":2},{"journeyRef":"1","aimedDepartureTime":"2019-05-08T23:37:00+01:00","locationAtcocode":"1800BNIN0D1"}]}`
+
+		envelope, departures, err := DecodeDeparturesMessage([]byte(message))
+
+		undecodable, ok := err.(*UndecodableDeparturesError)
+		if !ok {
+			t.Fatalf("got `%T`, want `%T`", err, &UndecodableDeparturesError{})
+		}
+
+		if len(undecodable.Indexes) != 1 || undecodable.Indexes[0] != 0 {
+			t.Errorf("got indexes %v, want %v", undecodable.Indexes, []int{0})
+		}
+
+		test_helpers.AssertString(t, envelope.Producer, "optis-poller")
+
+		if len(departures.Departures) != 1 {
+			t.Fatalf("got %d departures, want %d", len(departures.Departures), 1)
+		}
+
+		test_helpers.AssertString(t, departures.Departures[0].JourneyRef, "1")
+	})
+
+	t.Run("rejects a message with a newer schema version", func(t *testing.T) {
+		message := `{"schemaVersion":2,"departures":[]}`
+
+		_, _, err := DecodeDeparturesMessage([]byte(message))
+
+		if _, ok := err.(*UnsupportedSchemaVersionError); !ok {
+			t.Fatalf("got `%T`, want `%T`", err, &UnsupportedSchemaVersionError{})
+		}
+
+		test_helpers.AssertString(t, err.Error(), "unsupported departures schema version 2: this build reads versions up to 1")
+	})
+}
+
+func TestDecodeCachedDeparture(t *testing.T) {
+	t.Run("upgrades a departure cached without an envelope", func(t *testing.T) {
+		cached := `{"recordedAtTime":"2019-05-08T23:29:46+01:00","journeyRef":"2019-05-08_1235","aimedDepartureTime":"2019-05-08T23:37:00+01:00","locationAtcocode":"1800BNIN0D1","serviceNumber":"456"}`
+
+		envelope, departure, err := DecodeCachedDeparture([]byte(cached))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if envelope.SchemaVersion != CurrentSchemaVersion {
+			t.Errorf("got `%d`, want `%d`", envelope.SchemaVersion, CurrentSchemaVersion)
+		}
+
+		test_helpers.AssertString(t, departure.JourneyRef, "2019-05-08_1235")
+		test_helpers.AssertString(t, departure.ServiceNumber, "456")
+	})
+
+	t.Run("reads back an encoded departure", func(t *testing.T) {
+		generatedAt := test_helpers.ParseTime(t, "2019-05-08T23:30:00+01:00")
+
+		cached, err := EncodeCachedDeparture(NewEnvelope("ingester", "optis-siri-sm", generatedAt, ""), Departure{
+			JourneyRef:         "2019-05-08_1235",
+			AimedDepartureTime: test_helpers.ParseTime(t, "2019-05-08T23:37:00+01:00"),
+			LocationAtcocode:   "1800BNIN0D1",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test_helpers.AssertString(t, string(cached), `{"schemaVersion":1,"producer":"ingester","sourceFeed":"optis-siri-sm","generatedAt":"2019-05-08T23:30:00+01:00","journeyRef":"2019-05-08_1235","aimedDepartureTime":"2019-05-08T23:37:00+01:00","locationAtcocode":"1800BNIN0D1"}`)
+
+		envelope, departure, err := DecodeCachedDeparture(cached)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test_helpers.AssertString(t, envelope.Producer, "ingester")
+		test_helpers.AssertString(t, departure.JourneyRef, "2019-05-08_1235")
+	})
+
+	t.Run("rejects a departure with a newer schema version", func(t *testing.T) {
+		cached := `{"schemaVersion":3,"journeyRef":"2019-05-08_1235"}`
+
+		if _, _, err := DecodeCachedDeparture([]byte(cached)); err == nil {
+			t.Error("Should return an error!")
+		} else if _, ok := err.(*UnsupportedSchemaVersionError); !ok {
+			t.Errorf("got `%T`, want `%T`", err, &UnsupportedSchemaVersionError{})
+		}
+	})
+}
@@ -0,0 +1,163 @@
+package model
+
+import (
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// GTFSRealtimeVersion is the version of the GTFS Realtime specification used
+// for feed messages
+const GTFSRealtimeVersion = "2.0"
+
+// Incrementality values for a GTFS Realtime FeedHeader
+const (
+	FullDataset  = 0
+	Differential = 1
+)
+
+// ScheduleRelationship values for a GTFS Realtime StopTimeUpdate
+const (
+	StopTimeScheduled = 0
+	StopTimeSkipped   = 1
+	StopTimeNoData    = 2
+)
+
+// FeedMessage a representation of a GTFS Realtime FeedMessage; the field
+// numbers used when marshalling are taken from gtfs-realtime.proto
+type FeedMessage struct {
+	Header FeedHeader   `json:"header"`
+	Entity []FeedEntity `json:"entity,omitempty"`
+}
+
+// FeedHeader a representation of a GTFS Realtime FeedHeader
+type FeedHeader struct {
+	GTFSRealtimeVersion string `json:"gtfsRealtimeVersion"`
+	Incrementality      int    `json:"incrementality"`
+	Timestamp           uint64 `json:"timestamp,omitempty"`
+}
+
+// FeedEntity a representation of a GTFS Realtime FeedEntity
+type FeedEntity struct {
+	ID         string      `json:"id"`
+	TripUpdate *TripUpdate `json:"tripUpdate,omitempty"`
+}
+
+// TripUpdate a representation of a GTFS Realtime TripUpdate
+type TripUpdate struct {
+	Trip           TripDescriptor   `json:"trip"`
+	StopTimeUpdate []StopTimeUpdate `json:"stopTimeUpdate,omitempty"`
+	Timestamp      uint64           `json:"timestamp,omitempty"`
+}
+
+// TripDescriptor a representation of a GTFS Realtime TripDescriptor
+type TripDescriptor struct {
+	TripID  string `json:"tripId,omitempty"`
+	RouteID string `json:"routeId,omitempty"`
+}
+
+// StopTimeUpdate a representation of a GTFS Realtime StopTimeUpdate
+type StopTimeUpdate struct {
+	StopID               string         `json:"stopId,omitempty"`
+	Departure            *StopTimeEvent `json:"departure,omitempty"`
+	ScheduleRelationship int            `json:"scheduleRelationship,omitempty"`
+}
+
+// StopTimeEvent a representation of a GTFS Realtime StopTimeEvent
+type StopTimeEvent struct {
+	Delay *int32 `json:"delay,omitempty"`
+	Time  int64  `json:"time,omitempty"`
+}
+
+// MarshalProto encodes the feed message in the protocol buffer wire format
+func (fm FeedMessage) MarshalProto() []byte {
+	var b []byte
+	b = appendMessage(b, 1, fm.Header.marshalProto())
+	for _, entity := range fm.Entity {
+		b = appendMessage(b, 2, entity.marshalProto())
+	}
+	return b
+}
+
+func (fh FeedHeader) marshalProto() []byte {
+	var b []byte
+	b = appendString(b, 1, fh.GTFSRealtimeVersion)
+	if fh.Incrementality != FullDataset {
+		b = appendVarint(b, 2, uint64(fh.Incrementality))
+	}
+	if fh.Timestamp != 0 {
+		b = appendVarint(b, 3, fh.Timestamp)
+	}
+	return b
+}
+
+func (fe FeedEntity) marshalProto() []byte {
+	var b []byte
+	b = appendString(b, 1, fe.ID)
+	if fe.TripUpdate != nil {
+		b = appendMessage(b, 3, fe.TripUpdate.marshalProto())
+	}
+	return b
+}
+
+func (tu TripUpdate) marshalProto() []byte {
+	var b []byte
+	b = appendMessage(b, 1, tu.Trip.marshalProto())
+	for _, stopTimeUpdate := range tu.StopTimeUpdate {
+		b = appendMessage(b, 2, stopTimeUpdate.marshalProto())
+	}
+	if tu.Timestamp != 0 {
+		b = appendVarint(b, 4, tu.Timestamp)
+	}
+	return b
+}
+
+func (td TripDescriptor) marshalProto() []byte {
+	var b []byte
+	if td.TripID != "" {
+		b = appendString(b, 1, td.TripID)
+	}
+	if td.RouteID != "" {
+		b = appendString(b, 5, td.RouteID)
+	}
+	return b
+}
+
+func (stu StopTimeUpdate) marshalProto() []byte {
+	var b []byte
+	if stu.Departure != nil {
+		b = appendMessage(b, 3, stu.Departure.marshalProto())
+	}
+	if stu.StopID != "" {
+		b = appendString(b, 4, stu.StopID)
+	}
+	if stu.ScheduleRelationship != StopTimeScheduled {
+		b = appendVarint(b, 5, uint64(stu.ScheduleRelationship))
+	}
+	return b
+}
+
+func (ste StopTimeEvent) marshalProto() []byte {
+	var b []byte
+	if ste.Delay != nil {
+		// int32 fields are sign-extended to 64 bits on the wire
+		b = appendVarint(b, 1, uint64(int64(*ste.Delay)))
+	}
+	if ste.Time != 0 {
+		b = appendVarint(b, 2, uint64(ste.Time))
+	}
+	return b
+}
+
+func appendMessage(b []byte, num protowire.Number, m []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
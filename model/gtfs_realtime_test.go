@@ -0,0 +1,210 @@
+package model
+
+import (
+	"encoding/json"
+	"github.com/TfGMEnterprise/departures-service/test_helpers"
+	"google.golang.org/protobuf/encoding/protowire"
+	"reflect"
+	"testing"
+)
+
+// consumeFields decodes a single level of protocol buffer fields
+func consumeFields(t *testing.T, b []byte) map[protowire.Number][]interface{} {
+	t.Helper()
+
+	fields := make(map[protowire.Number][]interface{})
+
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatal(protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				t.Fatal(protowire.ParseError(n))
+			}
+			fields[num] = append(fields[num], v)
+			b = b[n:]
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				t.Fatal(protowire.ParseError(n))
+			}
+			fields[num] = append(fields[num], v)
+			b = b[n:]
+		default:
+			t.Fatalf("unexpected wire type %d", typ)
+		}
+	}
+
+	return fields
+}
+
+func TestFeedMessage_MarshalProto(t *testing.T) {
+	delay := int32(-30)
+
+	feedMessage := FeedMessage{
+		Header: FeedHeader{
+			GTFSRealtimeVersion: GTFSRealtimeVersion,
+			Incrementality:      FullDataset,
+			Timestamp:           1557354600,
+		},
+		Entity: []FeedEntity{
+			{
+				ID: "123_I_2019-05-08_1234",
+				TripUpdate: &TripUpdate{
+					Trip: TripDescriptor{
+						TripID:  "123_I_2019-05-08_1234",
+						RouteID: "123",
+					},
+					StopTimeUpdate: []StopTimeUpdate{
+						{
+							StopID: "1800BNIN0C1",
+							Departure: &StopTimeEvent{
+								Delay: &delay,
+								Time:  1557354840,
+							},
+						},
+						{
+							StopID:               "1800WA12481",
+							ScheduleRelationship: StopTimeNoData,
+						},
+					},
+					Timestamp: 1557354590,
+				},
+			},
+		},
+	}
+
+	fields := consumeFields(t, feedMessage.MarshalProto())
+
+	header := consumeFields(t, fields[1][0].([]byte))
+	if got := string(header[1][0].([]byte)); got != "2.0" {
+		t.Errorf("got gtfs_realtime_version `%s`, want `%s`", got, "2.0")
+	}
+	if _, exists := header[2]; exists {
+		t.Error("incrementality should be omitted for the default FULL_DATASET value")
+	}
+	if got := header[3][0].(uint64); got != 1557354600 {
+		t.Errorf("got header timestamp %d, want %d", got, 1557354600)
+	}
+
+	if len(fields[2]) != 1 {
+		t.Fatalf("got %d entities, want %d", len(fields[2]), 1)
+	}
+
+	entity := consumeFields(t, fields[2][0].([]byte))
+	if got := string(entity[1][0].([]byte)); got != "123_I_2019-05-08_1234" {
+		t.Errorf("got entity id `%s`", got)
+	}
+
+	tripUpdate := consumeFields(t, entity[3][0].([]byte))
+	trip := consumeFields(t, tripUpdate[1][0].([]byte))
+	if got := string(trip[1][0].([]byte)); got != "123_I_2019-05-08_1234" {
+		t.Errorf("got trip_id `%s`", got)
+	}
+	if got := string(trip[5][0].([]byte)); got != "123" {
+		t.Errorf("got route_id `%s`", got)
+	}
+	if got := tripUpdate[4][0].(uint64); got != 1557354590 {
+		t.Errorf("got trip update timestamp %d, want %d", got, 1557354590)
+	}
+
+	if len(tripUpdate[2]) != 2 {
+		t.Fatalf("got %d stop time updates, want %d", len(tripUpdate[2]), 2)
+	}
+
+	stopTimeUpdate := consumeFields(t, tripUpdate[2][0].([]byte))
+	if got := string(stopTimeUpdate[4][0].([]byte)); got != "1800BNIN0C1" {
+		t.Errorf("got stop_id `%s`", got)
+	}
+
+	departure := consumeFields(t, stopTimeUpdate[3][0].([]byte))
+	if got := int32(departure[1][0].(uint64)); got != -30 {
+		t.Errorf("got delay %d, want %d", got, -30)
+	}
+	if got := departure[2][0].(uint64); got != 1557354840 {
+		t.Errorf("got time %d, want %d", got, 1557354840)
+	}
+
+	noData := consumeFields(t, tripUpdate[2][1].([]byte))
+	want := map[protowire.Number][]interface{}{
+		4: {[]byte("1800WA12481")},
+		5: {uint64(StopTimeNoData)},
+	}
+	if !reflect.DeepEqual(noData, want) {
+		t.Errorf("got %#v, want %#v", noData, want)
+	}
+}
+
+func TestFeedMessage_MarshalProto_referenceParser(t *testing.T) {
+	delay := int32(-30)
+	noDelay := int32(0)
+
+	feedMessage := FeedMessage{
+		Header: FeedHeader{
+			GTFSRealtimeVersion: GTFSRealtimeVersion,
+			Incrementality:      Differential,
+			Timestamp:           1557354600,
+		},
+		Entity: []FeedEntity{
+			{
+				ID: "123_I_2019-05-08_1234",
+				TripUpdate: &TripUpdate{
+					Trip: TripDescriptor{
+						TripID:  "123_I_2019-05-08_1234",
+						RouteID: "123",
+					},
+					StopTimeUpdate: []StopTimeUpdate{
+						{
+							StopID: "1800BNIN0C1",
+							Departure: &StopTimeEvent{
+								Delay: &delay,
+								Time:  1557354840,
+							},
+						},
+						{
+							StopID: "1800WA12481",
+							Departure: &StopTimeEvent{
+								Delay: &noDelay,
+								Time:  1557355200,
+							},
+						},
+						{
+							StopID:               "1800WA12482",
+							ScheduleRelationship: StopTimeNoData,
+						},
+					},
+					Timestamp: 1557354590,
+				},
+			},
+			{
+				ID: "Service1",
+				TripUpdate: &TripUpdate{
+					Trip: TripDescriptor{
+						TripID: "Service1",
+					},
+					StopTimeUpdate: []StopTimeUpdate{
+						{
+							StopID:               "9100MNCROXR",
+							ScheduleRelationship: StopTimeSkipped,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	got := FeedMessage{}
+	if err := json.Unmarshal(test_helpers.DecodeGTFSRealtimeFeed(t, feedMessage.MarshalProto()), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, feedMessage) {
+		t.Errorf("got %#v, want %#v", got, feedMessage)
+	}
+}
@@ -1,33 +1,43 @@
 package model
 
-import (
-	"fmt"
-	"regexp"
-	"strconv"
-	"strings"
-	"time"
-)
+import "time"
 
 // Departure contains a unique identifier for the journey at the location,
-// the aimed and expected departure time, the departure location,
-// the destination, the bus service number and the operator
+// the aimed and expected departure time, the aimed and expected arrival time,
+// the departure location, the origin, the destination, the bus service number
+// and the operator. A journey that terminates at the location has no departure
+// time, and one that starts there has no arrival time. Timestamps are
+// marshalled to JSON as RFC3339 strings; see departure_json.go
 type Departure struct {
-	RecordedAtTime        string      `json:"recordedAtTime,omitempty"`
-	JourneyType           JourneyType `json:"journeyType,omitempty"`
-	JourneyRef            string      `json:"journeyRef,omitempty"`
-	AimedDepartureTime    string      `json:"aimedDepartureTime,omitempty"`
-	ExpectedDepartureTime *string     `json:"expectedDepartureTime,omitempty"`
-	DepartureStatus       *string     `json:"departureStatus,omitempty"`
-	LocationAtcocode      string      `json:"locationAtcocode,omitempty"`
-	Stand                 *string     `json:"stand,omitempty"`
-	DestinationAtcocode   string      `json:"destinationAtcocode,omitempty"`
-	Destination           string      `json:"destination,omitempty"`
-	ServiceNumber         string      `json:"serviceNumber,omitempty"`
-	OperatorCode          string      `json:"operatorCode,omitempty"`
+	RecordedAtTime        time.Time
+	JourneyType           JourneyType
+	JourneyRef            string
+	AimedDepartureTime    time.Time
+	ExpectedDepartureTime *time.Time
+	DepartureStatus       *string
+	AimedArrivalTime      time.Time
+	ExpectedArrivalTime   *time.Time
+	ArrivalStatus         *string
+	LocationAtcocode      string
+	Stand                 *string
+	OriginAtcocode        string
+	Origin                string
+	DestinationAtcocode   string
+	Destination           string
+	ServiceNumber         string
+	OperatorCode          string
 }
 
+// CancelledStatus is the departure status of a journey that is cancelled at
+// the location
+const CancelledStatus = "Cancelled"
+
+// CancelledRetention is how long after its aimed departure time a cancelled
+// departure is kept in the cache, and so the longest it can be shown for
+const CancelledRetention = 30 * time.Minute
+
 type DepartureInterface interface {
-	DepartureTime() (departureTime time.Time, isRealTime bool, err error)
+	DepartureTime() (departureTime time.Time, isRealTime bool)
 	IsExpired(now time.Time) bool
 }
 
@@ -38,6 +48,8 @@ type Internal struct {
 
 type ByDepartureTime []Departure
 
+type ByArrivalTime []Departure
+
 type ByServiceNumber []Departure
 
 func (a ByDepartureTime) Len() int {
@@ -49,14 +61,8 @@ func (a ByDepartureTime) Swap(i, j int) {
 }
 
 func (a ByDepartureTime) Less(i, j int) bool {
-	iDepartureTime, _, err := a[i].DepartureTime()
-	if err != nil {
-		panic(err)
-	}
-	jDepartureTime, _, err := a[j].DepartureTime()
-	if err != nil {
-		panic(err)
-	}
+	iDepartureTime, _ := a[i].DepartureTime()
+	jDepartureTime, _ := a[j].DepartureTime()
 
 	if iDepartureTime.Equal(jDepartureTime) {
 		result := lessByServiceNumber(a[i], a[j])
@@ -69,6 +75,18 @@ func (a ByDepartureTime) Less(i, j int) bool {
 	return iDepartureTime.Before(jDepartureTime)
 }
 
+func (a ByArrivalTime) Len() int {
+	return len(a)
+}
+
+func (a ByArrivalTime) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+
+func (a ByArrivalTime) Less(i, j int) bool {
+	return ByDepartureTime{a[i].AsArrival(), a[j].AsArrival()}.Less(0, 1)
+}
+
 func (a ByServiceNumber) Len() int {
 	return len(a)
 }
@@ -80,15 +98,8 @@ func (a ByServiceNumber) Swap(i, j int) {
 func (a ByServiceNumber) Less(i, j int) bool {
 	result := lessByServiceNumber(a[i], a[j])
 	if result == nil {
-		iDepartureTime, _, err := a[i].DepartureTime()
-		if err != nil {
-			panic(err)
-		}
-
-		jDepartureTime, _, err := a[j].DepartureTime()
-		if err != nil {
-			panic(err)
-		}
+		iDepartureTime, _ := a[i].DepartureTime()
+		jDepartureTime, _ := a[j].DepartureTime()
 
 		if iDepartureTime.Equal(jDepartureTime) {
 			return a[i].JourneyRef < a[j].JourneyRef
@@ -101,75 +112,93 @@ func (a ByServiceNumber) Less(i, j int) bool {
 }
 
 func lessByServiceNumber(a, b Departure) *bool {
-	var result bool
 	if a.ServiceNumber == b.ServiceNumber {
 		return nil
 	}
-	iPrefix, iDigits, iSuffix := a.GetServiceNumberParts()
-	jPrefix, jDigits, jSuffix := b.GetServiceNumberParts()
-
-	if iPrefix == nil && jPrefix == nil || iPrefix != nil && jPrefix != nil && *iPrefix == *jPrefix {
-		if iDigits != nil && jDigits != nil {
-			if *iDigits == *jDigits {
-				if iSuffix != nil && jSuffix != nil {
-					result = *iSuffix < *jSuffix
-					return &result
-				}
 
-				result = iSuffix == nil
+	result := CompareServiceNumbers(a.ServiceNumber, b.ServiceNumber) < 0
+	return &result
+}
 
-				return &result
-			}
+func (d Departure) DepartureTime() (departureTime time.Time, isRealTime bool) {
+	if d.ExpectedDepartureTime != nil {
+		return *d.ExpectedDepartureTime, true
+	}
 
-			result = *iDigits < *jDigits
-			return &result
-		}
+	return d.AimedDepartureTime, false
+}
 
-		result = jDigits == nil
+// HasDeparture returns true if the journey departs from the location
+func (d Departure) HasDeparture() bool {
+	return !d.AimedDepartureTime.IsZero()
+}
 
-		return &result
-	}
+// HasArrival returns true if the journey arrives at the location
+func (d Departure) HasArrival() bool {
+	return !d.AimedArrivalTime.IsZero()
+}
 
-	if iPrefix == nil {
-		result = true
-		return &result
-	}
+// ArrivalTime returns the expected arrival time if there is one, or the aimed
+// arrival time otherwise
+func (d Departure) ArrivalTime() (arrivalTime time.Time, isRealTime bool) {
+	return d.AsArrival().DepartureTime()
+}
 
-	if jPrefix == nil {
-		result = false
-		return &result
-	}
+// AsArrival returns a copy of the departure with the arrival time and status
+// in place of the departure time and status, so that an arrival can be sorted,
+// expired and displayed in the same way as a departure
+func (d Departure) AsArrival() Departure {
+	arrival := d
+	arrival.AimedDepartureTime = d.AimedArrivalTime
+	arrival.ExpectedDepartureTime = d.ExpectedArrivalTime
+	arrival.DepartureStatus = d.ArrivalStatus
 
-	result = *iPrefix < *jPrefix
-	return &result
+	return arrival
 }
 
-func (d Departure) DepartureTime() (departureTime time.Time, isRealTime bool, err error) {
-	if d.ExpectedDepartureTime != nil {
-		departureTime, err = time.Parse(time.RFC3339, *d.ExpectedDepartureTime)
-		return departureTime, true, err
-	}
-
-	departureTime, err = time.Parse(time.RFC3339, d.AimedDepartureTime)
-	return departureTime, false, err
+// IsCancelled returns true if the journey is cancelled at the location
+func (d Departure) IsCancelled() bool {
+	return d.DepartureStatus != nil && *d.DepartureStatus == CancelledStatus
 }
 
+// IsExpired returns true if the departure time has passed. Train departures
+// use the departure status where it holds an estimated time and are retained
+// while delayed, or while the estimated time is outside the window around
+// now. Cancelled departures expire when their aimed departure time passes.
 func (d Departure) IsExpired(now time.Time) bool {
-	depTime, _, err := d.DepartureTime()
-	if err != nil {
-		panic(err)
+	return d.IsExpiredAfter(now, 0)
+}
+
+// IsExpiredAfter returns true if the departure has expired, keeping cancelled
+// departures for the period after their aimed departure time so that
+// passengers can see that they were cancelled
+func (d Departure) IsExpiredAfter(now time.Time, cancelledPeriod time.Duration) bool {
+	if d.IsCancelled() {
+		cutoff := now.Add(-cancelledPeriod)
+		if d.JourneyType == Train {
+			cutoff = cutoff.Truncate(time.Minute)
+		}
+
+		return d.AimedDepartureTime.Before(cutoff)
 	}
 
+	depTime, _ := d.DepartureTime()
+
 	if d.JourneyType == Train {
+		if d.DepartureStatus == nil {
+			return depTime.Before(now.Truncate(time.Minute))
+		}
+
 		if *d.DepartureStatus == "Delayed" {
 			return false
 		}
 
-		re := regexp.MustCompile("^[0-9]{2}:[0-9]{2}$")
-		if re.MatchString(*d.DepartureStatus) {
+		if localTimeRegexp.MatchString(*d.DepartureStatus) {
+			// An estimated time outside the window around now is most likely
+			// for a train delayed by more than the window, so it is kept
 			expectedDepartureTime, err := ConvertDepartureTime(&now, depTime.Location(), *d.DepartureStatus)
 			if err != nil {
-				panic(err)
+				return false
 			}
 
 			return expectedDepartureTime.Before(now.Truncate(time.Minute))
@@ -181,52 +210,18 @@ func (d Departure) IsExpired(now time.Time) bool {
 	return depTime.Before(now)
 }
 
-func (d Departure) GetServiceNumberParts() (prefix *string, digits *int, suffix *string) {
-	re := regexp.MustCompile(`^([A-Z]+)?(([\d]{1,3})?([A-Z])?)?$`)
-	serviceNumber := []byte(strings.ToUpper(d.ServiceNumber))
-	matches := re.FindAllSubmatch(serviceNumber, -1)
-	if matches == nil || len(matches) > 1 {
-		err := fmt.Errorf("invalid service number: %s", d.ServiceNumber)
-		panic(err)
-	}
-	if matches[0][1] != nil {
-		prefixVal := string(matches[0][1])
-		prefix = &prefixVal
-	} else {
-		prefix = nil
-	}
-	if matches[0][4] != nil {
-		suffixVal := string(matches[0][4])
-		suffix = &suffixVal
-	} else {
-		suffix = nil
-	}
-	if matches[0][3] != nil {
-		digitsVal, err := strconv.Atoi(string(matches[0][3]))
-		if err != nil {
-			panic(err)
-		}
-		digits = &digitsVal
-	} else {
-		digits = nil
+// IsStale returns true if the departure has a real-time prediction that has
+// not been updated within the threshold
+func (d Departure) IsStale(now time.Time, threshold time.Duration) bool {
+	if d.ExpectedDepartureTime == nil || d.RecordedAtTime.IsZero() {
+		return false
 	}
-	return
+
+	return now.Sub(d.RecordedAtTime) > threshold
 }
 
+// GetStand returns the stand identifier from the location ATCO code using the
+// default stand rules
 func (d Departure) GetStand() *string {
-	re := regexp.MustCompile(`^180[A-Z0-9][A-Z]{2}(BS|IC|IN)([A-Z0-9]{2})[0-9]$`)
-	locationAtcocode := []byte(strings.ToUpper(d.LocationAtcocode))
-	matches := re.FindAllSubmatch(locationAtcocode, -1)
-
-	if matches == nil || len(matches) > 1 {
-		return nil
-	}
-
-	standPart := matches[0][2]
-	if string(standPart[0]) == "0" {
-		stand := string(standPart[1])
-		return &stand
-	}
-	stand := string(standPart)
-	return &stand
+	return DefaultStandRules.Stand(d.LocationAtcocode)
 }
@@ -12,15 +12,15 @@ func TestDepartures_SortByDepartureTime(t *testing.T) {
 	t.Run("should sort the departures in ascending time order", func(t *testing.T) {
 		now := time.Now()
 
-		expectedDepartureTime1 := test_helpers.AdjustTime(now, "40m").Format(time.RFC3339)
-		expectedDepartureTime2 := test_helpers.AdjustTime(now, "10m").Format(time.RFC3339)
+		expectedDepartureTime1 := test_helpers.AdjustTime(now, "40m")
+		expectedDepartureTime2 := test_helpers.AdjustTime(now, "10m")
 
 		departures := Internal{
-			[]Departure{
+			Departures: []Departure{
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1234",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "20m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "20m"),
 					ExpectedDepartureTime: &expectedDepartureTime1,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -28,9 +28,9 @@ func TestDepartures_SortByDepartureTime(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1235",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "30m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "30m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -38,9 +38,9 @@ func TestDepartures_SortByDepartureTime(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1236",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "35m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "35m"),
 					ExpectedDepartureTime: &expectedDepartureTime2,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -69,11 +69,11 @@ func TestDepartures_SortByDepartureTime(t *testing.T) {
 		now := time.Now()
 
 		departures := Internal{
-			[]Departure{
+			Departures: []Departure{
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1234",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -81,9 +81,9 @@ func TestDepartures_SortByDepartureTime(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1235",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -91,9 +91,9 @@ func TestDepartures_SortByDepartureTime(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1236",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -101,9 +101,9 @@ func TestDepartures_SortByDepartureTime(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1237",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -111,9 +111,9 @@ func TestDepartures_SortByDepartureTime(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1238",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -121,9 +121,9 @@ func TestDepartures_SortByDepartureTime(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1239",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -131,9 +131,9 @@ func TestDepartures_SortByDepartureTime(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1239",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -141,9 +141,9 @@ func TestDepartures_SortByDepartureTime(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1239",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -151,9 +151,9 @@ func TestDepartures_SortByDepartureTime(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1239",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -161,9 +161,9 @@ func TestDepartures_SortByDepartureTime(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1239",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -171,9 +171,9 @@ func TestDepartures_SortByDepartureTime(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1239",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -181,9 +181,9 @@ func TestDepartures_SortByDepartureTime(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1239",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -248,11 +248,11 @@ func TestDepartures_SortByDepartureTime(t *testing.T) {
 		now := time.Now()
 
 		departures := Internal{
-			[]Departure{
+			Departures: []Departure{
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1235",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -260,9 +260,9 @@ func TestDepartures_SortByDepartureTime(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1236",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -270,9 +270,9 @@ func TestDepartures_SortByDepartureTime(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1234",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -303,11 +303,11 @@ func TestDepartures_SortByServiceNumber(t *testing.T) {
 		now := time.Now()
 
 		departures := Internal{
-			[]Departure{
+			Departures: []Departure{
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1234",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -315,9 +315,9 @@ func TestDepartures_SortByServiceNumber(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1235",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -325,9 +325,9 @@ func TestDepartures_SortByServiceNumber(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1236",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -335,9 +335,9 @@ func TestDepartures_SortByServiceNumber(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1237",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -345,9 +345,9 @@ func TestDepartures_SortByServiceNumber(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1238",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -355,9 +355,9 @@ func TestDepartures_SortByServiceNumber(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1239",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -365,9 +365,9 @@ func TestDepartures_SortByServiceNumber(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1239",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -375,9 +375,9 @@ func TestDepartures_SortByServiceNumber(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1239",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -385,9 +385,9 @@ func TestDepartures_SortByServiceNumber(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1239",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -395,9 +395,9 @@ func TestDepartures_SortByServiceNumber(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1239",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -405,9 +405,9 @@ func TestDepartures_SortByServiceNumber(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1239",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -415,9 +415,9 @@ func TestDepartures_SortByServiceNumber(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1239",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -481,15 +481,15 @@ func TestDepartures_SortByServiceNumber(t *testing.T) {
 	t.Run("should sort the departures with the same service number by departure time", func(t *testing.T) {
 		now := time.Now()
 
-		expectedDepartureTime1 := test_helpers.AdjustTime(now, "40m").Format(time.RFC3339)
-		expectedDepartureTime2 := test_helpers.AdjustTime(now, "10m").Format(time.RFC3339)
+		expectedDepartureTime1 := test_helpers.AdjustTime(now, "40m")
+		expectedDepartureTime2 := test_helpers.AdjustTime(now, "10m")
 
 		departures := Internal{
-			[]Departure{
+			Departures: []Departure{
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1234",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "20m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "20m"),
 					ExpectedDepartureTime: &expectedDepartureTime1,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -497,9 +497,9 @@ func TestDepartures_SortByServiceNumber(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1235",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "30m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "30m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -507,9 +507,9 @@ func TestDepartures_SortByServiceNumber(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1236",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "35m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "35m"),
 					ExpectedDepartureTime: &expectedDepartureTime2,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -538,11 +538,11 @@ func TestDepartures_SortByServiceNumber(t *testing.T) {
 		now := time.Now()
 
 		departures := Internal{
-			[]Departure{
+			Departures: []Departure{
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1235",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -550,9 +550,9 @@ func TestDepartures_SortByServiceNumber(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1236",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -560,9 +560,9 @@ func TestDepartures_SortByServiceNumber(t *testing.T) {
 					OperatorCode:          "ANWE",
 				},
 				{
-					RecordedAtTime:        now.Format(time.RFC3339),
+					RecordedAtTime:        now,
 					JourneyRef:            now.Format("2006-01-02") + "_1234",
-					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m").Format(time.RFC3339),
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "10m"),
 					ExpectedDepartureTime: nil,
 					LocationAtcocode:      "1800BNIN0C1",
 					DestinationAtcocode:   "1800WA12481",
@@ -586,25 +586,38 @@ func TestDepartures_SortByServiceNumber(t *testing.T) {
 			t.Errorf("Expected third departure to have JourneyRef `%s`; got `%s`", now.Format("2006-01-02")+"_1236", departures.Departures[2].JourneyRef)
 		}
 	})
+
+	t.Run("should sort line names that are not simple service numbers without panicking", func(t *testing.T) {
+		now := time.Now()
+
+		departures := []Departure{
+			{JourneyRef: "1", AimedDepartureTime: now, ServiceNumber: "X43/X44"},
+			{JourneyRef: "2", AimedDepartureTime: now, ServiceNumber: "12"},
+			{JourneyRef: "3", AimedDepartureTime: now, ServiceNumber: "Metrolink"},
+			{JourneyRef: "4", AimedDepartureTime: test_helpers.AdjustTime(now, "1m"), ServiceNumber: "12"},
+			{JourneyRef: "5", AimedDepartureTime: now, ServiceNumber: "1000"},
+			{JourneyRef: "6", AimedDepartureTime: now, ServiceNumber: "V1a"},
+		}
+
+		sort.Sort(ByServiceNumber(departures))
+
+		for i, want := range []string{"2", "4", "5", "3", "6", "1"} {
+			test_helpers.AssertString(t, departures[i].JourneyRef, want)
+		}
+	})
 }
 
 func TestDeparture_DepartureTime(t *testing.T) {
 	t.Run("expected departure time", func(t *testing.T) {
-		expectedDepartureTime := "2019-05-20T11:22:33+01:00"
+		expectedDepartureTime := test_helpers.ParseTime(t, "2019-05-20T11:22:33+01:00")
 		dep := Departure{
-			AimedDepartureTime:    "2019-05-20T12:34:56+01:00",
+			AimedDepartureTime:    test_helpers.ParseTime(t, "2019-05-20T12:34:56+01:00"),
 			ExpectedDepartureTime: &expectedDepartureTime,
 		}
 
-		depTime, isRealTime, err := dep.DepartureTime()
-		if err != nil {
-			t.Error(err)
-		}
+		depTime, isRealTime := dep.DepartureTime()
 
-		wantTime, err := time.Parse(time.RFC3339, expectedDepartureTime)
-		if err != nil {
-			t.Error(err)
-		}
+		wantTime := expectedDepartureTime
 
 		if !depTime.Equal(wantTime) {
 			t.Errorf("got `%s`, want `%s` for departure time", depTime.Format(time.RFC3339), wantTime.Format(time.RFC3339))
@@ -617,18 +630,12 @@ func TestDeparture_DepartureTime(t *testing.T) {
 
 	t.Run("returns the aimed departure time if the expected departure time is nil", func(t *testing.T) {
 		dep := Departure{
-			AimedDepartureTime: "2019-05-20T12:34:56+01:00",
+			AimedDepartureTime: test_helpers.ParseTime(t, "2019-05-20T12:34:56+01:00"),
 		}
 
-		depTime, isRealTime, err := dep.DepartureTime()
-		if err != nil {
-			t.Error(err)
-		}
+		depTime, isRealTime := dep.DepartureTime()
 
-		wantTime, err := time.Parse(time.RFC3339, "2019-05-20T12:34:56+01:00")
-		if err != nil {
-			t.Error(err)
-		}
+		wantTime := test_helpers.ParseTime(t, "2019-05-20T12:34:56+01:00")
 
 		if !depTime.Equal(wantTime) {
 			t.Errorf("got `%s`, want `%s` for departure time", depTime.Format(time.RFC3339), wantTime.Format(time.RFC3339))
@@ -642,10 +649,10 @@ func TestDeparture_DepartureTime(t *testing.T) {
 
 func TestDeparture_IsExpired(t *testing.T) {
 	t.Run("bus - returns true if the departure has already occurred", func(t *testing.T) {
-		expectedDepartureTime := "2019-05-20T11:22:33+01:00"
+		expectedDepartureTime := test_helpers.ParseTime(t, "2019-05-20T11:22:33+01:00")
 		dep := Departure{
 			JourneyType:           Bus,
-			AimedDepartureTime:    "2019-05-20T12:34:56+01:00",
+			AimedDepartureTime:    test_helpers.ParseTime(t, "2019-05-20T12:34:56+01:00"),
 			ExpectedDepartureTime: &expectedDepartureTime,
 		}
 
@@ -662,10 +669,10 @@ func TestDeparture_IsExpired(t *testing.T) {
 	})
 
 	t.Run("bus - returns false if the departure is in the future", func(t *testing.T) {
-		expectedDepartureTime := "2019-05-20T11:22:33+01:00"
+		expectedDepartureTime := test_helpers.ParseTime(t, "2019-05-20T11:22:33+01:00")
 		dep := Departure{
 			JourneyType:           Bus,
-			AimedDepartureTime:    "2019-05-20T12:34:56+01:00",
+			AimedDepartureTime:    test_helpers.ParseTime(t, "2019-05-20T12:34:56+01:00"),
 			ExpectedDepartureTime: &expectedDepartureTime,
 		}
 
@@ -682,19 +689,14 @@ func TestDeparture_IsExpired(t *testing.T) {
 	})
 
 	t.Run("bus - returns false if the departure is right now", func(t *testing.T) {
-		expectedDepartureTime := "2019-05-20T11:22:33+01:00"
+		expectedDepartureTime := test_helpers.ParseTime(t, "2019-05-20T11:22:33+01:00")
 		dep := Departure{
 			JourneyType:           Bus,
-			AimedDepartureTime:    "2019-05-20T12:34:56+01:00",
+			AimedDepartureTime:    test_helpers.ParseTime(t, "2019-05-20T12:34:56+01:00"),
 			ExpectedDepartureTime: &expectedDepartureTime,
 		}
 
-		now, err := time.Parse(time.RFC3339, expectedDepartureTime)
-		if err != nil {
-			t.Error(err)
-		}
-
-		got := dep.IsExpired(now)
+		got := dep.IsExpired(expectedDepartureTime)
 
 		if got != false {
 			t.Errorf("got `%v`, want `%v` for departure is expired", got, false)
@@ -704,7 +706,7 @@ func TestDeparture_IsExpired(t *testing.T) {
 	t.Run("bus - works when only aimed departure time is available", func(t *testing.T) {
 		dep := Departure{
 			JourneyType:        Bus,
-			AimedDepartureTime: "2019-05-20T12:34:56+01:00",
+			AimedDepartureTime: test_helpers.ParseTime(t, "2019-05-20T12:34:56+01:00"),
 		}
 
 		now, err := time.Parse(time.RFC3339, "2019-05-20T13:00:00+01:00")
@@ -722,7 +724,7 @@ func TestDeparture_IsExpired(t *testing.T) {
 	t.Run("train - returns true if the departure minute has passed and the departure status is `On time`", func(t *testing.T) {
 		dep := Departure{
 			JourneyType:        Train,
-			AimedDepartureTime: "2019-07-18T14:25:00+01:00",
+			AimedDepartureTime: test_helpers.ParseTime(t, "2019-07-18T14:25:00+01:00"),
 			DepartureStatus:    aws.String("On time"),
 		}
 
@@ -741,7 +743,7 @@ func TestDeparture_IsExpired(t *testing.T) {
 	t.Run("train - returns false if the departure minute is now and the departure status is `On time`", func(t *testing.T) {
 		dep := Departure{
 			JourneyType:        Train,
-			AimedDepartureTime: "2019-07-18T14:26:00+01:00",
+			AimedDepartureTime: test_helpers.ParseTime(t, "2019-07-18T14:26:00+01:00"),
 			DepartureStatus:    aws.String("On time"),
 		}
 
@@ -760,7 +762,7 @@ func TestDeparture_IsExpired(t *testing.T) {
 	t.Run("train - returns false if the departure minute is in the future and the departure status is `On time`", func(t *testing.T) {
 		dep := Departure{
 			JourneyType:        Train,
-			AimedDepartureTime: "2019-07-18T14:26:00+01:00",
+			AimedDepartureTime: test_helpers.ParseTime(t, "2019-07-18T14:26:00+01:00"),
 			DepartureStatus:    aws.String("On time"),
 		}
 
@@ -779,7 +781,7 @@ func TestDeparture_IsExpired(t *testing.T) {
 	t.Run("train - returns true if the departure minute has passed and the departure status is `Cancelled`", func(t *testing.T) {
 		dep := Departure{
 			JourneyType:        Train,
-			AimedDepartureTime: "2019-07-18T14:25:00+01:00",
+			AimedDepartureTime: test_helpers.ParseTime(t, "2019-07-18T14:25:00+01:00"),
 			DepartureStatus:    aws.String("Cancelled"),
 		}
 
@@ -798,7 +800,7 @@ func TestDeparture_IsExpired(t *testing.T) {
 	t.Run("train - returns false if the departure minute is now and the departure status is `Cancelled`", func(t *testing.T) {
 		dep := Departure{
 			JourneyType:        Train,
-			AimedDepartureTime: "2019-07-18T14:26:00+01:00",
+			AimedDepartureTime: test_helpers.ParseTime(t, "2019-07-18T14:26:00+01:00"),
 			DepartureStatus:    aws.String("Cancelled"),
 		}
 
@@ -817,7 +819,7 @@ func TestDeparture_IsExpired(t *testing.T) {
 	t.Run("train - returns false if the departure minute is in the future and the departure status is `Cancelled`", func(t *testing.T) {
 		dep := Departure{
 			JourneyType:        Train,
-			AimedDepartureTime: "2019-07-18T14:26:00+01:00",
+			AimedDepartureTime: test_helpers.ParseTime(t, "2019-07-18T14:26:00+01:00"),
 			DepartureStatus:    aws.String("Cancelled"),
 		}
 
@@ -836,7 +838,7 @@ func TestDeparture_IsExpired(t *testing.T) {
 	t.Run("train - returns false if the departure minute has passed and the departure status is `Delayed`", func(t *testing.T) {
 		dep := Departure{
 			JourneyType:        Train,
-			AimedDepartureTime: "2019-07-18T14:25:00+01:00",
+			AimedDepartureTime: test_helpers.ParseTime(t, "2019-07-18T14:25:00+01:00"),
 			DepartureStatus:    aws.String("Delayed"),
 		}
 
@@ -855,7 +857,7 @@ func TestDeparture_IsExpired(t *testing.T) {
 	t.Run("train - returns false if the departure minute is now and the departure status is `Delayed`", func(t *testing.T) {
 		dep := Departure{
 			JourneyType:        Train,
-			AimedDepartureTime: "2019-07-18T14:26:00+01:00",
+			AimedDepartureTime: test_helpers.ParseTime(t, "2019-07-18T14:26:00+01:00"),
 			DepartureStatus:    aws.String("Delayed"),
 		}
 
@@ -874,7 +876,7 @@ func TestDeparture_IsExpired(t *testing.T) {
 	t.Run("train - returns false if the departure minute is in the future and the departure status is `Delayed`", func(t *testing.T) {
 		dep := Departure{
 			JourneyType:        Train,
-			AimedDepartureTime: "2019-07-18T14:26:00+01:00",
+			AimedDepartureTime: test_helpers.ParseTime(t, "2019-07-18T14:26:00+01:00"),
 			DepartureStatus:    aws.String("Delayed"),
 		}
 
@@ -893,7 +895,7 @@ func TestDeparture_IsExpired(t *testing.T) {
 	t.Run("train - returns true if the departure status is a time and that time has passed", func(t *testing.T) {
 		dep := Departure{
 			JourneyType:        Train,
-			AimedDepartureTime: "2019-07-18T14:25:00+01:00",
+			AimedDepartureTime: test_helpers.ParseTime(t, "2019-07-18T14:25:00+01:00"),
 			DepartureStatus:    aws.String("14:26"),
 		}
 
@@ -912,7 +914,7 @@ func TestDeparture_IsExpired(t *testing.T) {
 	t.Run("train - returns false if the departure status is a time and that time is now", func(t *testing.T) {
 		dep := Departure{
 			JourneyType:        Train,
-			AimedDepartureTime: "2019-07-18T14:26:00+01:00",
+			AimedDepartureTime: test_helpers.ParseTime(t, "2019-07-18T14:26:00+01:00"),
 			DepartureStatus:    aws.String("14:27"),
 		}
 
@@ -931,7 +933,7 @@ func TestDeparture_IsExpired(t *testing.T) {
 	t.Run("train - returns false if the departure status is a time and that time is in the future", func(t *testing.T) {
 		dep := Departure{
 			JourneyType:        Train,
-			AimedDepartureTime: "2019-07-18T14:26:00+01:00",
+			AimedDepartureTime: test_helpers.ParseTime(t, "2019-07-18T14:26:00+01:00"),
 			DepartureStatus:    aws.String("14:28"),
 		}
 
@@ -946,107 +948,88 @@ func TestDeparture_IsExpired(t *testing.T) {
 			t.Errorf("got `%v`, want `%v` for departure is expired", got, false)
 		}
 	})
-}
-
-func Test_GetServiceNumberParts(t *testing.T) {
-	t.Run("returns prefix, digits and suffix", func(t *testing.T) {
-		d := Departure{
-			ServiceNumber: "X42A",
-		}
 
-		prefix, digits, suffix := d.GetServiceNumberParts()
-
-		if *prefix != "X" {
-			t.Errorf("Expected prefix `%s`, got `%s`", "X", *prefix)
+	t.Run("train - returns false if the departure status is a time more than two hours after now", func(t *testing.T) {
+		dep := Departure{
+			JourneyType:        Train,
+			AimedDepartureTime: test_helpers.ParseTime(t, "2019-07-18T14:26:00+01:00"),
+			DepartureStatus:    aws.String("16:45"),
 		}
 
-		if *digits != 42 {
-			t.Errorf("Expected suffix `%d`, got `%d`", 42, *digits)
+		now, err := time.Parse(time.RFC3339, "2019-07-18T14:30:00+01:00")
+		if err != nil {
+			t.Fatal(err)
 		}
 
-		if *suffix != "A" {
-			t.Errorf("Expected suffix `%s`, got `%s`", "A", *suffix)
-		}
+		test_helpers.AssertBoolean(t, dep.IsExpired(now), false)
 	})
 
-	t.Run("returns empty string for prefix when there isn't a prefix", func(t *testing.T) {
-		d := Departure{
-			ServiceNumber: "42A",
-		}
-
-		prefix, digits, suffix := d.GetServiceNumberParts()
-
-		if prefix != nil {
-			t.Errorf("Expected prefix `%v`, got `%v`", nil, &prefix)
-		}
-
-		if *digits != 42 {
-			t.Errorf("Expected suffix `%d`, got `%d`", 42, &digits)
+	t.Run("returns true if there is no departure time", func(t *testing.T) {
+		dep := Departure{
+			JourneyType: Bus,
 		}
 
-		if *suffix != "A" {
-			t.Errorf("Expected suffix `%s`, got `%s`", "A", *suffix)
-		}
+		test_helpers.AssertBoolean(t, dep.IsExpired(time.Now()), true)
 	})
 
-	t.Run("returns empty string for suffix when there isn't a suffix", func(t *testing.T) {
-		d := Departure{
-			ServiceNumber: "X42",
-		}
-
-		prefix, digits, suffix := d.GetServiceNumberParts()
-
-		if *prefix != "X" {
-			t.Errorf("Expected prefix `%s`, got `%s`", "X", *prefix)
+	t.Run("train - uses the departure time if there is no departure status", func(t *testing.T) {
+		dep := Departure{
+			JourneyType:        Train,
+			AimedDepartureTime: test_helpers.ParseTime(t, "2019-07-18T14:26:00+01:00"),
 		}
 
-		if *digits != 42 {
-			t.Errorf("Expected suffix `%d`, got `%d`", 42, &digits)
+		now, err := time.Parse(time.RFC3339, "2019-07-18T14:27:00+01:00")
+		if err != nil {
+			t.Fatal(err)
 		}
 
-		if suffix != nil {
-			t.Errorf("Expected suffix `%v`, got `%v`", nil, &suffix)
-		}
+		test_helpers.AssertBoolean(t, dep.IsExpired(now), true)
 	})
 
-	t.Run("returns empty string for prefix and suffix when there isn't a prefix or suffix", func(t *testing.T) {
-		d := Departure{
-			ServiceNumber: "42",
+	t.Run("bus - cancelled departures expire at their aimed departure time", func(t *testing.T) {
+		expectedDepartureTime := test_helpers.ParseTime(t, "2019-05-20T12:40:00+01:00")
+		dep := Departure{
+			JourneyType:           Bus,
+			AimedDepartureTime:    test_helpers.ParseTime(t, "2019-05-20T12:34:56+01:00"),
+			ExpectedDepartureTime: &expectedDepartureTime,
+			DepartureStatus:       aws.String(CancelledStatus),
 		}
 
-		prefix, digits, suffix := d.GetServiceNumberParts()
-
-		if prefix != nil {
-			t.Errorf("Expected prefix `%v`, got `%v`", nil, &prefix)
-		}
+		test_helpers.AssertBoolean(t, dep.IsExpired(test_helpers.ParseTime(t, "2019-05-20T12:34:56+01:00")), false)
+		test_helpers.AssertBoolean(t, dep.IsExpired(test_helpers.ParseTime(t, "2019-05-20T12:35:00+01:00")), true)
+	})
+}
 
-		if *digits != 42 {
-			t.Errorf("Expected suffix `%d`, got `%d`", 42, &digits)
+func TestDeparture_IsExpiredAfter(t *testing.T) {
+	t.Run("keeps cancelled departures for the period", func(t *testing.T) {
+		dep := Departure{
+			JourneyType:        Bus,
+			AimedDepartureTime: test_helpers.ParseTime(t, "2019-05-20T12:34:56+01:00"),
+			DepartureStatus:    aws.String(CancelledStatus),
 		}
 
-		if suffix != nil {
-			t.Errorf("Expected suffix `%v`, got `%v`", nil, &suffix)
-		}
+		test_helpers.AssertBoolean(t, dep.IsExpiredAfter(test_helpers.ParseTime(t, "2019-05-20T12:39:56+01:00"), 5*time.Minute), false)
+		test_helpers.AssertBoolean(t, dep.IsExpiredAfter(test_helpers.ParseTime(t, "2019-05-20T12:39:57+01:00"), 5*time.Minute), true)
 	})
 
-	t.Run("returns service numbers that are all letters as the prefix", func(t *testing.T) {
-		d := Departure{
-			ServiceNumber: "TP",
+	t.Run("keeps cancelled train departures until the minute after the period", func(t *testing.T) {
+		dep := Departure{
+			JourneyType:        Train,
+			AimedDepartureTime: test_helpers.ParseTime(t, "2019-05-20T12:34:00+01:00"),
+			DepartureStatus:    aws.String(CancelledStatus),
 		}
 
-		prefix, digits, suffix := d.GetServiceNumberParts()
-
-		if *prefix != "TP" {
-			t.Errorf("Expected prefix `%s`, got `%s`", "TP", *prefix)
-		}
+		test_helpers.AssertBoolean(t, dep.IsExpiredAfter(test_helpers.ParseTime(t, "2019-05-20T12:39:59+01:00"), 5*time.Minute), false)
+		test_helpers.AssertBoolean(t, dep.IsExpiredAfter(test_helpers.ParseTime(t, "2019-05-20T12:40:00+01:00"), 5*time.Minute), true)
+	})
 
-		if digits != nil {
-			t.Errorf("Expected suffix `%v`, got `%v`", nil, &digits)
+	t.Run("does not keep departures that are not cancelled", func(t *testing.T) {
+		dep := Departure{
+			JourneyType:        Bus,
+			AimedDepartureTime: test_helpers.ParseTime(t, "2019-05-20T12:34:56+01:00"),
 		}
 
-		if suffix != nil {
-			t.Errorf("Expected suffix `%v`, got `%v`", nil, &suffix)
-		}
+		test_helpers.AssertBoolean(t, dep.IsExpiredAfter(test_helpers.ParseTime(t, "2019-05-20T12:35:00+01:00"), 5*time.Minute), true)
 	})
 }
 
@@ -1160,3 +1143,37 @@ func TestDeparture_GetStand(t *testing.T) {
 		}
 	})
 }
+
+func TestDeparture_IsStale(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	expectedDepartureTime := test_helpers.AdjustTime(now, "5m")
+
+	t.Run("returns true if the prediction was recorded before the threshold", func(t *testing.T) {
+		dep := Departure{
+			RecordedAtTime:        test_helpers.AdjustTime(now, "-6m"),
+			AimedDepartureTime:    now,
+			ExpectedDepartureTime: &expectedDepartureTime,
+		}
+
+		test_helpers.AssertBoolean(t, dep.IsStale(now, 5*time.Minute), true)
+	})
+
+	t.Run("returns false if the prediction was recorded within the threshold", func(t *testing.T) {
+		dep := Departure{
+			RecordedAtTime:        test_helpers.AdjustTime(now, "-4m"),
+			AimedDepartureTime:    now,
+			ExpectedDepartureTime: &expectedDepartureTime,
+		}
+
+		test_helpers.AssertBoolean(t, dep.IsStale(now, 5*time.Minute), false)
+	})
+
+	t.Run("returns false if there is no prediction", func(t *testing.T) {
+		dep := Departure{
+			RecordedAtTime:     test_helpers.AdjustTime(now, "-6m"),
+			AimedDepartureTime: now,
+		}
+
+		test_helpers.AssertBoolean(t, dep.IsStale(now, 5*time.Minute), false)
+	})
+}
@@ -0,0 +1,107 @@
+package model
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MetrolinkDepartures a representation of the TfGM Metrolink public
+// departures feed
+type MetrolinkDepartures struct {
+	Value []MetrolinkPID `json:"value"`
+}
+
+// MetrolinkPID a representation of a passenger information display on a
+// Metrolink platform. Each display shows up to four trams in order of
+// departure, held in the numbered fields.
+type MetrolinkPID struct {
+	Id              int       `json:"Id"`
+	Line            string    `json:"Line"`
+	TLAREF          string    `json:"TLAREF"`
+	PIDREF          string    `json:"PIDREF"`
+	StationLocation string    `json:"StationLocation"`
+	AtcoCode        string    `json:"AtcoCode"`
+	Direction       string    `json:"Direction"`
+	Dest0           string    `json:"Dest0"`
+	Carriages0      string    `json:"Carriages0"`
+	Status0         string    `json:"Status0"`
+	Wait0           string    `json:"Wait0"`
+	Dest1           string    `json:"Dest1"`
+	Carriages1      string    `json:"Carriages1"`
+	Status1         string    `json:"Status1"`
+	Wait1           string    `json:"Wait1"`
+	Dest2           string    `json:"Dest2"`
+	Carriages2      string    `json:"Carriages2"`
+	Status2         string    `json:"Status2"`
+	Wait2           string    `json:"Wait2"`
+	Dest3           string    `json:"Dest3"`
+	Carriages3      string    `json:"Carriages3"`
+	Status3         string    `json:"Status3"`
+	Wait3           string    `json:"Wait3"`
+	MessageBoard    string    `json:"MessageBoard"`
+	LastUpdated     time.Time `json:"LastUpdated"`
+}
+
+// MetrolinkTram a tram shown on a passenger information display
+type MetrolinkTram struct {
+	// Slot is the position of the tram on the display, from 0
+	Slot        int
+	Destination string
+	Carriages   string
+	Status      string
+	// WaitMinutes is the number of minutes until the tram departs, relative to
+	// the time the display was last updated
+	WaitMinutes int
+}
+
+// Trams returns the trams shown on the display, skipping empty slots and
+// slots whose wait is not a number of minutes
+func (pid MetrolinkPID) Trams() []MetrolinkTram {
+	slots := []struct {
+		destination string
+		carriages   string
+		status      string
+		wait        string
+	}{
+		{pid.Dest0, pid.Carriages0, pid.Status0, pid.Wait0},
+		{pid.Dest1, pid.Carriages1, pid.Status1, pid.Wait1},
+		{pid.Dest2, pid.Carriages2, pid.Status2, pid.Wait2},
+		{pid.Dest3, pid.Carriages3, pid.Status3, pid.Wait3},
+	}
+
+	var trams []MetrolinkTram
+
+	for i, slot := range slots {
+		destination := strings.TrimSpace(slot.destination)
+		if destination == "" {
+			continue
+		}
+
+		waitMinutes, err := strconv.Atoi(strings.TrimSpace(slot.wait))
+		if err != nil {
+			continue
+		}
+
+		trams = append(trams, MetrolinkTram{
+			Slot:        i,
+			Destination: destination,
+			Carriages:   slot.carriages,
+			Status:      slot.status,
+			WaitMinutes: waitMinutes,
+		})
+	}
+
+	return trams
+}
+
+// ParseMetrolinkDepartures reads the Metrolink departures feed from JSON
+func ParseMetrolinkDepartures(data []byte) (*MetrolinkDepartures, error) {
+	departures := MetrolinkDepartures{}
+	if err := json.Unmarshal(data, &departures); err != nil {
+		return nil, err
+	}
+
+	return &departures, nil
+}
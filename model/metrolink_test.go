@@ -0,0 +1,56 @@
+package model
+
+import (
+	"github.com/TfGMEnterprise/departures-service/test_helpers"
+	"io/ioutil"
+	"testing"
+)
+
+func TestParseMetrolinkDepartures(t *testing.T) {
+	data, err := ioutil.ReadFile("../test_resources/MetrolinkDepartures.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	feed, err := ParseMetrolinkDepartures(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(feed.Value) != 4 {
+		t.Fatalf("got %d displays, want %d", len(feed.Value), 4)
+	}
+
+	pid := feed.Value[0]
+	test_helpers.AssertString(t, pid.AtcoCode, "9400ZZMAMCU2")
+	test_helpers.AssertBoolean(t, pid.LastUpdated.Equal(test_helpers.ParseTime(t, "2019-07-30T14:12:37Z")), true)
+
+	t.Run("returns the trams in each slot", func(t *testing.T) {
+		trams := pid.Trams()
+		if len(trams) != 3 {
+			t.Fatalf("got %d trams, want %d", len(trams), 3)
+		}
+
+		test_helpers.AssertString(t, trams[1].Destination, "Etihad Campus")
+		test_helpers.AssertString(t, trams[1].Carriages, "Double")
+		test_helpers.AssertString(t, trams[1].Status, "Due")
+
+		if trams[1].Slot != 1 || trams[1].WaitMinutes != 11 {
+			t.Errorf("got slot %d waiting %d minutes, want slot %d waiting %d minutes", trams[1].Slot, trams[1].WaitMinutes, 1, 11)
+		}
+	})
+
+	t.Run("skips slots without a destination or wait", func(t *testing.T) {
+		trams := feed.Value[2].Trams()
+		if len(trams) != 2 {
+			t.Fatalf("got %d trams, want %d", len(trams), 2)
+		}
+
+		test_helpers.AssertString(t, trams[0].Destination, "Terminates Here")
+		test_helpers.AssertString(t, trams[1].Destination, "Eccles")
+
+		if trams := feed.Value[3].Trams(); len(trams) != 0 {
+			t.Errorf("got %d trams, want %d", len(trams), 0)
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package model
+
+import (
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+// Token kinds are declared in sort order: separators are positioned before
+// digits, which are positioned before letters
+const (
+	separatorToken tokenKind = iota
+	digitToken
+	letterToken
+)
+
+type serviceNumberToken struct {
+	kind  tokenKind
+	value string
+}
+
+// CompareServiceNumbers compares two service numbers in natural order,
+// returning -1 if a is positioned before b, 1 if a is positioned after b and 0
+// if they are identical.
+//
+// Service numbers are split into runs of digits, letters and separators, then
+// compared run by run. Digit runs are compared by their numeric value, so `12`
+// is positioned before `123` and `1000`; letter runs are compared without
+// regard to case. A service number that runs out of tokens first is positioned
+// first, so `12` is positioned before `12A` and `X43` before `X43/X44`.
+func CompareServiceNumbers(a, b string) int {
+	aTokens := tokeniseServiceNumber(a)
+	bTokens := tokeniseServiceNumber(b)
+
+	for i := 0; i < len(aTokens) && i < len(bTokens); i++ {
+		if result := compareServiceNumberTokens(aTokens[i], bTokens[i]); result != 0 {
+			return result
+		}
+	}
+
+	if len(aTokens) != len(bTokens) {
+		return compareInts(len(aTokens), len(bTokens))
+	}
+
+	// Service numbers that differ only by case or leading zeros are ordered
+	// by their raw value so that the order is deterministic
+	return strings.Compare(a, b)
+}
+
+func tokeniseServiceNumber(serviceNumber string) []serviceNumberToken {
+	var tokens []serviceNumberToken
+
+	for _, r := range serviceNumber {
+		kind := separatorToken
+		if r >= '0' && r <= '9' {
+			kind = digitToken
+		} else if unicode.IsLetter(r) {
+			kind = letterToken
+		}
+
+		last := len(tokens) - 1
+		if last >= 0 && tokens[last].kind == kind {
+			tokens[last].value += string(r)
+			continue
+		}
+
+		tokens = append(tokens, serviceNumberToken{kind: kind, value: string(r)})
+	}
+
+	return tokens
+}
+
+func compareServiceNumberTokens(a, b serviceNumberToken) int {
+	if a.kind != b.kind {
+		return compareInts(int(a.kind), int(b.kind))
+	}
+
+	switch a.kind {
+	case digitToken:
+		aDigits := strings.TrimLeft(a.value, "0")
+		bDigits := strings.TrimLeft(b.value, "0")
+
+		// Without leading zeros, a longer run of digits is a larger number
+		if len(aDigits) != len(bDigits) {
+			return compareInts(len(aDigits), len(bDigits))
+		}
+
+		return strings.Compare(aDigits, bDigits)
+	case letterToken:
+		return strings.Compare(strings.ToUpper(a.value), strings.ToUpper(b.value))
+	default:
+		return strings.Compare(a.value, b.value)
+	}
+}
+
+func compareInts(a, b int) int {
+	if a < b {
+		return -1
+	}
+
+	if a > b {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,133 @@
+package model
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"io/ioutil"
+	"testing"
+)
+
+// sortedServiceNumbers lists every line name in the TXC test dataset alongside
+// Greater Manchester line names that do not fit a simple service number
+// pattern, in their expected order
+var sortedServiceNumbers = []string{
+	"",
+	"01",
+	"1",
+	"2",
+	"12",
+	"12/13",
+	"12A",
+	"12a",
+	"12B",
+	"19",
+	"50",
+	"123",
+	"192",
+	"232",
+	"500",
+	"525",
+	"1000",
+	"A12",
+	"A12B",
+	"Airport Express",
+	"B12",
+	"Metrolink",
+	"TP",
+	"V1",
+	"V1a",
+	"V2",
+	"X43",
+	"X43/X44",
+	"X50",
+}
+
+func TestCompareServiceNumbers(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want int
+	}{
+		{"identical service numbers", "42", "42", 0},
+		{"digits by numeric value", "12", "123", -1},
+		{"digits longer than three characters", "1000", "999", 1},
+		{"no suffix before a suffix", "12", "12A", -1},
+		{"suffixes alphabetically", "12A", "12B", -1},
+		{"no prefix before a prefix", "12", "A12", -1},
+		{"prefixes alphabetically", "A12", "B12", -1},
+		{"lower case suffix", "V1a", "V1B", -1},
+		{"combined line names after their first line", "X43/X44", "X43", 1},
+		{"separators before letters", "12/13", "12A", -1},
+		{"named services after numbered services", "Metrolink", "525", 1},
+		{"named services alphabetically", "Metrolink", "TP", -1},
+		{"empty service number first", "", "1", -1},
+		{"leading zeros by raw value", "01", "1", -1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := CompareServiceNumbers(test.a, test.b); got != test.want {
+				t.Errorf("got `%d`, want `%d` comparing `%s` with `%s`", got, test.want, test.a, test.b)
+			}
+
+			if got := CompareServiceNumbers(test.b, test.a); got != -test.want {
+				t.Errorf("got `%d`, want `%d` comparing `%s` with `%s`", got, -test.want, test.b, test.a)
+			}
+		})
+	}
+}
+
+func TestCompareServiceNumbers_SortedServiceNumbers(t *testing.T) {
+	for i, a := range sortedServiceNumbers {
+		for j, b := range sortedServiceNumbers {
+			want := compareInts(i, j)
+			if got := CompareServiceNumbers(a, b); got != want {
+				t.Errorf("got `%d`, want `%d` comparing `%s` with `%s`", got, want, a, b)
+			}
+		}
+	}
+}
+
+func TestCompareServiceNumbers_TXCLineNames(t *testing.T) {
+	r, err := zip.OpenReader("../test_resources/txc.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	known := make(map[string]bool)
+	for _, serviceNumber := range sortedServiceNumbers {
+		known[serviceNumber] = true
+	}
+
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		txc := TransXChange{}
+		if err := xml.Unmarshal(data, &txc); err != nil {
+			t.Fatalf("cannot unmarshal %s: %v", f.Name, err)
+		}
+
+		for _, service := range txc.Services.Service {
+			for _, line := range service.Lines.Line {
+				if !known[line.LineName] {
+					t.Errorf("line name `%s` in %s is missing from sortedServiceNumbers", line.LineName, f.Name)
+				}
+			}
+		}
+	}
+}
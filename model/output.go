@@ -9,6 +9,7 @@ type Output struct {
 
 // DepartureDisplay contains:
 // departure time - either as a countdown for real-time data, or HH:MM for scheduled data;
+// real time - whether the departure time is from a real-time prediction;
 // stand - a one- or two-character string for a bus station stand, or nil if there isn't one;
 // service number - the bus service number, including prefix and suffix if applicable; and
 // destination - where the bus is going: typically would be the end point of the route, but
@@ -16,10 +17,36 @@ type Output struct {
 // departure status - a text string used for rail departures to represent the status of
 //   the departure; e.g. "On time", "Delayed", "Cancelled", or the estimated departure time
 //   ("15:04")
+// location ATCO code - the stop the departure is from; only set when departures
+//   for several stops are merged into a single board
+// origin - where the journey started; only set on an arrivals board, where the
+//   departure time and status hold the arrival time and status
 type DepartureDisplay struct {
-	DepartureTime   string  `json:"departureTime,omitempty"`
-	Stand           *string `json:"stand,omitempty"`
-	ServiceNumber   string  `json:"serviceNumber,omitempty"`
-	Destination     string  `json:"destination,omitempty"`
-	DepartureStatus *string `json:"departureStatus,omitempty"`
+	DepartureTime    string  `json:"departureTime,omitempty"`
+	RealTime         bool    `json:"realTime"`
+	Stand            *string `json:"stand,omitempty"`
+	ServiceNumber    string  `json:"serviceNumber,omitempty"`
+	Destination      string  `json:"destination,omitempty"`
+	DepartureStatus  *string `json:"departureStatus,omitempty"`
+	LocationAtcocode string  `json:"locationAtcocode,omitempty"`
+	Origin           string  `json:"origin,omitempty"`
+}
+
+// ErrorOutput contains:
+// code - a machine-readable error code; e.g. "invalidParameter", "stopNotFound"
+// message - a human-readable description of the error
+type ErrorOutput struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// BatchOutput contains a board for each stop in a batch request, keyed by
+// ATCO code
+type BatchOutput map[string]BatchBoard
+
+// BatchBoard contains either the output for a stop, or the error that
+// prevented the board for that stop from being returned
+type BatchBoard struct {
+	*Output
+	Error *ErrorOutput `json:"error,omitempty"`
 }
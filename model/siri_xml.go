@@ -0,0 +1,99 @@
+package model
+
+import (
+	"encoding/xml"
+	"reflect"
+)
+
+// SIRI namespace and version used when marshalling SIRI data
+const (
+	SiriNamespace = "http://www.siri.org.uk/siri"
+	SiriVersion   = "1.3"
+)
+
+// marshalNonZeroFields encodes each field of a struct as a child element
+// named after the field, omitting any fields that hold their zero value.
+// The SIRI structs have no XML tags, so without this the encoder would
+// output empty elements and zero timestamps for every unset field.
+func marshalNonZeroFields(e *xml.Encoder, start xml.StartElement, v interface{}) error {
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	val := reflect.ValueOf(v)
+	typ := val.Type()
+
+	for i := 0; i < val.NumField(); i++ {
+		field := val.Field(i)
+
+		if reflect.DeepEqual(field.Interface(), reflect.Zero(field.Type()).Interface()) {
+			continue
+		}
+
+		if err := e.EncodeElement(field.Interface(), xml.StartElement{Name: xml.Name{Local: typ.Field(i).Name}}); err != nil {
+			return err
+		}
+	}
+
+	return e.EncodeToken(start.End())
+}
+
+// MarshalXML encodes the Siri root element with the SIRI namespace and version
+func (s Siri) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Name = xml.Name{Local: "Siri"}
+	start.Attr = []xml.Attr{
+		{Name: xml.Name{Local: "xmlns"}, Value: SiriNamespace},
+		{Name: xml.Name{Local: "version"}, Value: SiriVersion},
+	}
+
+	return marshalNonZeroFields(e, start, s)
+}
+
+func (ec ErrorCondition) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return marshalNonZeroFields(e, start, ec)
+}
+
+func (ex Extensions) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return marshalNonZeroFields(e, start, ex)
+}
+
+func (f FramedVehicleJourneyRef) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return marshalNonZeroFields(e, start, f)
+}
+
+func (mc MonitoredCall) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return marshalNonZeroFields(e, start, mc)
+}
+
+func (msv MonitoredStopVisit) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return marshalNonZeroFields(e, start, msv)
+}
+
+func (mvj MonitoredVehicleJourney) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return marshalNonZeroFields(e, start, mvj)
+}
+
+func (sd ServiceDelivery) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return marshalNonZeroFields(e, start, sd)
+}
+
+func (sr ServiceRequest) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return marshalNonZeroFields(e, start, sr)
+}
+
+// MarshalXML encodes the StopMonitoringDelivery element with the SIRI version
+func (smd StopMonitoringDelivery) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Attr = []xml.Attr{
+		{Name: xml.Name{Local: "version"}, Value: SiriVersion},
+	}
+
+	return marshalNonZeroFields(e, start, smd)
+}
+
+func (smr StopMonitoringRequest) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return marshalNonZeroFields(e, start, smr)
+}
+
+func (vl VehicleLocation) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return marshalNonZeroFields(e, start, vl)
+}
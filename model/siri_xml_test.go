@@ -0,0 +1,93 @@
+package model
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+)
+
+func TestSiri_MarshalXML(t *testing.T) {
+	t.Run("omits unset elements", func(t *testing.T) {
+		responseTimestamp := time.Date(2019, 5, 8, 23, 30, 0, 0, time.UTC)
+
+		siri := Siri{
+			ServiceDelivery: ServiceDelivery{
+				ResponseTimestamp: responseTimestamp,
+				ProducerRef:       "TfGM",
+				Status:            true,
+				StopMonitoringDelivery: StopMonitoringDelivery{
+					ResponseTimestamp: responseTimestamp,
+					Status:            true,
+					MonitoredStopVisit: []MonitoredStopVisit{
+						{
+							MonitoringRef: "1800BNIN0C1",
+							MonitoredVehicleJourney: MonitoredVehicleJourney{
+								LineRef:         "123",
+								DestinationName: "Hobbiton",
+								MonitoredCall: MonitoredCall{
+									StopPointRef:       "1800BNIN0C1",
+									AimedDepartureTime: time.Date(2019, 5, 8, 23, 34, 0, 0, time.UTC),
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+
+		got, err := xml.Marshal(siri)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := `<Siri xmlns="http://www.siri.org.uk/siri" version="1.3">` +
+			`<ServiceDelivery>` +
+			`<ResponseTimestamp>2019-05-08T23:30:00Z</ResponseTimestamp>` +
+			`<ProducerRef>TfGM</ProducerRef>` +
+			`<Status>true</Status>` +
+			`<StopMonitoringDelivery version="1.3">` +
+			`<ResponseTimestamp>2019-05-08T23:30:00Z</ResponseTimestamp>` +
+			`<Status>true</Status>` +
+			`<MonitoredStopVisit>` +
+			`<MonitoringRef>1800BNIN0C1</MonitoringRef>` +
+			`<MonitoredVehicleJourney>` +
+			`<LineRef>123</LineRef>` +
+			`<DestinationName>Hobbiton</DestinationName>` +
+			`<MonitoredCall>` +
+			`<StopPointRef>1800BNIN0C1</StopPointRef>` +
+			`<AimedDepartureTime>2019-05-08T23:34:00Z</AimedDepartureTime>` +
+			`</MonitoredCall>` +
+			`</MonitoredVehicleJourney>` +
+			`</MonitoredStopVisit>` +
+			`</StopMonitoringDelivery>` +
+			`</ServiceDelivery>` +
+			`</Siri>`
+
+		if string(got) != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	})
+
+	t.Run("can be unmarshalled", func(t *testing.T) {
+		siri := Siri{
+			ServiceDelivery: ServiceDelivery{
+				ProducerRef: "TfGM",
+				Status:      true,
+			},
+		}
+
+		b, err := xml.Marshal(siri)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := Siri{}
+		if err := xml.Unmarshal(b, &got); err != nil {
+			t.Fatal(err)
+		}
+
+		if got.ServiceDelivery.ProducerRef != "TfGM" || !got.ServiceDelivery.Status {
+			t.Errorf("unexpected result: %#v", got)
+		}
+	})
+}
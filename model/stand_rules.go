@@ -0,0 +1,138 @@
+package model
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// StandIndicatorKeyPrefix prefixes the ATCO code in the key holding the
+// NaPTAN Indicator of a stop in the stops in area cache
+const StandIndicatorKeyPrefix = "indicator:"
+
+// StandRule extracts the stand identifier from the ATCO codes starting with
+// AtcocodePrefix. Pattern is matched against the upper case ATCO code and must
+// capture the stand identifier in a group named `stand`.
+type StandRule struct {
+	AtcocodePrefix string `json:"atcocodePrefix"`
+	Pattern        string `json:"pattern"`
+	pattern        *regexp.Regexp
+	standIndex     int
+}
+
+// StandRules holds the stand rules for each ATCO region
+type StandRules struct {
+	rules []StandRule
+}
+
+// DefaultStandRules matches the Greater Manchester bus station and
+// interchange stands
+var DefaultStandRules = mustParseStandRules([]byte(`{
+	"rules": [
+		{"atcocodePrefix": "180", "pattern": "^180[A-Z0-9][A-Z]{2}(BS|IC|IN)(?P<stand>[A-Z0-9]{2})[0-9]$"}
+	]
+}`))
+
+// standIndicatorRegexp matches NaPTAN Indicator values that name a stand; e.g.
+// `Stand A`; `Stop K`
+var standIndicatorRegexp = regexp.MustCompile(`^(?i)(stand|stop|stance|bay)\s+([A-Z0-9]{1,3})$`)
+
+// ParseStandRules reads stand rules from JSON. Where more than one rule
+// applies to an ATCO code, the rule with the longest prefix is tried first,
+// then the remaining rules in the order given.
+func ParseStandRules(rulesJSON []byte) (*StandRules, error) {
+	config := struct {
+		Rules []StandRule `json:"rules"`
+	}{}
+
+	if err := json.Unmarshal(rulesJSON, &config); err != nil {
+		return nil, errors.Wrap(err, "cannot parse stand rules")
+	}
+
+	for i := range config.Rules {
+		rule := &config.Rules[i]
+
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot compile stand rule for ATCO prefix `%s`", rule.AtcocodePrefix)
+		}
+
+		rule.standIndex = -1
+		for index, name := range pattern.SubexpNames() {
+			if name == "stand" {
+				rule.standIndex = index
+			}
+		}
+
+		if rule.standIndex < 0 {
+			return nil, errors.Errorf("stand rule for ATCO prefix `%s` has no `stand` group", rule.AtcocodePrefix)
+		}
+
+		rule.AtcocodePrefix = strings.ToUpper(rule.AtcocodePrefix)
+		rule.pattern = pattern
+	}
+
+	sort.SliceStable(config.Rules, func(i, j int) bool {
+		return len(config.Rules[i].AtcocodePrefix) > len(config.Rules[j].AtcocodePrefix)
+	})
+
+	return &StandRules{rules: config.Rules}, nil
+}
+
+func mustParseStandRules(rulesJSON []byte) *StandRules {
+	rules, err := ParseStandRules(rulesJSON)
+	if err != nil {
+		panic(err)
+	}
+
+	return rules
+}
+
+// Stand returns the stand identifier for the ATCO code from the first rule
+// that matches it, or nil if no rule matches. Leading zeros are removed from
+// the identifier, so `0A` becomes `A`.
+func (r *StandRules) Stand(atcocode string) *string {
+	atcocode = strings.ToUpper(atcocode)
+
+	for _, rule := range r.rules {
+		if !strings.HasPrefix(atcocode, rule.AtcocodePrefix) {
+			continue
+		}
+
+		matches := rule.pattern.FindStringSubmatch(atcocode)
+		if matches == nil {
+			continue
+		}
+
+		stand := trimStandZeros(matches[rule.standIndex])
+		if stand == "" {
+			continue
+		}
+
+		return &stand
+	}
+
+	return nil
+}
+
+// StandFromIndicator returns the stand identifier from a NaPTAN Indicator
+// such as `Stand A` or `Stop K`, or nil if the indicator does not name a stand
+func StandFromIndicator(indicator string) *string {
+	matches := standIndicatorRegexp.FindStringSubmatch(strings.TrimSpace(indicator))
+	if matches == nil {
+		return nil
+	}
+
+	stand := trimStandZeros(strings.ToUpper(matches[2]))
+	return &stand
+}
+
+func trimStandZeros(stand string) string {
+	for len(stand) > 1 && stand[0] == '0' {
+		stand = stand[1:]
+	}
+
+	return stand
+}
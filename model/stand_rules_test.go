@@ -0,0 +1,88 @@
+package model
+
+import (
+	"github.com/TfGMEnterprise/departures-service/test_helpers"
+	"github.com/aws/aws-sdk-go/aws"
+	"testing"
+)
+
+func TestParseStandRules(t *testing.T) {
+	t.Run("tries the rule with the longest prefix first", func(t *testing.T) {
+		rules, err := ParseStandRules([]byte(`{
+			"rules": [
+				{"atcocodePrefix": "2", "pattern": "^2[0-9]{3}(?P<stand>[A-Z]{1,2})[0-9]*$"},
+				{"atcocodePrefix": "250", "pattern": "^250[0-9]BS(?P<stand>[0-9]{2})$"}
+			]
+		}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stand := rules.Stand("2500BS07")
+		if stand == nil {
+			t.Fatal("expected a stand")
+		}
+		test_helpers.AssertString(t, *stand, "7")
+
+		stand = rules.Stand("2123C")
+		if stand == nil {
+			t.Fatal("expected a stand")
+		}
+		test_helpers.AssertString(t, *stand, "C")
+	})
+
+	t.Run("returns nil if no rule applies", func(t *testing.T) {
+		if stand := DefaultStandRules.Stand("2500IMG3851"); stand != nil {
+			t.Errorf("got `%s`, want `%v`", *stand, nil)
+		}
+	})
+
+	t.Run("rejects a rule without a stand group", func(t *testing.T) {
+		_, err := ParseStandRules([]byte(`{"rules": [{"atcocodePrefix": "180", "pattern": "^180(BS|IC|IN)[A-Z]$"}]}`))
+		if err == nil {
+			t.Fatal("Should return an error!")
+		}
+
+		test_helpers.AssertString(t, err.Error(), "stand rule for ATCO prefix `180` has no `stand` group")
+	})
+
+	t.Run("rejects an invalid pattern", func(t *testing.T) {
+		if _, err := ParseStandRules([]byte(`{"rules": [{"atcocodePrefix": "180", "pattern": "^180(?P<stand>[A-Z]$"}]}`)); err == nil {
+			t.Error("Should return an error!")
+		}
+	})
+}
+
+func TestStandFromIndicator(t *testing.T) {
+	tests := []struct {
+		indicator string
+		want      *string
+	}{
+		{"Stand G", aws.String("G")},
+		{"Stop K", aws.String("K")},
+		{"stand 03", aws.String("3")},
+		{"Bay 12", aws.String("12")},
+		{"Nr Market", nil},
+		{"opp", nil},
+		{"", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.indicator, func(t *testing.T) {
+			got := StandFromIndicator(test.indicator)
+
+			if test.want == nil {
+				if got != nil {
+					t.Errorf("got `%s`, want `%v`", *got, nil)
+				}
+				return
+			}
+
+			if got == nil {
+				t.Fatalf("got `%v`, want `%s`", got, *test.want)
+			}
+
+			test_helpers.AssertString(t, *got, *test.want)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError lists every problem found with a departure record
+type ValidationError struct {
+	JourneyRef       string
+	LocationAtcocode string
+	Problems         []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid departure `%s` at location `%s`: %s", e.JourneyRef, e.LocationAtcocode, strings.Join(e.Problems, "; "))
+}
+
+// Validate checks that the departure can be safely sorted, expired and
+// presented. It returns a *ValidationError describing every problem found, or
+// nil if the departure is valid.
+func (d Departure) Validate() error {
+	var problems []string
+
+	if d.JourneyRef == "" {
+		problems = append(problems, "journeyRef is missing")
+	}
+
+	if d.LocationAtcocode == "" {
+		problems = append(problems, "locationAtcocode is missing")
+	}
+
+	switch d.JourneyType {
+	case "", Bus, Train, Tram:
+	default:
+		problems = append(problems, fmt.Sprintf("journeyType `%s` is not recognised", d.JourneyType))
+	}
+
+	// A journey that terminates at the location only has an arrival time
+	if !d.HasDeparture() && !d.HasArrival() {
+		problems = append(problems, "aimedDepartureTime is missing")
+	}
+
+	if d.JourneyType == Train && d.HasDeparture() && d.DepartureStatus == nil {
+		problems = append(problems, "departureStatus is missing for a train departure")
+	}
+
+	if d.JourneyType == Train && d.HasArrival() && d.ArrivalStatus == nil {
+		problems = append(problems, "arrivalStatus is missing for a train arrival")
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return &ValidationError{
+		JourneyRef:       d.JourneyRef,
+		LocationAtcocode: d.LocationAtcocode,
+		Problems:         problems,
+	}
+}
+
+// RemoveInvalidDepartures removes any departures that fail validation,
+// returning the validation error for each one removed
+func (a *Internal) RemoveInvalidDepartures() []error {
+	var errs []error
+
+	i := 0
+	for _, departure := range a.Departures {
+		if err := departure.Validate(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		a.Departures[i] = departure
+		i++
+	}
+
+	a.Departures = a.Departures[:i]
+
+	return errs
+}
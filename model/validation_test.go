@@ -0,0 +1,136 @@
+package model
+
+import (
+	"github.com/TfGMEnterprise/departures-service/test_helpers"
+	"github.com/aws/aws-sdk-go/aws"
+	"testing"
+)
+
+func TestDeparture_Validate(t *testing.T) {
+	t.Run("returns nil for a valid bus departure", func(t *testing.T) {
+		dep := Departure{
+			RecordedAtTime:        test_helpers.ParseTime(t, "2019-07-18T14:20:00+01:00"),
+			JourneyType:           Bus,
+			JourneyRef:            "2019-07-18_1234",
+			AimedDepartureTime:    test_helpers.ParseTime(t, "2019-07-18T14:26:00+01:00"),
+			ExpectedDepartureTime: aws.Time(test_helpers.ParseTime(t, "2019-07-18T14:27:00+01:00")),
+			LocationAtcocode:      "1800BNIN0C1",
+			ServiceNumber:         "X42A",
+		}
+
+		if err := dep.Validate(); err != nil {
+			t.Errorf("got `%v`, want `%v`", err, nil)
+		}
+	})
+
+	t.Run("returns nil for a valid train departure", func(t *testing.T) {
+		dep := Departure{
+			JourneyType:        Train,
+			JourneyRef:         "abc123",
+			AimedDepartureTime: test_helpers.ParseTime(t, "2019-07-18T14:26:00+01:00"),
+			DepartureStatus:    aws.String("On time"),
+			LocationAtcocode:   "9100MNCRPIC",
+		}
+
+		if err := dep.Validate(); err != nil {
+			t.Errorf("got `%v`, want `%v`", err, nil)
+		}
+	})
+
+	t.Run("returns nil for a train that terminates at the location", func(t *testing.T) {
+		dep := Departure{
+			JourneyType:      Train,
+			JourneyRef:       "abc123",
+			AimedArrivalTime: test_helpers.ParseTime(t, "2019-07-18T14:26:00+01:00"),
+			ArrivalStatus:    aws.String("On time"),
+			LocationAtcocode: "9100MNCRPIC",
+		}
+
+		if err := dep.Validate(); err != nil {
+			t.Errorf("got `%v`, want `%v`", err, nil)
+		}
+	})
+
+	t.Run("reports every problem with the departure", func(t *testing.T) {
+		dep := Departure{
+			JourneyType:   JourneyType("ferry"),
+			ServiceNumber: "X43/X44",
+		}
+
+		err := dep.Validate()
+
+		validationErr, ok := err.(*ValidationError)
+		if !ok {
+			t.Fatalf("got `%T`, want `%T`", err, &ValidationError{})
+		}
+
+		want := []string{
+			"journeyRef is missing",
+			"locationAtcocode is missing",
+			"journeyType `ferry` is not recognised",
+			"aimedDepartureTime is missing",
+		}
+
+		if len(validationErr.Problems) != len(want) {
+			t.Fatalf("got %d problems `%v`, want %d", len(validationErr.Problems), validationErr.Problems, len(want))
+		}
+
+		for i, problem := range want {
+			test_helpers.AssertString(t, validationErr.Problems[i], problem)
+		}
+	})
+
+	t.Run("requires a departure status for train departures", func(t *testing.T) {
+		dep := Departure{
+			JourneyType:        Train,
+			JourneyRef:         "abc123",
+			AimedDepartureTime: test_helpers.ParseTime(t, "2019-07-18T14:26:00+01:00"),
+			LocationAtcocode:   "9100MNCRPIC",
+		}
+
+		err := dep.Validate()
+		if err == nil {
+			t.Fatal("expected an error for a train departure without a status")
+		}
+
+		test_helpers.AssertString(t, err.Error(), "invalid departure `abc123` at location `9100MNCRPIC`: departureStatus is missing for a train departure")
+	})
+	t.Run("requires an arrival status for train arrivals", func(t *testing.T) {
+		dep := Departure{
+			JourneyType:      Train,
+			JourneyRef:       "abc123",
+			AimedArrivalTime: test_helpers.ParseTime(t, "2019-07-18T14:26:00+01:00"),
+			LocationAtcocode: "9100MNCRPIC",
+		}
+
+		err := dep.Validate()
+		if err == nil {
+			t.Fatal("expected an error for a train arrival without a status")
+		}
+
+		test_helpers.AssertString(t, err.Error(), "invalid departure `abc123` at location `9100MNCRPIC`: arrivalStatus is missing for a train arrival")
+	})
+}
+
+func TestInternal_RemoveInvalidDepartures(t *testing.T) {
+	departures := Internal{
+		Departures: []Departure{
+			{JourneyRef: "1", AimedDepartureTime: test_helpers.ParseTime(t, "2019-07-18T14:26:00+01:00"), LocationAtcocode: "1800BNIN0C1"},
+			{JourneyRef: "2", LocationAtcocode: "1800BNIN0C1"},
+			{JourneyRef: "3", AimedDepartureTime: test_helpers.ParseTime(t, "2019-07-18T14:28:00+01:00"), LocationAtcocode: "1800BNIN0C1"},
+		},
+	}
+
+	errs := departures.RemoveInvalidDepartures()
+
+	if len(errs) != 1 {
+		t.Fatalf("got %d errors, want %d", len(errs), 1)
+	}
+
+	if len(departures.Departures) != 2 {
+		t.Fatalf("got %d departures, want %d", len(departures.Departures), 2)
+	}
+
+	test_helpers.AssertString(t, departures.Departures[0].JourneyRef, "1")
+	test_helpers.AssertString(t, departures.Departures[1].JourneyRef, "3")
+}
@@ -1,17 +1,19 @@
 package main
 
 import (
-	"encoding/json"
 	"github.com/ChannelMeter/iso8601duration"
 	"github.com/TfGMEnterprise/departures-service/dlog"
 	"github.com/TfGMEnterprise/departures-service/model"
 	optis_client "github.com/TfGMEnterprise/departures-service/optis-client"
+	"github.com/TfGMEnterprise/departures-service/repository"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sns"
 	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/gomodule/redigo/redis"
 	"github.com/pkg/errors"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
@@ -20,6 +22,15 @@ import (
 	"time"
 )
 
+const (
+	// producerName identifies the poller in the envelope of each published message
+	producerName = "optis-poller"
+
+	// sourceFeed identifies the OPTIS SIRI-SM feed in the envelope of each
+	// published message
+	sourceFeed = "optis-siri-sm"
+)
+
 // BusStation is the location we are requesting data for
 type BusStation struct {
 	Atcocode string `json:"atcocode"`
@@ -33,6 +44,14 @@ type OptisPoller struct {
 	OptisRequestorRef      string
 	SNSClient              snsiface.SNSAPI
 	SNSTopicARN            *string
+	// Clock returns the current time; time.Now is used if it is not set
+	Clock func() time.Time
+	// StandRules extract the stand from the ATCO code of each stop; the default
+	// stand rules are used if it is not set
+	StandRules *model.StandRules
+	// StopsInAreaPool holds the NaPTAN Indicator of each stop, used for stops
+	// that no stand rule matches; indicators are not used if it is not set
+	StopsInAreaPool *redis.Pool
 }
 
 func main() {
@@ -110,6 +129,34 @@ func main() {
 		OptisAPIKey: optisAPIKey,
 	}
 
+	standRules := model.DefaultStandRules
+
+	standRulesFile, exists := os.LookupEnv("STAND_RULES_FILE")
+	if exists && standRulesFile != "" {
+		standRulesJSON, err := ioutil.ReadFile(standRulesFile)
+		if err != nil {
+			logger.Fatal(errors.Wrapf(err, "cannot read STAND_RULES_FILE `%s`", standRulesFile))
+			return
+		}
+
+		standRules, err = model.ParseStandRules(standRulesJSON)
+		if err != nil {
+			logger.Fatal(errors.Wrapf(err, "STAND_RULES_FILE `%s` is not valid", standRulesFile))
+			return
+		}
+	}
+
+	var stopsInAreaPool *redis.Pool
+
+	stopsInAreaRedisHost, exists := os.LookupEnv("STOPS_IN_AREA_REDIS_HOST")
+	if exists && stopsInAreaRedisHost != "" {
+		stopsInAreaPool = repository.NewRedisPool([]repository.RedisPoolOption{
+			repository.RedisPoolDial(func() (redis.Conn, error) {
+				return redis.Dial("tcp", stopsInAreaRedisHost)
+			}),
+		}...)
+	}
+
 	sess := session.Must(session.NewSession())
 
 	snsClient := *sns.New(sess)
@@ -122,11 +169,34 @@ func main() {
 		OptisRequestorRef:      optisRequestorRef,
 		SNSClient:              &snsClient,
 		SNSTopicARN:            &snsTopicURN,
+		Clock:                  time.Now,
+		StandRules:             standRules,
+		StopsInAreaPool:        stopsInAreaPool,
+	}
+
+	if op.StopsInAreaPool != nil {
+		defer func() {
+			op.Logger.Debug("close stops in area Redis pool")
+			if err := op.StopsInAreaPool.Close(); err != nil {
+				op.Logger.Print("failed to close stops in area Redis pool")
+				return
+			}
+			op.Logger.Debug("closed stops in area Redis pool")
+		}()
 	}
 
 	lambda.Start(op.Handler)
 }
 
+// now returns the current time from the poller clock
+func (op *OptisPoller) now() time.Time {
+	if op.Clock == nil {
+		return time.Now()
+	}
+
+	return op.Clock()
+}
+
 func (op *OptisPoller) Handler(busStation BusStation) error {
 	op.Logger.Debug("Handler")
 
@@ -140,11 +210,19 @@ func (op *OptisPoller) Handler(busStation BusStation) error {
 		return errors.Wrap(err, "request to OPTIS failed")
 	}
 
+	envelope := model.NewEnvelope(producerName, sourceFeed, op.now(), busStation.Atcocode)
+
+	// The response lists every journey at the bus station, so the ingester
+	// can remove cached journeys that are missing from it
+	if busStation.Atcocode != "" {
+		envelope.Snapshot = op.snapshot(siriResponse)
+	}
+
 	op.filter(siriResponse)
 
 	departures := op.transform(siriResponse)
 
-	departuresJSON, err := json.Marshal(&departures)
+	departuresJSON, err := model.EncodeDeparturesMessage(envelope, departures)
 	message := aws.String(string(departuresJSON))
 	if err != nil {
 		return errors.Wrap(err, "cannot marshal JSON from departure")
@@ -187,15 +265,61 @@ func (op *OptisPoller) checkHasDepartures(siriResponse *model.Siri) error {
 	return nil
 }
 
+// snapshot returns the period that the response lists every journey for: the
+// preview interval from now or, if OPTIS returned the maximum number of stop
+// visits, until the latest call returned, as later journeys may have been left
+// out. It must be read before the response is filtered.
+func (op *OptisPoller) snapshot(siri *model.Siri) *model.Snapshot {
+	op.Logger.Debug("snapshot")
+
+	now := op.now()
+
+	snapshot := model.Snapshot{
+		From:  now,
+		Until: now.Add(op.OptisPreviewInterval.ToDuration()),
+	}
+
+	monitoredStopVisits := siri.ServiceDelivery.StopMonitoringDelivery.MonitoredStopVisit
+	if op.OptisMaximumStopVisits <= 0 || len(monitoredStopVisits) < op.OptisMaximumStopVisits {
+		return &snapshot
+	}
+
+	latest := now
+	for _, monitoredStopVisit := range monitoredStopVisits {
+		callTime := op.callTime(&monitoredStopVisit.MonitoredVehicleJourney.MonitoredCall)
+		if callTime.After(latest) {
+			latest = callTime
+		}
+	}
+
+	if latest.Before(snapshot.Until) {
+		op.Logger.Debugf("OPTIS returned %d stop visits; snapshot ends at %s", len(monitoredStopVisits), latest.Format(time.RFC3339))
+		snapshot.Until = latest
+	}
+
+	return &snapshot
+}
+
+// callTime returns the time of the call: the departure time if there is one,
+// or the arrival time otherwise, preferring expected times to aimed times
+func (op *OptisPoller) callTime(call *model.MonitoredCall) time.Time {
+	for _, ts := range []time.Time{call.ExpectedDepartureTime, call.AimedDepartureTime, call.ExpectedArrivalTime, call.AimedArrivalTime} {
+		if !op.isZeroTime(ts) {
+			return ts
+		}
+	}
+
+	return time.Time{}
+}
+
 func (op *OptisPoller) filter(siri *model.Siri) {
 	op.Logger.Debug("filter")
 	i := 0
 	initialLen := len(siri.ServiceDelivery.StopMonitoringDelivery.MonitoredStopVisit)
 	op.Logger.Debugf("filter - %d records to filter", initialLen)
 	for _, monitoredStopVisit := range siri.ServiceDelivery.StopMonitoringDelivery.MonitoredStopVisit {
-		if op.hasDepartureTime(&monitoredStopVisit.MonitoredVehicleJourney.MonitoredCall) &&
-			!op.erroneousRecord(&monitoredStopVisit.MonitoredVehicleJourney) &&
-			!op.cancelledJourney(&monitoredStopVisit.MonitoredVehicleJourney) {
+		if (op.hasDepartureTime(&monitoredStopVisit.MonitoredVehicleJourney.MonitoredCall) || op.hasArrivalTime(&monitoredStopVisit.MonitoredVehicleJourney.MonitoredCall)) &&
+			!op.erroneousRecord(&monitoredStopVisit.MonitoredVehicleJourney) {
 			siri.ServiceDelivery.StopMonitoringDelivery.MonitoredStopVisit[i] = monitoredStopVisit
 			i++
 			op.Logger.Debugf("include JourneyRef %s", op.getMonitoredJourneyIdentity(&monitoredStopVisit.MonitoredVehicleJourney))
@@ -223,8 +347,25 @@ func (op *OptisPoller) hasDepartureTime(call *model.MonitoredCall) bool {
 	return call.ExpectedDepartureTime != zeroTime || call.AimedDepartureTime != zeroTime
 }
 
+// hasArrivalTime returns true if the call has an arrival time; a journey that
+// terminates at the stop only has an arrival time
+func (op *OptisPoller) hasArrivalTime(call *model.MonitoredCall) bool {
+	op.Logger.Debug("hasArrivalTime")
+	return !op.isZeroTime(call.ExpectedArrivalTime) || !op.isZeroTime(call.AimedArrivalTime)
+}
+
 func (op *OptisPoller) erroneousRecord(monitoredVehicleJourney *model.MonitoredVehicleJourney) bool {
 	op.Logger.Debug("notErroneousRecord")
+
+	// A journey that terminates at the stop is checked by its arrival time
+	if op.isZeroTime(monitoredVehicleJourney.MonitoredCall.AimedDepartureTime) {
+		erroneous := monitoredVehicleJourney.MonitoredCall.AimedArrivalTime.Before(monitoredVehicleJourney.OriginAimedDepartureTime)
+		if erroneous {
+			op.Logger.Printf("erroneous record: AimedArrivalTime %s is before OriginAimedDepartureTime %s", monitoredVehicleJourney.MonitoredCall.AimedArrivalTime, monitoredVehicleJourney.OriginAimedDepartureTime)
+		}
+		return erroneous
+	}
+
 	erroneous := monitoredVehicleJourney.MonitoredCall.AimedDepartureTime.Before(monitoredVehicleJourney.OriginAimedDepartureTime)
 	if erroneous {
 		op.Logger.Printf("erroneous record: AimedDepartureTime %s is before OriginAimedDepartureTime %s", monitoredVehicleJourney.MonitoredCall.AimedDepartureTime, monitoredVehicleJourney.OriginAimedDepartureTime)
@@ -232,6 +373,8 @@ func (op *OptisPoller) erroneousRecord(monitoredVehicleJourney *model.MonitoredV
 	return erroneous
 }
 
+// cancelledJourney returns true if the departure of the journey from the stop
+// is cancelled; cancelled journeys are kept so that boards can show them
 func (op *OptisPoller) cancelledJourney(monitoredVehicleJourney *model.MonitoredVehicleJourney) bool {
 	op.Logger.Debug("cancelledJourney")
 	cancelled := monitoredVehicleJourney.MonitoredCall.DepartureStatus == "cancelled"
@@ -241,6 +384,13 @@ func (op *OptisPoller) cancelledJourney(monitoredVehicleJourney *model.Monitored
 	return cancelled
 }
 
+// cancelledArrival returns true if the arrival of the journey at the stop is
+// cancelled
+func (op *OptisPoller) cancelledArrival(monitoredVehicleJourney *model.MonitoredVehicleJourney) bool {
+	op.Logger.Debug("cancelledArrival")
+	return monitoredVehicleJourney.MonitoredCall.ArrivalStatus == "cancelled"
+}
+
 func (op *OptisPoller) isZeroTime(ts time.Time) bool {
 	op.Logger.Debugf("isZeroTime `%s`", ts.Format(time.RFC3339))
 	return ts == time.Time{}
@@ -249,14 +399,18 @@ func (op *OptisPoller) isZeroTime(ts time.Time) bool {
 func (op *OptisPoller) transform(siri *model.Siri) model.Internal {
 	op.Logger.Debug("transform")
 	departures := model.Internal{}
+	stands := make(map[string]*string)
 
 	for _, monitoredStopVisit := range siri.ServiceDelivery.StopMonitoringDelivery.MonitoredStopVisit {
 		departure := model.Departure{
-			RecordedAtTime:      monitoredStopVisit.RecordedAtTime.Format(time.RFC3339),
+			RecordedAtTime:      monitoredStopVisit.RecordedAtTime,
 			JourneyType:         model.Bus,
 			JourneyRef:          op.getMonitoredJourneyIdentity(&monitoredStopVisit.MonitoredVehicleJourney),
-			AimedDepartureTime:  monitoredStopVisit.MonitoredVehicleJourney.MonitoredCall.AimedDepartureTime.Format(time.RFC3339),
+			AimedDepartureTime:  monitoredStopVisit.MonitoredVehicleJourney.MonitoredCall.AimedDepartureTime,
+			AimedArrivalTime:    monitoredStopVisit.MonitoredVehicleJourney.MonitoredCall.AimedArrivalTime,
 			LocationAtcocode:    monitoredStopVisit.MonitoredVehicleJourney.MonitoredCall.StopPointRef,
+			OriginAtcocode:      monitoredStopVisit.MonitoredVehicleJourney.OriginRef,
+			Origin:              monitoredStopVisit.MonitoredVehicleJourney.OriginName,
 			DestinationAtcocode: monitoredStopVisit.MonitoredVehicleJourney.DestinationRef,
 			Destination:         monitoredStopVisit.MonitoredVehicleJourney.DestinationName,
 			ServiceNumber:       monitoredStopVisit.MonitoredVehicleJourney.LineRef,
@@ -264,11 +418,36 @@ func (op *OptisPoller) transform(siri *model.Siri) model.Internal {
 		}
 
 		if !op.isZeroTime(monitoredStopVisit.MonitoredVehicleJourney.MonitoredCall.ExpectedDepartureTime) {
-			expectedDepartureTime := monitoredStopVisit.MonitoredVehicleJourney.MonitoredCall.ExpectedDepartureTime.Format(time.RFC3339)
+			expectedDepartureTime := monitoredStopVisit.MonitoredVehicleJourney.MonitoredCall.ExpectedDepartureTime
 			departure.ExpectedDepartureTime = &expectedDepartureTime
 		}
 
-		if stand := departure.GetStand(); stand != nil {
+		if !op.isZeroTime(monitoredStopVisit.MonitoredVehicleJourney.MonitoredCall.ExpectedArrivalTime) {
+			expectedArrivalTime := monitoredStopVisit.MonitoredVehicleJourney.MonitoredCall.ExpectedArrivalTime
+			departure.ExpectedArrivalTime = &expectedArrivalTime
+		}
+
+		// A cancelled journey has no prediction, so it is shown at its aimed
+		// time with a cancelled status
+		if op.cancelledJourney(&monitoredStopVisit.MonitoredVehicleJourney) {
+			departureStatus := model.CancelledStatus
+			departure.DepartureStatus = &departureStatus
+			departure.ExpectedDepartureTime = nil
+		}
+
+		if op.cancelledArrival(&monitoredStopVisit.MonitoredVehicleJourney) {
+			arrivalStatus := model.CancelledStatus
+			departure.ArrivalStatus = &arrivalStatus
+			departure.ExpectedArrivalTime = nil
+		}
+
+		stand, exists := stands[departure.LocationAtcocode]
+		if !exists {
+			stand = op.getStand(departure.LocationAtcocode)
+			stands[departure.LocationAtcocode] = stand
+		}
+
+		if stand != nil {
 			departure.Stand = stand
 		}
 
@@ -277,3 +456,56 @@ func (op *OptisPoller) transform(siri *model.Siri) model.Internal {
 
 	return departures
 }
+
+// getStand returns the stand for the stop from the stand rules or, if no rule
+// matches, from the NaPTAN Indicator of the stop
+func (op *OptisPoller) getStand(locationAtcocode string) *string {
+	op.Logger.Debugf("getStand for `%s`", locationAtcocode)
+
+	standRules := op.StandRules
+	if standRules == nil {
+		standRules = model.DefaultStandRules
+	}
+
+	if stand := standRules.Stand(locationAtcocode); stand != nil {
+		return stand
+	}
+
+	if op.StopsInAreaPool == nil {
+		return nil
+	}
+
+	indicator, err := op.getIndicator(locationAtcocode)
+	if err != nil {
+		op.Logger.Printf("cannot get indicator for `%s`: %v", locationAtcocode, err)
+		return nil
+	}
+
+	if indicator == nil {
+		return nil
+	}
+
+	return model.StandFromIndicator(*indicator)
+}
+
+// getIndicator returns the NaPTAN Indicator for the stop from the stops in
+// area cache, or nil if the stop has no indicator
+func (op *OptisPoller) getIndicator(locationAtcocode string) (*string, error) {
+	var err error = nil
+	conn := op.StopsInAreaPool.Get()
+	defer func() {
+		if cerr := conn.Close(); cerr != nil {
+			err = cerr
+		}
+	}()
+
+	indicator, err := redis.String(conn.Do("GET", model.StandIndicatorKeyPrefix+locationAtcocode))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot get indicator for `%s` from Redis", locationAtcocode)
+	}
+
+	return &indicator, err
+}
@@ -6,11 +6,14 @@ import (
 	"github.com/ChannelMeter/iso8601duration"
 	"github.com/TfGMEnterprise/departures-service/dlog"
 	"github.com/TfGMEnterprise/departures-service/model"
+	"github.com/TfGMEnterprise/departures-service/repository"
 	"github.com/TfGMEnterprise/departures-service/test_helpers"
+	"github.com/alicebob/miniredis"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/sns"
 	"github.com/aws/aws-sdk-go/service/sns/snsiface"
 	"github.com/fortytw2/leaktest"
+	"github.com/gomodule/redigo/redis"
 	"io/ioutil"
 	"net/http"
 	"reflect"
@@ -200,6 +203,8 @@ var (
 								DataFrameRef:           "2019-05-09",
 								DatedVehicleJourneyRef: "0005",
 							},
+							OriginRef:                   "1800HN00011",
+							OriginName:                  "Hobbiton",
 							DestinationRef:              "1800BR00021",
 							OriginAimedDepartureTime:    test_helpers.AdjustTime(now, "-20m"),
 							DestinationAimedArrivalTime: test_helpers.AdjustTime(now, "1h30m"),
@@ -237,7 +242,7 @@ var (
 						},
 					},
 					{
-						RecordedAtTime: time.Now(),
+						RecordedAtTime: now,
 						MonitoringRef:  "1800BNIN0G1",
 						MonitoredVehicleJourney: model.MonitoredVehicleJourney{
 							LineRef:      "7",
@@ -250,9 +255,10 @@ var (
 							OriginAimedDepartureTime:    test_helpers.AdjustTime(now, "-20m"),
 							DestinationAimedArrivalTime: test_helpers.AdjustTime(now, "1h30m"),
 							MonitoredCall: model.MonitoredCall{
-								StopPointRef:       "1800BNIN0B1",
-								AimedDepartureTime: test_helpers.AdjustTime(now, "1m10s"),
-								DepartureStatus:    "cancelled",
+								StopPointRef:          "1800BNIN0B1",
+								AimedDepartureTime:    test_helpers.AdjustTime(now, "1m10s"),
+								ExpectedDepartureTime: test_helpers.AdjustTime(now, "1m30s"),
+								DepartureStatus:       "cancelled",
 							},
 						},
 						Extensions: model.Extensions{
@@ -283,6 +289,18 @@ func (mockOptisClient *MockOptisClient) Request(siriRequest string) (*model.Siri
 	}
 }
 
+// buildEnvelopeJSON returns the envelope fields expected at the start of a
+// published departures message
+func buildEnvelopeJSON(atcocode string) string {
+	envelopeJSON := `"schemaVersion":1,"producer":"optis-poller","sourceFeed":"optis-siri-sm","generatedAt":"` + now.Format(time.RFC3339Nano) + `"`
+	if atcocode != "" {
+		envelopeJSON += `,"location":"` + atcocode + `"`
+		envelopeJSON += `,"snapshot":{"from":"` + now.Format(time.RFC3339Nano) + `","until":"` + now.Add(previewIntervalDuration.ToDuration()).Format(time.RFC3339Nano) + `"}`
+	}
+
+	return envelopeJSON + ","
+}
+
 func TestOptisPoller_Handler(t *testing.T) {
 	defer leaktest.Check(t)()
 
@@ -315,14 +333,17 @@ func TestOptisPoller_Handler(t *testing.T) {
 			OptisRequestorRef:      requestorRef,
 			SNSClient:              mockedSNSClient,
 			SNSTopicARN:            aws.String(snsTopicArn),
+			Clock:                  func() time.Time { return now },
 		}
 
 		expectation := sns.PublishInput{
-			Message: aws.String(`{"departures":[` +
+			Message: aws.String(`{` + buildEnvelopeJSON(busStationAtcocode) + `"departures":[` +
 				`{"recordedAtTime":"` + now.Format(time.RFC3339) + `","journeyType":"` + string(model.Bus) + `","journeyRef":"1_inbound_2019-05-09_0001","aimedDepartureTime":"` + test_helpers.AdjustTime(now, "3m8s").Format(time.RFC3339) + `","expectedDepartureTime":"` + test_helpers.AdjustTime(now, "59s").Format(time.RFC3339) + `","locationAtcocode":"` + busStationAtcocode + `0A1","stand":"A","destinationAtcocode":"1800HN00011","destination":"Hobbiton","serviceNumber":"1","operatorCode":"ANWE"},` +
 				`{"recordedAtTime":"` + now.Format(time.RFC3339) + `","journeyType":"` + string(model.Bus) + `","journeyRef":"2_outbound_2019-05-09_0002","aimedDepartureTime":"` + test_helpers.AdjustTime(now, "1m10s").Format(time.RFC3339) + `","locationAtcocode":"` + busStationAtcocode + `0B1","stand":"B","destinationAtcocode":"1800MD00011","destination":"Mordor","serviceNumber":"2","operatorCode":"ANWE"},` +
 				`{"recordedAtTime":"` + now.Format(time.RFC3339) + `","journeyType":"` + string(model.Bus) + `","journeyRef":"3_outbound_2019-05-09_0003","aimedDepartureTime":"` + test_helpers.AdjustTime(now, "3m8s").Format(time.RFC3339) + `","expectedDepartureTime":"` + test_helpers.AdjustTime(now, "1m1s").Format(time.RFC3339) + `","locationAtcocode":"` + busStationAtcocode + `0C1","stand":"C","destinationAtcocode":"1800MT00011","destination":"Minas Tirith","serviceNumber":"3","operatorCode":"ANWE"},` +
-				`{"recordedAtTime":"` + now.Format(time.RFC3339) + `","journeyType":"` + string(model.Bus) + `","journeyRef":"4_inbound_2019-05-09_0004","aimedDepartureTime":"` + test_helpers.AdjustTime(now, "3m8s").Format(time.RFC3339) + `","expectedDepartureTime":"` + test_helpers.AdjustTime(now, "2m59s").Format(time.RFC3339) + `","locationAtcocode":"` + busStationAtcocode + `0D1","stand":"D","destinationAtcocode":"1800BR00011","destination":"Bree","serviceNumber":"4","operatorCode":"ANWE"}` +
+				`{"recordedAtTime":"` + now.Format(time.RFC3339) + `","journeyType":"` + string(model.Bus) + `","journeyRef":"4_inbound_2019-05-09_0004","aimedDepartureTime":"` + test_helpers.AdjustTime(now, "3m8s").Format(time.RFC3339) + `","expectedDepartureTime":"` + test_helpers.AdjustTime(now, "2m59s").Format(time.RFC3339) + `","locationAtcocode":"` + busStationAtcocode + `0D1","stand":"D","destinationAtcocode":"1800BR00011","destination":"Bree","serviceNumber":"4","operatorCode":"ANWE"},` +
+				`{"recordedAtTime":"` + now.Format(time.RFC3339) + `","journeyType":"` + string(model.Bus) + `","journeyRef":"5_inbound_2019-05-09_0005","aimedArrivalTime":"` + test_helpers.AdjustTime(now, "3m8s").Format(time.RFC3339) + `","expectedArrivalTime":"` + test_helpers.AdjustTime(now, "3m8s").Format(time.RFC3339) + `","locationAtcocode":"` + busStationAtcocode + `0E1","stand":"E","originAtcocode":"1800HN00011","origin":"Hobbiton","destinationAtcocode":"1800BR00021","serviceNumber":"5","operatorCode":"ANWE"},` +
+				`{"recordedAtTime":"` + now.Format(time.RFC3339) + `","journeyType":"` + string(model.Bus) + `","journeyRef":"7_inbound_2019-05-10_0007","aimedDepartureTime":"` + test_helpers.AdjustTime(now, "1m10s").Format(time.RFC3339) + `","departureStatus":"Cancelled","locationAtcocode":"` + busStationAtcocode + `0B1","stand":"B","destinationAtcocode":"1800BR00021","serviceNumber":"7","operatorCode":"ANWE"}` +
 				`]}`),
 			TopicArn: aws.String(snsTopicArn),
 		}
@@ -364,6 +385,7 @@ func TestOptisPoller_Handler(t *testing.T) {
 			OptisRequestorRef:      "invalid",
 			SNSClient:              mockedSNSClient,
 			SNSTopicARN:            aws.String(snsTopicArn),
+			Clock:                  func() time.Time { return now },
 		}
 
 		if err := op.Handler(busStation); err == nil {
@@ -398,10 +420,11 @@ func TestOptisPoller_Handler(t *testing.T) {
 			OptisRequestorRef:      requestorRef,
 			SNSClient:              mockedSNSClient,
 			SNSTopicARN:            aws.String(snsTopicArn),
+			Clock:                  func() time.Time { return now },
 		}
 
 		expectation := sns.PublishInput{
-			Message:  aws.String(`{"departures":null}`),
+			Message:  aws.String(`{` + buildEnvelopeJSON("") + `"departures":null}`),
 			TopicArn: aws.String(snsTopicArn),
 		}
 
@@ -442,10 +465,11 @@ func TestOptisPoller_Handler(t *testing.T) {
 			OptisRequestorRef:      requestorRef,
 			SNSClient:              mockedSNSClient,
 			SNSTopicARN:            aws.String(snsTopicArn),
+			Clock:                  func() time.Time { return now },
 		}
 
 		expectation := sns.PublishInput{
-			Message:  aws.String(`{"departures":null}`),
+			Message:  aws.String(`{` + buildEnvelopeJSON("invalid") + `"departures":null}`),
 			TopicArn: aws.String(snsTopicArn),
 		}
 
@@ -522,3 +546,134 @@ func TestOptisPoller_hasDepatureTime(t *testing.T) {
 		test_helpers.AssertBoolean(t, got, true)
 	})
 }
+
+func TestOptisPoller_getStand(t *testing.T) {
+	stopsInAreaDB, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stopsInAreaDB.Close()
+
+	if err := stopsInAreaDB.Set(model.StandIndicatorKeyPrefix+"1800BNINM1", "Stand M"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stopsInAreaDB.Set(model.StandIndicatorKeyPrefix+"1800EB01741", "opp"); err != nil {
+		t.Fatal(err)
+	}
+
+	standRules, err := model.ParseStandRules([]byte(`{"rules": [{"atcocodePrefix": "2500", "pattern": "^2500[A-Z]{4}(?P<stand>[A-Z0-9]{2})$"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	op := OptisPoller{
+		Logger: dlog.NewLogger([]dlog.LoggerOption{
+			dlog.LoggerSetOutput(ioutil.Discard),
+		}...),
+		StopsInAreaPool: repository.NewRedisPool([]repository.RedisPoolOption{
+			repository.RedisPoolDial(func() (redis.Conn, error) {
+				return redis.Dial("tcp", stopsInAreaDB.Addr())
+			}),
+		}...),
+	}
+
+	t.Run("uses the default stand rules if none are configured", func(t *testing.T) {
+		stand := op.getStand("1800BNIN0C1")
+		if stand == nil {
+			t.Fatal("expected a stand")
+		}
+
+		test_helpers.AssertString(t, *stand, "C")
+	})
+
+	t.Run("uses the configured stand rules", func(t *testing.T) {
+		op := op
+		op.StandRules = standRules
+
+		stand := op.getStand("2500LANC0B")
+		if stand == nil {
+			t.Fatal("expected a stand")
+		}
+
+		test_helpers.AssertString(t, *stand, "B")
+	})
+
+	t.Run("falls back to the NaPTAN indicator", func(t *testing.T) {
+		stand := op.getStand("1800BNINM1")
+		if stand == nil {
+			t.Fatal("expected a stand")
+		}
+
+		test_helpers.AssertString(t, *stand, "M")
+	})
+
+	t.Run("returns nil if the indicator does not name a stand", func(t *testing.T) {
+		if stand := op.getStand("1800EB01741"); stand != nil {
+			t.Errorf("got `%s`, want `%v`", *stand, nil)
+		}
+	})
+
+	t.Run("returns nil if the stop has no indicator", func(t *testing.T) {
+		if stand := op.getStand("1800EB00021"); stand != nil {
+			t.Errorf("got `%s`, want `%v`", *stand, nil)
+		}
+	})
+}
+
+func TestOptisPoller_snapshot(t *testing.T) {
+	logger := dlog.NewLogger([]dlog.LoggerOption{
+		dlog.LoggerSetOutput(ioutil.Discard),
+	}...)
+
+	visit := func(aimedDepartureTime time.Time, aimedArrivalTime time.Time) model.MonitoredStopVisit {
+		return model.MonitoredStopVisit{
+			MonitoredVehicleJourney: model.MonitoredVehicleJourney{
+				MonitoredCall: model.MonitoredCall{
+					AimedDepartureTime: aimedDepartureTime,
+					AimedArrivalTime:   aimedArrivalTime,
+				},
+			},
+		}
+	}
+
+	siri := &model.Siri{
+		ServiceDelivery: model.ServiceDelivery{
+			StopMonitoringDelivery: model.StopMonitoringDelivery{
+				MonitoredStopVisit: []model.MonitoredStopVisit{
+					visit(test_helpers.AdjustTime(now, "10m"), time.Time{}),
+					visit(time.Time{}, test_helpers.AdjustTime(now, "40m")),
+					visit(test_helpers.AdjustTime(now, "20m"), test_helpers.AdjustTime(now, "19m")),
+				},
+			},
+		},
+	}
+
+	t.Run("covers the preview interval", func(t *testing.T) {
+		op := OptisPoller{
+			Logger:                 logger,
+			OptisMaximumStopVisits: maximumStopVisits,
+			OptisPreviewInterval:   *previewIntervalDuration,
+			Clock:                  func() time.Time { return now },
+		}
+
+		snapshot := op.snapshot(siri)
+
+		test_helpers.AssertBoolean(t, snapshot.From.Equal(now), true)
+		test_helpers.AssertBoolean(t, snapshot.Until.Equal(test_helpers.AdjustTime(now, "1h30m")), true)
+	})
+
+	t.Run("ends at the latest call if the maximum number of stop visits was returned", func(t *testing.T) {
+		op := OptisPoller{
+			Logger:                 logger,
+			OptisMaximumStopVisits: 3,
+			OptisPreviewInterval:   *previewIntervalDuration,
+			Clock:                  func() time.Time { return now },
+		}
+
+		snapshot := op.snapshot(siri)
+
+		test_helpers.AssertBoolean(t, snapshot.From.Equal(now), true)
+		test_helpers.AssertBoolean(t, snapshot.Until.Equal(test_helpers.AdjustTime(now, "40m")), true)
+	})
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/TfGMEnterprise/departures-service/model"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The maximum number of stops that can be requested in a batch
+const maxBatchStops = 20
+
+// The number of departures read for each stop in a batch, as a multiple of
+// top, so that there are usually enough left once expired departures have
+// been removed
+const batchReadFactor = 2
+
+type batchRequest struct {
+	Stops []batchStop `json:"stops"`
+}
+
+type batchStop struct {
+	Atcocode string `json:"atcocode"`
+	Top      *int64 `json:"top,omitempty"`
+}
+
+// batchResult holds the cached departures read for a stop in a batch
+type batchResult struct {
+	departures []string
+	exists     bool
+}
+
+// isBatchRequest checks whether the request is for the batch endpoint
+func (p Presenter) isBatchRequest(request events.APIGatewayProxyRequest) bool {
+	return strings.HasSuffix(strings.TrimSuffix(request.Path, "/"), "/batch")
+}
+
+// presentBatch returns boards for several stops, reading the departures for
+// every stop from Redis in a single pipelined round trip. Stops that are not
+// valid or not found are returned with an error entry instead of a board.
+func (p Presenter) presentBatch(request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	p.Logger.Debug("presentBatch")
+
+	if request.HTTPMethod != "" && request.HTTPMethod != http.MethodPost {
+		return nil, newInvalidParameterError(errors.Errorf("method %s is not supported for batch requests", request.HTTPMethod))
+	}
+
+	batch := batchRequest{}
+	if err := json.Unmarshal([]byte(request.Body), &batch); err != nil {
+		return nil, newInvalidParameterError(errors.Wrap(err, "batch request body is not valid"))
+	}
+
+	if len(batch.Stops) == 0 {
+		return nil, newInvalidParameterError(errors.New("at least one stop is required"))
+	}
+
+	if len(batch.Stops) > maxBatchStops {
+		return nil, newInvalidParameterError(errors.Errorf("a maximum of %d stops can be requested", maxBatchStops))
+	}
+
+	now := p.now()
+	output := model.BatchOutput{}
+
+	var stops []batchStop
+	var tops []int64
+
+	for _, stop := range batch.Stops {
+		if _, exists := output[stop.Atcocode]; exists {
+			continue
+		}
+
+		top := int64(10)
+		if stop.Top != nil {
+			top = *stop.Top
+		}
+
+		if !p.validateAtcocode(stop.Atcocode) {
+			output[stop.Atcocode] = p.batchErrorBoard(newInvalidParameterError(errors.Errorf("atcocode value `%s` is not valid", stop.Atcocode)))
+			continue
+		}
+
+		if !p.validateTop(top) {
+			output[stop.Atcocode] = p.batchErrorBoard(newInvalidParameterError(errors.Errorf("top value `%d` is not valid", top)))
+			continue
+		}
+
+		// Reserve the entry so that duplicate stops are only read once
+		output[stop.Atcocode] = model.BatchBoard{}
+
+		stops = append(stops, stop)
+		tops = append(tops, top)
+	}
+
+	results, err := p.readBatchDepartures(stops, tops)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, stop := range stops {
+		board, err := p.transformBatchResult(now, stop.Atcocode, tops[i], results[i])
+		if err != nil {
+			if pErr, ok := err.(*presenterError); ok && pErr.statusCode < http.StatusInternalServerError {
+				output[stop.Atcocode] = p.batchErrorBoard(err)
+				continue
+			}
+
+			return nil, err
+		}
+
+		output[stop.Atcocode] = model.BatchBoard{
+			Output: board,
+		}
+	}
+
+	outputJSON, err := json.Marshal(output)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal JSON for batch response")
+	}
+
+	return &events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers: map[string]string{
+			"content-type": "application/json",
+		},
+		Body: string(outputJSON),
+	}, nil
+}
+
+// readBatchDepartures reads departures for each stop using a single pipelined
+// round trip to Redis
+func (p Presenter) readBatchDepartures(stops []batchStop, tops []int64) ([]batchResult, error) {
+	p.Logger.Debugf("readBatchDepartures for %d stop(s)", len(stops))
+
+	results := make([]batchResult, len(stops))
+	if len(stops) == 0 {
+		return results, nil
+	}
+
+	var err error = nil
+	conn := p.Pool.Get()
+	defer func() {
+		if cErr := conn.Close(); cErr != nil {
+			err = cErr
+		}
+	}()
+
+	for i, stop := range stops {
+		if sErr := conn.Send("LRANGE", stop.Atcocode, int64(0), tops[i]*batchReadFactor-1); sErr != nil {
+			return nil, newServiceUnavailableError(errors.Wrap(sErr, "cannot send batch request to Redis"))
+		}
+
+		if sErr := conn.Send("EXISTS", stop.Atcocode); sErr != nil {
+			return nil, newServiceUnavailableError(errors.Wrap(sErr, "cannot send batch request to Redis"))
+		}
+	}
+
+	if fErr := conn.Flush(); fErr != nil {
+		return nil, newServiceUnavailableError(errors.Wrap(fErr, "cannot flush batch request to Redis"))
+	}
+
+	for i, stop := range stops {
+		departures, rErr := redis.Strings(conn.Receive())
+		if rErr != nil && rErr != redis.ErrNil {
+			return nil, newServiceUnavailableError(errors.Wrapf(rErr, "cannot get departures for `%s` from Redis", stop.Atcocode))
+		}
+
+		exists, rErr := redis.Bool(conn.Receive())
+		if rErr != nil {
+			return nil, newServiceUnavailableError(errors.Wrapf(rErr, "cannot check whether `%s` exists in Redis", stop.Atcocode))
+		}
+
+		results[i] = batchResult{
+			departures: departures,
+			exists:     exists,
+		}
+	}
+
+	return results, err
+}
+
+// transformBatchResult turns the departures read for a stop into a board,
+// falling back to paging through the cache if there were too many expired
+// departures in the batch read
+func (p Presenter) transformBatchResult(now time.Time, atcocode string, top int64, result batchResult) (*model.Output, error) {
+	p.Logger.Debugf("transformBatchResult for %s", atcocode)
+
+	if !result.exists {
+		return nil, newStopNotFoundError(errors.Errorf("no departures found for atcocode `%s`", atcocode))
+	}
+
+	deps := &model.Internal{}
+
+	p.appendCachedDepartures(deps, atcocode, result.departures)
+
+	p.downgradeStaleDepartures(now, deps)
+	p.removeExpiredDepartures(now, deps)
+
+	if len(deps.Departures) < int(top) && int64(len(result.departures)) == top*batchReadFactor {
+		var err error
+		deps, err = p.getDepartures(now, atcocode, top, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(deps.Departures) > int(top) {
+		deps.Departures = deps.Departures[:top]
+	}
+
+	return p.transformToOutput(now, model.GetJourneyType(atcocode), deps, false)
+}
+
+func (p Presenter) batchErrorBoard(err error) model.BatchBoard {
+	_, errorOutput := p.errorOutput(err)
+
+	return model.BatchBoard{
+		Error: errorOutput,
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/TfGMEnterprise/departures-service/dlog"
+	"github.com/TfGMEnterprise/departures-service/model"
+	"github.com/TfGMEnterprise/departures-service/repository"
+	"github.com/TfGMEnterprise/departures-service/test_helpers"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+	"github.com/rafaeljusto/redigomock"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPresenter_BatchHandler(t *testing.T) {
+	logger := dlog.NewLogger([]dlog.LoggerOption{
+		dlog.LoggerSetOutput(ioutil.Discard),
+	}...)
+
+	newPresenter := func(conn *redigomock.Conn) Presenter {
+		return Presenter{
+			Logger: logger,
+			Pool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return conn, nil
+				}),
+			}...),
+		}
+	}
+
+	t.Run("gets boards for several stops in one pipelined request", func(t *testing.T) {
+		now := time.Now().Truncate(time.Second)
+
+		atcocode1 := "1800NE43431"
+		atcocode2 := "1800NE43441"
+		atcocode3 := "1800NE43451"
+
+		departure1 := buildJSONDeparture(
+			t,
+			test_helpers.AdjustTime(now, "-10s"),
+			model.Bus,
+			1234,
+			test_helpers.AdjustTime(now, "5m10s"),
+			nil,
+			atcocode1,
+			nil,
+			"1800WA12481",
+			"Hobbiton",
+			"123",
+			"ANWE")
+
+		departure2 := buildJSONDeparture(
+			t,
+			test_helpers.AdjustTime(now, "-10s"),
+			model.Bus,
+			1235,
+			test_helpers.AdjustTime(now, "-1m"),
+			nil,
+			atcocode2,
+			nil,
+			"1800WA12481",
+			"Mordor",
+			"456",
+			"ANWE")
+
+		departure3 := buildJSONDeparture(
+			t,
+			test_helpers.AdjustTime(now, "-10s"),
+			model.Bus,
+			1236,
+			test_helpers.AdjustTime(now, "7m10s"),
+			nil,
+			atcocode2,
+			nil,
+			"1800WA12481",
+			"Mordor",
+			"456",
+			"ANWE")
+
+		conn := redigomock.NewConn()
+		conn.Command("LRANGE", atcocode1, int64(0), int64(1)).ExpectStringSlice(string(departure1))
+		conn.Command("EXISTS", atcocode1).Expect(int64(1))
+		conn.Command("LRANGE", atcocode2, int64(0), int64(3)).ExpectStringSlice(string(departure2), string(departure3))
+		conn.Command("EXISTS", atcocode2).Expect(int64(1))
+		conn.Command("LRANGE", atcocode3, int64(0), int64(1)).ExpectStringSlice()
+		conn.Command("EXISTS", atcocode3).Expect(int64(0))
+
+		p := newPresenter(conn)
+
+		req := events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodPost,
+			Path:       "/departures/batch",
+			Body: `{"stops":[` +
+				`{"atcocode":"` + atcocode1 + `","top":1},` +
+				`{"atcocode":"` + atcocode2 + `","top":2},` +
+				`{"atcocode":"` + atcocode3 + `","top":1},` +
+				`{"atcocode":"foo"}` +
+				`]}`,
+		}
+
+		got, err := p.Handler(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got.StatusCode != http.StatusOK {
+			t.Fatalf("wrong status code: got %d, wanted %d: %s", got.StatusCode, http.StatusOK, got.Body)
+		}
+
+		output := map[string]struct {
+			model.Output
+			Error *model.ErrorOutput `json:"error"`
+		}{}
+		if err := json.Unmarshal([]byte(got.Body), &output); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(output) != 4 {
+			t.Errorf("got %d boards, wanted %d", len(output), 4)
+		}
+
+		if len(output[atcocode1].Departures) != 1 {
+			t.Errorf("got %d departures for %s, wanted %d", len(output[atcocode1].Departures), atcocode1, 1)
+		}
+
+		// The expired departure is removed
+		if len(output[atcocode2].Departures) != 1 {
+			t.Errorf("got %d departures for %s, wanted %d", len(output[atcocode2].Departures), atcocode2, 1)
+		} else {
+			test_helpers.AssertString(t, output[atcocode2].Departures[0].DepartureTime, test_helpers.AdjustTime(now, "7m10s").Format("15:04"))
+		}
+
+		if output[atcocode3].Error == nil {
+			t.Errorf("should return an error for %s", atcocode3)
+		} else {
+			test_helpers.AssertString(t, output[atcocode3].Error.Code, errorCodeStopNotFound)
+		}
+
+		if output["foo"].Error == nil {
+			t.Error("should return an error for foo")
+		} else {
+			test_helpers.AssertString(t, output["foo"].Error.Code, errorCodeInvalidParameter)
+		}
+
+		if err := conn.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("skips cached records that cannot be read", func(t *testing.T) {
+		now := time.Now().Truncate(time.Second)
+
+		atcocode := "1800NE43431"
+
+		invalidTrain := buildJSONDeparture(
+			t,
+			test_helpers.AdjustTime(now, "-10s"),
+			model.Train,
+			1234,
+			test_helpers.AdjustTime(now, "4m10s"),
+			nil,
+			atcocode,
+			nil,
+			"1800WA12481",
+			"Hobbiton",
+			"",
+			"NT")
+
+		departure1 := buildJSONDeparture(
+			t,
+			test_helpers.AdjustTime(now, "-10s"),
+			model.Bus,
+			1235,
+			test_helpers.AdjustTime(now, "5m10s"),
+			nil,
+			atcocode,
+			nil,
+			"1800WA12481",
+			"Hobbiton",
+			"123",
+			"ANWE")
+
+		departure2 := buildJSONDeparture(
+			t,
+			test_helpers.AdjustTime(now, "-10s"),
+			model.Bus,
+			1236,
+			test_helpers.AdjustTime(now, "7m10s"),
+			nil,
+			atcocode,
+			nil,
+			"1800WA12481",
+			"Mordor",
+			"456",
+			"ANWE")
+
+		conn := redigomock.NewConn()
+		conn.Command("LRANGE", atcocode, int64(0), int64(3)).ExpectStringSlice(`{"journeyRef":`, string(invalidTrain), string(departure1), string(departure2))
+		conn.Command("EXISTS", atcocode).Expect(int64(1))
+
+		p := newPresenter(conn)
+
+		got, err := p.Handler(events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodPost,
+			Path:       "/departures/batch",
+			Body:       `{"stops":[{"atcocode":"` + atcocode + `","top":2}]}`,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got.StatusCode != http.StatusOK {
+			t.Fatalf("wrong status code: got %d, wanted %d: %s", got.StatusCode, http.StatusOK, got.Body)
+		}
+
+		output := map[string]model.BatchBoard{}
+		if err := json.Unmarshal([]byte(got.Body), &output); err != nil {
+			t.Fatal(err)
+		}
+
+		board := output[atcocode]
+		if board.Output == nil || len(board.Output.Departures) != 2 {
+			t.Fatalf("got board %s, wanted %d departures", got.Body, 2)
+		}
+
+		test_helpers.AssertString(t, board.Output.Departures[0].ServiceNumber, "123")
+		test_helpers.AssertString(t, board.Output.Departures[1].ServiceNumber, "456")
+
+		if err := conn.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("returns error if too many stops are requested", func(t *testing.T) {
+		p := newPresenter(redigomock.NewConn())
+
+		body := `{"stops":[`
+		for i := 0; i <= maxBatchStops; i++ {
+			if i > 0 {
+				body += ","
+			}
+			body += `{"atcocode":"1800NE43431"}`
+		}
+		body += `]}`
+
+		got, err := p.Handler(events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodPost,
+			Path:       "/departures/batch",
+			Body:       body,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertErrorResponse(t, got, http.StatusBadRequest, errorCodeInvalidParameter, "maximum")
+	})
+
+	t.Run("returns a service unavailable response if Redis cannot be reached", func(t *testing.T) {
+		conn := redigomock.NewConn()
+		conn.Command("LRANGE", "1800NE43431", int64(0), int64(19)).ExpectError(errors.New("connection refused"))
+		conn.Command("EXISTS", "1800NE43431").Expect(int64(1))
+
+		p := newPresenter(conn)
+
+		got, err := p.Handler(events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodPost,
+			Path:       "/departures/batch",
+			Body:       `{"stops":[{"atcocode":"1800NE43431"}]}`,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertErrorResponse(t, got, http.StatusServiceUnavailable, errorCodeServiceUnavailable, http.StatusText(http.StatusServiceUnavailable))
+	})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/TfGMEnterprise/departures-service/model"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+// The longest time a response can be cached for, regardless of its content
+const maxCacheAge = 60 * time.Second
+
+// computeETag creates a weak entity tag from the format, the departures as
+// displayed, and the time the newest departure data was recorded
+func (p Presenter) computeETag(format outputFormat, deps *model.Internal, output *model.Output) (string, error) {
+	p.Logger.Debug("computeETag")
+
+	newestRecordedAtTime := time.Time{}
+
+	for _, dep := range deps.Departures {
+		if dep.RecordedAtTime.After(newestRecordedAtTime) {
+			newestRecordedAtTime = dep.RecordedAtTime
+		}
+	}
+
+	outputJSON, err := json.Marshal(output)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot marshal JSON for entity tag")
+	}
+
+	hash := sha1.New()
+	hash.Write([]byte(format))
+	hash.Write([]byte(newestRecordedAtTime.Format(time.RFC3339)))
+	hash.Write(outputJSON)
+
+	// The tag is weak as SIRI responses include the response timestamp
+	return `W/"` + hex.EncodeToString(hash.Sum(nil)) + `"`, nil
+}
+
+// computeMaxAge returns the number of seconds until the countdown for any
+// real-time departure next changes, or any departure expires, up to the
+// maximum cache age
+func (p Presenter) computeMaxAge(now time.Time, deps *model.Internal) int {
+	p.Logger.Debug("computeMaxAge")
+
+	maxAge := maxCacheAge
+
+	for _, dep := range deps.Departures {
+		if untilExpiry := p.untilExpiry(now, dep); untilExpiry < maxAge {
+			maxAge = untilExpiry
+		}
+
+		depTime, isRealTime := dep.DepartureTime()
+		if !isRealTime {
+			continue
+		}
+
+		untilNextMinute := depTime.Sub(now) % time.Minute
+		if untilNextMinute < 0 {
+			untilNextMinute = 0
+		}
+
+		if untilNextMinute < maxAge {
+			maxAge = untilNextMinute
+		}
+	}
+
+	return int(maxAge / time.Second)
+}
+
+// untilExpiry returns the time for which the departure will still be shown,
+// up to the maximum cache age. Cancelled departures are shown for the
+// cancelled period after their aimed departure time, and delayed trains until
+// they have an estimated time.
+func (p Presenter) untilExpiry(now time.Time, dep model.Departure) time.Duration {
+	expiresAt, _ := dep.DepartureTime()
+
+	switch {
+	case dep.IsCancelled():
+		expiresAt = dep.AimedDepartureTime.Add(p.CancelledPeriod)
+	case dep.JourneyType == model.Train && dep.DepartureStatus != nil:
+		if *dep.DepartureStatus == "Delayed" {
+			return maxCacheAge
+		}
+
+		if estimatedDepartureTime, err := model.ConvertDepartureTime(&now, expiresAt.Location(), *dep.DepartureStatus); err == nil {
+			expiresAt = *estimatedDepartureTime
+		}
+	}
+
+	untilExpiry := expiresAt.Sub(now)
+
+	if untilExpiry < 0 {
+		return 0
+	}
+
+	if untilExpiry > maxCacheAge {
+		return maxCacheAge
+	}
+
+	return untilExpiry
+}
+
+// matchesETag checks whether the If-None-Match header value matches the
+// entity tag, using the weak comparison
+func (p Presenter) matchesETag(ifNoneMatch string, etag string) bool {
+	p.Logger.Debugf("matchesETag: %s", ifNoneMatch)
+
+	if ifNoneMatch == "" {
+		return false
+	}
+
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
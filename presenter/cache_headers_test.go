@@ -0,0 +1,198 @@
+package main
+
+import (
+	"github.com/TfGMEnterprise/departures-service/dlog"
+	"github.com/TfGMEnterprise/departures-service/model"
+	"github.com/TfGMEnterprise/departures-service/test_helpers"
+	"github.com/aws/aws-sdk-go/aws"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestPresenter_computeETag(t *testing.T) {
+	p := Presenter{
+		Logger: dlog.NewLogger([]dlog.LoggerOption{
+			dlog.LoggerSetOutput(ioutil.Discard),
+		}...),
+	}
+
+	now := time.Now().Truncate(time.Second)
+
+	deps := &model.Internal{
+		Departures: []model.Departure{
+			{
+				RecordedAtTime:     now,
+				AimedDepartureTime: now,
+			},
+		},
+	}
+
+	output := &model.Output{
+		JourneyType: model.Bus,
+		Departures: []model.DepartureDisplay{
+			{DepartureTime: "Approaching"},
+		},
+	}
+
+	etag, err := p.computeETag(formatJSON, deps, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("is stable for the same departures", func(t *testing.T) {
+		got, err := p.computeETag(formatJSON, deps, output)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test_helpers.AssertString(t, got, etag)
+	})
+
+	t.Run("changes with the format", func(t *testing.T) {
+		got, err := p.computeETag(formatSiri, deps, output)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test_helpers.AssertBoolean(t, got == etag, false)
+	})
+
+	t.Run("changes when newer data is recorded", func(t *testing.T) {
+		newer := &model.Internal{
+			Departures: []model.Departure{
+				{
+					RecordedAtTime:     test_helpers.AdjustTime(now, "10s"),
+					AimedDepartureTime: now,
+				},
+			},
+		}
+
+		got, err := p.computeETag(formatJSON, newer, output)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test_helpers.AssertBoolean(t, got == etag, false)
+	})
+}
+
+func TestPresenter_computeMaxAge(t *testing.T) {
+	p := Presenter{
+		Logger: dlog.NewLogger([]dlog.LoggerOption{
+			dlog.LoggerSetOutput(ioutil.Discard),
+		}...),
+	}
+
+	now := time.Now().Truncate(time.Second)
+
+	t.Run("expires when the next countdown minute is reached", func(t *testing.T) {
+		expected := test_helpers.AdjustTime(now, "2m25s")
+		deps := &model.Internal{
+			Departures: []model.Departure{
+				{
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "2m"),
+					ExpectedDepartureTime: &expected,
+				},
+			},
+		}
+
+		if got := p.computeMaxAge(now, deps); got != 25 {
+			t.Errorf("got %d, wanted %d", got, 25)
+		}
+	})
+
+	t.Run("uses the maximum age without real-time departures", func(t *testing.T) {
+		deps := &model.Internal{
+			Departures: []model.Departure{
+				{AimedDepartureTime: test_helpers.AdjustTime(now, "2m25s")},
+			},
+		}
+
+		if got := p.computeMaxAge(now, deps); got != int(maxCacheAge/time.Second) {
+			t.Errorf("got %d, wanted %d", got, int(maxCacheAge/time.Second))
+		}
+	})
+
+	t.Run("expires before a scheduled departure leaves the board", func(t *testing.T) {
+		deps := &model.Internal{
+			Departures: []model.Departure{
+				{AimedDepartureTime: test_helpers.AdjustTime(now, "2m25s")},
+				{AimedDepartureTime: test_helpers.AdjustTime(now, "25s")},
+			},
+		}
+
+		if got := p.computeMaxAge(now, deps); got != 25 {
+			t.Errorf("got %d, wanted %d", got, 25)
+		}
+	})
+
+	t.Run("expires before a cancelled departure leaves the board", func(t *testing.T) {
+		p := p
+		p.CancelledPeriod = 10 * time.Minute
+
+		deps := &model.Internal{
+			Departures: []model.Departure{
+				{
+					AimedDepartureTime: test_helpers.AdjustTime(now, "-9m50s"),
+					DepartureStatus:    aws.String(model.CancelledStatus),
+				},
+			},
+		}
+
+		if got := p.computeMaxAge(now, deps); got != 10 {
+			t.Errorf("got %d, wanted %d", got, 10)
+		}
+	})
+
+	t.Run("expires before a train leaves the board at its estimated time", func(t *testing.T) {
+		now := time.Date(2019, 5, 20, 12, 0, 20, 0, time.UTC)
+
+		deps := &model.Internal{
+			Departures: []model.Departure{
+				{
+					JourneyType:        model.Train,
+					AimedDepartureTime: test_helpers.AdjustTime(now, "-5m20s"),
+					DepartureStatus:    aws.String("12:01"),
+				},
+			},
+		}
+
+		if got := p.computeMaxAge(now, deps); got != 40 {
+			t.Errorf("got %d, wanted %d", got, 40)
+		}
+	})
+
+	t.Run("ignores departures that do not expire while delayed", func(t *testing.T) {
+		deps := &model.Internal{
+			Departures: []model.Departure{
+				{
+					JourneyType:        model.Train,
+					AimedDepartureTime: test_helpers.AdjustTime(now, "-5m"),
+					DepartureStatus:    aws.String("Delayed"),
+				},
+			},
+		}
+
+		if got := p.computeMaxAge(now, deps); got != int(maxCacheAge/time.Second) {
+			t.Errorf("got %d, wanted %d", got, int(maxCacheAge/time.Second))
+		}
+	})
+}
+
+func TestPresenter_matchesETag(t *testing.T) {
+	p := Presenter{
+		Logger: dlog.NewLogger([]dlog.LoggerOption{
+			dlog.LoggerSetOutput(ioutil.Discard),
+		}...),
+	}
+
+	etag := `W/"abc"`
+
+	test_helpers.AssertBoolean(t, p.matchesETag("", etag), false)
+	test_helpers.AssertBoolean(t, p.matchesETag("*", etag), true)
+	test_helpers.AssertBoolean(t, p.matchesETag(`W/"abc"`, etag), true)
+	test_helpers.AssertBoolean(t, p.matchesETag(`"abc"`, etag), true)
+	test_helpers.AssertBoolean(t, p.matchesETag(`"def", W/"abc"`, etag), true)
+	test_helpers.AssertBoolean(t, p.matchesETag(`"def"`, etag), false)
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"github.com/TfGMEnterprise/departures-service/model"
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scriptPageSize is the number of departures the script reads from the list at
+// a time, so that a large list is not loaded into memory at once
+const scriptPageSize = 50
+
+// departuresScriptSource reads the next departures for a location in a single
+// atomic call. It reads the list in pages, skips departures that have expired,
+// do not match the filter or cannot be decoded, and returns:
+//
+// 1. whether the location exists
+// 2. up to top departures, or all of them if top is 0
+// 3. the records that could not be decoded
+//
+// The script applies the same rules as model.IsExpiredAfter and the departure
+// filter, so the presenter shows the departures it returns as they are. An
+// estimated time of day is read with the UTC offset of the departure time,
+// which can differ from the presenter by an hour around a clock change.
+//
+// If trimming is enabled, the expired departures at the head of the list are
+// removed by the rule the ingester uses for the cache: real-time predictions
+// are trusted, and cancelled departures are kept for model.CancelledRetention.
+//
+// KEYS[1] is the key of the board for the location. ARGV is the current Unix
+// time in seconds, top, the stale threshold in seconds, the page size,
+// comma-separated lists of the service numbers, operator codes and stands to
+// filter by, the board type, how long in seconds cancelled departures are
+// shown after their aimed time, whether to trim expired departures (1 or 0),
+// and how long in seconds cancelled departures are kept in the cache. The
+// arrivals board uses the arrival time and status in place of the departure
+// time and status.
+const departuresScriptSource = `
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local top = tonumber(ARGV[2])
+local staleThreshold = tonumber(ARGV[3])
+local pageSize = tonumber(ARGV[4])
+
+local function toSet(values)
+  local set = {}
+  local empty = true
+  for value in string.gmatch(values, "[^,]+") do
+    set[value] = true
+    empty = false
+  end
+  if empty then
+    return nil
+  end
+  return set
+end
+
+local serviceNumbers = toSet(ARGV[5])
+local operatorCodes = toSet(ARGV[6])
+local stands = toSet(ARGV[7])
+local arrivals = ARGV[8] == "arrivals"
+local cancelledPeriod = tonumber(ARGV[9])
+local trim = ARGV[10] == "1"
+local cancelledRetention = tonumber(ARGV[11])
+
+-- The window around now in which an estimated time of day is placed, as in
+-- model.DefaultDepartureTimeWindow
+local windowPast = 7200
+local windowFuture = 7200
+
+local function daysFromCivil(y, m, d)
+  if m <= 2 then
+    y = y - 1
+  end
+  local era = math.floor(y / 400)
+  local yoe = y - era * 400
+  local mp = (m + 9) % 12
+  local doy = math.floor((153 * mp + 2) / 5) + d - 1
+  local doe = yoe * 365 + math.floor(yoe / 4) - math.floor(yoe / 100) + doy
+  return era * 146097 + doe - 719468
+end
+
+-- Returns the Unix time and UTC offset in seconds of an RFC 3339 time
+local function parseTime(value)
+  if type(value) ~= "string" then
+    return nil
+  end
+
+  local y, mo, d, h, mi, s, rest = string.match(value, "^(%d+)-(%d+)-(%d+)T(%d+):(%d+):(%d+)(.*)$")
+  if not y then
+    return nil
+  end
+
+  rest = string.gsub(rest, "^%.%d+", "")
+
+  local offset = 0
+  if rest ~= "Z" then
+    local sign, oh, om = string.match(rest, "^([+-])(%d+):(%d+)$")
+    if not sign then
+      return nil
+    end
+    offset = tonumber(oh) * 3600 + tonumber(om) * 60
+    if sign == "-" then
+      offset = -offset
+    end
+  end
+
+  local days = daysFromCivil(tonumber(y), tonumber(mo), tonumber(d))
+  local t = days * 86400 + tonumber(h) * 3600 + tonumber(mi) * 60 + tonumber(s) - offset
+
+  return t, offset
+end
+
+-- Returns the Unix time of the clock time on the previous, current or next day
+-- that is nearest to now within the window, or nil if there is none
+local function clockTime(h, m, offset)
+  local dayStart = math.floor((now + offset) / 86400) * 86400 - offset
+  local nearest = nil
+
+  for day = -1, 1 do
+    local t = dayStart + day * 86400 + h * 3600 + m * 60
+    if t >= now - windowPast and t <= now + windowFuture then
+      if nearest == nil or math.abs(t - now) < math.abs(nearest - now) then
+        nearest = t
+      end
+    end
+  end
+
+  return nearest
+end
+
+local function departureTime(dep, useStale)
+  local expectedTime, aimedTime = dep.expectedDepartureTime, dep.aimedDepartureTime
+  if arrivals then
+    expectedTime, aimedTime = dep.expectedArrivalTime, dep.aimedArrivalTime
+  end
+
+  if type(expectedTime) == "string" then
+    local stale = false
+    if useStale and staleThreshold > 0 then
+      local recordedAtTime = parseTime(dep.recordedAtTime)
+      stale = recordedAtTime ~= nil and now - recordedAtTime > staleThreshold
+    end
+
+    if not stale then
+      return parseTime(expectedTime)
+    end
+  end
+
+  return parseTime(aimedTime)
+end
+
+-- Returns true if the departure has expired, keeping cancelled departures for
+-- the period; stale predictions are ignored if useStale is set
+local function isExpired(dep, period, useStale)
+  local status = dep.departureStatus
+  if arrivals then
+    status = dep.arrivalStatus
+  end
+
+  if status == "Cancelled" then
+    local aimedTime = dep.aimedDepartureTime
+    if arrivals then
+      aimedTime = dep.aimedArrivalTime
+    end
+
+    local t = parseTime(aimedTime)
+    if not t then
+      return true
+    end
+
+    local cutoff = now - period
+    if dep.journeyType == "train" then
+      cutoff = math.floor(cutoff / 60) * 60
+    end
+    return t < cutoff
+  end
+
+  local t, offset = departureTime(dep, useStale)
+  if not t then
+    return true
+  end
+
+  if dep.journeyType ~= "train" then
+    return t < now
+  end
+
+  local nowMinute = math.floor(now / 60) * 60
+
+  if status == "Delayed" then
+    return false
+  end
+
+  if type(status) == "string" then
+    local h, m = string.match(status, "^(%d%d):(%d%d)$")
+    if h then
+      local expected = clockTime(tonumber(h), tonumber(m), offset)
+      if not expected then
+        -- Most likely delayed by more than the window
+        return false
+      end
+      return expected < nowMinute
+    end
+  end
+
+  return t < nowMinute
+end
+
+local function matches(dep)
+  if serviceNumbers and not serviceNumbers[string.upper(tostring(dep.serviceNumber or ""))] then
+    return false
+  end
+  if operatorCodes and not operatorCodes[string.upper(tostring(dep.operatorCode or ""))] then
+    return false
+  end
+  if stands and (type(dep.stand) ~= "string" or not stands[string.upper(dep.stand)]) then
+    return false
+  end
+  return true
+end
+
+if redis.call("EXISTS", key) == 0 then
+  return {0, {}, {}}
+end
+
+local result = {}
+local unreadable = {}
+local expiredHead = 0
+local inHead = trim
+local start = 0
+local done = false
+
+while not done do
+  local entries = redis.call("LRANGE", key, start, start + pageSize - 1)
+
+  for _, entry in ipairs(entries) do
+    local ok, dep = pcall(cjson.decode, entry)
+    ok = ok and type(dep) == "table"
+
+    if inHead and ok and isExpired(dep, cancelledRetention, false) then
+      expiredHead = expiredHead + 1
+    else
+      inHead = false
+    end
+
+    if not ok then
+      table.insert(unreadable, entry)
+    elseif not isExpired(dep, cancelledPeriod, true) and matches(dep) then
+      table.insert(result, entry)
+      if top > 0 and #result >= top then
+        done = true
+        break
+      end
+    end
+  end
+
+  if #entries < pageSize then
+    done = true
+  end
+
+  start = start + pageSize
+end
+
+if expiredHead > 0 then
+  redis.call("LTRIM", key, expiredHead, -1)
+end
+
+return {1, result, unreadable}
+`
+
+var departuresScript = redis.NewScript(1, departuresScriptSource)
+
+// readDeparturesWithScript reads the next departures for a single location
+// with one call to the departures script, which removes expired and filtered
+// departures and, if TrimExpired is set, trims the cache
+func (p Presenter) readDeparturesWithScript(now time.Time, atcocode string, top int64, filter *departureFilter) (*model.Internal, error) {
+	p.Logger.Debugf("readDeparturesWithScript for %s", atcocode)
+
+	var err error = nil
+	conn := p.Pool.Get()
+	defer func() {
+		if cErr := conn.Close(); cErr != nil {
+			err = cErr
+		}
+	}()
+
+	trim := "0"
+	if p.TrimExpired {
+		trim = "1"
+	}
+
+	args := []interface{}{
+		p.board.Key(atcocode),
+		strconv.FormatFloat(float64(now.UnixNano())/float64(time.Second), 'f', 3, 64),
+		top,
+		int64(p.StaleThreshold / time.Second),
+		scriptPageSize,
+	}
+
+	if filter == nil {
+		filter = &departureFilter{}
+	}
+
+	args = append(args, joinFilterValues(filter.serviceNumbers), joinFilterValues(filter.operatorCodes), joinFilterValues(filter.stands), string(p.board), int64(p.CancelledPeriod/time.Second), trim, int64(model.CancelledRetention/time.Second))
+
+	values, sErr := redis.Values(departuresScript.Do(conn, args...))
+	if sErr != nil {
+		return nil, sErr
+	}
+
+	var exists int64
+	var cDeps, unreadable []string
+
+	if _, sErr := redis.Scan(values, &exists, &cDeps, &unreadable); sErr != nil {
+		return nil, errors.Wrapf(sErr, "cannot read departures script result for `%s`", atcocode)
+	}
+
+	if exists == 0 {
+		return nil, newStopNotFoundError(errors.Errorf("no departures found for atcocode `%s`", atcocode))
+	}
+
+	for _, record := range unreadable {
+		p.Logger.Printf("skipped cached record for `%s`: cannot decode: %s", atcocode, record)
+	}
+
+	deps := model.Internal{}
+
+	p.appendCachedDepartures(&deps, atcocode, cDeps)
+
+	// The script has already used the aimed time of stale predictions; they
+	// are downgraded here so that they are shown as scheduled
+	p.downgradeStaleDepartures(now, &deps)
+
+	return &deps, err
+}
+
+// isScriptingUnsupportedError checks whether Redis rejected the departures
+// script because it does not support scripting
+func isScriptingUnsupportedError(err error) bool {
+	if _, ok := err.(redis.Error); !ok {
+		return false
+	}
+
+	return strings.Contains(strings.ToLower(err.Error()), "unknown command")
+}
+
+func joinFilterValues(values map[string]bool) string {
+	joined := make([]string, 0, len(values))
+	for value := range values {
+		joined = append(joined, value)
+	}
+
+	sort.Strings(joined)
+
+	return strings.Join(joined, ",")
+}
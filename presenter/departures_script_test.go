@@ -0,0 +1,414 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/TfGMEnterprise/departures-service/dlog"
+	"github.com/TfGMEnterprise/departures-service/model"
+	"github.com/TfGMEnterprise/departures-service/repository"
+	"github.com/TfGMEnterprise/departures-service/test_helpers"
+	"github.com/alicebob/miniredis"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/gomodule/redigo/redis"
+	"io/ioutil"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPresenter_ReadDeparturesWithScript(t *testing.T) {
+	logger := dlog.NewLogger([]dlog.LoggerOption{
+		dlog.LoggerSetOutput(ioutil.Discard),
+	}...)
+
+	loc, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2019, 5, 8, 12, 0, 30, 0, loc)
+
+	busDeparture := func(journeyRef string, serviceNumber string, recordedAtTime string, aimed string, expected string) model.Departure {
+		dep := model.Departure{
+			RecordedAtTime:     test_helpers.AdjustTime(now, recordedAtTime),
+			JourneyType:        model.Bus,
+			JourneyRef:         journeyRef,
+			AimedDepartureTime: test_helpers.AdjustTime(now, aimed),
+			LocationAtcocode:   "1800BNIN0C1",
+			Stand:              aws.String("C"),
+			ServiceNumber:      serviceNumber,
+			OperatorCode:       "ANWE",
+		}
+
+		if expected != "" {
+			dep.ExpectedDepartureTime = aws.Time(test_helpers.AdjustTime(now, expected))
+		}
+
+		return dep
+	}
+
+	trainDeparture := func(journeyRef string, aimed string, status string) model.Departure {
+		return model.Departure{
+			RecordedAtTime:     now,
+			JourneyType:        model.Train,
+			JourneyRef:         journeyRef,
+			AimedDepartureTime: test_helpers.AdjustTime(now, aimed),
+			DepartureStatus:    aws.String(status),
+			LocationAtcocode:   "9100MNCRPIC",
+		}
+	}
+
+	setup := func(t *testing.T, key string, departures ...model.Departure) (*miniredis.Miniredis, Presenter) {
+		t.Helper()
+
+		s, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, departure := range departures {
+			departureJSON, err := json.Marshal(departure)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := s.Push(key, string(departureJSON)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		p := Presenter{
+			Logger: logger,
+			Pool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", s.Addr())
+				}),
+			}...),
+			ReadWithScript: true,
+		}
+
+		return s, p
+	}
+
+	journeyRefs := func(deps *model.Internal) []string {
+		var refs []string
+		for _, dep := range deps.Departures {
+			refs = append(refs, dep.JourneyRef)
+		}
+		return refs
+	}
+
+	assertJourneyRefs := func(t *testing.T, deps *model.Internal, want ...string) {
+		t.Helper()
+
+		got := journeyRefs(deps)
+		if len(got) != len(want) {
+			t.Fatalf("got journeys %v, wanted %v", got, want)
+		}
+
+		for i := range want {
+			test_helpers.AssertString(t, got[i], want[i])
+		}
+	}
+
+	t.Run("skips expired departures and returns the next top departures", func(t *testing.T) {
+		s, p := setup(t, "1800BNIN0C1",
+			busDeparture("1", "123", "-1m", "-2m", ""),
+			busDeparture("2", "123", "-1m", "-1m", "-1s"),
+			busDeparture("3", "456", "-1m", "1m", ""),
+			busDeparture("4", "789", "-1m", "2m", "3m"),
+			busDeparture("5", "123", "-1m", "5m", ""))
+		defer s.Close()
+
+		deps, err := p.readDeparturesWithScript(now, "1800BNIN0C1", 2, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertJourneyRefs(t, deps, "3", "4")
+
+		// The cache is not changed unless trimming is enabled
+		list, err := s.List("1800BNIN0C1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(list) != 5 {
+			t.Errorf("got %d cached departures, wanted %d", len(list), 5)
+		}
+	})
+
+	t.Run("trims expired departures from the head of the list", func(t *testing.T) {
+		s, p := setup(t, "1800BNIN0C1",
+			busDeparture("1", "123", "-1m", "-2m", ""),
+			busDeparture("2", "123", "-1m", "-1m", "-1s"),
+			busDeparture("3", "456", "-1m", "1m", ""))
+		defer s.Close()
+
+		p.TrimExpired = true
+
+		deps, err := p.readDeparturesWithScript(now, "1800BNIN0C1", 2, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertJourneyRefs(t, deps, "3")
+
+		list, err := s.List("1800BNIN0C1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(list) != 1 {
+			t.Errorf("got %d cached departures, wanted %d", len(list), 1)
+		}
+	})
+
+	t.Run("trims expired departures by the cache's rules", func(t *testing.T) {
+		cancelled := busDeparture("1", "123", "-10m", "-5m", "")
+		cancelled.DepartureStatus = aws.String(model.CancelledStatus)
+
+		s, p := setup(t, "1800BNIN0C1",
+			busDeparture("0", "123", "-10m", "-6m", ""),
+			cancelled,
+			busDeparture("2", "123", "-10m", "-1m", "2m"))
+		defer s.Close()
+
+		// The presenter no longer shows the cancelled departure or trusts the
+		// prediction, but the cache keeps both
+		p.TrimExpired = true
+		p.StaleThreshold = 5 * time.Minute
+
+		deps, err := p.readDeparturesWithScript(now, "1800BNIN0C1", 2, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertJourneyRefs(t, deps)
+
+		list, err := s.List("1800BNIN0C1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(list) != 2 {
+			t.Errorf("got %d cached departures, wanted %d", len(list), 2)
+		}
+	})
+
+	t.Run("reads the list in pages", func(t *testing.T) {
+		var departures []model.Departure
+		for i := 0; i < 2*scriptPageSize+10; i++ {
+			departures = append(departures, busDeparture(strconv.Itoa(i), "123", "-1m", "-2m", ""))
+		}
+		departures = append(departures, busDeparture("next", "123", "-1m", "1m", ""))
+
+		s, p := setup(t, "1800BNIN0C1", departures...)
+		defer s.Close()
+
+		p.TrimExpired = true
+
+		deps, err := p.readDeparturesWithScript(now, "1800BNIN0C1", 2, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertJourneyRefs(t, deps, "next")
+
+		list, err := s.List("1800BNIN0C1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(list) != 1 {
+			t.Errorf("got %d cached departures, wanted %d", len(list), 1)
+		}
+	})
+
+	t.Run("applies the filter", func(t *testing.T) {
+		s, p := setup(t, "1800BNIN0C1",
+			busDeparture("1", "123", "-1m", "1m", ""),
+			busDeparture("2", "456", "-1m", "2m", ""),
+			busDeparture("3", "123", "-1m", "3m", ""),
+			busDeparture("4", "123", "-1m", "4m", ""))
+		defer s.Close()
+
+		filter, err := p.newDepartureFilter(map[string]string{"serviceNumber": "123"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		deps, err := p.readDeparturesWithScript(now, "1800BNIN0C1", 2, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertJourneyRefs(t, deps, "1", "3")
+	})
+
+	t.Run("uses the aimed time for stale predictions", func(t *testing.T) {
+		s, p := setup(t, "1800BNIN0C1",
+			busDeparture("1", "123", "-10m", "-1m", "5m"),
+			busDeparture("2", "456", "-10s", "2m", "3m"))
+		defer s.Close()
+
+		p.StaleThreshold = 5 * time.Minute
+
+		deps, err := p.readDeparturesWithScript(now, "1800BNIN0C1", 2, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertJourneyRefs(t, deps, "2")
+	})
+
+	t.Run("applies the rail departure status rules", func(t *testing.T) {
+		s, p := setup(t, "9100MNCRPIC",
+			trainDeparture("1", "-2m", "On time"),
+			trainDeparture("2", "-5m", "Delayed"),
+			trainDeparture("3", "-3m", test_helpers.AdjustTime(now, "2m").Format("15:04")),
+			trainDeparture("4", "-1m", test_helpers.AdjustTime(now, "-1m").Format("15:04")),
+			trainDeparture("5", "0s", "On time"),
+			trainDeparture("6", "1m", test_helpers.AdjustTime(now, "2h30m").Format("15:04")))
+		defer s.Close()
+
+		deps, err := p.readDeparturesWithScript(now, "9100MNCRPIC", 6, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A train delayed by more than two hours is kept
+		assertJourneyRefs(t, deps, "2", "3", "5", "6")
+	})
+
+	t.Run("shows cancelled departures for the cancelled period", func(t *testing.T) {
+		cancelled := func(dep model.Departure) model.Departure {
+			dep.DepartureStatus = aws.String(model.CancelledStatus)
+			return dep
+		}
+
+		s, p := setup(t, "1800BNIN0C1",
+			cancelled(busDeparture("1", "123", "-5m", "-3m", "")),
+			cancelled(busDeparture("2", "123", "-5m", "-1m", "")),
+			busDeparture("3", "123", "-5m", "-30s", ""),
+			trainDeparture("4", "-1m", model.CancelledStatus),
+			busDeparture("5", "123", "-5m", "2m", ""))
+		defer s.Close()
+
+		p.CancelledPeriod = 2 * time.Minute
+
+		deps, err := p.readDeparturesWithScript(now, "1800BNIN0C1", 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertJourneyRefs(t, deps, "2", "4", "5")
+	})
+
+	t.Run("reads the arrivals board by arrival time", func(t *testing.T) {
+		arrival := func(journeyRef string, aimedArrival string, aimedDeparture string) model.Departure {
+			dep := busDeparture(journeyRef, "123", "-1m", aimedDeparture, "")
+			dep.AimedDepartureTime = time.Time{}
+			if aimedDeparture != "" {
+				dep.AimedDepartureTime = test_helpers.AdjustTime(now, aimedDeparture)
+			}
+			dep.AimedArrivalTime = test_helpers.AdjustTime(now, aimedArrival)
+			return dep
+		}
+
+		s, p := setup(t, model.ArrivalsKeyPrefix+"1800BNIN0C1",
+			arrival("1", "-1m", "1m"),
+			arrival("2", "1m", ""),
+			arrival("3", "2m", "3m"))
+		defer s.Close()
+
+		p.TrimExpired = true
+		p.board = model.ArrivalsBoard
+
+		deps, err := p.readDeparturesWithScript(now, "1800BNIN0C1", 2, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertJourneyRefs(t, deps, "2", "3")
+
+		// Arrivals are shown by their arrival time
+		test_helpers.AssertString(t, deps.Departures[0].AimedDepartureTime.Format(time.RFC3339), test_helpers.AdjustTime(now, "1m").Format(time.RFC3339))
+
+		list, err := s.List(model.ArrivalsKeyPrefix + "1800BNIN0C1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(list) != 2 {
+			t.Errorf("got %d cached arrivals, wanted %d", len(list), 2)
+		}
+	})
+
+	t.Run("skips cached records that cannot be read", func(t *testing.T) {
+		invalid := busDeparture("3", "123", "-1m", "3m", "")
+		invalid.LocationAtcocode = ""
+
+		s, p := setup(t, "1800BNIN0C1",
+			busDeparture("1", "123", "-1m", "1m", ""))
+		defer s.Close()
+
+		if _, err := s.Push("1800BNIN0C1", `{"journeyRef":`); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, dep := range []model.Departure{busDeparture("2", "123", "-1m", "2m", ""), invalid} {
+			departureJSON, err := json.Marshal(dep)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := s.Push("1800BNIN0C1", string(departureJSON)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		deps, err := p.readDeparturesWithScript(now, "1800BNIN0C1", 2, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertJourneyRefs(t, deps, "1", "2")
+
+		deps, err = p.readDeparturesWithScript(now, "1800BNIN0C1", 3, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertJourneyRefs(t, deps, "1", "2")
+	})
+
+	t.Run("returns not found error if the location is not in the cache", func(t *testing.T) {
+		s, p := setup(t, "1800BNIN0C1")
+		defer s.Close()
+
+		_, err := p.readDeparturesWithScript(now, "1800BNIN0C1", 2, nil)
+		test_helpers.AssertBoolean(t, isStopNotFoundError(err), true)
+	})
+
+	t.Run("matches the departures read by page", func(t *testing.T) {
+		s, p := setup(t, "1800BNIN0C1",
+			busDeparture("1", "123", "-1m", "-2m", ""),
+			busDeparture("2", "123", "-1m", "-1m", "-1s"),
+			busDeparture("3", "456", "-1m", "1m", ""),
+			busDeparture("4", "789", "-1m", "2m", "3m"),
+			busDeparture("5", "123", "-1m", "5m", ""))
+		defer s.Close()
+
+		byScript, err := p.getDepartures(now, "1800BNIN0C1", 3, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		byPage, err := p.getDeparturesByPage(now, "1800BNIN0C1", 3, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertJourneyRefs(t, byScript, journeyRefs(byPage)...)
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/TfGMEnterprise/departures-service/model"
+	"github.com/pkg/errors"
+)
+
+// DisplayRule configures how departure times are shown on a board
+type DisplayRule struct {
+	// Real-time departures less than this many seconds away show the due label
+	DueWithinSeconds int    `json:"dueWithinSeconds"`
+	DueLabel         string `json:"dueLabel"`
+	// Real-time departures more than this many minutes away show the clock
+	// time; zero means real-time departures always show a countdown
+	MaxCountdownMinutes int    `json:"maxCountdownMinutes"`
+	MinuteLabel         string `json:"minuteLabel"`
+	MinutesLabel        string `json:"minutesLabel"`
+	// The Go time layout used to show scheduled departures
+	ClockFormat string `json:"clockFormat"`
+}
+
+// DisplayRules holds the default display rule and any overrides for
+// particular journey types
+type DisplayRules struct {
+	Default      DisplayRule
+	JourneyTypes map[model.JourneyType]DisplayRule
+}
+
+// defaultDisplayRule matches the departure times shown before display rules
+// could be configured
+var defaultDisplayRule = DisplayRule{
+	DueWithinSeconds:    60,
+	DueLabel:            "Approaching",
+	MaxCountdownMinutes: 0,
+	MinuteLabel:         "min",
+	MinutesLabel:        "mins",
+	ClockFormat:         "15:04",
+}
+
+// ParseDisplayRules reads display rules from JSON. Fields missing from the
+// default rule are taken from the built-in rule, and fields missing from a
+// journey type rule are taken from the default rule.
+func ParseDisplayRules(rulesJSON []byte) (*DisplayRules, error) {
+	config := struct {
+		Default      json.RawMessage                       `json:"default"`
+		JourneyTypes map[model.JourneyType]json.RawMessage `json:"journeyTypes"`
+	}{}
+
+	if err := json.Unmarshal(rulesJSON, &config); err != nil {
+		return nil, errors.Wrap(err, "cannot parse display rules")
+	}
+
+	rules := &DisplayRules{
+		Default:      defaultDisplayRule,
+		JourneyTypes: map[model.JourneyType]DisplayRule{},
+	}
+
+	if len(config.Default) > 0 {
+		if err := json.Unmarshal(config.Default, &rules.Default); err != nil {
+			return nil, errors.Wrap(err, "cannot parse default display rule")
+		}
+	}
+
+	for journeyType, ruleJSON := range config.JourneyTypes {
+		rule := rules.Default
+		if err := json.Unmarshal(ruleJSON, &rule); err != nil {
+			return nil, errors.Wrapf(err, "cannot parse display rule for journey type `%s`", journeyType)
+		}
+
+		rules.JourneyTypes[journeyType] = rule
+	}
+
+	return rules, nil
+}
+
+// displayRule returns the display rule for the journey type
+func (p *Presenter) displayRule(journeyType model.JourneyType) DisplayRule {
+	if p.DisplayRules == nil {
+		return defaultDisplayRule
+	}
+
+	if rule, exists := p.DisplayRules.JourneyTypes[journeyType]; exists {
+		return rule
+	}
+
+	return p.DisplayRules.Default
+}
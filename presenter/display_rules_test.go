@@ -0,0 +1,47 @@
+package main
+
+import (
+	"github.com/TfGMEnterprise/departures-service/model"
+	"github.com/TfGMEnterprise/departures-service/test_helpers"
+	"testing"
+)
+
+func TestParseDisplayRules(t *testing.T) {
+	t.Run("uses the built-in rule if no rules are set", func(t *testing.T) {
+		rules, err := ParseDisplayRules([]byte(`{}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if rules.Default != defaultDisplayRule {
+			t.Errorf("got %#v, wanted %#v", rules.Default, defaultDisplayRule)
+		}
+	})
+
+	t.Run("takes missing journey type fields from the default rule", func(t *testing.T) {
+		rules, err := ParseDisplayRules([]byte(`{
+			"default": {"dueLabel": "Due", "maxCountdownMinutes": 60},
+			"journeyTypes": {"train": {"minutesLabel": "minutes"}}
+		}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test_helpers.AssertString(t, rules.Default.DueLabel, "Due")
+		test_helpers.AssertString(t, rules.Default.MinutesLabel, defaultDisplayRule.MinutesLabel)
+
+		train := rules.JourneyTypes[model.Train]
+		test_helpers.AssertString(t, train.DueLabel, "Due")
+		test_helpers.AssertString(t, train.MinutesLabel, "minutes")
+
+		if train.MaxCountdownMinutes != 60 {
+			t.Errorf("got %d, wanted %d", train.MaxCountdownMinutes, 60)
+		}
+	})
+
+	t.Run("returns error if the rules are not valid", func(t *testing.T) {
+		if _, err := ParseDisplayRules([]byte(`{"default": {"dueWithinSeconds": "foo"}}`)); err == nil {
+			t.Error("should return error")
+		}
+	})
+}
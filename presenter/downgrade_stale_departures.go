@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/TfGMEnterprise/departures-service/model"
+	"sort"
+	"time"
+)
+
+// downgradeStaleDepartures drops real-time predictions that have not been
+// updated within the stale threshold, so that the departure falls back to its
+// aimed time and is shown as scheduled
+func (p *Presenter) downgradeStaleDepartures(now time.Time, deps *model.Internal) int {
+	p.Logger.Debug("downgradeStaleDepartures")
+
+	if deps == nil || p.StaleThreshold <= 0 {
+		return 0
+	}
+
+	downgraded := 0
+	for i := range deps.Departures {
+		if deps.Departures[i].IsStale(now, p.StaleThreshold) {
+			deps.Departures[i].ExpectedDepartureTime = nil
+			downgraded++
+		}
+	}
+
+	p.Logger.Debugf("downgraded %d stale departure(s)", downgraded)
+
+	// A departure that falls back to its aimed time may now be out of order
+	if downgraded > 0 {
+		sort.Stable(model.ByDepartureTime(deps.Departures))
+	}
+
+	return downgraded
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"github.com/TfGMEnterprise/departures-service/dlog"
+	"github.com/TfGMEnterprise/departures-service/model"
+	"github.com/TfGMEnterprise/departures-service/test_helpers"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestPresenter_downgradeStaleDepartures(t *testing.T) {
+	logger := dlog.NewLogger([]dlog.LoggerOption{
+		dlog.LoggerSetOutput(ioutil.Discard),
+	}...)
+
+	now := time.Now().Truncate(time.Second)
+
+	buildDeps := func() *model.Internal {
+		expected1 := test_helpers.AdjustTime(now, "2m")
+		expected2 := test_helpers.AdjustTime(now, "4m")
+
+		return &model.Internal{
+			Departures: []model.Departure{
+				{
+					RecordedAtTime:        test_helpers.AdjustTime(now, "-10s"),
+					JourneyRef:            "1",
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "1m"),
+					ExpectedDepartureTime: &expected1,
+				},
+				{
+					RecordedAtTime:        test_helpers.AdjustTime(now, "-20m"),
+					JourneyRef:            "2",
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "-1m"),
+					ExpectedDepartureTime: &expected2,
+				},
+			},
+		}
+	}
+
+	t.Run("falls back to the aimed time for stale predictions", func(t *testing.T) {
+		p := Presenter{
+			Logger:         logger,
+			StaleThreshold: 5 * time.Minute,
+		}
+
+		deps := buildDeps()
+
+		if got := p.downgradeStaleDepartures(now, deps); got != 1 {
+			t.Errorf("got %d, wanted %d downgraded departures", got, 1)
+		}
+
+		// The downgraded departure is now due before the other one
+		test_helpers.AssertString(t, deps.Departures[0].JourneyRef, "2")
+		test_helpers.AssertBoolean(t, deps.Departures[0].ExpectedDepartureTime == nil, true)
+		test_helpers.AssertBoolean(t, deps.Departures[1].ExpectedDepartureTime == nil, false)
+	})
+
+	t.Run("trusts all predictions if there is no threshold", func(t *testing.T) {
+		p := Presenter{
+			Logger: logger,
+		}
+
+		deps := buildDeps()
+
+		if got := p.downgradeStaleDepartures(now, deps); got != 0 {
+			t.Errorf("got %d, wanted %d downgraded departures", got, 0)
+		}
+
+		test_helpers.AssertString(t, deps.Departures[0].JourneyRef, "1")
+	})
+}
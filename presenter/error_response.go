@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/TfGMEnterprise/departures-service/model"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pkg/errors"
+	"net/http"
+)
+
+// Machine-readable error codes returned to clients in the error response body
+const (
+	errorCodeInvalidParameter   = "invalidParameter"
+	errorCodeForbidden          = "forbidden"
+	errorCodeStopNotFound       = "stopNotFound"
+	errorCodeServiceUnavailable = "serviceUnavailable"
+	errorCodeInternalError      = "internalError"
+)
+
+// presenterError associates an error with the HTTP status code and error
+// code that should be returned to the client
+type presenterError struct {
+	statusCode int
+	code       string
+	err        error
+}
+
+func (e *presenterError) Error() string {
+	return e.err.Error()
+}
+
+func newInvalidParameterError(err error) error {
+	return &presenterError{
+		statusCode: http.StatusBadRequest,
+		code:       errorCodeInvalidParameter,
+		err:        err,
+	}
+}
+
+func newForbiddenError(err error) error {
+	return &presenterError{
+		statusCode: http.StatusForbidden,
+		code:       errorCodeForbidden,
+		err:        err,
+	}
+}
+
+func newStopNotFoundError(err error) error {
+	return &presenterError{
+		statusCode: http.StatusNotFound,
+		code:       errorCodeStopNotFound,
+		err:        err,
+	}
+}
+
+func newServiceUnavailableError(err error) error {
+	return &presenterError{
+		statusCode: http.StatusServiceUnavailable,
+		code:       errorCodeServiceUnavailable,
+		err:        err,
+	}
+}
+
+func isStopNotFoundError(err error) bool {
+	pErr, ok := err.(*presenterError)
+	return ok && pErr.code == errorCodeStopNotFound
+}
+
+// errorResponse logs the error and converts it into an API Gateway response.
+// Client errors include the error message in the response body; server errors
+// only include a generic message so that internal details stay in the logs.
+func (p Presenter) errorResponse(err error) (*events.APIGatewayProxyResponse, error) {
+	p.Logger.Debug("errorResponse")
+
+	statusCode, output := p.errorOutput(err)
+
+	outputJSON, err := json.Marshal(output)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal JSON for error response")
+	}
+
+	return &events.APIGatewayProxyResponse{
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"content-type": "application/json",
+		},
+		Body: string(outputJSON),
+	}, nil
+}
+
+// errorOutput logs the error and returns the HTTP status code and error
+// output to return to the client
+func (p Presenter) errorOutput(err error) (int, *model.ErrorOutput) {
+	pErr, ok := err.(*presenterError)
+	if !ok {
+		pErr = &presenterError{
+			statusCode: http.StatusInternalServerError,
+			code:       errorCodeInternalError,
+			err:        err,
+		}
+	}
+
+	output := model.ErrorOutput{
+		Code:    pErr.code,
+		Message: pErr.err.Error(),
+	}
+
+	if pErr.statusCode >= http.StatusInternalServerError {
+		p.Logger.Printf("%+v", pErr.err)
+		output.Message = http.StatusText(pErr.statusCode)
+	} else {
+		p.Logger.Debugf("%+v", pErr.err)
+	}
+
+	return pErr.statusCode, &output
+}
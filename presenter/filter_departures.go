@@ -0,0 +1,104 @@
+package main
+
+import (
+	"github.com/TfGMEnterprise/departures-service/model"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// departureFilter holds the optional service number, operator code and stand
+// values requested by the client; an empty set matches any value
+type departureFilter struct {
+	serviceNumbers map[string]bool
+	operatorCodes  map[string]bool
+	stands         map[string]bool
+}
+
+func (p *Presenter) newDepartureFilter(queryStringParameters map[string]string) (*departureFilter, error) {
+	p.Logger.Debug("newDepartureFilter")
+
+	filter := departureFilter{}
+
+	var err error
+
+	if filter.serviceNumbers, err = p.parseFilterValues(queryStringParameters, "serviceNumber", p.validateServiceNumber); err != nil {
+		return nil, err
+	}
+
+	if filter.operatorCodes, err = p.parseFilterValues(queryStringParameters, "operatorCode", p.validateOperatorCode); err != nil {
+		return nil, err
+	}
+
+	if filter.stands, err = p.parseFilterValues(queryStringParameters, "stand", p.validateStand); err != nil {
+		return nil, err
+	}
+
+	return &filter, nil
+}
+
+// parseFilterValues splits a comma-separated query string parameter into a
+// set of upper case values, validating each value in turn
+func (p *Presenter) parseFilterValues(queryStringParameters map[string]string, name string, validate func(string) bool) (map[string]bool, error) {
+	p.Logger.Debugf("parseFilterValues for %s", name)
+
+	valuesStr, exists := queryStringParameters[name]
+	if !exists {
+		return nil, nil
+	}
+
+	values := make(map[string]bool)
+
+	for _, value := range strings.Split(valuesStr, ",") {
+		value = strings.TrimSpace(value)
+
+		if !validate(value) {
+			return nil, errors.Errorf("%s value `%s` is not valid", name, value)
+		}
+
+		values[strings.ToUpper(value)] = true
+	}
+
+	return values, nil
+}
+
+func (f *departureFilter) matches(dep model.Departure) bool {
+	if len(f.serviceNumbers) > 0 && !f.serviceNumbers[strings.ToUpper(dep.ServiceNumber)] {
+		return false
+	}
+
+	if len(f.operatorCodes) > 0 && !f.operatorCodes[strings.ToUpper(dep.OperatorCode)] {
+		return false
+	}
+
+	if len(f.stands) > 0 && (dep.Stand == nil || !f.stands[strings.ToUpper(*dep.Stand)]) {
+		return false
+	}
+
+	return true
+}
+
+// filterDepartures removes any departures that do not match the filter,
+// preserving the order of the remaining departures
+func (p *Presenter) filterDepartures(filter *departureFilter, deps *model.Internal) int64 {
+	p.Logger.Debug("filterDepartures")
+
+	if filter == nil || deps == nil {
+		return 0
+	}
+
+	i := 0
+	for _, dep := range deps.Departures {
+		if filter.matches(dep) {
+			deps.Departures[i] = dep
+			i++
+		}
+	}
+
+	removed := len(deps.Departures) - i
+
+	p.Logger.Debugf("filtered %d departure(s)", removed)
+
+	deps.Departures = deps.Departures[:i]
+
+	return int64(removed)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"github.com/TfGMEnterprise/departures-service/dlog"
+	"github.com/TfGMEnterprise/departures-service/model"
+	"github.com/aws/aws-sdk-go/aws"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestPresenter_NewDepartureFilter(t *testing.T) {
+	logger := dlog.NewLogger([]dlog.LoggerOption{
+		dlog.LoggerSetOutput(ioutil.Discard),
+	}...)
+
+	p := Presenter{
+		Logger: logger,
+	}
+
+	t.Run("returns an empty filter if no filter values are provided", func(t *testing.T) {
+		got, err := p.newDepartureFilter(map[string]string{
+			"atcocode": "1800BNIN",
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(got.serviceNumbers) != 0 || len(got.operatorCodes) != 0 || len(got.stands) != 0 {
+			t.Errorf("filter should be empty: got %#v", got)
+		}
+	})
+
+	t.Run("splits comma-separated values", func(t *testing.T) {
+		got, err := p.newDepartureFilter(map[string]string{
+			"serviceNumber": "192, x50",
+			"operatorCode":  "SCMN",
+			"stand":         "a,B",
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(got.serviceNumbers) != 2 || !got.serviceNumbers["192"] || !got.serviceNumbers["X50"] {
+			t.Errorf("unexpected service numbers: %#v", got.serviceNumbers)
+		}
+
+		if len(got.operatorCodes) != 1 || !got.operatorCodes["SCMN"] {
+			t.Errorf("unexpected operator codes: %#v", got.operatorCodes)
+		}
+
+		if len(got.stands) != 2 || !got.stands["A"] || !got.stands["B"] {
+			t.Errorf("unexpected stands: %#v", got.stands)
+		}
+	})
+
+	t.Run("returns an error for an invalid value", func(t *testing.T) {
+		_, err := p.newDepartureFilter(map[string]string{
+			"stand": "A,,B",
+		})
+
+		if err == nil {
+			t.Error("should return an error")
+			return
+		}
+
+		if !strings.Contains(err.Error(), "stand") {
+			t.Errorf("error should include the parameter name: %s", "stand")
+		}
+	})
+}
+
+func TestPresenter_FilterDepartures(t *testing.T) {
+	logger := dlog.NewLogger([]dlog.LoggerOption{
+		dlog.LoggerSetOutput(ioutil.Discard),
+	}...)
+
+	p := Presenter{
+		Logger: logger,
+	}
+
+	departures := func() *model.Internal {
+		return &model.Internal{
+			Departures: []model.Departure{
+				{JourneyRef: "1", ServiceNumber: "192", OperatorCode: "SCMN", Stand: aws.String("A")},
+				{JourneyRef: "2", ServiceNumber: "X50", OperatorCode: "ANWE", Stand: aws.String("B")},
+				{JourneyRef: "3", ServiceNumber: "192", OperatorCode: "SCMN", Stand: aws.String("B")},
+				{JourneyRef: "4", ServiceNumber: "50", OperatorCode: "FMAN"},
+			},
+		}
+	}
+
+	journeyRefs := func(deps *model.Internal) string {
+		var refs []string
+		for _, dep := range deps.Departures {
+			refs = append(refs, dep.JourneyRef)
+		}
+		return strings.Join(refs, ",")
+	}
+
+	t.Run("handles a nil filter", func(t *testing.T) {
+		deps := departures()
+
+		got := p.filterDepartures(nil, deps)
+
+		if got != 0 {
+			t.Errorf("got `%d`, want `%d`", got, 0)
+		}
+	})
+
+	t.Run("does not remove anything with an empty filter", func(t *testing.T) {
+		deps := departures()
+
+		got := p.filterDepartures(&departureFilter{}, deps)
+
+		if got != 0 || len(deps.Departures) != 4 {
+			t.Errorf("removed %d departure(s); should remove %d", got, 0)
+		}
+	})
+
+	t.Run("removes departures for other service numbers", func(t *testing.T) {
+		deps := departures()
+
+		got := p.filterDepartures(&departureFilter{
+			serviceNumbers: map[string]bool{"192": true},
+		}, deps)
+
+		if got != 2 {
+			t.Errorf("removed %d departure(s); should remove %d", got, 2)
+		}
+
+		if refs := journeyRefs(deps); refs != "1,3" {
+			t.Errorf("got journeys `%s`, want `%s`", refs, "1,3")
+		}
+	})
+
+	t.Run("combines service number, operator code and stand filters", func(t *testing.T) {
+		deps := departures()
+
+		got := p.filterDepartures(&departureFilter{
+			serviceNumbers: map[string]bool{"192": true, "X50": true, "50": true},
+			operatorCodes:  map[string]bool{"SCMN": true, "ANWE": true, "FMAN": true},
+			stands:         map[string]bool{"B": true},
+		}, deps)
+
+		if got != 2 {
+			t.Errorf("removed %d departure(s); should remove %d", got, 2)
+		}
+
+		if refs := journeyRefs(deps); refs != "2,3" {
+			t.Errorf("got journeys `%s`, want `%s`", refs, "2,3")
+		}
+	})
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+)
+
+// How long in-flight requests are given to complete when the server stops
+const shutdownTimeout = 10 * time.Second
+
+// serve runs the presenter as a standalone HTTP server until a value is
+// received on stop, then shuts down gracefully
+func (p Presenter) serve(addr string, stop <-chan os.Signal) error {
+	p.Logger.Debugf("serve on %s", addr)
+
+	// Streams are pushed board changes from Redis keyspace notifications
+	p.streamHub = newStreamHub()
+	go p.listenForChanges(p.streamHub)
+
+	// There is no write timeout as streams are open indefinitely
+	server := &http.Server{
+		Addr:        addr,
+		Handler:     p.newServeMux(),
+		ReadTimeout: 10 * time.Second,
+	}
+
+	// Streams would otherwise hold the shutdown open until it timed out
+	server.RegisterOnShutdown(p.streamHub.close)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		p.streamHub.close()
+		return errors.Wrap(err, "HTTP server stopped")
+	case sig := <-stop:
+		p.Logger.Printf("received %s; shutting down HTTP server", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		return errors.Wrap(err, "cannot shut down HTTP server")
+	}
+
+	return nil
+}
+
+func (p Presenter) newServeMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/departures", p.apiGatewayHTTPHandler(http.MethodGet))
+	mux.HandleFunc("/departures/batch", p.apiGatewayHTTPHandler(http.MethodPost))
+	mux.HandleFunc("/departures/stream", p.streamHTTPHandler)
+	mux.HandleFunc("/healthz", p.healthzHTTPHandler)
+
+	return mux
+}
+
+// apiGatewayHTTPHandler returns a handler that maps an HTTP request with the
+// given method onto the API Gateway handler
+func (p Presenter) apiGatewayHTTPHandler(method string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p.serveAPIGateway(method, w, r)
+	}
+}
+
+func (p Presenter) serveAPIGateway(method string, w http.ResponseWriter, r *http.Request) {
+	p.Logger.Debugf("serveAPIGateway %s %s", r.Method, r.URL.Path)
+
+	if r.Method != method {
+		p.Logger.Debugf("invalid method %s", r.Method)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	requestBody, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		p.Logger.Printf("could not read body: %s", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	resp, err := p.Handler(p.newAPIGatewayRequest(r, string(requestBody)))
+	if err != nil {
+		p.Logger.Printf("%+v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	p.writeAPIGatewayResponse(w, resp)
+}
+
+// newAPIGatewayRequest converts an HTTP request into an API Gateway request;
+// only the first value of any repeated header or parameter is used
+func (p Presenter) newAPIGatewayRequest(r *http.Request, body string) events.APIGatewayProxyRequest {
+	request := events.APIGatewayProxyRequest{
+		Path:                  r.URL.Path,
+		HTTPMethod:            r.Method,
+		Headers:               map[string]string{},
+		QueryStringParameters: map[string]string{},
+		Body:                  body,
+	}
+
+	for name := range r.Header {
+		request.Headers[name] = r.Header.Get(name)
+	}
+
+	query := r.URL.Query()
+	for name := range query {
+		request.QueryStringParameters[name] = query.Get(name)
+	}
+
+	return request
+}
+
+func (p Presenter) writeAPIGatewayResponse(w http.ResponseWriter, resp *events.APIGatewayProxyResponse) {
+	body := []byte(resp.Body)
+	if resp.IsBase64Encoded {
+		var err error
+		body, err = base64.StdEncoding.DecodeString(resp.Body)
+		if err != nil {
+			p.Logger.Printf("could not decode response body: %s", err.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	for name, value := range resp.Headers {
+		w.Header().Set(name, value)
+	}
+
+	w.WriteHeader(resp.StatusCode)
+
+	if _, err := w.Write(body); err != nil {
+		p.Logger.Printf("could not write response: %s", err.Error())
+	}
+}
+
+// healthzHTTPHandler reports whether the Redis cache can be reached
+func (p Presenter) healthzHTTPHandler(w http.ResponseWriter, r *http.Request) {
+	p.Logger.Debug("healthzHTTPHandler")
+
+	conn := p.Pool.Get()
+	defer func() {
+		if err := conn.Close(); err != nil {
+			p.Logger.Printf("could not close Redis connection: %s", err.Error())
+		}
+	}()
+
+	if _, err := conn.Do("PING"); err != nil {
+		p.Logger.Printf("could not ping Redis: %s", err.Error())
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
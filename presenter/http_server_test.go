@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/TfGMEnterprise/departures-service/dlog"
+	"github.com/TfGMEnterprise/departures-service/model"
+	"github.com/TfGMEnterprise/departures-service/repository"
+	"github.com/TfGMEnterprise/departures-service/test_helpers"
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+	"github.com/rafaeljusto/redigomock"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPresenter_HTTPServer(t *testing.T) {
+	logger := dlog.NewLogger([]dlog.LoggerOption{
+		dlog.LoggerSetOutput(ioutil.Discard),
+	}...)
+
+	newPresenter := func(conn *redigomock.Conn) Presenter {
+		return Presenter{
+			Logger: logger,
+			Pool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return conn, nil
+				}),
+			}...),
+		}
+	}
+
+	t.Run("gets departures for the requested atcocode", func(t *testing.T) {
+		now := time.Now().Truncate(time.Second)
+
+		atcocode := "1800BNIN0C1"
+
+		stand := "C"
+		departure1 := buildJSONDeparture(
+			t,
+			test_helpers.AdjustTime(now, "-10s"),
+			model.Bus,
+			1234,
+			test_helpers.AdjustTime(now, "5m10s"),
+			nil,
+			atcocode,
+			&stand,
+			"1800WA12481",
+			"Hobbiton",
+			"123",
+			"ANWE")
+
+		conn := redigomock.NewConn()
+		conn.Command("LRANGE", atcocode, int64(0), int64(0)).ExpectStringSlice(string(departure1))
+
+		p := newPresenter(conn)
+
+		req := httptest.NewRequest(http.MethodGet, "/departures?atcocode="+atcocode+"&top=1", nil)
+		w := httptest.NewRecorder()
+
+		p.newServeMux().ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("wrong status code: got %d, wanted %d", w.Code, http.StatusOK)
+		}
+
+		test_helpers.AssertString(t, w.Header().Get("Content-Type"), "application/json")
+
+		output := model.Output{}
+		if err := json.Unmarshal(w.Body.Bytes(), &output); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(output.Departures) != 1 {
+			t.Fatalf("got %d departures, wanted %d", len(output.Departures), 1)
+		}
+
+		test_helpers.AssertString(t, output.Departures[0].ServiceNumber, "123")
+	})
+
+	t.Run("returns the error response from the handler", func(t *testing.T) {
+		p := newPresenter(redigomock.NewConn())
+
+		req := httptest.NewRequest(http.MethodGet, "/departures?atcocode=foo", nil)
+		w := httptest.NewRecorder()
+
+		p.newServeMux().ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("wrong status code: got %d, wanted %d", w.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("only allows GET requests for departures", func(t *testing.T) {
+		p := newPresenter(redigomock.NewConn())
+
+		req := httptest.NewRequest(http.MethodPost, "/departures?atcocode=1800BNIN0C1", nil)
+		w := httptest.NewRecorder()
+
+		p.newServeMux().ServeHTTP(w, req)
+
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("wrong status code: got %d, wanted %d", w.Code, http.StatusMethodNotAllowed)
+		}
+	})
+
+	t.Run("reports healthy if Redis can be reached", func(t *testing.T) {
+		conn := redigomock.NewConn()
+		conn.Command("PING").Expect("PONG")
+
+		p := newPresenter(conn)
+
+		req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+		w := httptest.NewRecorder()
+
+		p.newServeMux().ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("wrong status code: got %d, wanted %d", w.Code, http.StatusOK)
+		}
+	})
+
+	t.Run("reports unhealthy if Redis cannot be reached", func(t *testing.T) {
+		conn := redigomock.NewConn()
+		conn.Command("PING").ExpectError(errors.New("connection refused"))
+
+		p := newPresenter(conn)
+
+		req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+		w := httptest.NewRecorder()
+
+		p.newServeMux().ServeHTTP(w, req)
+
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("wrong status code: got %d, wanted %d", w.Code, http.StatusServiceUnavailable)
+		}
+	})
+
+	t.Run("shuts down when stopped", func(t *testing.T) {
+		p := newPresenter(redigomock.NewConn())
+
+		stop := make(chan os.Signal, 1)
+		stop <- os.Interrupt
+
+		if err := p.serve("127.0.0.1:0", stop); err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/TfGMEnterprise/departures-service/model"
+	"sort"
+	"strings"
+)
+
+// The maximum number of locations that can be combined into a single board
+const maxAtcocodes = 5
+
+// parseAtcocodes splits a comma-separated list of ATCO codes, ignoring any
+// duplicates
+func (p *Presenter) parseAtcocodes(atcocodeStr string) []string {
+	p.Logger.Debugf("parseAtcocodes: %s", atcocodeStr)
+
+	var atcocodes []string
+	seen := make(map[string]bool)
+
+	for _, atcocode := range strings.Split(atcocodeStr, ",") {
+		atcocode = strings.TrimSpace(atcocode)
+
+		if seen[strings.ToUpper(atcocode)] {
+			continue
+		}
+
+		seen[strings.ToUpper(atcocode)] = true
+		atcocodes = append(atcocodes, atcocode)
+	}
+
+	return atcocodes
+}
+
+// mergeDepartures sorts the departures for several locations into departure
+// time order and keeps the first `top` departures
+func (p *Presenter) mergeDepartures(deps *model.Internal, top int64) {
+	p.Logger.Debug("mergeDepartures")
+
+	if deps == nil {
+		return
+	}
+
+	sort.Sort(model.ByDepartureTime(deps.Departures))
+
+	if int64(len(deps.Departures)) > top {
+		deps.Departures = deps.Departures[:top]
+	}
+}
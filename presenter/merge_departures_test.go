@@ -0,0 +1,95 @@
+package main
+
+import (
+	"github.com/TfGMEnterprise/departures-service/dlog"
+	"github.com/TfGMEnterprise/departures-service/model"
+	"github.com/TfGMEnterprise/departures-service/test_helpers"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPresenter_ParseAtcocodes(t *testing.T) {
+	logger := dlog.NewLogger([]dlog.LoggerOption{
+		dlog.LoggerSetOutput(ioutil.Discard),
+	}...)
+
+	p := Presenter{
+		Logger: logger,
+	}
+
+	t.Run("returns a single atcocode", func(t *testing.T) {
+		got := p.parseAtcocodes("1800BNIN0C1")
+		want := []string{"1800BNIN0C1"}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %#v, want %#v", got, want)
+		}
+	})
+
+	t.Run("splits a comma-separated list and ignores duplicates", func(t *testing.T) {
+		got := p.parseAtcocodes("1800NE43431, 1800NE43441,1800ne43431")
+		want := []string{"1800NE43431", "1800NE43441"}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %#v, want %#v", got, want)
+		}
+	})
+}
+
+func TestPresenter_MergeDepartures(t *testing.T) {
+	logger := dlog.NewLogger([]dlog.LoggerOption{
+		dlog.LoggerSetOutput(ioutil.Discard),
+	}...)
+
+	p := Presenter{
+		Logger: logger,
+	}
+
+	t.Run("handles a nil value", func(t *testing.T) {
+		p.mergeDepartures(nil, 10)
+	})
+
+	t.Run("sorts departures from several locations and keeps the top departures", func(t *testing.T) {
+		now := time.Now().Truncate(time.Second)
+
+		deps := model.Internal{
+			Departures: []model.Departure{
+				{
+					JourneyRef:         "1",
+					LocationAtcocode:   "1800NE43431",
+					AimedDepartureTime: test_helpers.AdjustTime(now, "1m"),
+				},
+				{
+					JourneyRef:         "2",
+					LocationAtcocode:   "1800NE43431",
+					AimedDepartureTime: test_helpers.AdjustTime(now, "5m"),
+				},
+				{
+					JourneyRef:         "3",
+					LocationAtcocode:   "1800NE43441",
+					AimedDepartureTime: test_helpers.AdjustTime(now, "2m"),
+				},
+				{
+					JourneyRef:         "4",
+					LocationAtcocode:   "1800NE43441",
+					AimedDepartureTime: test_helpers.AdjustTime(now, "3m"),
+				},
+			},
+		}
+
+		p.mergeDepartures(&deps, 3)
+
+		if len(deps.Departures) != 3 {
+			t.Errorf("Internal struct contains %d departures, should be %d", len(deps.Departures), 3)
+			return
+		}
+
+		for i, want := range []string{"1", "3", "4"} {
+			if got := deps.Departures[i].JourneyRef; got != want {
+				t.Errorf("got journey `%s` at position %d, want `%s`", got, i, want)
+			}
+		}
+	})
+}
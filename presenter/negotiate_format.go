@@ -0,0 +1,124 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+)
+
+type outputFormat string
+
+const (
+	formatJSON   outputFormat = "json"
+	formatSiri   outputFormat = "siri"
+	formatSpeech outputFormat = "speech"
+)
+
+// negotiateFormat returns the output format requested by the client, either
+// explicitly with the `format` query string parameter or through the
+// `Accept` header; the default is JSON
+func (p *Presenter) negotiateFormat(queryStringParameters map[string]string, headers map[string]string) (outputFormat, error) {
+	p.Logger.Debug("negotiateFormat")
+
+	if format, exists := queryStringParameters["format"]; exists {
+		switch outputFormat(strings.ToLower(format)) {
+		case formatJSON:
+			return formatJSON, nil
+		case formatSiri:
+			return formatSiri, nil
+		case formatSpeech:
+			return formatSpeech, nil
+		default:
+			return "", errors.Errorf("format value `%s` is not valid", format)
+		}
+	}
+
+	accept := getHeader(headers, "Accept")
+	if accept == "" {
+		return formatJSON, nil
+	}
+
+	return negotiateAccept(accept), nil
+}
+
+// negotiateAccept chooses the format with the highest quality value in the
+// Accept header. Types the presenter does not serve, including wildcards and
+// e.g. the text/html a browser asks for first, are served the default JSON,
+// which is also preferred on ties; otherwise the first type listed wins.
+func negotiateAccept(accept string) outputFormat {
+	quality := make(map[outputFormat]float64)
+	refused := make(map[outputFormat]bool)
+	var order []outputFormat
+
+	for _, mediaRange := range strings.Split(accept, ",") {
+		params := strings.Split(mediaRange, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+
+		q, ok := mediaRangeQuality(params[1:])
+		if !ok {
+			continue
+		}
+
+		format, supported := formatJSON, false
+		switch mediaType {
+		case "application/json":
+			format, supported = formatJSON, true
+		case "application/xml", "text/xml":
+			format, supported = formatSiri, true
+		case "text/plain":
+			format, supported = formatSpeech, true
+		}
+
+		if q == 0 {
+			// Only a type named explicitly can refuse a format
+			if supported {
+				refused[format] = true
+			}
+			continue
+		}
+
+		if _, seen := quality[format]; !seen {
+			order = append(order, format)
+		}
+
+		if q > quality[format] {
+			quality[format] = q
+		}
+	}
+
+	best := formatJSON
+	bestQuality := -1.0
+
+	for _, format := range order {
+		if refused[format] {
+			continue
+		}
+
+		q := quality[format]
+		if q > bestQuality || (q == bestQuality && format == formatJSON) {
+			best, bestQuality = format, q
+		}
+	}
+
+	return best
+}
+
+// mediaRangeQuality returns the quality value in the parameters of a media
+// range, which is 1 if it is not given; ok is false if it cannot be read
+func mediaRangeQuality(params []string) (q float64, ok bool) {
+	for _, param := range params {
+		nameValue := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(nameValue) != 2 || strings.ToLower(strings.TrimSpace(nameValue[0])) != "q" {
+			continue
+		}
+
+		q, err := strconv.ParseFloat(strings.TrimSpace(nameValue[1]), 64)
+		if err != nil || q < 0 || q > 1 {
+			return 0, false
+		}
+
+		return q, true
+	}
+
+	return 1, true
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"github.com/TfGMEnterprise/departures-service/dlog"
+	"io/ioutil"
+	"testing"
+)
+
+func TestPresenter_NegotiateFormat(t *testing.T) {
+	logger := dlog.NewLogger([]dlog.LoggerOption{
+		dlog.LoggerSetOutput(ioutil.Discard),
+	}...)
+
+	p := Presenter{
+		Logger: logger,
+	}
+
+	tests := []struct {
+		name                  string
+		queryStringParameters map[string]string
+		headers               map[string]string
+		want                  outputFormat
+		wantErr               bool
+	}{
+		{
+			name: "defaults to JSON",
+			want: formatJSON,
+		},
+		{
+			name:                  "uses the format parameter",
+			queryStringParameters: map[string]string{"format": "SIRI"},
+			want:                  formatSiri,
+		},
+		{
+			name:                  "prefers the format parameter over the Accept header",
+			queryStringParameters: map[string]string{"format": "json"},
+			headers:               map[string]string{"Accept": "application/xml"},
+			want:                  formatJSON,
+		},
+		{
+			name:    "uses the Accept header",
+			headers: map[string]string{"accept": "application/xml"},
+			want:    formatSiri,
+		},
+		{
+			name:    "prefers JSON on a tie in the Accept header",
+			headers: map[string]string{"Accept": "text/xml, application/json"},
+			want:    formatJSON,
+		},
+		{
+			name:    "uses the first type listed on a tie without JSON",
+			headers: map[string]string{"Accept": "text/plain, text/xml"},
+			want:    formatSpeech,
+		},
+		{
+			name:    "uses the highest quality type in the Accept header",
+			headers: map[string]string{"Accept": "application/json;q=0.5, text/xml;q=0.8"},
+			want:    formatSiri,
+		},
+		{
+			name:    "uses JSON for a browser Accept header",
+			headers: map[string]string{"Accept": "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+			want:    formatJSON,
+		},
+		{
+			name:    "uses JSON for an application wildcard in the Accept header",
+			headers: map[string]string{"Accept": "application/*, text/plain;q=0.5"},
+			want:    formatJSON,
+		},
+		{
+			name:    "uses a supported type preferred to an unsupported one",
+			headers: map[string]string{"Accept": "text/html;q=0.5, application/xml"},
+			want:    formatSiri,
+		},
+		{
+			name:    "does not use a type refused in the Accept header",
+			headers: map[string]string{"Accept": "application/json;q=0, */*, text/plain;q=0.1"},
+			want:    formatSpeech,
+		},
+		{
+			name:    "ignores a quality value that cannot be read",
+			headers: map[string]string{"Accept": "text/plain;q=high, text/xml;q=0.5"},
+			want:    formatSiri,
+		},
+		{
+			name:                  "uses the speech format parameter",
+			queryStringParameters: map[string]string{"format": "speech"},
+			want:                  formatSpeech,
+		},
+		{
+			name:    "uses speech for a plain text Accept header",
+			headers: map[string]string{"Accept": "text/plain"},
+			want:    formatSpeech,
+		},
+		{
+			name:    "defaults to JSON for an unsupported Accept header",
+			headers: map[string]string{"Accept": "*/*"},
+			want:    formatJSON,
+		},
+		{
+			name:                  "returns an error for an unknown format",
+			queryStringParameters: map[string]string{"format": "csv"},
+			wantErr:               true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.negotiateFormat(tt.queryStringParameters, tt.headers)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if got != tt.want {
+				t.Errorf("got `%s`, want `%s`", got, tt.want)
+			}
+		})
+	}
+}
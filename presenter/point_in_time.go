@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/subtle"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// The request header containing the key that authenticates support requests
+const supportKeyHeader = "X-Support-Key"
+
+// now returns the current time from the presenter clock
+func (p Presenter) now() time.Time {
+	if p.Clock == nil {
+		return time.Now()
+	}
+
+	return p.Clock()
+}
+
+// parseAt returns the time given by the optional at parameter. The parameter
+// can only be used by authenticated support requests.
+func (p Presenter) parseAt(queryStringParameters map[string]string, headers map[string]string) (*time.Time, error) {
+	p.Logger.Debug("parseAt")
+
+	atStr, exists := queryStringParameters["at"]
+	if !exists {
+		return nil, nil
+	}
+
+	if !p.authenticateSupport(headers) {
+		return nil, newForbiddenError(errors.New("at can only be used by authenticated support requests"))
+	}
+
+	at, err := time.Parse(time.RFC3339, atStr)
+	if err != nil {
+		return nil, newInvalidParameterError(errors.Errorf("at value `%s` is not valid", atStr))
+	}
+
+	return &at, nil
+}
+
+// authenticateSupport checks the request includes the support key
+func (p Presenter) authenticateSupport(headers map[string]string) bool {
+	p.Logger.Debug("authenticateSupport")
+
+	if p.SupportAPIKey == "" {
+		return false
+	}
+
+	key := getHeader(headers, supportKeyHeader)
+
+	return subtle.ConstantTimeCompare([]byte(key), []byte(p.SupportAPIKey)) == 1
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"github.com/TfGMEnterprise/departures-service/dlog"
+	"github.com/TfGMEnterprise/departures-service/test_helpers"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestPresenter_now(t *testing.T) {
+	clock := time.Date(2019, 5, 8, 8, 14, 0, 0, time.UTC)
+
+	p := Presenter{
+		Clock: func() time.Time {
+			return clock
+		},
+	}
+
+	if got := p.now(); !got.Equal(clock) {
+		t.Errorf("got %s, wanted %s", got, clock)
+	}
+}
+
+func TestPresenter_parseAt(t *testing.T) {
+	logger := dlog.NewLogger([]dlog.LoggerOption{
+		dlog.LoggerSetOutput(ioutil.Discard),
+	}...)
+
+	p := Presenter{
+		Logger:        logger,
+		SupportAPIKey: "secret",
+	}
+
+	t.Run("returns nil if at is not set", func(t *testing.T) {
+		at, err := p.parseAt(map[string]string{}, map[string]string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test_helpers.AssertBoolean(t, at == nil, true)
+	})
+
+	t.Run("parses at for authenticated requests", func(t *testing.T) {
+		at, err := p.parseAt(map[string]string{
+			"at": "2019-05-08T08:14:00+01:00",
+		}, map[string]string{
+			"x-support-key": "secret",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test_helpers.AssertString(t, at.UTC().Format(time.RFC3339), "2019-05-08T07:14:00Z")
+	})
+
+	t.Run("returns forbidden error if the support key is wrong", func(t *testing.T) {
+		_, err := p.parseAt(map[string]string{
+			"at": "2019-05-08T08:14:00+01:00",
+		}, map[string]string{
+			"X-Support-Key": "foo",
+		})
+
+		pErr, ok := err.(*presenterError)
+		test_helpers.AssertBoolean(t, ok, true)
+		if ok {
+			test_helpers.AssertString(t, pErr.code, errorCodeForbidden)
+		}
+	})
+
+	t.Run("returns forbidden error if no support key is configured", func(t *testing.T) {
+		p := Presenter{
+			Logger: logger,
+		}
+
+		_, err := p.parseAt(map[string]string{
+			"at": "2019-05-08T08:14:00+01:00",
+		}, map[string]string{
+			"X-Support-Key": "",
+		})
+
+		pErr, ok := err.(*presenterError)
+		test_helpers.AssertBoolean(t, ok, true)
+		if ok {
+			test_helpers.AssertString(t, pErr.code, errorCodeForbidden)
+		}
+	})
+
+	t.Run("returns invalid parameter error if at is not valid", func(t *testing.T) {
+		_, err := p.parseAt(map[string]string{
+			"at": "08:14",
+		}, map[string]string{
+			"X-Support-Key": "secret",
+		})
+
+		pErr, ok := err.(*presenterError)
+		test_helpers.AssertBoolean(t, ok, true)
+		if ok {
+			test_helpers.AssertString(t, pErr.code, errorCodeInvalidParameter)
+		}
+	})
+}
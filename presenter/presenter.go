@@ -9,7 +9,9 @@ import (
 	"github.com/pkg/errors"
 	"log"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/aws/aws-lambda-go/lambda"
@@ -19,6 +21,31 @@ import (
 type Presenter struct {
 	Logger *dlog.Logger
 	Pool   *redis.Pool
+	// Clock returns the current time; time.Now is used if it is not set
+	Clock func() time.Time
+	// SupportAPIKey authenticates point-in-time requests; the at parameter
+	// is rejected if it is not set
+	SupportAPIKey string
+	// DisplayRules configure how departure times are shown; the built-in
+	// rule is used if they are not set
+	DisplayRules *DisplayRules
+	// StaleThreshold is how long a real-time prediction is trusted after it
+	// was recorded; zero means predictions are always trusted
+	StaleThreshold time.Duration
+	// ReadWithScript reads departures with a single call to a Lua script,
+	// falling back to reading by page if Redis does not support scripting
+	ReadWithScript bool
+	// TrimExpired makes the script remove expired departures from the head of
+	// the cache, by the rules the ingester applies to the cache
+	TrimExpired bool
+	// CancelledPeriod is how long after their aimed departure time cancelled
+	// departures are shown for; zero removes them at their aimed departure
+	// time. The cache keeps them for at most model.CancelledRetention.
+	CancelledPeriod time.Duration
+	// board is the board requested; departures are shown if it is not set.
+	// It is set on the copy of the presenter used for each request
+	board     model.BoardType
+	streamHub *streamHub
 	PresenterInterface
 }
 
@@ -42,6 +69,52 @@ func main() {
 		logger.Fatal("DEPARTURES_REDIS_HOST not set in environment")
 	}
 
+	// Point-in-time rendering is only available if a support key is set
+	supportAPIKey := os.Getenv("PRESENTER_SUPPORT_API_KEY")
+
+	var displayRules *DisplayRules
+	var err error
+
+	displayRulesJSON, exists := os.LookupEnv("PRESENTER_DISPLAY_RULES")
+	if exists && displayRulesJSON != "" {
+		displayRules, err = ParseDisplayRules([]byte(displayRulesJSON))
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	staleThresholdStr, exists := os.LookupEnv("PRESENTER_STALE_THRESHOLD")
+	if !exists || staleThresholdStr == "" {
+		staleThresholdStr = "0"
+	}
+
+	staleThreshold, err := strconv.Atoi(staleThresholdStr)
+	if err != nil {
+		logger.Fatal("PRESENTER_STALE_THRESHOLD value is invalid")
+	}
+
+	if staleThreshold < 0 {
+		logger.Fatal("PRESENTER_STALE_THRESHOLD value must not be negative")
+	}
+
+	cancelledPeriodStr, exists := os.LookupEnv("PRESENTER_CANCELLED_PERIOD")
+	if !exists || cancelledPeriodStr == "" {
+		cancelledPeriodStr = "0"
+	}
+
+	cancelledPeriod, err := strconv.Atoi(cancelledPeriodStr)
+	if err != nil {
+		logger.Fatal("PRESENTER_CANCELLED_PERIOD value is invalid")
+	}
+
+	if cancelledPeriod < 0 || time.Duration(cancelledPeriod)*time.Second > model.CancelledRetention {
+		logger.Fatalf("PRESENTER_CANCELLED_PERIOD value must be between 0 and %d", int64(model.CancelledRetention/time.Second))
+	}
+
+	// Scripting is used unless disabled; e.g. for engines that do not support it
+	readWithScript := os.Getenv("PRESENTER_DISABLE_SCRIPTING") != "true"
+	trimExpired := os.Getenv("PRESENTER_TRIM_EXPIRED") == "true"
+
 	p := &Presenter{
 		Logger: logger,
 		Pool: repository.NewRedisPool([]repository.RedisPoolOption{
@@ -49,6 +122,13 @@ func main() {
 				return redis.Dial("tcp", departuresRedisHost)
 			}),
 		}...),
+		Clock:           time.Now,
+		SupportAPIKey:   supportAPIKey,
+		DisplayRules:    displayRules,
+		StaleThreshold:  time.Duration(staleThreshold) * time.Second,
+		ReadWithScript:  readWithScript,
+		TrimExpired:     trimExpired,
+		CancelledPeriod: time.Duration(cancelledPeriod) * time.Second,
 	}
 
 	defer func() {
@@ -60,15 +140,48 @@ func main() {
 		p.Logger.Debug("closed Redis pool")
 	}()
 
+	// Run as a standalone HTTP server if a port is set; e.g. locally or in a
+	// container
+	serverPort, exists := os.LookupEnv("PRESENTER_SERVER_PORT")
+	if exists && serverPort != "" {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+		if err := p.serve(":"+serverPort, stop); err != nil {
+			p.Logger.Print(err)
+		}
+
+		return
+	}
+
 	lambda.Start(p.Handler)
 }
 
 func (p Presenter) Handler(request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
 	p.Logger.Debug("Handler")
 
-	atcocode, exists := request.QueryStringParameters["atcocode"]
+	var resp *events.APIGatewayProxyResponse
+	var err error
+
+	if p.isBatchRequest(request) {
+		resp, err = p.presentBatch(request)
+	} else {
+		resp, err = p.present(request)
+	}
+
+	if err != nil {
+		return p.errorResponse(err)
+	}
+
+	return resp, nil
+}
+
+func (p Presenter) present(request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	p.Logger.Debug("present")
+
+	atcocodeStr, exists := request.QueryStringParameters["atcocode"]
 	if !exists {
-		return nil, errors.New("atcocode is required")
+		return nil, newInvalidParameterError(errors.New("atcocode is required"))
 	}
 
 	topStr, exists := request.QueryStringParameters["top"]
@@ -79,63 +192,188 @@ func (p Presenter) Handler(request events.APIGatewayProxyRequest) (*events.APIGa
 
 	top, err := strconv.ParseInt(topStr, 10, 64)
 	if err != nil {
-		return nil, errors.Wrapf(err, "top value `%s` is not valid", topStr)
+		return nil, newInvalidParameterError(errors.Errorf("top value `%s` is not valid", topStr))
+	}
+
+	// Several stops can be requested as a comma-separated list to produce a
+	// merged departure board
+	atcocodes := p.parseAtcocodes(atcocodeStr)
+
+	if len(atcocodes) > maxAtcocodes {
+		return nil, newInvalidParameterError(errors.Errorf("a maximum of %d atcocode values can be requested", maxAtcocodes))
 	}
 
 	// Validate Atcocode
-	if !p.validateAtcocode(atcocode) {
-		return nil, errors.Errorf("atcocode value `%s` is not valid", atcocode)
+	for _, atcocode := range atcocodes {
+		if !p.validateAtcocode(atcocode) {
+			return nil, newInvalidParameterError(errors.Errorf("atcocode value `%s` is not valid", atcocode))
+		}
 	}
 
 	// Validate Top
 	if !p.validateTop(top) {
-		return nil, errors.Errorf("top value `%d` is not valid", top)
+		return nil, newInvalidParameterError(errors.Errorf("top value `%d` is not valid", top))
 	}
 
+	// Validate optional service number, operator code and stand filters
+	filter, err := p.newDepartureFilter(request.QueryStringParameters)
+	if err != nil {
+		return nil, newInvalidParameterError(err)
+	}
+
+	format, err := p.negotiateFormat(request.QueryStringParameters, request.Headers)
+	if err != nil {
+		return nil, newInvalidParameterError(err)
+	}
+
+	// Arrivals are shown in place of departures if requested
+	board, err := model.ParseBoardType(request.QueryStringParameters["type"])
+	if err != nil {
+		return nil, newInvalidParameterError(err)
+	}
+
+	if board == model.ArrivalsBoard && format != formatJSON {
+		return nil, newInvalidParameterError(errors.Errorf("type `%s` is only available as JSON", board))
+	}
+
+	p.board = board
+
+	// Support engineers can render the board as it would have been displayed
+	// at a given moment
+	at, err := p.parseAt(request.QueryStringParameters, request.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	now := p.now()
+	if at != nil {
+		now = *at
+
+		// The cache must not be changed based on a time other than now; this
+		// only affects the copy of the presenter used for this request
+		p.TrimExpired = false
+	}
+
+	merged := len(atcocodes) > 1
+
 	deps := model.Internal{}
 
-	// Get data from Redis cache and remove expired departures, up to limit
-	now := time.Now()
-	start := int64(0)
-	end := top
+	// Stops that are not in the cache are left off a merged board; the
+	// request only fails if none of the requested stops are in the cache
+	var notFoundErr error
+	found := false
 
-	for {
-		if err := p.assignNextDepartures(&deps, atcocode, start, end); err != nil {
+	for _, atcocode := range atcocodes {
+		stopDeps, err := p.getDepartures(now, atcocode, top, filter)
+		if isStopNotFoundError(err) {
+			notFoundErr = err
+			continue
+		}
+
+		if err != nil {
 			return nil, err
 		}
 
-		removed := p.removeExpiredDepartures(now, &deps)
+		deps.Departures = append(deps.Departures, stopDeps.Departures...)
+		found = true
+	}
 
-		if removed == 0 || len(deps.Departures) == int(top) {
-			break
-		}
+	if !found {
+		return nil, notFoundErr
+	}
 
-		start += top
-		end += removed
+	if merged {
+		p.mergeDepartures(&deps, top)
 	}
 
 	// Transform data for output purposes
+	output, err := p.transformToOutput(now, model.GetJourneyType(atcocodes[0]), &deps, merged)
+	if err != nil {
+		return nil, err
+	}
+
+	// Allow clients and caches to reuse the response until the board changes
+	etag, err := p.computeETag(format, &deps, output)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheControl := "max-age=" + strconv.Itoa(p.computeMaxAge(now, &deps))
+	if at != nil {
+		// Point-in-time boards are for support use and must not be shared
+		cacheControl = "no-store"
+	}
+
+	if p.matchesETag(getHeader(request.Headers, "If-None-Match"), etag) {
+		return &events.APIGatewayProxyResponse{
+			StatusCode: 304,
+			Headers: map[string]string{
+				"etag":          etag,
+				"cache-control": cacheControl,
+				"vary":          "Accept",
+			},
+		}, nil
+	}
+
+	var resp *events.APIGatewayProxyResponse
+
+	switch format {
+	case formatSiri:
+		resp, err = p.siriResponse(now, atcocodes, &deps)
+	case formatSpeech:
+		resp, err = p.speechResponse(now, output.JourneyType, &deps)
+	default:
+		resp, err = p.jsonResponse(output)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Headers["etag"] = etag
+	resp.Headers["cache-control"] = cacheControl
+	// The format is negotiated from the Accept header, so shared caches must
+	// not serve one format in place of another
+	resp.Headers["vary"] = "Accept"
+
+	return resp, nil
+}
+
+// transformToOutput converts departures into the format used for display
+func (p Presenter) transformToOutput(now time.Time, journeyType model.JourneyType, deps *model.Internal, merged bool) (*model.Output, error) {
+	p.Logger.Debug("transformToOutput")
+
 	output := model.Output{
-		JourneyType: model.GetJourneyType(atcocode),
+		JourneyType: journeyType,
 	}
 
 	for _, dep := range deps.Departures {
-		depTime, err := p.transformDepartureTime(now, dep)
-		if err != nil {
-			return nil, err
-		}
-
 		depDisplay := model.DepartureDisplay{
-			DepartureTime:   depTime,
+			DepartureTime:   p.transformDepartureTime(now, dep.JourneyType, dep),
+			RealTime:        isRealTimeDeparture(dep),
 			Stand:           dep.Stand,
 			ServiceNumber:   dep.ServiceNumber,
 			Destination:     dep.Destination,
 			DepartureStatus: dep.DepartureStatus,
 		}
 
+		if merged {
+			depDisplay.LocationAtcocode = dep.LocationAtcocode
+		}
+
+		if p.board == model.ArrivalsBoard {
+			depDisplay.Origin = dep.Origin
+		}
+
 		output.Departures = append(output.Departures, depDisplay)
 	}
 
+	return &output, nil
+}
+
+func (p Presenter) jsonResponse(output *model.Output) (*events.APIGatewayProxyResponse, error) {
+	p.Logger.Debug("jsonResponse")
+
 	// Marshal data in JSON format and return
 	outputJSON, err := json.Marshal(output)
 	if err != nil {
@@ -148,10 +386,81 @@ func (p Presenter) Handler(request events.APIGatewayProxyRequest) (*events.APIGa
 			"content-type": "application/json",
 		},
 		Body: string(outputJSON),
-	}, err
+	}, nil
+}
+
+// getDepartures gets data for a single location from the Redis cache and
+// removes expired and filtered departures, up to limit
+func (p Presenter) getDepartures(now time.Time, atcocode string, top int64, filter *departureFilter) (*model.Internal, error) {
+	p.Logger.Debugf("getDepartures for %s", atcocode)
+
+	if p.ReadWithScript {
+		deps, err := p.readDeparturesWithScript(now, atcocode, top, filter)
+
+		switch {
+		case err == nil:
+			return deps, nil
+		case isScriptingUnsupportedError(err):
+			p.Logger.Printf("cannot read departures with script; reading by page: %s", err)
+		case isStopNotFoundError(err):
+			return nil, err
+		default:
+			if _, ok := err.(*presenterError); ok {
+				return nil, err
+			}
+
+			return nil, newServiceUnavailableError(errors.Wrapf(err, "cannot get departures for `%s` from Redis", atcocode))
+		}
+	}
+
+	return p.getDeparturesByPage(now, atcocode, top, filter)
+}
+
+// getDeparturesByPage reads departures in growing windows until there are
+// enough that have not expired or been filtered out
+func (p Presenter) getDeparturesByPage(now time.Time, atcocode string, top int64, filter *departureFilter) (*model.Internal, error) {
+	p.Logger.Debugf("getDeparturesByPage for %s", atcocode)
+
+	deps := model.Internal{}
+
+	start := int64(0)
+	end := top
+
+	for {
+		skipped, err := p.assignNextDepartures(&deps, atcocode, start, end)
+		if err != nil {
+			return nil, err
+		}
+
+		// An empty first page may mean that the stop is unknown
+		if start == 0 && len(deps.Departures) == 0 && skipped == 0 {
+			exists, err := p.locationExists(atcocode)
+			if err != nil {
+				return nil, err
+			}
+
+			if !exists {
+				return nil, newStopNotFoundError(errors.Errorf("no departures found for atcocode `%s`", atcocode))
+			}
+		}
+
+		p.downgradeStaleDepartures(now, &deps)
+
+		removed := skipped + p.removeExpiredDepartures(now, &deps)
+		removed += p.filterDepartures(filter, &deps)
+
+		if removed == 0 || len(deps.Departures) == int(top) {
+			break
+		}
+
+		start = end
+		end += removed
+	}
+
+	return &deps, nil
 }
 
-func (p Presenter) assignNextDepartures(departures *model.Internal, atcocode string, start int64, end int64) error {
+func (p Presenter) assignNextDepartures(departures *model.Internal, atcocode string, start int64, end int64) (int64, error) {
 	p.Logger.Debugf("assignNextDepartures for %s (start: %d; end: %d)", atcocode, start, end)
 
 	var err error = nil
@@ -162,21 +471,64 @@ func (p Presenter) assignNextDepartures(departures *model.Internal, atcocode str
 		}
 	}()
 
-	cDeps, cErr := redis.Strings(conn.Do("LRANGE", atcocode, start, end-1))
+	cDeps, cErr := redis.Strings(conn.Do("LRANGE", p.board.Key(atcocode), start, end-1))
 	if cErr != nil && cErr == redis.ErrNil {
-		return nil
+		return 0, nil
 	}
 
 	if cErr != nil {
-		return cErr
+		return 0, newServiceUnavailableError(errors.Wrapf(cErr, "cannot get departures for `%s` from Redis", atcocode))
+	}
+
+	return p.appendCachedDepartures(departures, atcocode, cDeps), err
+}
+
+// appendCachedDepartures decodes the cached records for a location and
+// appends them to departures as seen on the board. Records that cannot be
+// decoded or fail validation are logged and skipped, as the ingester does, so
+// that a single bad record cannot fail the whole board; it returns the number
+// skipped.
+func (p Presenter) appendCachedDepartures(departures *model.Internal, atcocode string, records []string) int64 {
+	cached := model.Internal{}
+	skipped := int64(0)
+
+	for _, record := range records {
+		_, dep, err := model.DecodeCachedDeparture([]byte(record))
+		if err != nil {
+			p.Logger.Printf("skipped cached record for `%s`: %v: %s", atcocode, err, record)
+			skipped++
+			continue
+		}
+		cached.Departures = append(cached.Departures, *dep)
+	}
+
+	for _, err := range cached.RemoveInvalidDepartures() {
+		p.Logger.Printf("skipped cached departure for `%s`: %v", atcocode, err)
+		skipped++
+	}
+
+	for _, dep := range cached.Departures {
+		departures.Departures = append(departures.Departures, p.board.View(dep))
 	}
 
-	for i := 0; i < len(cDeps); i++ {
-		dep := model.Departure{}
-		if uErr := json.Unmarshal([]byte(cDeps[i]), &dep); uErr != nil {
-			return uErr
+	return skipped
+}
+
+func (p Presenter) locationExists(atcocode string) (bool, error) {
+	p.Logger.Debugf("locationExists for %s", atcocode)
+
+	var err error = nil
+	conn := p.Pool.Get()
+	defer func() {
+		if cErr := conn.Close(); cErr != nil {
+			err = cErr
 		}
-		departures.Departures = append(departures.Departures, dep)
+	}()
+
+	exists, cErr := redis.Bool(conn.Do("EXISTS", p.board.Key(atcocode)))
+	if cErr != nil {
+		return false, newServiceUnavailableError(errors.Wrapf(cErr, "cannot check whether `%s` exists in Redis", atcocode))
 	}
-	return err
+
+	return exists, err
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"encoding/xml"
 	"github.com/TfGMEnterprise/departures-service/dlog"
 	"github.com/TfGMEnterprise/departures-service/model"
 	"github.com/TfGMEnterprise/departures-service/repository"
@@ -10,8 +11,10 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/fortytw2/leaktest"
 	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
 	"github.com/rafaeljusto/redigomock"
 	"io/ioutil"
+	"net/http"
 	"reflect"
 	"strconv"
 	"strings"
@@ -22,20 +25,12 @@ import (
 func buildJSONDeparture(t *testing.T, recordedAtTime time.Time, journeyType model.JourneyType, journeyRef int, aimedDepartureTime time.Time, expectedDepartureTime *time.Time, locationAtcocode string, stand *string, destinationAtcocode string, destinationName string, serviceNumber string, operatorCode string) []byte {
 	t.Helper()
 
-	var expectedDepartureTimeStr *string
-	if expectedDepartureTime != nil {
-		expectedDepartureTimeRef := expectedDepartureTime.Format(time.RFC3339)
-		expectedDepartureTimeStr = &expectedDepartureTimeRef
-	} else {
-		expectedDepartureTimeStr = nil
-	}
-
 	departure := model.Departure{
-		RecordedAtTime:        recordedAtTime.Format(time.RFC3339),
+		RecordedAtTime:        recordedAtTime,
 		JourneyType:           journeyType,
 		JourneyRef:            recordedAtTime.Format("2006-01-02") + `_` + strconv.Itoa(journeyRef),
-		AimedDepartureTime:    aimedDepartureTime.Format(time.RFC3339),
-		ExpectedDepartureTime: expectedDepartureTimeStr,
+		AimedDepartureTime:    aimedDepartureTime,
+		ExpectedDepartureTime: expectedDepartureTime,
 		LocationAtcocode:      locationAtcocode,
 		Stand:                 stand,
 		DestinationAtcocode:   destinationAtcocode,
@@ -52,6 +47,56 @@ func buildJSONDeparture(t *testing.T, recordedAtTime time.Time, journeyType mode
 	return departureJSON
 }
 
+func assertErrorResponse(t *testing.T, got *events.APIGatewayProxyResponse, statusCode int, code string, message string) {
+	t.Helper()
+
+	if got == nil {
+		t.Fatal("should return a response")
+	}
+
+	if got.StatusCode != statusCode {
+		t.Errorf("wrong status code: got %d, wanted %d", got.StatusCode, statusCode)
+	}
+
+	errorOutput := model.ErrorOutput{}
+	if err := json.Unmarshal([]byte(got.Body), &errorOutput); err != nil {
+		t.Fatal(err)
+	}
+
+	if errorOutput.Code != code {
+		t.Errorf("wrong error code: got `%s`, wanted `%s`", errorOutput.Code, code)
+	}
+
+	if !strings.Contains(errorOutput.Message, message) {
+		t.Errorf("error message `%s` should include `%s`", errorOutput.Message, message)
+	}
+}
+
+// assertCacheHeaders checks the caching headers are set, then removes them so
+// the rest of the response can be compared exactly
+func assertCacheHeaders(t *testing.T, got *events.APIGatewayProxyResponse) {
+	t.Helper()
+
+	if got == nil {
+		t.Fatal("should return a response")
+	}
+
+	if !strings.HasPrefix(got.Headers["etag"], `W/"`) {
+		t.Errorf("etag `%s` should be a weak entity tag", got.Headers["etag"])
+	}
+
+	cacheControl := got.Headers["cache-control"]
+	if !strings.HasPrefix(cacheControl, "max-age=") && cacheControl != "no-store" {
+		t.Errorf("cache-control `%s` should set max-age or no-store", cacheControl)
+	}
+
+	test_helpers.AssertString(t, got.Headers["vary"], "Accept")
+
+	delete(got.Headers, "etag")
+	delete(got.Headers, "cache-control")
+	delete(got.Headers, "vary")
+}
+
 func TestPresenter_Handler(t *testing.T) {
 	defer leaktest.Check(t)()
 
@@ -70,16 +115,13 @@ func TestPresenter_Handler(t *testing.T) {
 			Logger: logger,
 		}
 
-		_, err := p.Handler(req)
-
-		if err == nil {
-			t.Error("should return an error")
+		got, err := p.Handler(req)
+		if err != nil {
+			t.Error(err)
 			return
 		}
 
-		if !strings.Contains(err.Error(), "foo") {
-			t.Errorf("error should include the requested atcocode: %s", "foo")
-		}
+		assertErrorResponse(t, got, http.StatusBadRequest, errorCodeInvalidParameter, "foo")
 	})
 
 	t.Run("returns error if top is not valid", func(t *testing.T) {
@@ -94,16 +136,13 @@ func TestPresenter_Handler(t *testing.T) {
 			Logger: logger,
 		}
 
-		_, err := p.Handler(req)
-
-		if err == nil {
-			t.Error("should return an error")
+		got, err := p.Handler(req)
+		if err != nil {
+			t.Error(err)
 			return
 		}
 
-		if !strings.Contains(err.Error(), "-1") {
-			t.Errorf("error should include the requested value: %d", -1)
-		}
+		assertErrorResponse(t, got, http.StatusBadRequest, errorCodeInvalidParameter, "-1")
 	})
 
 	t.Run("gets the data for the requested bus atcocode from the cache", func(t *testing.T) {
@@ -209,18 +248,149 @@ func TestPresenter_Handler(t *testing.T) {
 				"content-type": "application/json",
 			},
 			Body: `{"journeyType":"` + string(model.Bus) + `","departures":[` +
-				`{"departureTime":"Approaching","stand":"C","serviceNumber":"123","destination":"Hobbiton"},` +
-				`{"departureTime":"1 min","stand":"C","serviceNumber":"456","destination":"Hobbiton"},` +
-				`{"departureTime":"2 mins","stand":"C","serviceNumber":"789","destination":"Hobbiton"},` +
-				`{"departureTime":"` + test_helpers.AdjustTime(now, "5m10s").Format("15:04") + `","stand":"C","serviceNumber":"123","destination":"Hobbiton"}` +
+				`{"departureTime":"Approaching","realTime":true,"stand":"C","serviceNumber":"123","destination":"Hobbiton"},` +
+				`{"departureTime":"1 min","realTime":true,"stand":"C","serviceNumber":"456","destination":"Hobbiton"},` +
+				`{"departureTime":"2 mins","realTime":true,"stand":"C","serviceNumber":"789","destination":"Hobbiton"},` +
+				`{"departureTime":"` + test_helpers.AdjustTime(now, "5m10s").Format("15:04") + `","realTime":false,"stand":"C","serviceNumber":"123","destination":"Hobbiton"}` +
+				`]}`,
+		}
+
+		assertCacheHeaders(t, got)
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("unexpected result: got %#v, wanted %#v\n", got, want)
+		}
+	})
+
+	t.Run("gets the arrivals for the requested atcocode from the cache", func(t *testing.T) {
+		now := time.Now().Truncate(time.Second)
+
+		atcocode := "1800BNIN0C1"
+		top := 2
+
+		req := events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{
+				"atcocode": atcocode,
+				"top":      strconv.Itoa(top),
+				"type":     "arrivals",
+			},
+		}
+
+		expectedArrivalTime := test_helpers.AdjustTime(now, "1m10s")
+
+		arrival1, err := json.Marshal(model.Departure{
+			RecordedAtTime:      test_helpers.AdjustTime(now, "-10s"),
+			JourneyType:         model.Bus,
+			JourneyRef:          "1234",
+			AimedArrivalTime:    test_helpers.AdjustTime(now, "2m10s"),
+			ExpectedArrivalTime: &expectedArrivalTime,
+			LocationAtcocode:    atcocode,
+			Stand:               aws.String("C"),
+			Origin:              "Bree",
+			Destination:         "Hobbiton",
+			ServiceNumber:       "123",
+			OperatorCode:        "ANWE",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		arrival2, err := json.Marshal(model.Departure{
+			RecordedAtTime:     test_helpers.AdjustTime(now, "-10s"),
+			JourneyType:        model.Bus,
+			JourneyRef:         "1235",
+			AimedDepartureTime: test_helpers.AdjustTime(now, "6m10s"),
+			AimedArrivalTime:   test_helpers.AdjustTime(now, "5m10s"),
+			LocationAtcocode:   atcocode,
+			Stand:              aws.String("C"),
+			Origin:             "Mordor",
+			Destination:        "Rivendell",
+			ServiceNumber:      "456",
+			OperatorCode:       "ANWE",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		conn := redigomock.NewConn()
+		conn.Command("LRANGE", model.ArrivalsKeyPrefix+atcocode, int64(0), int64(top)-1).ExpectStringSlice(string(arrival1), string(arrival2))
+
+		p := &Presenter{
+			Logger: logger,
+			Pool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return conn, nil
+				}),
+			}...),
+		}
+
+		got, err := p.Handler(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		want := &events.APIGatewayProxyResponse{
+			StatusCode: 200,
+			Headers: map[string]string{
+				"content-type": "application/json",
+			},
+			Body: `{"journeyType":"` + string(model.Bus) + `","departures":[` +
+				`{"departureTime":"1 min","realTime":true,"stand":"C","serviceNumber":"123","destination":"Hobbiton","origin":"Bree"},` +
+				`{"departureTime":"` + test_helpers.AdjustTime(now, "5m10s").Format("15:04") + `","realTime":false,"stand":"C","serviceNumber":"456","destination":"Rivendell","origin":"Mordor"}` +
 				`]}`,
 		}
 
+		assertCacheHeaders(t, got)
+
 		if !reflect.DeepEqual(got, want) {
 			t.Errorf("unexpected result: got %#v, wanted %#v\n", got, want)
 		}
 	})
 
+	t.Run("returns error if the board type is not valid", func(t *testing.T) {
+		req := events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{
+				"atcocode": "1800BNIN0C1",
+				"type":     "connections",
+			},
+		}
+
+		p := &Presenter{
+			Logger: logger,
+		}
+
+		got, err := p.Handler(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		assertErrorResponse(t, got, http.StatusBadRequest, errorCodeInvalidParameter, "connections")
+	})
+
+	t.Run("returns error if arrivals are requested as SIRI", func(t *testing.T) {
+		req := events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{
+				"atcocode": "1800BNIN0C1",
+				"type":     "arrivals",
+				"format":   "siri",
+			},
+		}
+
+		p := &Presenter{
+			Logger: logger,
+		}
+
+		got, err := p.Handler(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		assertErrorResponse(t, got, http.StatusBadRequest, errorCodeInvalidParameter, "only available as JSON")
+	})
+
 	t.Run("sets a sensible default for the top value if none is provided", func(t *testing.T) {
 		atcocode := "1800BNIN0C1"
 
@@ -234,6 +404,7 @@ func TestPresenter_Handler(t *testing.T) {
 		// Redis LRANGE returns upto and including the limit value;
 		// i.e. LRANGE <key> 0 3 returns the first FOUR values
 		conn.Command("LRANGE", atcocode, int64(0), int64(9)).ExpectStringSlice([]string{}...)
+		conn.Command("EXISTS", atcocode).Expect(int64(1))
 
 		p := &Presenter{
 			Logger: logger,
@@ -365,12 +536,110 @@ func TestPresenter_Handler(t *testing.T) {
 				"content-type": "application/json",
 			},
 			Body: `{"journeyType":"` + string(model.Bus) + `","departures":[` +
-				`{"departureTime":"1 min","stand":"C","serviceNumber":"456","destination":"Hobbiton"},` +
-				`{"departureTime":"2 mins","stand":"C","serviceNumber":"789","destination":"Hobbiton"},` +
-				`{"departureTime":"` + test_helpers.AdjustTime(now, "5m10s").Format("15:04") + `","stand":"C","serviceNumber":"123","destination":"Hobbiton"}` +
+				`{"departureTime":"1 min","realTime":true,"stand":"C","serviceNumber":"456","destination":"Hobbiton"},` +
+				`{"departureTime":"2 mins","realTime":true,"stand":"C","serviceNumber":"789","destination":"Hobbiton"},` +
+				`{"departureTime":"` + test_helpers.AdjustTime(now, "5m10s").Format("15:04") + `","realTime":false,"stand":"C","serviceNumber":"123","destination":"Hobbiton"}` +
+				`]}`,
+		}
+
+		assertCacheHeaders(t, got)
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("unexpected result: got %#v, wanted %#v\n", got, want)
+		}
+	})
+
+	t.Run("skips cached records that cannot be read and gets later departures", func(t *testing.T) {
+		now := time.Now()
+		atcocode := "1800BNIN0C1"
+		top := 2
+
+		req := events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{
+				"atcocode": atcocode,
+				"top":      strconv.Itoa(top),
+			},
+		}
+
+		stand := "C"
+
+		invalidDeparture := buildJSONDeparture(
+			t,
+			test_helpers.AdjustTime(now, "-10s"),
+			model.Bus,
+			1234,
+			test_helpers.AdjustTime(now, "1m10s"),
+			nil,
+			"",
+			&stand,
+			"1800WA12481",
+			"Hobbiton",
+			"123",
+			"ANWE")
+		departure1 := buildJSONDeparture(
+			t,
+			test_helpers.AdjustTime(now, "-10s"),
+			model.Bus,
+			1235,
+			test_helpers.AdjustTime(now, "2m10s"),
+			nil,
+			atcocode,
+			&stand,
+			"1800WA12481",
+			"Hobbiton",
+			"456",
+			"ANWE")
+		departure2 := buildJSONDeparture(
+			t,
+			test_helpers.AdjustTime(now, "-10s"),
+			model.Bus,
+			1236,
+			test_helpers.AdjustTime(now, "3m10s"),
+			nil,
+			atcocode,
+			&stand,
+			"1800WA12481",
+			"Hobbiton",
+			"789",
+			"ANWE")
+
+		conn := redigomock.NewConn()
+		conn.Command("LRANGE", atcocode, int64(0), int64(1)).ExpectStringSlice(`{"journeyRef":`, string(invalidDeparture))
+		conn.Command("LRANGE", atcocode, int64(2), int64(3)).ExpectStringSlice(string(departure1), string(departure2))
+
+		p := &Presenter{
+			Logger: logger,
+			Pool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return conn, nil
+				}),
+			}...),
+		}
+
+		got, err := p.Handler(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if err := conn.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+			return
+		}
+
+		want := &events.APIGatewayProxyResponse{
+			StatusCode: 200,
+			Headers: map[string]string{
+				"content-type": "application/json",
+			},
+			Body: `{"journeyType":"` + string(model.Bus) + `","departures":[` +
+				`{"departureTime":"` + test_helpers.AdjustTime(now, "2m10s").Format("15:04") + `","realTime":false,"stand":"C","serviceNumber":"456","destination":"Hobbiton"},` +
+				`{"departureTime":"` + test_helpers.AdjustTime(now, "3m10s").Format("15:04") + `","realTime":false,"stand":"C","serviceNumber":"789","destination":"Hobbiton"}` +
 				`]}`,
 		}
 
+		assertCacheHeaders(t, got)
+
 		if !reflect.DeepEqual(got, want) {
 			t.Errorf("unexpected result: got %#v, wanted %#v\n", got, want)
 		}
@@ -469,11 +738,13 @@ func TestPresenter_Handler(t *testing.T) {
 				"content-type": "application/json",
 			},
 			Body: `{"journeyType":"` + string(model.Bus) + `","departures":[` +
-				`{"departureTime":"1 min","stand":"C","serviceNumber":"456","destination":"Hobbiton"},` +
-				`{"departureTime":"2 mins","stand":"C","serviceNumber":"789","destination":"Hobbiton"}` +
+				`{"departureTime":"1 min","realTime":true,"stand":"C","serviceNumber":"456","destination":"Hobbiton"},` +
+				`{"departureTime":"2 mins","realTime":true,"stand":"C","serviceNumber":"789","destination":"Hobbiton"}` +
 				`]}`,
 		}
 
+		assertCacheHeaders(t, got)
+
 		if !reflect.DeepEqual(got, want) {
 			t.Errorf("unexpected result: got %#v, wanted %#v\n", got, want)
 		}
@@ -493,10 +764,10 @@ func TestPresenter_Handler(t *testing.T) {
 		}
 
 		departure1 := model.Departure{
-			RecordedAtTime:     now.Format(time.RFC3339),
+			RecordedAtTime:     now,
 			JourneyType:        model.Train,
 			JourneyRef:         "Service1",
-			AimedDepartureTime: test_helpers.AdjustTime(now, "2m").Format(time.RFC3339),
+			AimedDepartureTime: test_helpers.AdjustTime(now, "2m"),
 			DepartureStatus:    aws.String("On time"),
 			LocationAtcocode:   atcocode,
 			Stand:              aws.String("1"),
@@ -510,10 +781,10 @@ func TestPresenter_Handler(t *testing.T) {
 		}
 
 		departure2 := model.Departure{
-			RecordedAtTime:     now.Format(time.RFC3339),
+			RecordedAtTime:     now,
 			JourneyType:        model.Train,
 			JourneyRef:         "Service2",
-			AimedDepartureTime: test_helpers.AdjustTime(now, "4m").Format(time.RFC3339),
+			AimedDepartureTime: test_helpers.AdjustTime(now, "4m"),
 			DepartureStatus:    aws.String("Delayed"),
 			LocationAtcocode:   atcocode,
 			Stand:              aws.String("2"),
@@ -527,10 +798,10 @@ func TestPresenter_Handler(t *testing.T) {
 		}
 
 		departure3 := model.Departure{
-			RecordedAtTime:     now.Format(time.RFC3339),
+			RecordedAtTime:     now,
 			JourneyType:        model.Train,
 			JourneyRef:         "Service3",
-			AimedDepartureTime: test_helpers.AdjustTime(now, "12m").Format(time.RFC3339),
+			AimedDepartureTime: test_helpers.AdjustTime(now, "12m"),
 			DepartureStatus:    aws.String("Cancelled"),
 			LocationAtcocode:   atcocode,
 			Destination:        "Minas Tirith",
@@ -543,10 +814,10 @@ func TestPresenter_Handler(t *testing.T) {
 		}
 
 		departure4 := model.Departure{
-			RecordedAtTime:     now.Format(time.RFC3339),
+			RecordedAtTime:     now,
 			JourneyType:        model.Train,
 			JourneyRef:         "Service4",
-			AimedDepartureTime: test_helpers.AdjustTime(now, "15m").Format(time.RFC3339),
+			AimedDepartureTime: test_helpers.AdjustTime(now, "15m"),
 			DepartureStatus:    aws.String(test_helpers.AdjustTime(now, "20m").Format("15:04")),
 			LocationAtcocode:   atcocode,
 			Stand:              aws.String("4"),
@@ -592,16 +863,618 @@ func TestPresenter_Handler(t *testing.T) {
 				"content-type": "application/json",
 			},
 			Body: `{"journeyType":"` + string(model.Train) + `","departures":[` +
-				`{"departureTime":"` + test_helpers.AdjustTime(now, "2m").Format("15:04") + `","stand":"1","destination":"Hobbiton","departureStatus":"On time"},` +
-				`{"departureTime":"` + test_helpers.AdjustTime(now, "4m").Format("15:04") + `","stand":"2","destination":"Mordor","departureStatus":"Delayed"},` +
-				`{"departureTime":"` + test_helpers.AdjustTime(now, "12m").Format("15:04") + `","destination":"Minas Tirith","departureStatus":"Cancelled"},` +
-				`{"departureTime":"` + test_helpers.AdjustTime(now, "15m").Format("15:04") + `","stand":"4","destination":"Hobbiton","departureStatus":"` + test_helpers.AdjustTime(now, "20m").Format("15:04") + `"}` +
+				`{"departureTime":"` + test_helpers.AdjustTime(now, "2m").Format("15:04") + `","realTime":true,"stand":"1","destination":"Hobbiton","departureStatus":"On time"},` +
+				`{"departureTime":"` + test_helpers.AdjustTime(now, "4m").Format("15:04") + `","realTime":true,"stand":"2","destination":"Mordor","departureStatus":"Delayed"},` +
+				`{"departureTime":"` + test_helpers.AdjustTime(now, "12m").Format("15:04") + `","realTime":false,"destination":"Minas Tirith","departureStatus":"Cancelled"},` +
+				`{"departureTime":"` + test_helpers.AdjustTime(now, "15m").Format("15:04") + `","realTime":true,"stand":"4","destination":"Hobbiton","departureStatus":"` + test_helpers.AdjustTime(now, "20m").Format("15:04") + `"}` +
 				`]}`,
 		}
 
+		assertCacheHeaders(t, got)
+
 		if !reflect.DeepEqual(got, want) {
 			t.Errorf("unexpected result: got %#v, wanted %#v\n", got, want)
 		}
 	})
 
+	t.Run("returns error if a filter value is not valid", func(t *testing.T) {
+		req := events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{
+				"atcocode":      "1800BNIN",
+				"serviceNumber": "123,foo;bar",
+			},
+		}
+
+		p := &Presenter{
+			Logger: logger,
+		}
+
+		got, err := p.Handler(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		assertErrorResponse(t, got, http.StatusBadRequest, errorCodeInvalidParameter, "foo;bar")
+	})
+
+	t.Run("filters departures and appends response with equivalent number of later departures", func(t *testing.T) {
+		now := time.Now().Truncate(time.Second)
+		atcocode := "1800BNIN0C1"
+
+		top := 2
+		req := events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{
+				"atcocode":      atcocode,
+				"top":           strconv.Itoa(top),
+				"serviceNumber": "123",
+				"stand":         "c",
+			},
+		}
+
+		stand := "C"
+
+		departure1ExpectedTime := test_helpers.AdjustTime(now, "50s")
+		departure1 := buildJSONDeparture(
+			t,
+			test_helpers.AdjustTime(now, "-10s"),
+			model.Bus,
+			1234,
+			test_helpers.AdjustTime(now, "1m10s"),
+			&departure1ExpectedTime,
+			atcocode,
+			&stand,
+			"1800WA12481",
+			"Hobbiton",
+			"123",
+			"ANWE")
+		departure2ExpectedTime := test_helpers.AdjustTime(now, "1m10s")
+		departure2 := buildJSONDeparture(
+			t,
+			test_helpers.AdjustTime(now, "-10s"),
+			model.Bus,
+			1235,
+			test_helpers.AdjustTime(now, "4m10s"),
+			&departure2ExpectedTime,
+			atcocode,
+			&stand,
+			"1800WA12481",
+			"Hobbiton",
+			"456",
+			"ANWE")
+		departure3ExpectedTime := test_helpers.AdjustTime(now, "2m10s")
+		departure3 := buildJSONDeparture(
+			t,
+			test_helpers.AdjustTime(now, "-10s"),
+			model.Bus,
+			1236,
+			test_helpers.AdjustTime(now, "3m10s"),
+			&departure3ExpectedTime,
+			atcocode,
+			&stand,
+			"1800WA12481",
+			"Hobbiton",
+			"789",
+			"ANWE")
+		departure4 := buildJSONDeparture(
+			t,
+			test_helpers.AdjustTime(now, "-10s"),
+			model.Bus,
+			1237,
+			test_helpers.AdjustTime(now, "5m10s"),
+			nil,
+			atcocode,
+			&stand,
+			"1800WA12481",
+			"Hobbiton",
+			"123",
+			"ANWE")
+
+		conn := redigomock.NewConn()
+		conn.Command("LRANGE", atcocode, int64(0), int64(1)).ExpectStringSlice(string(departure1), string(departure2))
+		conn.Command("LRANGE", atcocode, int64(2), int64(2)).ExpectStringSlice(string(departure3))
+		conn.Command("LRANGE", atcocode, int64(3), int64(3)).ExpectStringSlice(string(departure4))
+
+		p := &Presenter{
+			Logger: logger,
+			Pool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return conn, nil
+				}),
+			}...),
+		}
+
+		got, err := p.Handler(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if err := conn.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+			return
+		}
+
+		want := &events.APIGatewayProxyResponse{
+			StatusCode: 200,
+			Headers: map[string]string{
+				"content-type": "application/json",
+			},
+			Body: `{"journeyType":"` + string(model.Bus) + `","departures":[` +
+				`{"departureTime":"Approaching","realTime":true,"stand":"C","serviceNumber":"123","destination":"Hobbiton"},` +
+				`{"departureTime":"` + test_helpers.AdjustTime(now, "5m10s").Format("15:04") + `","realTime":false,"stand":"C","serviceNumber":"123","destination":"Hobbiton"}` +
+				`]}`,
+		}
+
+		assertCacheHeaders(t, got)
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("unexpected result: got %#v, wanted %#v\n", got, want)
+		}
+	})
+
+	t.Run("returns error if too many atcocodes are requested", func(t *testing.T) {
+		req := events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{
+				"atcocode": "1800NE43431,1800NE43432,1800NE43433,1800NE43434,1800NE43435,1800NE43436",
+			},
+		}
+
+		p := &Presenter{
+			Logger: logger,
+		}
+
+		got, err := p.Handler(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		assertErrorResponse(t, got, http.StatusBadRequest, errorCodeInvalidParameter, "maximum")
+	})
+
+	t.Run("merges the data for several requested atcocodes from the cache", func(t *testing.T) {
+		now := time.Now().Truncate(time.Second)
+
+		atcocode1 := "1800NE43431"
+		atcocode2 := "1800NE43441"
+		top := 3
+
+		req := events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{
+				"atcocode": atcocode1 + "," + atcocode2,
+				"top":      strconv.Itoa(top),
+			},
+		}
+
+		departure1ExpectedTime := test_helpers.AdjustTime(now, "-5s")
+		departure1 := buildJSONDeparture(
+			t,
+			test_helpers.AdjustTime(now, "-10s"),
+			model.Bus,
+			1234,
+			test_helpers.AdjustTime(now, "1m10s"),
+			&departure1ExpectedTime,
+			atcocode1,
+			nil,
+			"1800WA12481",
+			"Hobbiton",
+			"123",
+			"ANWE")
+		departure2ExpectedTime := test_helpers.AdjustTime(now, "2m10s")
+		departure2 := buildJSONDeparture(
+			t,
+			test_helpers.AdjustTime(now, "-10s"),
+			model.Bus,
+			1235,
+			test_helpers.AdjustTime(now, "2m10s"),
+			&departure2ExpectedTime,
+			atcocode1,
+			nil,
+			"1800WA12481",
+			"Hobbiton",
+			"123",
+			"ANWE")
+		departure3ExpectedTime := test_helpers.AdjustTime(now, "1m10s")
+		departure3 := buildJSONDeparture(
+			t,
+			test_helpers.AdjustTime(now, "-10s"),
+			model.Bus,
+			1236,
+			test_helpers.AdjustTime(now, "1m10s"),
+			&departure3ExpectedTime,
+			atcocode2,
+			nil,
+			"1800SB12341",
+			"Mordor",
+			"456",
+			"ANWE")
+		departure4 := buildJSONDeparture(
+			t,
+			test_helpers.AdjustTime(now, "-10s"),
+			model.Bus,
+			1237,
+			test_helpers.AdjustTime(now, "5m10s"),
+			nil,
+			atcocode2,
+			nil,
+			"1800SB12341",
+			"Mordor",
+			"456",
+			"ANWE")
+		departure5 := buildJSONDeparture(
+			t,
+			test_helpers.AdjustTime(now, "-10s"),
+			model.Bus,
+			1238,
+			test_helpers.AdjustTime(now, "6m10s"),
+			nil,
+			atcocode2,
+			nil,
+			"1800SB12341",
+			"Mordor",
+			"456",
+			"ANWE")
+
+		conn := redigomock.NewConn()
+		conn.Command("LRANGE", atcocode1, int64(0), int64(2)).ExpectStringSlice(string(departure1), string(departure2))
+		conn.Command("LRANGE", atcocode1, int64(3), int64(3)).ExpectStringSlice([]string{}...)
+		conn.Command("LRANGE", atcocode2, int64(0), int64(2)).ExpectStringSlice(string(departure3), string(departure4), string(departure5))
+
+		p := &Presenter{
+			Logger: logger,
+			Pool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return conn, nil
+				}),
+			}...),
+		}
+
+		got, err := p.Handler(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if err := conn.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+			return
+		}
+
+		want := &events.APIGatewayProxyResponse{
+			StatusCode: 200,
+			Headers: map[string]string{
+				"content-type": "application/json",
+			},
+			Body: `{"journeyType":"` + string(model.Bus) + `","departures":[` +
+				`{"departureTime":"1 min","realTime":true,"serviceNumber":"456","destination":"Mordor","locationAtcocode":"` + atcocode2 + `"},` +
+				`{"departureTime":"2 mins","realTime":true,"serviceNumber":"123","destination":"Hobbiton","locationAtcocode":"` + atcocode1 + `"},` +
+				`{"departureTime":"` + test_helpers.AdjustTime(now, "5m10s").Format("15:04") + `","realTime":false,"serviceNumber":"456","destination":"Mordor","locationAtcocode":"` + atcocode2 + `"}` +
+				`]}`,
+		}
+
+		assertCacheHeaders(t, got)
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("unexpected result: got %#v, wanted %#v\n", got, want)
+		}
+	})
+
+	t.Run("returns a bad request response if atcocode is missing", func(t *testing.T) {
+		req := events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{},
+		}
+
+		p := &Presenter{
+			Logger: logger,
+		}
+
+		got, err := p.Handler(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		assertErrorResponse(t, got, http.StatusBadRequest, errorCodeInvalidParameter, "atcocode")
+	})
+
+	t.Run("returns a not found response if the atcocode is not in the cache", func(t *testing.T) {
+		atcocode := "1800NE43431"
+
+		req := events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{
+				"atcocode": atcocode,
+			},
+		}
+
+		conn := redigomock.NewConn()
+		conn.Command("LRANGE", atcocode, int64(0), int64(9)).ExpectStringSlice([]string{}...)
+		conn.Command("EXISTS", atcocode).Expect(int64(0))
+
+		p := &Presenter{
+			Logger: logger,
+			Pool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return conn, nil
+				}),
+			}...),
+		}
+
+		got, err := p.Handler(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if err := conn.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+			return
+		}
+
+		assertErrorResponse(t, got, http.StatusNotFound, errorCodeStopNotFound, atcocode)
+	})
+
+	t.Run("returns a service unavailable response if Redis cannot be reached", func(t *testing.T) {
+		atcocode := "1800NE43431"
+
+		req := events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{
+				"atcocode": atcocode,
+			},
+		}
+
+		p := &Presenter{
+			Logger: logger,
+			Pool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return nil, errors.New("dial tcp: connection refused")
+				}),
+			}...),
+		}
+
+		got, err := p.Handler(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		assertErrorResponse(t, got, http.StatusServiceUnavailable, errorCodeServiceUnavailable, http.StatusText(http.StatusServiceUnavailable))
+
+		if strings.Contains(got.Body, "connection refused") {
+			t.Error("internal error details should not be included in the response")
+		}
+	})
+
+	t.Run("returns SIRI Stop Monitoring XML if requested", func(t *testing.T) {
+		now := time.Now().Truncate(time.Second)
+
+		atcocode := "1800BNIN0C1"
+
+		req := events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{
+				"atcocode": atcocode,
+				"top":      "1",
+			},
+			Headers: map[string]string{
+				"Accept": "application/xml",
+			},
+		}
+
+		stand := "C"
+		departure1 := buildJSONDeparture(
+			t,
+			test_helpers.AdjustTime(now, "-10s"),
+			model.Bus,
+			1234,
+			test_helpers.AdjustTime(now, "1m10s"),
+			nil,
+			atcocode,
+			&stand,
+			"1800WA12481",
+			"Hobbiton",
+			"123",
+			"ANWE")
+
+		conn := redigomock.NewConn()
+		conn.Command("LRANGE", atcocode, int64(0), int64(0)).ExpectStringSlice(string(departure1))
+
+		p := &Presenter{
+			Logger: logger,
+			Pool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return conn, nil
+				}),
+			}...),
+		}
+
+		got, err := p.Handler(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if got.StatusCode != http.StatusOK {
+			t.Errorf("wrong status code: got %d, wanted %d", got.StatusCode, http.StatusOK)
+		}
+
+		test_helpers.AssertString(t, got.Headers["content-type"], "application/xml")
+
+		siri := model.Siri{}
+		if err := xml.Unmarshal([]byte(got.Body), &siri); err != nil {
+			t.Fatal(err)
+		}
+
+		visits := siri.ServiceDelivery.StopMonitoringDelivery.MonitoredStopVisit
+		if len(visits) != 1 {
+			t.Fatalf("got %d monitored stop visits, want %d", len(visits), 1)
+		}
+
+		test_helpers.AssertString(t, visits[0].MonitoredVehicleJourney.LineRef, "123")
+		test_helpers.AssertString(t, visits[0].MonitoredVehicleJourney.DestinationName, "Hobbiton")
+		test_helpers.AssertString(t, visits[0].MonitoredVehicleJourney.MonitoredCall.DeparturePlatformName, "C")
+	})
+
+	t.Run("returns not modified if the entity tag matches", func(t *testing.T) {
+		now := time.Now().Truncate(time.Second)
+
+		atcocode := "1800BNIN0C1"
+
+		stand := "C"
+		departure1 := buildJSONDeparture(
+			t,
+			test_helpers.AdjustTime(now, "-10s"),
+			model.Bus,
+			1234,
+			test_helpers.AdjustTime(now, "5m10s"),
+			nil,
+			atcocode,
+			&stand,
+			"1800WA12481",
+			"Hobbiton",
+			"123",
+			"ANWE")
+
+		conn := redigomock.NewConn()
+		conn.Command("LRANGE", atcocode, int64(0), int64(0)).ExpectStringSlice(string(departure1))
+
+		p := &Presenter{
+			Logger: logger,
+			Pool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return conn, nil
+				}),
+			}...),
+		}
+
+		req := events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{
+				"atcocode": atcocode,
+				"top":      "1",
+			},
+		}
+
+		first, err := p.Handler(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		etag := first.Headers["etag"]
+		if etag == "" {
+			t.Fatal("should set an entity tag")
+		}
+
+		req.Headers = map[string]string{
+			"if-none-match": etag,
+		}
+
+		got, err := p.Handler(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if got.StatusCode != http.StatusNotModified {
+			t.Errorf("wrong status code: got %d, wanted %d", got.StatusCode, http.StatusNotModified)
+		}
+
+		test_helpers.AssertString(t, got.Headers["etag"], etag)
+		test_helpers.AssertString(t, got.Headers["vary"], "Accept")
+		test_helpers.AssertString(t, got.Body, "")
+	})
+
+	t.Run("renders the board at the requested point in time", func(t *testing.T) {
+		now := time.Date(2019, 5, 8, 8, 0, 0, 0, time.UTC)
+
+		atcocode := "1800BNIN0C1"
+
+		stand := "C"
+		expected1 := test_helpers.AdjustTime(now, "14m30s")
+		departure1 := buildJSONDeparture(
+			t,
+			test_helpers.AdjustTime(now, "-10s"),
+			model.Bus,
+			1234,
+			test_helpers.AdjustTime(now, "14m"),
+			&expected1,
+			atcocode,
+			&stand,
+			"1800WA12481",
+			"Hobbiton",
+			"123",
+			"ANWE")
+
+		conn := redigomock.NewConn()
+		conn.Command("LRANGE", atcocode, int64(0), int64(0)).ExpectStringSlice(string(departure1))
+
+		p := &Presenter{
+			Logger: logger,
+			Pool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return conn, nil
+				}),
+			}...),
+			Clock: func() time.Time {
+				return now
+			},
+			SupportAPIKey: "secret",
+		}
+
+		req := events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{
+				"atcocode": atcocode,
+				"top":      "1",
+				"at":       test_helpers.AdjustTime(now, "12m").Format(time.RFC3339),
+			},
+			Headers: map[string]string{
+				"X-Support-Key": "secret",
+			},
+		}
+
+		got, err := p.Handler(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		test_helpers.AssertString(t, got.Headers["cache-control"], "no-store")
+
+		assertCacheHeaders(t, got)
+
+		want := &events.APIGatewayProxyResponse{
+			StatusCode: 200,
+			Headers: map[string]string{
+				"content-type": "application/json",
+			},
+			Body: `{"journeyType":"` + string(model.Bus) + `","departures":[` +
+				`{"departureTime":"2 mins","realTime":true,"stand":"C","serviceNumber":"123","destination":"Hobbiton"}` +
+				`]}`,
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("unexpected result: got %#v, wanted %#v\n", got, want)
+		}
+	})
+
+	t.Run("returns a forbidden response if a point in time is requested without authentication", func(t *testing.T) {
+		p := &Presenter{
+			Logger:        logger,
+			SupportAPIKey: "secret",
+		}
+
+		req := events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{
+				"atcocode": "1800BNIN0C1",
+				"at":       "2019-05-08T08:14:00+01:00",
+			},
+		}
+
+		got, err := p.Handler(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		assertErrorResponse(t, got, http.StatusForbidden, errorCodeForbidden, "authenticated")
+	})
 }
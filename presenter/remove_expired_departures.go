@@ -5,7 +5,10 @@ import (
 	"time"
 )
 
-// We trust that the data is sorted by ascending departure time
+// removeExpiredDepartures removes the departures that have expired, keeping
+// cancelled departures for CancelledPeriod. The data is sorted by departure
+// time, but a cancelled departure that is still shown can come before ones
+// that have expired, so every departure is checked.
 func (p *Presenter) removeExpiredDepartures(now time.Time, deps *model.Internal) int64 {
 	p.Logger.Debug("removeExpiredDepartures")
 
@@ -13,18 +16,21 @@ func (p *Presenter) removeExpiredDepartures(now time.Time, deps *model.Internal)
 		return 0
 	}
 
-	var i = 0
+	i := 0
 	for _, dep := range deps.Departures {
-		if dep.IsExpired(now) {
-			i++
+		if dep.IsExpiredAfter(now, p.CancelledPeriod) {
 			continue
 		}
-		break
+
+		deps.Departures[i] = dep
+		i++
 	}
 
-	p.Logger.Debugf("removed %d expired departure(s)", i)
+	removed := len(deps.Departures) - i
+
+	p.Logger.Debugf("removed %d expired departure(s)", removed)
 
-	deps.Departures = deps.Departures[i:]
+	deps.Departures = deps.Departures[:i]
 
-	return int64(i)
+	return int64(removed)
 }
@@ -4,6 +4,7 @@ import (
 	"github.com/TfGMEnterprise/departures-service/dlog"
 	"github.com/TfGMEnterprise/departures-service/model"
 	"github.com/TfGMEnterprise/departures-service/test_helpers"
+	"github.com/aws/aws-sdk-go/aws"
 	"io/ioutil"
 	"testing"
 	"time"
@@ -33,10 +34,10 @@ func TestPresenter_RemoveExpiredDepartures(t *testing.T) {
 
 		deps := model.Internal{}
 		deps.Departures = append(deps.Departures, model.Departure{
-			AimedDepartureTime: test_helpers.AdjustTime(now, "10s").Format(time.RFC3339),
+			AimedDepartureTime: test_helpers.AdjustTime(now, "10s"),
 		})
 		deps.Departures = append(deps.Departures, model.Departure{
-			AimedDepartureTime: test_helpers.AdjustTime(now, "20s").Format(time.RFC3339),
+			AimedDepartureTime: test_helpers.AdjustTime(now, "20s"),
 		})
 
 		got := p.removeExpiredDepartures(now, &deps)
@@ -56,11 +57,11 @@ func TestPresenter_RemoveExpiredDepartures(t *testing.T) {
 
 		deps := model.Internal{}
 		deps.Departures = append(deps.Departures, model.Departure{
-			AimedDepartureTime: test_helpers.AdjustTime(now, "-10s").Format(time.RFC3339),
+			AimedDepartureTime: test_helpers.AdjustTime(now, "-10s"),
 		})
 		deps.Departures = append(deps.Departures, model.Departure{
 			JourneyRef:         "1234",
-			AimedDepartureTime: test_helpers.AdjustTime(now, "10s").Format(time.RFC3339),
+			AimedDepartureTime: test_helpers.AdjustTime(now, "10s"),
 		})
 
 		got := p.removeExpiredDepartures(now, &deps)
@@ -79,4 +80,46 @@ func TestPresenter_RemoveExpiredDepartures(t *testing.T) {
 			t.Errorf("Removed %d departure(s); should remove %d", got, 1)
 		}
 	})
+
+	t.Run("keeps cancelled departures for the cancelled period", func(t *testing.T) {
+		now := time.Now().Truncate(time.Second)
+
+		deps := model.Internal{}
+		deps.Departures = append(deps.Departures, model.Departure{
+			JourneyRef:         "1233",
+			AimedDepartureTime: test_helpers.AdjustTime(now, "-3m"),
+			DepartureStatus:    aws.String(model.CancelledStatus),
+		})
+		deps.Departures = append(deps.Departures, model.Departure{
+			JourneyRef:         "1234",
+			AimedDepartureTime: test_helpers.AdjustTime(now, "-1m"),
+			DepartureStatus:    aws.String(model.CancelledStatus),
+		})
+		deps.Departures = append(deps.Departures, model.Departure{
+			JourneyRef:         "1235",
+			AimedDepartureTime: test_helpers.AdjustTime(now, "-30s"),
+		})
+		deps.Departures = append(deps.Departures, model.Departure{
+			JourneyRef:         "1236",
+			AimedDepartureTime: test_helpers.AdjustTime(now, "10s"),
+		})
+
+		p := Presenter{
+			Logger:          logger,
+			CancelledPeriod: 2 * time.Minute,
+		}
+
+		got := p.removeExpiredDepartures(now, &deps)
+
+		if len(deps.Departures) != 2 {
+			t.Fatalf("Internal struct contains %d departures, should be %d", len(deps.Departures), 2)
+		}
+
+		test_helpers.AssertString(t, deps.Departures[0].JourneyRef, "1234")
+		test_helpers.AssertString(t, deps.Departures[1].JourneyRef, "1236")
+
+		if got != 2 {
+			t.Errorf("Removed %d departure(s); should remove %d", got, 2)
+		}
+	})
 }
@@ -0,0 +1,15 @@
+package main
+
+import "strings"
+
+// getHeader returns the value of a request header; API Gateway does not
+// normalise the case of header names
+func getHeader(headers map[string]string, name string) string {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+
+	return ""
+}
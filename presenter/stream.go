@@ -0,0 +1,318 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/TfGMEnterprise/departures-service/model"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The Redis channel pattern for keyspace notifications on every key; the
+// departures cache only holds the departures and arrivals lists of each stop
+const keyspaceNotificationPattern = "__keyspace@*__:*"
+
+// How long to wait before resubscribing after losing the Redis connection
+const streamResubscribeInterval = 5 * time.Second
+
+// How often a comment is sent to keep idle streams open through proxies
+var streamKeepAliveInterval = 30 * time.Second
+
+// streamHub passes Redis keyspace notifications on to the streams that are
+// subscribed to the changed keys
+type streamHub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan struct{}]bool
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+func newStreamHub() *streamHub {
+	return &streamHub{
+		subscribers: make(map[string]map[chan struct{}]bool),
+		done:        make(chan struct{}),
+	}
+}
+
+// subscribe returns a channel that receives a value whenever any of the keys
+// in the departures cache change, and a function to unsubscribe
+func (h *streamHub) subscribe(keys []string) (<-chan struct{}, func()) {
+	// Notifications are coalesced; a stream only needs to know that at least
+	// one change has happened since it last rendered the board
+	notify := make(chan struct{}, 1)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, key := range keys {
+		if h.subscribers[key] == nil {
+			h.subscribers[key] = make(map[chan struct{}]bool)
+		}
+		h.subscribers[key][notify] = true
+	}
+
+	unsubscribe := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		for _, key := range keys {
+			delete(h.subscribers[key], notify)
+			if len(h.subscribers[key]) == 0 {
+				delete(h.subscribers, key)
+			}
+		}
+	}
+
+	return notify, unsubscribe
+}
+
+// notify tells the streams subscribed to the key that it changed
+func (h *streamHub) notify(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for notify := range h.subscribers[key] {
+		select {
+		case notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// close ends all streams
+func (h *streamHub) close() {
+	h.closeOnce.Do(func() {
+		close(h.done)
+	})
+}
+
+// listenForChanges subscribes to Redis keyspace notifications and passes
+// them on to the stream hub until the hub is closed, resubscribing if the
+// connection is lost
+func (p Presenter) listenForChanges(hub *streamHub) {
+	p.Logger.Debug("listenForChanges")
+
+	for {
+		err := p.receiveKeyspaceNotifications(hub)
+
+		select {
+		case <-hub.done:
+			return
+		default:
+		}
+
+		p.Logger.Printf("keyspace notifications stopped: %s; resubscribing in %s", err, streamResubscribeInterval)
+
+		select {
+		case <-hub.done:
+			return
+		case <-time.After(streamResubscribeInterval):
+		}
+	}
+}
+
+func (p Presenter) receiveKeyspaceNotifications(hub *streamHub) error {
+	psc := redis.PubSubConn{Conn: p.Pool.Get()}
+	defer func() {
+		if err := psc.Close(); err != nil {
+			p.Logger.Debugf("could not close Redis connection: %s", err.Error())
+		}
+	}()
+
+	if err := psc.PSubscribe(keyspaceNotificationPattern); err != nil {
+		return errors.Wrap(err, "cannot subscribe to keyspace notifications")
+	}
+
+	// Unsubscribing once the hub is closed stops Receive blocking; the
+	// connection is only closed after this has finished
+	stopped := make(chan struct{})
+	unsubscribed := make(chan struct{})
+
+	go func() {
+		defer close(unsubscribed)
+
+		select {
+		case <-hub.done:
+			if err := psc.PUnsubscribe(); err != nil {
+				p.Logger.Debugf("could not unsubscribe from keyspace notifications: %s", err.Error())
+			}
+		case <-stopped:
+		}
+	}()
+
+	defer func() {
+		close(stopped)
+		<-unsubscribed
+	}()
+
+	for {
+		switch v := psc.Receive().(type) {
+		case redis.Message:
+			if key := keyFromKeyspaceChannel(v.Channel); key != "" {
+				hub.notify(key)
+			}
+		case redis.Subscription:
+			if v.Count == 0 {
+				return errors.New("unsubscribed from keyspace notifications")
+			}
+		case error:
+			return errors.Wrap(v, "cannot receive keyspace notification")
+		}
+	}
+}
+
+// keyFromKeyspaceChannel returns the key from a keyspace notification
+// channel, which has the format __keyspace@<db>__:<key>
+func keyFromKeyspaceChannel(channel string) string {
+	parts := strings.SplitN(channel, ":", 2)
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "__keyspace@") {
+		return ""
+	}
+
+	return parts[1]
+}
+
+// streamHTTPHandler pushes the board for the requested stops as server-sent
+// events whenever their departures change, and whenever the countdown for a
+// departure would change
+func (p Presenter) streamHTTPHandler(w http.ResponseWriter, r *http.Request) {
+	p.Logger.Debug("streamHTTPHandler")
+
+	if r.Method != http.MethodGet {
+		p.Logger.Debugf("invalid method %s", r.Method)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok || p.streamHub == nil {
+		p.Logger.Print("streaming is not supported")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	request := p.newAPIGatewayRequest(r, "")
+
+	// Streams are always JSON, and always include the board
+	request.QueryStringParameters["format"] = string(formatJSON)
+	for name := range request.Headers {
+		if strings.EqualFold(name, "If-None-Match") {
+			delete(request.Headers, name)
+		}
+	}
+
+	resp, err := p.present(request)
+	if err != nil {
+		resp, err = p.errorResponse(err)
+		if err != nil {
+			p.Logger.Printf("%+v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		p.writeAPIGatewayResponse(w, resp)
+		return
+	}
+
+	// The board type has been validated when presenting the board
+	board, _ := model.ParseBoardType(request.QueryStringParameters["type"])
+
+	notify, unsubscribe := p.streamHub.subscribe(streamKeys(board, p.parseAtcocodes(request.QueryStringParameters["atcocode"])))
+	defer unsubscribe()
+
+	w.Header().Set("content-type", "text/event-stream")
+	w.Header().Set("cache-control", "no-cache")
+	w.Header().Set("connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	lastETag := ""
+
+	// The timer is only reset once the board has been rendered again, so that
+	// keep-alives do not put off the next countdown change
+	tick := time.NewTimer(p.streamTickInterval(resp))
+	defer tick.Stop()
+
+	keepAlive := time.NewTicker(streamKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		if resp != nil && resp.Headers["etag"] != lastETag {
+			if _, err := fmt.Fprintf(w, "event: board\nid: %s\ndata: %s\n\n", resp.Headers["etag"], resp.Body); err != nil {
+				p.Logger.Debugf("could not write to stream: %s", err.Error())
+				return
+			}
+			flusher.Flush()
+
+			lastETag = resp.Headers["etag"]
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-p.streamHub.done:
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+			continue
+		case <-notify:
+			if !tick.Stop() {
+				<-tick.C
+			}
+		case <-tick.C:
+		}
+
+		resp, err = p.present(request)
+		if err != nil {
+			// Keep the stream open; the board is sent again once it can be read
+			_, errorOutput := p.errorOutput(err)
+
+			errorJSON, err := json.Marshal(errorOutput)
+			if err != nil {
+				p.Logger.Printf("%+v", errors.Wrap(err, "cannot marshal JSON for stream error"))
+				return
+			}
+
+			if _, err := fmt.Fprintf(w, "event: error\ndata: %s\n\n", errorJSON); err != nil {
+				return
+			}
+			flusher.Flush()
+
+			tick.Reset(streamResubscribeInterval)
+			continue
+		}
+
+		tick.Reset(p.streamTickInterval(resp))
+	}
+}
+
+// streamKeys returns the keys in the departures cache of the board for the
+// stops, whose keyspace notifications the stream is subscribed to
+func streamKeys(board model.BoardType, atcocodes []string) []string {
+	keys := make([]string, len(atcocodes))
+
+	for i, atcocode := range atcocodes {
+		keys[i] = board.Key(atcocode)
+	}
+
+	return keys
+}
+
+// streamTickInterval returns how long until the board needs to be sent again
+// to keep countdowns correct, which is the lifetime set for caching it
+func (p Presenter) streamTickInterval(resp *events.APIGatewayProxyResponse) time.Duration {
+	maxAge, err := strconv.Atoi(strings.TrimPrefix(resp.Headers["cache-control"], "max-age="))
+	if err != nil || maxAge < 1 {
+		return time.Second
+	}
+
+	return time.Duration(maxAge) * time.Second
+}
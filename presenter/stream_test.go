@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/TfGMEnterprise/departures-service/dlog"
+	"github.com/TfGMEnterprise/departures-service/model"
+	"github.com/TfGMEnterprise/departures-service/repository"
+	"github.com/TfGMEnterprise/departures-service/test_helpers"
+	"github.com/gomodule/redigo/redis"
+	"github.com/rafaeljusto/redigomock"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamHub(t *testing.T) {
+	hub := newStreamHub()
+
+	notify, unsubscribe := hub.subscribe([]string{"1800NE43431", "1800NE43441"})
+
+	t.Run("notifies subscribers of changes to their stops", func(t *testing.T) {
+		hub.notify("1800NE43441")
+
+		select {
+		case <-notify:
+		default:
+			t.Error("should notify subscriber")
+		}
+	})
+
+	t.Run("coalesces notifications", func(t *testing.T) {
+		hub.notify("1800NE43431")
+		hub.notify("1800NE43441")
+
+		<-notify
+
+		select {
+		case <-notify:
+			t.Error("should only notify subscriber once")
+		default:
+		}
+	})
+
+	t.Run("does not notify subscribers of changes to other stops", func(t *testing.T) {
+		hub.notify("1800BNIN0C1")
+
+		select {
+		case <-notify:
+			t.Error("should not notify subscriber")
+		default:
+		}
+	})
+
+	t.Run("stops notifying after unsubscribing", func(t *testing.T) {
+		unsubscribe()
+		hub.notify("1800NE43431")
+
+		select {
+		case <-notify:
+			t.Error("should not notify subscriber")
+		default:
+		}
+
+		test_helpers.AssertBoolean(t, len(hub.subscribers) == 0, true)
+	})
+}
+
+func TestKeyFromKeyspaceChannel(t *testing.T) {
+	test_helpers.AssertString(t, keyFromKeyspaceChannel("__keyspace@0__:1800NE43431"), "1800NE43431")
+	test_helpers.AssertString(t, keyFromKeyspaceChannel("__keyevent@0__:rpush"), "")
+	test_helpers.AssertString(t, keyFromKeyspaceChannel("foo"), "")
+}
+
+func TestPresenter_StreamHTTPHandler(t *testing.T) {
+	logger := dlog.NewLogger([]dlog.LoggerOption{
+		dlog.LoggerSetOutput(ioutil.Discard),
+	}...)
+
+	newPresenter := func(conn *redigomock.Conn) Presenter {
+		return Presenter{
+			Logger: logger,
+			Pool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return conn, nil
+				}),
+			}...),
+			streamHub: newStreamHub(),
+		}
+	}
+
+	t.Run("sends the board as an event until the stream ends", func(t *testing.T) {
+		now := time.Now().Truncate(time.Second)
+
+		atcocode := "1800BNIN0C1"
+
+		departure1 := buildJSONDeparture(
+			t,
+			test_helpers.AdjustTime(now, "-10s"),
+			model.Bus,
+			1234,
+			test_helpers.AdjustTime(now, "5m10s"),
+			nil,
+			atcocode,
+			nil,
+			"1800WA12481",
+			"Hobbiton",
+			"123",
+			"ANWE")
+
+		conn := redigomock.NewConn()
+		conn.Command("LRANGE", atcocode, int64(0), int64(0)).ExpectStringSlice(string(departure1))
+
+		p := newPresenter(conn)
+
+		req := httptest.NewRequest(http.MethodGet, "/departures/stream?atcocode="+atcocode+"&top=1", nil)
+		w := httptest.NewRecorder()
+
+		done := make(chan struct{})
+		go func() {
+			p.newServeMux().ServeHTTP(w, req)
+			close(done)
+		}()
+
+		// A change to the stop renders the board again; as it is unchanged it
+		// is not sent again
+		time.Sleep(10 * time.Millisecond)
+		p.streamHub.notify(atcocode)
+		time.Sleep(10 * time.Millisecond)
+
+		p.streamHub.close()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("stream should end when the hub is closed")
+		}
+
+		test_helpers.AssertString(t, w.Header().Get("Content-Type"), "text/event-stream")
+
+		body := w.Body.String()
+		if strings.Count(body, "event: board\n") != 1 {
+			t.Errorf("should send the board once: %s", body)
+		}
+
+		if !strings.Contains(body, `"serviceNumber":"123"`) {
+			t.Errorf("should include the departures: %s", body)
+		}
+	})
+
+	t.Run("sends the board again when a countdown changes between keep-alives", func(t *testing.T) {
+		keepAliveInterval := streamKeepAliveInterval
+		streamKeepAliveInterval = 10 * time.Millisecond
+		defer func() { streamKeepAliveInterval = keepAliveInterval }()
+
+		now := time.Now().Truncate(time.Second)
+
+		atcocode := "1800BNIN0C1"
+
+		// The countdown changes within a second, so the board is rendered
+		// again after a second
+		expectedDepartureTime := test_helpers.AdjustTime(now, "5m1s")
+
+		departure1 := buildJSONDeparture(t, now, model.Bus, 1234, test_helpers.AdjustTime(now, "5m"), &expectedDepartureTime, atcocode, nil, "1800WA12481", "Hobbiton", "123", "ANWE")
+		departure2 := buildJSONDeparture(t, now, model.Bus, 1234, test_helpers.AdjustTime(now, "5m"), &expectedDepartureTime, atcocode, nil, "1800WA12481", "Hobbiton", "124", "ANWE")
+
+		conn := redigomock.NewConn()
+		conn.Command("LRANGE", atcocode, int64(0), int64(0)).ExpectStringSlice(string(departure1)).ExpectStringSlice(string(departure2))
+
+		p := newPresenter(conn)
+
+		req := httptest.NewRequest(http.MethodGet, "/departures/stream?atcocode="+atcocode+"&top=1", nil)
+		w := httptest.NewRecorder()
+
+		done := make(chan struct{})
+		go func() {
+			p.newServeMux().ServeHTTP(w, req)
+			close(done)
+		}()
+
+		time.Sleep(1500 * time.Millisecond)
+
+		p.streamHub.close()
+		<-done
+
+		body := w.Body.String()
+		if strings.Count(body, "event: board\n") != 2 {
+			t.Errorf("should send the board again once the countdown changes: %s", body)
+		}
+
+		if !strings.Contains(body, ": keep-alive\n") {
+			t.Errorf("should send keep-alives: %s", body)
+		}
+	})
+
+	t.Run("sends the arrivals board again when the arrivals change", func(t *testing.T) {
+		now := time.Now().Truncate(time.Second)
+
+		atcocode := "1800BNIN0C1"
+
+		arrival := model.Departure{
+			RecordedAtTime:   test_helpers.AdjustTime(now, "-10s"),
+			JourneyType:      model.Bus,
+			JourneyRef:       "1234",
+			AimedArrivalTime: test_helpers.AdjustTime(now, "5m10s"),
+			LocationAtcocode: atcocode,
+			Origin:           "Bree",
+			Destination:      "Hobbiton",
+			ServiceNumber:    "123",
+			OperatorCode:     "ANWE",
+		}
+
+		arrival1, err := json.Marshal(arrival)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		arrival.Origin = "Mordor"
+		arrival2, err := json.Marshal(arrival)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		conn := redigomock.NewConn()
+		conn.Command("LRANGE", "arrivals:"+atcocode, int64(0), int64(0)).ExpectStringSlice(string(arrival1)).ExpectStringSlice(string(arrival2))
+
+		p := newPresenter(conn)
+
+		req := httptest.NewRequest(http.MethodGet, "/departures/stream?atcocode="+atcocode+"&top=1&type=arrivals", nil)
+		w := httptest.NewRecorder()
+
+		done := make(chan struct{})
+		go func() {
+			p.newServeMux().ServeHTTP(w, req)
+			close(done)
+		}()
+
+		time.Sleep(10 * time.Millisecond)
+		p.streamHub.notify("arrivals:" + atcocode)
+		time.Sleep(10 * time.Millisecond)
+
+		p.streamHub.close()
+		<-done
+
+		body := w.Body.String()
+		if strings.Count(body, "event: board\n") != 2 {
+			t.Errorf("should send the board again when the arrivals change: %s", body)
+		}
+
+		if !strings.Contains(body, `"origin":"Mordor"`) {
+			t.Errorf("should include the changed arrivals: %s", body)
+		}
+	})
+
+	t.Run("returns an error response if the request is not valid", func(t *testing.T) {
+		p := newPresenter(redigomock.NewConn())
+
+		req := httptest.NewRequest(http.MethodGet, "/departures/stream?atcocode=foo", nil)
+		w := httptest.NewRecorder()
+
+		p.newServeMux().ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("wrong status code: got %d, wanted %d", w.Code, http.StatusBadRequest)
+		}
+	})
+}
@@ -6,31 +6,65 @@ import (
 	"time"
 )
 
-func (p *Presenter) transformDepartureTime(now time.Time, dep model.DepartureInterface) (string, error) {
+func (p *Presenter) transformDepartureTime(now time.Time, journeyType model.JourneyType, dep model.DepartureInterface) string {
 	p.Logger.Debug("transformDepartureTime")
-	depTime, isRealTime, err := dep.DepartureTime()
-
-	if err != nil {
-		return "", err
-	}
+	depTime, isRealTime := dep.DepartureTime()
 
 	p.Logger.Debugf("departure time is: %s (real-time: %v)", depTime.Format(time.RFC3339), isRealTime)
 
-	if isRealTime {
-		wait := int(depTime.Sub(now).Truncate(time.Minute).Minutes())
+	rule := p.displayRule(journeyType)
 
-		if wait == 0 {
-			return "Approaching", nil
-		}
+	due, wait, isCountdown := p.countdown(now, journeyType, dep)
 
-		mins := "min"
+	switch {
+	case due:
+		return rule.DueLabel
+	case isCountdown:
+		mins := rule.MinuteLabel
 
 		if wait != 1 {
-			mins += "s"
+			mins = rule.MinutesLabel
 		}
 
-		return strconv.Itoa(wait) + " " + mins, nil
+		return strconv.Itoa(wait) + " " + mins
+	}
+
+	return depTime.Format(rule.ClockFormat)
+}
+
+// countdown returns whether a real-time departure is shown as due and,
+// otherwise, the whole minutes until it departs if it is shown as a countdown
+// rather than a clock time, following the display rule for the journey type
+func (p *Presenter) countdown(now time.Time, journeyType model.JourneyType, dep model.DepartureInterface) (due bool, wait int, isCountdown bool) {
+	depTime, isRealTime := dep.DepartureTime()
+	if !isRealTime {
+		return false, 0, false
+	}
+
+	rule := p.displayRule(journeyType)
+
+	until := depTime.Sub(now)
+
+	if until < time.Duration(rule.DueWithinSeconds)*time.Second {
+		return true, 0, false
+	}
+
+	wait = int(until.Truncate(time.Minute).Minutes())
+
+	if rule.MaxCountdownMinutes == 0 || wait <= rule.MaxCountdownMinutes {
+		return false, wait, true
+	}
+
+	return false, 0, false
+}
+
+// isRealTimeDeparture returns true if the departure is shown from real-time
+// data. Rail real-time data is held in the departure status, e.g. "On time"
+// or an estimated time, rather than in an expected departure time.
+func isRealTimeDeparture(dep model.Departure) bool {
+	if dep.JourneyType == model.Train {
+		return dep.DepartureStatus != nil && *dep.DepartureStatus != "" && !dep.IsCancelled()
 	}
 
-	return depTime.Format("15:04"), nil
+	return dep.ExpectedDepartureTime != nil
 }
@@ -4,6 +4,7 @@ import (
 	"github.com/TfGMEnterprise/departures-service/dlog"
 	"github.com/TfGMEnterprise/departures-service/model"
 	"github.com/TfGMEnterprise/departures-service/test_helpers"
+	"github.com/aws/aws-sdk-go/aws"
 	"io/ioutil"
 	"testing"
 	"time"
@@ -22,10 +23,10 @@ func Test_TransformDepartureTime(t *testing.T) {
 		now := time.Now().Truncate(time.Second)
 
 		dep := model.Departure{
-			AimedDepartureTime: "2019-05-20T12:34:56+01:00",
+			AimedDepartureTime: test_helpers.ParseTime(t, "2019-05-20T12:34:56+01:00"),
 		}
 
-		got, _ := p.transformDepartureTime(now, dep)
+		got := p.transformDepartureTime(now, dep.JourneyType, dep)
 
 		want := "12:34"
 
@@ -37,13 +38,13 @@ func Test_TransformDepartureTime(t *testing.T) {
 	t.Run("should return `Approaching` if expected departure time is less than one minute away", func(t *testing.T) {
 		now := time.Now().Truncate(time.Second)
 
-		expectedDepartureTime := test_helpers.AdjustTime(now, "59s").Format(time.RFC3339)
+		expectedDepartureTime := test_helpers.AdjustTime(now, "59s")
 		dep := model.Departure{
-			AimedDepartureTime:    "2019-05-20T12:34:56+01:00",
+			AimedDepartureTime:    test_helpers.ParseTime(t, "2019-05-20T12:34:56+01:00"),
 			ExpectedDepartureTime: &expectedDepartureTime,
 		}
 
-		got, _ := p.transformDepartureTime(now, dep)
+		got := p.transformDepartureTime(now, dep.JourneyType, dep)
 
 		want := "Approaching"
 
@@ -55,13 +56,13 @@ func Test_TransformDepartureTime(t *testing.T) {
 	t.Run("should return `1 min` if expected departure time is exactly 1 minute away", func(t *testing.T) {
 		now := time.Now().Truncate(time.Second)
 
-		expectedDepartureTime := test_helpers.AdjustTime(now, "1m").Format(time.RFC3339)
+		expectedDepartureTime := test_helpers.AdjustTime(now, "1m")
 		dep := model.Departure{
-			AimedDepartureTime:    "2019-05-20T12:34:56+01:00",
+			AimedDepartureTime:    test_helpers.ParseTime(t, "2019-05-20T12:34:56+01:00"),
 			ExpectedDepartureTime: &expectedDepartureTime,
 		}
 
-		got, _ := p.transformDepartureTime(now, dep)
+		got := p.transformDepartureTime(now, dep.JourneyType, dep)
 
 		want := "1 min"
 
@@ -73,13 +74,13 @@ func Test_TransformDepartureTime(t *testing.T) {
 	t.Run("should return `1 min` if expected departure time is less than two minutes away", func(t *testing.T) {
 		now := time.Now().Truncate(time.Second)
 
-		expectedDepartureTime := test_helpers.AdjustTime(now, "1m59s").Format(time.RFC3339)
+		expectedDepartureTime := test_helpers.AdjustTime(now, "1m59s")
 		dep := model.Departure{
-			AimedDepartureTime:    "2019-05-20T12:34:56+01:00",
+			AimedDepartureTime:    test_helpers.ParseTime(t, "2019-05-20T12:34:56+01:00"),
 			ExpectedDepartureTime: &expectedDepartureTime,
 		}
 
-		got, _ := p.transformDepartureTime(now, dep)
+		got := p.transformDepartureTime(now, dep.JourneyType, dep)
 
 		want := "1 min"
 
@@ -91,13 +92,13 @@ func Test_TransformDepartureTime(t *testing.T) {
 	t.Run("should return `2 mins` if expected departure time is exactly 2 minutes away", func(t *testing.T) {
 		now := time.Now().Truncate(time.Second)
 
-		expectedDepartureTime := test_helpers.AdjustTime(now, "2m").Format(time.RFC3339)
+		expectedDepartureTime := test_helpers.AdjustTime(now, "2m")
 		dep := model.Departure{
-			AimedDepartureTime:    "2019-05-20T12:34:56+01:00",
+			AimedDepartureTime:    test_helpers.ParseTime(t, "2019-05-20T12:34:56+01:00"),
 			ExpectedDepartureTime: &expectedDepartureTime,
 		}
 
-		got, _ := p.transformDepartureTime(now, dep)
+		got := p.transformDepartureTime(now, dep.JourneyType, dep)
 
 		want := "2 mins"
 
@@ -109,13 +110,13 @@ func Test_TransformDepartureTime(t *testing.T) {
 	t.Run("should return `2 mins` if expected departure time is less than three minutes away", func(t *testing.T) {
 		now := time.Now().Truncate(time.Second)
 
-		expectedDepartureTime := test_helpers.AdjustTime(now, "2m59s").Format(time.RFC3339)
+		expectedDepartureTime := test_helpers.AdjustTime(now, "2m59s")
 		dep := model.Departure{
-			AimedDepartureTime:    "2019-05-20T12:34:56+01:00",
+			AimedDepartureTime:    test_helpers.ParseTime(t, "2019-05-20T12:34:56+01:00"),
 			ExpectedDepartureTime: &expectedDepartureTime,
 		}
 
-		got, _ := p.transformDepartureTime(now, dep)
+		got := p.transformDepartureTime(now, dep.JourneyType, dep)
 
 		want := "2 mins"
 
@@ -123,4 +124,82 @@ func Test_TransformDepartureTime(t *testing.T) {
 			t.Errorf("got `%s`, want `%s` for departure time", got, want)
 		}
 	})
+
+	t.Run("should apply the configured display rules", func(t *testing.T) {
+		rules, err := ParseDisplayRules([]byte(`{
+			"default": {"dueLabel": "Due", "maxCountdownMinutes": 60},
+			"journeyTypes": {"train": {"minuteLabel": "minute", "minutesLabel": "minutes"}}
+		}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p := Presenter{
+			Logger:       logger,
+			DisplayRules: rules,
+		}
+
+		now := time.Date(2019, 5, 20, 12, 0, 0, 0, time.UTC)
+
+		tests := []struct {
+			name        string
+			journeyType model.JourneyType
+			expected    string
+			want        string
+		}{
+			{"due", model.Bus, "59s", "Due"},
+			{"countdown", model.Bus, "60m59s", "60 mins"},
+			{"clock time", model.Bus, "61m", "13:01"},
+			{"rail wording", model.Train, "1m30s", "1 minute"},
+			{"rail plural wording", model.Train, "5m", "5 minutes"},
+		}
+
+		for _, tt := range tests {
+			expectedDepartureTime := test_helpers.AdjustTime(now, tt.expected)
+			dep := model.Departure{
+				AimedDepartureTime:    now,
+				ExpectedDepartureTime: &expectedDepartureTime,
+			}
+
+			got := p.transformDepartureTime(now, tt.journeyType, dep)
+
+			if got != tt.want {
+				t.Errorf("%s: got `%s`, want `%s` for departure time", tt.name, got, tt.want)
+			}
+		}
+	})
+}
+
+func Test_IsRealTimeDeparture(t *testing.T) {
+	now := time.Date(2019, 5, 20, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		journeyType model.JourneyType
+		expected    *time.Time
+		status      *string
+		want        bool
+	}{
+		{"bus with an expected time", model.Bus, &now, nil, true},
+		{"bus without an expected time", model.Bus, nil, nil, false},
+		{"train on time", model.Train, nil, aws.String("On time"), true},
+		{"train delayed", model.Train, nil, aws.String("Delayed"), true},
+		{"train with an estimated time", model.Train, nil, aws.String("12:05"), true},
+		{"train cancelled", model.Train, nil, aws.String(model.CancelledStatus), false},
+		{"train without a status", model.Train, nil, nil, false},
+		{"train with an empty status", model.Train, nil, aws.String(""), false},
+	}
+
+	for _, tt := range tests {
+		dep := model.Departure{
+			JourneyType:           tt.journeyType,
+			AimedDepartureTime:    now,
+			ExpectedDepartureTime: tt.expected,
+			DepartureStatus:       tt.status,
+		}
+
+		if got := isRealTimeDeparture(dep); got != tt.want {
+			t.Errorf("%s: got %v, want %v for real-time", tt.name, got, tt.want)
+		}
+	}
 }
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/xml"
+	"github.com/TfGMEnterprise/departures-service/model"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pkg/errors"
+	"regexp"
+	"time"
+)
+
+const siriProducerRef = "TfGM"
+
+// siriResponse renders departures as a SIRI Stop Monitoring delivery
+func (p Presenter) siriResponse(now time.Time, atcocodes []string, deps *model.Internal) (*events.APIGatewayProxyResponse, error) {
+	p.Logger.Debug("siriResponse")
+
+	siri, err := p.transformToSiri(now, atcocodes, deps)
+	if err != nil {
+		return nil, err
+	}
+
+	siriXML, err := xml.Marshal(siri)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal SIRI XML")
+	}
+
+	return &events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers: map[string]string{
+			"content-type": "application/xml",
+		},
+		Body: xml.Header + string(siriXML),
+	}, nil
+}
+
+func (p Presenter) transformToSiri(now time.Time, atcocodes []string, deps *model.Internal) (*model.Siri, error) {
+	p.Logger.Debug("transformToSiri")
+
+	responseTimestamp := now.Truncate(time.Second)
+
+	stopMonitoringDelivery := model.StopMonitoringDelivery{
+		ResponseTimestamp: responseTimestamp,
+		Status:            true,
+	}
+
+	for _, dep := range deps.Departures {
+		monitoringRef := atcocodes[0]
+		if len(atcocodes) > 1 {
+			monitoringRef = dep.LocationAtcocode
+		}
+
+		monitoredStopVisit, err := p.transformToMonitoredStopVisit(now, monitoringRef, dep)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot transform departure `%s` to SIRI", dep.JourneyRef)
+		}
+
+		stopMonitoringDelivery.MonitoredStopVisit = append(stopMonitoringDelivery.MonitoredStopVisit, *monitoredStopVisit)
+	}
+
+	return &model.Siri{
+		ServiceDelivery: model.ServiceDelivery{
+			ResponseTimestamp:      responseTimestamp,
+			ProducerRef:            siriProducerRef,
+			Status:                 true,
+			StopMonitoringDelivery: stopMonitoringDelivery,
+		},
+	}, nil
+}
+
+func (p Presenter) transformToMonitoredStopVisit(now time.Time, monitoringRef string, dep model.Departure) (*model.MonitoredStopVisit, error) {
+	p.Logger.Debugf("transformToMonitoredStopVisit for %s", dep.JourneyRef)
+
+	aimedDepartureTime := dep.AimedDepartureTime
+
+	monitoredCall := model.MonitoredCall{
+		StopPointRef:       dep.LocationAtcocode,
+		AimedDepartureTime: aimedDepartureTime,
+	}
+
+	if dep.ExpectedDepartureTime != nil {
+		monitoredCall.ExpectedDepartureTime = *dep.ExpectedDepartureTime
+	}
+
+	if dep.DepartureStatus != nil {
+		monitoredCall.DepartureStatus = p.transformToSiriDepartureStatus(*dep.DepartureStatus)
+
+		// Rail departure status may be an estimated departure time; one that
+		// cannot be converted is left out rather than failing the response
+		if regexp.MustCompile("^[0-9]{2}:[0-9]{2}$").MatchString(*dep.DepartureStatus) {
+			expectedDepartureTime, err := model.ConvertDepartureTime(&now, aimedDepartureTime.Location(), *dep.DepartureStatus)
+			if err != nil {
+				p.Logger.Printf("cannot convert departure status of `%s` to expected departure time: %v", dep.JourneyRef, err)
+			} else {
+				monitoredCall.ExpectedDepartureTime = *expectedDepartureTime
+			}
+		}
+	}
+
+	if dep.Stand != nil {
+		monitoredCall.DeparturePlatformName = *dep.Stand
+	}
+
+	monitoredStopVisit := model.MonitoredStopVisit{
+		RecordedAtTime: dep.RecordedAtTime,
+		MonitoringRef:  monitoringRef,
+		MonitoredVehicleJourney: model.MonitoredVehicleJourney{
+			LineRef: dep.ServiceNumber,
+			FramedVehicleJourneyRef: model.FramedVehicleJourneyRef{
+				DataFrameRef:           aimedDepartureTime.Format("2006-01-02"),
+				DatedVehicleJourneyRef: dep.JourneyRef,
+			},
+			OperatorRef:     dep.OperatorCode,
+			DestinationRef:  dep.DestinationAtcocode,
+			DestinationName: dep.Destination,
+			Monitored:       !monitoredCall.ExpectedDepartureTime.IsZero(),
+			MonitoredCall:   monitoredCall,
+		},
+		Extensions: model.Extensions{
+			NationalOperatorCode: dep.OperatorCode,
+		},
+	}
+
+	return &monitoredStopVisit, nil
+}
+
+// transformToSiriDepartureStatus converts a National Rail departure status to
+// the equivalent SIRI departure status
+func (p Presenter) transformToSiriDepartureStatus(departureStatus string) string {
+	p.Logger.Debugf("transformToSiriDepartureStatus: %s", departureStatus)
+
+	switch departureStatus {
+	case "On time":
+		return "onTime"
+	case "Delayed":
+		return "delayed"
+	case "Cancelled":
+		return "cancelled"
+	}
+
+	if regexp.MustCompile("^[0-9]{2}:[0-9]{2}$").MatchString(departureStatus) {
+		return "delayed"
+	}
+
+	return "noReport"
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"github.com/TfGMEnterprise/departures-service/dlog"
+	"github.com/TfGMEnterprise/departures-service/model"
+	"github.com/TfGMEnterprise/departures-service/test_helpers"
+	"github.com/aws/aws-sdk-go/aws"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestPresenter_TransformToSiri(t *testing.T) {
+	logger := dlog.NewLogger([]dlog.LoggerOption{
+		dlog.LoggerSetOutput(ioutil.Discard),
+	}...)
+
+	p := Presenter{
+		Logger: logger,
+	}
+
+	loc, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2019, 5, 8, 12, 0, 0, 0, loc)
+
+	t.Run("transforms a real-time bus departure", func(t *testing.T) {
+		deps := model.Internal{
+			Departures: []model.Departure{
+				{
+					RecordedAtTime:        test_helpers.AdjustTime(now, "-10s"),
+					JourneyType:           model.Bus,
+					JourneyRef:            "123_I_2019-05-08_1234",
+					AimedDepartureTime:    test_helpers.AdjustTime(now, "5m"),
+					ExpectedDepartureTime: aws.Time(test_helpers.AdjustTime(now, "6m")),
+					LocationAtcocode:      "1800BNIN0C1",
+					Stand:                 aws.String("C"),
+					DestinationAtcocode:   "1800WA12481",
+					Destination:           "Hobbiton",
+					ServiceNumber:         "123",
+					OperatorCode:          "ANWE",
+				},
+			},
+		}
+
+		got, err := p.transformToSiri(now, []string{"1800BNIN"}, &deps)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !got.ServiceDelivery.Status || !got.ServiceDelivery.StopMonitoringDelivery.Status {
+			t.Error("delivery status should be true")
+		}
+
+		visits := got.ServiceDelivery.StopMonitoringDelivery.MonitoredStopVisit
+		if len(visits) != 1 {
+			t.Fatalf("got %d monitored stop visits, want %d", len(visits), 1)
+		}
+
+		visit := visits[0]
+		test_helpers.AssertString(t, visit.MonitoringRef, "1800BNIN")
+		test_helpers.AssertString(t, visit.MonitoredVehicleJourney.LineRef, "123")
+		test_helpers.AssertString(t, visit.MonitoredVehicleJourney.OperatorRef, "ANWE")
+		test_helpers.AssertString(t, visit.MonitoredVehicleJourney.DestinationName, "Hobbiton")
+		test_helpers.AssertString(t, visit.MonitoredVehicleJourney.FramedVehicleJourneyRef.DatedVehicleJourneyRef, "123_I_2019-05-08_1234")
+		test_helpers.AssertString(t, visit.MonitoredVehicleJourney.MonitoredCall.StopPointRef, "1800BNIN0C1")
+		test_helpers.AssertString(t, visit.MonitoredVehicleJourney.MonitoredCall.DeparturePlatformName, "C")
+		test_helpers.AssertBoolean(t, visit.MonitoredVehicleJourney.Monitored, true)
+
+		if !visit.MonitoredVehicleJourney.MonitoredCall.AimedDepartureTime.Equal(test_helpers.AdjustTime(now, "5m")) {
+			t.Errorf("unexpected aimed departure time: %s", visit.MonitoredVehicleJourney.MonitoredCall.AimedDepartureTime)
+		}
+
+		if !visit.MonitoredVehicleJourney.MonitoredCall.ExpectedDepartureTime.Equal(test_helpers.AdjustTime(now, "6m")) {
+			t.Errorf("unexpected expected departure time: %s", visit.MonitoredVehicleJourney.MonitoredCall.ExpectedDepartureTime)
+		}
+	})
+
+	t.Run("transforms a delayed rail departure", func(t *testing.T) {
+		deps := model.Internal{
+			Departures: []model.Departure{
+				{
+					JourneyType:        model.Train,
+					JourneyRef:         "Service1",
+					AimedDepartureTime: test_helpers.AdjustTime(now, "5m"),
+					DepartureStatus:    aws.String("12:09"),
+					LocationAtcocode:   "9100MNCRPIC",
+					Destination:        "Hobbiton",
+					OperatorCode:       "NT",
+				},
+			},
+		}
+
+		got, err := p.transformToSiri(now, []string{"9100MNCRPIC"}, &deps)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		call := got.ServiceDelivery.StopMonitoringDelivery.MonitoredStopVisit[0].MonitoredVehicleJourney.MonitoredCall
+		test_helpers.AssertString(t, call.DepartureStatus, "delayed")
+
+		if !call.ExpectedDepartureTime.Equal(test_helpers.AdjustTime(now, "9m")) {
+			t.Errorf("unexpected expected departure time: %s", call.ExpectedDepartureTime)
+		}
+	})
+
+	t.Run("leaves out an estimated departure time outside the window", func(t *testing.T) {
+		deps := model.Internal{
+			Departures: []model.Departure{
+				{
+					JourneyType:        model.Train,
+					JourneyRef:         "Service1",
+					AimedDepartureTime: test_helpers.AdjustTime(now, "5m"),
+					DepartureStatus:    aws.String("18:00"),
+					LocationAtcocode:   "9100MNCRPIC",
+					Destination:        "Hobbiton",
+					OperatorCode:       "NT",
+				},
+				{
+					JourneyType:        model.Train,
+					JourneyRef:         "Service2",
+					AimedDepartureTime: test_helpers.AdjustTime(now, "10m"),
+					DepartureStatus:    aws.String("12:12"),
+					LocationAtcocode:   "9100MNCRPIC",
+					Destination:        "Bree",
+					OperatorCode:       "NT",
+				},
+			},
+		}
+
+		got, err := p.transformToSiri(now, []string{"9100MNCRPIC"}, &deps)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		visits := got.ServiceDelivery.StopMonitoringDelivery.MonitoredStopVisit
+		if len(visits) != 2 {
+			t.Fatalf("got %d monitored stop visits, want %d", len(visits), 2)
+		}
+
+		test_helpers.AssertBoolean(t, visits[0].MonitoredVehicleJourney.Monitored, false)
+		test_helpers.AssertBoolean(t, visits[0].MonitoredVehicleJourney.MonitoredCall.ExpectedDepartureTime.IsZero(), true)
+		test_helpers.AssertString(t, visits[0].MonitoredVehicleJourney.MonitoredCall.DepartureStatus, "delayed")
+
+		if !visits[1].MonitoredVehicleJourney.MonitoredCall.ExpectedDepartureTime.Equal(test_helpers.AdjustTime(now, "12m")) {
+			t.Errorf("unexpected expected departure time: %s", visits[1].MonitoredVehicleJourney.MonitoredCall.ExpectedDepartureTime)
+		}
+	})
+
+	t.Run("uses the departure location as the monitoring ref for merged boards", func(t *testing.T) {
+		deps := model.Internal{
+			Departures: []model.Departure{
+				{
+					JourneyRef:         "1",
+					AimedDepartureTime: test_helpers.AdjustTime(now, "5m"),
+					LocationAtcocode:   "1800NE43441",
+				},
+			},
+		}
+
+		got, err := p.transformToSiri(now, []string{"1800NE43431", "1800NE43441"}, &deps)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test_helpers.AssertString(t, got.ServiceDelivery.StopMonitoringDelivery.MonitoredStopVisit[0].MonitoringRef, "1800NE43441")
+	})
+}
+
+func TestPresenter_TransformToSiriDepartureStatus(t *testing.T) {
+	logger := dlog.NewLogger([]dlog.LoggerOption{
+		dlog.LoggerSetOutput(ioutil.Discard),
+	}...)
+
+	p := Presenter{
+		Logger: logger,
+	}
+
+	for departureStatus, want := range map[string]string{
+		"On time":   "onTime",
+		"Delayed":   "delayed",
+		"Cancelled": "cancelled",
+		"15:04":     "delayed",
+		"foo":       "noReport",
+	} {
+		test_helpers.AssertString(t, p.transformToSiriDepartureStatus(departureStatus), want)
+	}
+}
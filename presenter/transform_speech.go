@@ -0,0 +1,166 @@
+package main
+
+import (
+	"github.com/TfGMEnterprise/departures-service/model"
+	"github.com/aws/aws-lambda-go/events"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Abbreviations used in destination names that should be read out in full
+var speechAbbreviations = map[string]string{
+	"ave":  "Avenue",
+	"ctr":  "Centre",
+	"est":  "Estate",
+	"hosp": "Hospital",
+	"int":  "Interchange",
+	"ln":   "Lane",
+	"nr":   "near",
+	"opp":  "opposite",
+	"pk":   "Park",
+	"rd":   "Road",
+	"rly":  "Railway",
+	"sq":   "Square",
+	"stn":  "Station",
+	"univ": "University",
+}
+
+// speechClockFormat is the format clock times are read out in, whatever the
+// display rules for the board
+const speechClockFormat = "15:04"
+
+var speechClockTimeRegexp = regexp.MustCompile("^[0-9]{2}:[0-9]{2}$")
+
+// speechResponse renders departures as natural-language sentences, one per
+// line, for text-to-speech systems
+func (p Presenter) speechResponse(now time.Time, journeyType model.JourneyType, deps *model.Internal) (*events.APIGatewayProxyResponse, error) {
+	p.Logger.Debug("speechResponse")
+
+	sentences := make([]string, 0, len(deps.Departures))
+	for _, dep := range deps.Departures {
+		sentences = append(sentences, p.transformToSpeech(now, journeyType, dep))
+	}
+
+	return &events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers: map[string]string{
+			"content-type": "text/plain; charset=utf-8",
+		},
+		Body: strings.Join(sentences, "\n"),
+	}, nil
+}
+
+// transformToSpeech renders a departure as a sentence; e.g. "The 192 to
+// Hazel Grove departs from stand C in 4 minutes." The sentence is built from
+// the departure times rather than the board as displayed, so that it reads
+// the same whatever the display rules, but a departure is read out as due or
+// counted down when the board shows it so.
+func (p Presenter) transformToSpeech(now time.Time, journeyType model.JourneyType, dep model.Departure) string {
+	p.Logger.Debug("transformToSpeech")
+
+	destination := p.expandAbbreviations(dep.Destination)
+
+	if journeyType == model.Train {
+		return p.transformRailToSpeech(destination, dep)
+	}
+
+	sentence := "The "
+	switch {
+	case dep.ServiceNumber != "":
+		sentence += dep.ServiceNumber + " "
+	case journeyType == model.Tram:
+		sentence += "tram "
+	default:
+		sentence += "bus "
+	}
+
+	// Circular services use the service description as their destination
+	if strings.Contains(strings.ToLower(destination), "circular") {
+		sentence += strings.Replace(destination, " - ", " to ", -1) + " service"
+	} else {
+		sentence += "to " + destination
+	}
+
+	// A cancelled service is read out at its scheduled time
+	if dep.IsCancelled() {
+		return sentence + " at " + dep.AimedDepartureTime.Format(speechClockFormat) + " has been cancelled."
+	}
+
+	from := ""
+	if dep.Stand != nil && *dep.Stand != "" {
+		from = " from " + p.speechStandName(journeyType) + " " + *dep.Stand
+	}
+
+	due, wait, isCountdown := p.countdown(now, journeyType, dep)
+
+	switch {
+	case due:
+		return sentence + " is now departing" + from + "."
+	case isCountdown:
+		unit := "minutes"
+		if wait == 1 {
+			unit = "minute"
+		}
+
+		return sentence + " departs" + from + " in " + strconv.Itoa(wait) + " " + unit + "."
+	}
+
+	depTime, _ := dep.DepartureTime()
+
+	return sentence + " departs" + from + " at " + depTime.Format(speechClockFormat) + "."
+}
+
+// transformRailToSpeech renders a rail departure, which is identified by its
+// scheduled time and described by its departure status
+func (p Presenter) transformRailToSpeech(destination string, dep model.Departure) string {
+	sentence := "The " + dep.AimedDepartureTime.Format(speechClockFormat) + " to " + destination
+
+	from := ""
+	if dep.Stand != nil && *dep.Stand != "" {
+		from = " from platform " + *dep.Stand
+	}
+
+	if dep.DepartureStatus == nil {
+		return sentence + " departs" + from + "."
+	}
+
+	status := *dep.DepartureStatus
+
+	switch {
+	case status == "On time":
+		return sentence + from + " is on time."
+	case status == "Delayed":
+		return sentence + from + " is delayed."
+	case status == "Cancelled":
+		return sentence + " has been cancelled."
+	case speechClockTimeRegexp.MatchString(status):
+		return sentence + from + " is expected at " + status + "."
+	}
+
+	return sentence + from + " is " + strings.ToLower(status) + "."
+}
+
+func (p Presenter) speechStandName(journeyType model.JourneyType) string {
+	if journeyType == model.Bus {
+		return "stand"
+	}
+
+	return "platform"
+}
+
+// expandAbbreviations replaces abbreviated words so that they are read out in
+// full; e.g. "Stockport Stn" becomes "Stockport Station"
+func (p Presenter) expandAbbreviations(text string) string {
+	words := strings.Fields(text)
+
+	for i, word := range words {
+		key := strings.ToLower(strings.TrimSuffix(word, "."))
+		if expansion, exists := speechAbbreviations[key]; exists {
+			words[i] = expansion
+		}
+	}
+
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"github.com/TfGMEnterprise/departures-service/dlog"
+	"github.com/TfGMEnterprise/departures-service/model"
+	"github.com/TfGMEnterprise/departures-service/test_helpers"
+	"github.com/aws/aws-sdk-go/aws"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestPresenter_TransformToSpeech(t *testing.T) {
+	logger := dlog.NewLogger([]dlog.LoggerOption{
+		dlog.LoggerSetOutput(ioutil.Discard),
+	}...)
+
+	now := time.Date(2019, 5, 8, 15, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		journeyType model.JourneyType
+		dep         model.Departure
+		want        string
+	}{
+		{
+			name:        "bus countdown from a stand",
+			journeyType: model.Bus,
+			dep: model.Departure{
+				AimedDepartureTime:    test_helpers.AdjustTime(now, "3m"),
+				ExpectedDepartureTime: aws.Time(test_helpers.AdjustTime(now, "4m10s")),
+				Stand:                 aws.String("C"),
+				ServiceNumber:         "192",
+				Destination:           "Hazel Grove",
+			},
+			want: "The 192 to Hazel Grove departs from stand C in 4 minutes.",
+		},
+		{
+			name:        "bus countdown of one minute without a stand",
+			journeyType: model.Bus,
+			dep: model.Departure{
+				AimedDepartureTime:    test_helpers.AdjustTime(now, "1m"),
+				ExpectedDepartureTime: aws.Time(test_helpers.AdjustTime(now, "1m30s")),
+				ServiceNumber:         "192",
+				Destination:           "Stockport Bus Stn",
+			},
+			want: "The 192 to Stockport Bus Station departs in 1 minute.",
+		},
+		{
+			name:        "bus that is due",
+			journeyType: model.Bus,
+			dep: model.Departure{
+				AimedDepartureTime:    now,
+				ExpectedDepartureTime: aws.Time(test_helpers.AdjustTime(now, "30s")),
+				Stand:                 aws.String("C"),
+				ServiceNumber:         "192",
+				Destination:           "Hazel Grove",
+			},
+			want: "The 192 to Hazel Grove is now departing from stand C.",
+		},
+		{
+			name:        "scheduled circular bus",
+			journeyType: model.Bus,
+			dep: model.Departure{
+				AimedDepartureTime: test_helpers.AdjustTime(now, "4m"),
+				ServiceNumber:      "17",
+				Destination:        "Middleton - Moorclose circular",
+			},
+			want: "The 17 Middleton to Moorclose circular service departs at 15:04.",
+		},
+		{
+			name:        "rail on time",
+			journeyType: model.Train,
+			dep: model.Departure{
+				AimedDepartureTime: test_helpers.AdjustTime(now, "59m"),
+				Stand:              aws.String("1"),
+				Destination:        "Manchester Piccadilly",
+				DepartureStatus:    aws.String("On time"),
+			},
+			want: "The 15:59 to Manchester Piccadilly from platform 1 is on time.",
+		},
+		{
+			name:        "rail delayed",
+			journeyType: model.Train,
+			dep: model.Departure{
+				AimedDepartureTime: test_helpers.AdjustTime(now, "1h1m"),
+				Destination:        "Wigan North Western",
+				DepartureStatus:    aws.String("Delayed"),
+			},
+			want: "The 16:01 to Wigan North Western is delayed.",
+		},
+		{
+			name:        "bus cancelled",
+			journeyType: model.Bus,
+			dep: model.Departure{
+				AimedDepartureTime: test_helpers.AdjustTime(now, "4m"),
+				Stand:              aws.String("C"),
+				ServiceNumber:      "192",
+				Destination:        "Hazel Grove",
+				DepartureStatus:    aws.String(model.CancelledStatus),
+			},
+			want: "The 192 to Hazel Grove at 15:04 has been cancelled.",
+		},
+		{
+			name:        "rail cancelled",
+			journeyType: model.Train,
+			dep: model.Departure{
+				AimedDepartureTime: test_helpers.AdjustTime(now, "1h9m"),
+				Stand:              aws.String("3"),
+				Destination:        "Buxton",
+				DepartureStatus:    aws.String("Cancelled"),
+			},
+			want: "The 16:09 to Buxton has been cancelled.",
+		},
+		{
+			name:        "rail expected time",
+			journeyType: model.Train,
+			dep: model.Departure{
+				AimedDepartureTime: test_helpers.AdjustTime(now, "1h12m"),
+				Stand:              aws.String("4"),
+				Destination:        "Hazel Grove",
+				DepartureStatus:    aws.String("16:17"),
+			},
+			want: "The 16:12 to Hazel Grove from platform 4 is expected at 16:17.",
+		},
+	}
+
+	t.Run("with the default display rules", func(t *testing.T) {
+		p := Presenter{
+			Logger: logger,
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				test_helpers.AssertString(t, p.transformToSpeech(now, tt.journeyType, tt.dep), tt.want)
+			})
+		}
+	})
+
+	t.Run("with configured display rules", func(t *testing.T) {
+		rule := DisplayRule{
+			DueWithinSeconds: 60,
+			DueLabel:         "Due",
+			MinuteLabel:      "m",
+			MinutesLabel:     "m",
+			ClockFormat:      "3:04pm",
+		}
+
+		p := Presenter{
+			Logger: logger,
+			DisplayRules: &DisplayRules{
+				Default:      rule,
+				JourneyTypes: map[model.JourneyType]DisplayRule{},
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				test_helpers.AssertString(t, p.transformToSpeech(now, tt.journeyType, tt.dep), tt.want)
+			})
+		}
+	})
+
+	t.Run("reads out the clock time beyond the countdown", func(t *testing.T) {
+		p := Presenter{
+			Logger: logger,
+			DisplayRules: &DisplayRules{
+				Default: DisplayRule{
+					DueWithinSeconds:    60,
+					DueLabel:            "Due",
+					MaxCountdownMinutes: 10,
+					ClockFormat:         "3:04pm",
+				},
+			},
+		}
+
+		dep := model.Departure{
+			AimedDepartureTime:    test_helpers.AdjustTime(now, "15m"),
+			ExpectedDepartureTime: aws.Time(test_helpers.AdjustTime(now, "16m")),
+			ServiceNumber:         "192",
+			Destination:           "Hazel Grove",
+		}
+
+		test_helpers.AssertString(t, p.transformToSpeech(now, model.Bus, dep), "The 192 to Hazel Grove departs at 15:16.")
+	})
+}
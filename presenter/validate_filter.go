@@ -0,0 +1,29 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// validateServiceNumber allows the separators used in TransXChange line names;
+// e.g. X43/X44 or V1-V2
+func (p *Presenter) validateServiceNumber(serviceNumber string) bool {
+	p.Logger.Debugf("validateServiceNumber: %s", serviceNumber)
+	serviceNumber = strings.ToUpper(serviceNumber)
+	matched, _ := regexp.MatchString(`^[A-Z0-9][A-Z0-9/ -]{0,9}$`, serviceNumber)
+	return matched
+}
+
+func (p *Presenter) validateOperatorCode(operatorCode string) bool {
+	p.Logger.Debugf("validateOperatorCode: %s", operatorCode)
+	operatorCode = strings.ToUpper(operatorCode)
+	matched, _ := regexp.MatchString(`^[A-Z0-9]{2,4}$`, operatorCode)
+	return matched
+}
+
+func (p *Presenter) validateStand(stand string) bool {
+	p.Logger.Debugf("validateStand: %s", stand)
+	stand = strings.ToUpper(stand)
+	matched, _ := regexp.MatchString(`^[A-Z0-9]{1,3}$`, stand)
+	return matched
+}
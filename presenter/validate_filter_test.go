@@ -0,0 +1,148 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"github.com/TfGMEnterprise/departures-service/dlog"
+	"github.com/TfGMEnterprise/departures-service/model"
+	"github.com/TfGMEnterprise/departures-service/test_helpers"
+	"io/ioutil"
+	"testing"
+)
+
+func Test_validateServiceNumber(t *testing.T) {
+	logger := dlog.NewLogger([]dlog.LoggerOption{
+		dlog.LoggerSetOutput(ioutil.Discard),
+	}...)
+
+	p := Presenter{
+		Logger: logger,
+	}
+
+	t.Run("valid numeric service number", func(t *testing.T) {
+		got := p.validateServiceNumber("192")
+		test_helpers.AssertBoolean(t, got, true)
+	})
+
+	t.Run("valid service number with prefix and suffix", func(t *testing.T) {
+		got := p.validateServiceNumber("x50a")
+		test_helpers.AssertBoolean(t, got, true)
+	})
+
+	t.Run("invalid empty service number", func(t *testing.T) {
+		got := p.validateServiceNumber("")
+		test_helpers.AssertBoolean(t, got, false)
+	})
+
+	t.Run("valid service numbers with separators", func(t *testing.T) {
+		for _, serviceNumber := range []string{"12/13", "X43/X44", "V1-V2", "n 1"} {
+			got := p.validateServiceNumber(serviceNumber)
+			test_helpers.AssertBoolean(t, got, true)
+		}
+	})
+
+	t.Run("valid TransXChange line names", func(t *testing.T) {
+		r, err := zip.OpenReader("../test_resources/txc.zip")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+
+		for _, f := range r.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := ioutil.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			txc := model.TransXChange{}
+			if err := xml.Unmarshal(data, &txc); err != nil {
+				t.Fatalf("cannot unmarshal %s: %v", f.Name, err)
+			}
+
+			for _, service := range txc.Services.Service {
+				for _, line := range service.Lines.Line {
+					if !p.validateServiceNumber(line.LineName) {
+						t.Errorf("line name `%s` in %s is not a valid service number", line.LineName, f.Name)
+					}
+				}
+			}
+		}
+	})
+
+	t.Run("invalid service number", func(t *testing.T) {
+		got := p.validateServiceNumber("1;2")
+		test_helpers.AssertBoolean(t, got, false)
+	})
+
+	t.Run("invalid service number starting with a separator", func(t *testing.T) {
+		for _, serviceNumber := range []string{"/12", "-12", " 12"} {
+			got := p.validateServiceNumber(serviceNumber)
+			test_helpers.AssertBoolean(t, got, false)
+		}
+	})
+
+	t.Run("invalid long service number", func(t *testing.T) {
+		got := p.validateServiceNumber("X43/X44/X45")
+		test_helpers.AssertBoolean(t, got, false)
+	})
+}
+
+func Test_validateOperatorCode(t *testing.T) {
+	logger := dlog.NewLogger([]dlog.LoggerOption{
+		dlog.LoggerSetOutput(ioutil.Discard),
+	}...)
+
+	p := Presenter{
+		Logger: logger,
+	}
+
+	t.Run("valid national operator code", func(t *testing.T) {
+		got := p.validateOperatorCode("ANWE")
+		test_helpers.AssertBoolean(t, got, true)
+	})
+
+	t.Run("valid rail operator code", func(t *testing.T) {
+		got := p.validateOperatorCode("nt")
+		test_helpers.AssertBoolean(t, got, true)
+	})
+
+	t.Run("invalid operator code", func(t *testing.T) {
+		got := p.validateOperatorCode("FOOBAR")
+		test_helpers.AssertBoolean(t, got, false)
+	})
+}
+
+func Test_validateStand(t *testing.T) {
+	logger := dlog.NewLogger([]dlog.LoggerOption{
+		dlog.LoggerSetOutput(ioutil.Discard),
+	}...)
+
+	p := Presenter{
+		Logger: logger,
+	}
+
+	t.Run("valid bus station stand", func(t *testing.T) {
+		got := p.validateStand("c")
+		test_helpers.AssertBoolean(t, got, true)
+	})
+
+	t.Run("valid rail platform", func(t *testing.T) {
+		got := p.validateStand("13A")
+		test_helpers.AssertBoolean(t, got, true)
+	})
+
+	t.Run("invalid stand", func(t *testing.T) {
+		got := p.validateStand("Stand A")
+		test_helpers.AssertBoolean(t, got, false)
+	})
+}
@@ -84,9 +84,11 @@ func (nre NREPoller) Handler(railStation RailStation) error {
 		Crs: &crs,
 	}
 
-	departureBoard, err := nre.Service.GetDepartureBoard(&req)
+	// The arrivals and departures board includes services that terminate at
+	// the station, which only have an arrival time
+	departureBoard, err := nre.Service.GetArrivalDepartureBoard(&req)
 	if err != nil {
-		return errors.Wrapf(err, "cannot get departure board for %s", railStation.CRSCode)
+		return errors.Wrapf(err, "cannot get arrival and departure board for %s", railStation.CRSCode)
 	}
 
 	departuresJSON, err := json.Marshal(&departureBoard.GetStationBoardResult)
@@ -226,7 +226,7 @@ type MockNREService struct {
 	nationalrail.LDBServiceSoap
 }
 
-func (nre MockNREService) GetDepartureBoard(request *nationalrail.GetBoardRequestParams) (*nationalrail.StationBoardResponseType, error) {
+func (nre MockNREService) GetArrivalDepartureBoard(request *nationalrail.GetBoardRequestParams) (*nationalrail.StationBoardResponseType, error) {
 	if *request.Crs == "HOB" {
 		return HappyRailStationResponse, nil
 	}
@@ -13,15 +13,31 @@ import (
 	"github.com/pkg/errors"
 	"log"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
+const (
+	// producerName identifies the rail ingester in the envelope of each cached
+	// departure
+	producerName = "rail-ingester"
+
+	// sourceFeed identifies the National Rail OpenLDBWS feed in the envelope of
+	// each cached departure
+	sourceFeed = "nationalrail-ldbws"
+)
+
 type RailIngester struct {
 	Logger         *dlog.Logger
 	DeparturesPool *redis.Pool
 	TimeLocation   *time.Location
+	// DepartureTimeWindow bounds the scheduled departure times read from a
+	// station board; model.DefaultDepartureTimeWindow is used if it is not set
+	DepartureTimeWindow *model.DepartureTimeWindow
+	// Clock returns the current time; time.Now is used if it is not set
+	Clock func() time.Time
 }
 
 func main() {
@@ -51,10 +67,32 @@ func main() {
 		logger.Fatal("cannot load time location for Europe/London")
 	}
 
+	departureTimeWindow := model.DefaultDepartureTimeWindow
+
+	timeWindowStr, exists := os.LookupEnv("NRE_TIME_WINDOW")
+	if exists && timeWindowStr != "" {
+		timeWindow, err := strconv.Atoi(timeWindowStr)
+		if err != nil {
+			logger.Fatal("NRE_TIME_WINDOW value is invalid")
+		}
+
+		if timeWindow <= 0 {
+			logger.Fatal("NRE_TIME_WINDOW value must be greater than 0")
+		}
+
+		departureTimeWindow.Future = time.Duration(timeWindow) * time.Minute
+
+		if departureTimeWindow.Past+departureTimeWindow.Future >= 24*time.Hour {
+			logger.Fatal("NRE_TIME_WINDOW value must be less than 1320")
+		}
+	}
+
 	in := RailIngester{
-		Logger:         logger,
-		DeparturesPool: repository.NewRedisPool(departuresPoolOptions...),
-		TimeLocation:   timeLocation,
+		Logger:              logger,
+		DeparturesPool:      repository.NewRedisPool(departuresPoolOptions...),
+		TimeLocation:        timeLocation,
+		DepartureTimeWindow: &departureTimeWindow,
+		Clock:               time.Now,
 	}
 
 	defer func() {
@@ -69,6 +107,24 @@ func main() {
 	lambda.Start(in.Handler)
 }
 
+// now returns the current time from the rail ingester clock
+func (in *RailIngester) now() time.Time {
+	if in.Clock == nil {
+		return time.Now()
+	}
+
+	return in.Clock()
+}
+
+// departureTimeWindow returns the window used to read scheduled departure times
+func (in *RailIngester) departureTimeWindow() model.DepartureTimeWindow {
+	if in.DepartureTimeWindow == nil {
+		return model.DefaultDepartureTimeWindow
+	}
+
+	return *in.DepartureTimeWindow
+}
+
 func (in *RailIngester) Handler(event events.SNSEvent) error {
 	in.Logger.Debug("Handler")
 
@@ -134,22 +190,29 @@ func (in *RailIngester) processRecords(exitImmediately <-chan struct{}, wg *sync
 	}
 
 	// Transform station board into our internal departures model
-	departures, err := in.transformToInternalModel(time.Now(), in.TimeLocation, &stationBoard, atcocode)
+	departures, err := in.transformToInternalModel(in.now(), in.TimeLocation, &stationBoard, atcocode)
 	if err != nil {
 		errs <- errors.Wrapf(err, "could not transform response for %s", crs)
 		return
 	}
 
-	// Remove any departures that have expired
-	if err := in.removeExpiredDepartures(time.Now(), departures); err != nil {
-		errs <- errors.Wrap(err, "could not remove expired departures from event data")
-		return
-	}
+	// Cache the departures and arrivals boards for the station; services that
+	// call at the station appear on both
+	for _, board := range []model.BoardType{model.DeparturesBoard, model.ArrivalsBoard} {
+		boardDepartures := model.Internal{Departures: board.Filter(departures.Departures)}
 
-	// Cache departures for the station
-	if err := in.updateCachedData(atcocode, departures); err != nil {
-		errs <- errors.Wrap(err, "could not update cached data")
-		return
+		// Remove any departures that have expired
+		if err := in.removeExpiredDepartures(in.now(), &boardDepartures, board); err != nil {
+			errs <- errors.Wrap(err, "could not remove expired departures from event data")
+			return
+		}
+
+		board.Sort(boardDepartures.Departures)
+
+		if err := in.updateCachedData(board.Key(atcocode), &boardDepartures); err != nil {
+			errs <- errors.Wrapf(err, "could not update cached %s", board)
+			return
+		}
 	}
 
 	select {
@@ -164,65 +227,115 @@ func (in *RailIngester) processRecords(exitImmediately <-chan struct{}, wg *sync
 func (in *RailIngester) transformToInternalModel(now time.Time, localLocation *time.Location, stationBoard *nationalrail.StationBoard, locationAtcocode string) (*model.Internal, error) {
 	in.Logger.Debug("transformToInternalModel")
 
-	platformAvailable := stationBoard.PlatformAvailable
-
 	departures := model.Internal{}
 
 	if stationBoard.TrainServices != nil {
 		for _, service := range stationBoard.TrainServices.Service {
-			if service.ServiceID == nil {
-				return nil, errors.New("ServiceID value is missing")
+			departure, err := in.transformService(now, localLocation, stationBoard, service, locationAtcocode)
+			if err != nil {
+				in.Logger.Printf("quarantined service at location `%s`: %v", locationAtcocode, err)
+				continue
 			}
 
-			if service.Std == nil {
-				return nil, fmt.Errorf("Std value is missing for %s", string(*service.ServiceID))
-			}
+			departures.Departures = append(departures.Departures, *departure)
+		}
+	}
 
-			if service.Etd == nil {
-				return nil, fmt.Errorf("Etd value is missing for %s", string(*service.ServiceID))
-			}
+	in.quarantineInvalidDepartures(&departures)
 
-			if service.Destination == nil {
-				return nil, fmt.Errorf("Destination is missing for %s", string(*service.ServiceID))
-			}
+	return &departures, nil
+}
 
-			if service.OperatorCode == nil {
-				return nil, fmt.Errorf("OperatorCode is missing for %s", string(*service.ServiceID))
-			}
+func (in *RailIngester) transformService(now time.Time, localLocation *time.Location, stationBoard *nationalrail.StationBoard, service *nationalrail.ServiceItem, locationAtcocode string) (*model.Departure, error) {
+	if service.ServiceID == nil {
+		return nil, errors.New("ServiceID value is missing")
+	}
 
-			aimedDepartureTime, err := model.ConvertDepartureTime(&now, localLocation, string(*service.Std))
-			if err != nil {
-				return nil, errors.Wrapf(err, "cannot read departure time for %s", string(*service.ServiceID))
-			}
+	// A service that terminates at the station has no departure time, and
+	// one that starts there has no arrival time
+	if service.Std == nil && service.Sta == nil {
+		return nil, fmt.Errorf("Std and Sta values are missing for %s", string(*service.ServiceID))
+	}
 
-			destination, err := in.convertDestination(service.Destination)
-			if err != nil {
-				return nil, errors.Wrapf(err, "cannot read destination for %s", string(*service.ServiceID))
-			}
+	if service.Std != nil && service.Etd == nil {
+		return nil, fmt.Errorf("Etd value is missing for %s", string(*service.ServiceID))
+	}
 
-			departureStatus := string(*service.Etd)
-
-			departure := model.Departure{
-				RecordedAtTime:     stationBoard.GeneratedAt.Format(time.RFC3339),
-				JourneyType:        model.Train,
-				JourneyRef:         string(*service.ServiceID),
-				AimedDepartureTime: aimedDepartureTime.Format(time.RFC3339),
-				DepartureStatus:    &departureStatus,
-				LocationAtcocode:   locationAtcocode,
-				Destination:        *destination,
-				OperatorCode:       string(*service.OperatorCode),
-			}
+	if service.Sta != nil && service.Eta == nil {
+		return nil, fmt.Errorf("Eta value is missing for %s", string(*service.ServiceID))
+	}
 
-			if platformAvailable && service.Platform != nil {
-				platform := string(*service.Platform)
-				departure.Stand = &platform
-			}
+	if service.Destination == nil {
+		return nil, fmt.Errorf("Destination is missing for %s", string(*service.ServiceID))
+	}
+
+	if service.OperatorCode == nil {
+		return nil, fmt.Errorf("OperatorCode is missing for %s", string(*service.ServiceID))
+	}
+
+	destination, err := in.convertDestination(service.Destination)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot read destination for %s", string(*service.ServiceID))
+	}
+
+	departure := model.Departure{
+		RecordedAtTime:   stationBoard.GeneratedAt,
+		JourneyType:      model.Train,
+		JourneyRef:       string(*service.ServiceID),
+		LocationAtcocode: locationAtcocode,
+		Destination:      *destination,
+		OperatorCode:     string(*service.OperatorCode),
+	}
+
+	if service.Std != nil {
+		aimedDepartureTime, err := model.ConvertDepartureTimeWithin(now, localLocation, string(*service.Std), in.departureTimeWindow())
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot read departure time for %s", string(*service.ServiceID))
+		}
+
+		departureStatus := string(*service.Etd)
 
-			departures.Departures = append(departures.Departures, departure)
+		departure.AimedDepartureTime = *aimedDepartureTime
+		departure.DepartureStatus = &departureStatus
+	}
+
+	if service.Sta != nil {
+		aimedArrivalTime, err := model.ConvertDepartureTimeWithin(now, localLocation, string(*service.Sta), in.departureTimeWindow())
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot read arrival time for %s", string(*service.ServiceID))
 		}
+
+		arrivalStatus := string(*service.Eta)
+
+		departure.AimedArrivalTime = *aimedArrivalTime
+		departure.ArrivalStatus = &arrivalStatus
 	}
 
-	return &departures, nil
+	if service.Origin != nil {
+		origin, err := in.convertDestination(service.Origin)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot read origin for %s", string(*service.ServiceID))
+		}
+
+		departure.Origin = *origin
+	}
+
+	if stationBoard.PlatformAvailable && service.Platform != nil {
+		platform := string(*service.Platform)
+		departure.Stand = &platform
+	}
+
+	return &departure, nil
+}
+
+// quarantineInvalidDepartures removes and logs any departures that fail
+// validation so that a single malformed service cannot fail the whole board
+func (in *RailIngester) quarantineInvalidDepartures(departures *model.Internal) {
+	in.Logger.Debug("quarantineInvalidDepartures")
+
+	for _, err := range departures.RemoveInvalidDepartures() {
+		in.Logger.Printf("quarantined departure: %v", err)
+	}
 }
 
 func (in *RailIngester) convertDestination(locations *nationalrail.ArrayOfServiceLocations) (*string, error) {
@@ -246,12 +359,14 @@ func (in *RailIngester) convertDestination(locations *nationalrail.ArrayOfServic
 	return &combined, nil
 }
 
-func (in *RailIngester) removeExpiredDepartures(now time.Time, departures *model.Internal) error {
+// removeExpiredDepartures removes the departures whose time on the board has
+// passed; on the arrivals board, this is the arrival time
+func (in *RailIngester) removeExpiredDepartures(now time.Time, departures *model.Internal, board model.BoardType) error {
 	in.Logger.Debug("removeExpiredDepartures")
 
 	i := 0
 	for _, departure := range departures.Departures {
-		if departure.IsExpired(now) {
+		if board.IsExpired(departure, now) {
 			continue
 		}
 
@@ -293,8 +408,10 @@ func (in *RailIngester) updateCachedData(locationAtcocode string, departures *mo
 
 	args[0] = locationAtcocode
 
+	envelope := model.NewEnvelope(producerName, sourceFeed, in.now(), "")
+
 	for i, departure := range departures.Departures {
-		departureJSON, err := json.Marshal(departure)
+		departureJSON, err := model.EncodeCachedDeparture(envelope, departure)
 		if err != nil {
 			return errors.Wrapf(err, "cannot marshal JSON for departure `%s` at location `%s`", departure.JourneyRef, locationAtcocode)
 		}
@@ -24,6 +24,9 @@ const (
 var (
 	locLondon, _ = time.LoadLocation("Europe/Paris")
 	now          = time.Now().In(locLondon)
+
+	// cacheEnvelope is the envelope expected on departures the rail ingester caches
+	cacheEnvelope = model.NewEnvelope(producerName, sourceFeed, now, "")
 )
 
 func buildSnsEvent(t *testing.T, stationBoard *nationalrail.StationBoard) events.SNSEvent {
@@ -147,11 +150,11 @@ func TestRailngester_Handler(t *testing.T) {
 			},
 		}
 
-		expectation1, err := json.Marshal(model.Departure{
-			RecordedAtTime:     now.Format(time.RFC3339),
+		expectation1, err := model.EncodeCachedDeparture(cacheEnvelope, model.Departure{
+			RecordedAtTime:     now,
 			JourneyType:        model.Train,
 			JourneyRef:         "Service1",
-			AimedDepartureTime: test_helpers.AdjustTime(now, "2m").Truncate(time.Minute).Format(time.RFC3339),
+			AimedDepartureTime: test_helpers.AdjustTime(now, "2m").Truncate(time.Minute),
 			DepartureStatus:    aws.String("On time"),
 			LocationAtcocode:   locationAtcocode,
 			Stand:              aws.String("14"),
@@ -162,11 +165,11 @@ func TestRailngester_Handler(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		expectation2, err := json.Marshal(model.Departure{
-			RecordedAtTime:     now.Format(time.RFC3339),
+		expectation2, err := model.EncodeCachedDeparture(cacheEnvelope, model.Departure{
+			RecordedAtTime:     now,
 			JourneyType:        model.Train,
 			JourneyRef:         "Service2",
-			AimedDepartureTime: test_helpers.AdjustTime(now, "8m").Truncate(time.Minute).Format(time.RFC3339),
+			AimedDepartureTime: test_helpers.AdjustTime(now, "8m").Truncate(time.Minute),
 			DepartureStatus:    aws.String("Delayed"),
 			LocationAtcocode:   locationAtcocode,
 			Stand:              aws.String("13"),
@@ -193,6 +196,7 @@ func TestRailngester_Handler(t *testing.T) {
 				}),
 			}...),
 			TimeLocation: locLondon,
+			Clock:        func() time.Time { return now },
 		}
 
 		event := buildSnsEvent(t, &stationBoard)
@@ -260,10 +264,10 @@ func TestRailngester_Handler(t *testing.T) {
 		}
 
 		seed1, err := json.Marshal(model.Departure{
-			RecordedAtTime:     now.Format(time.RFC3339),
+			RecordedAtTime:     now,
 			JourneyType:        model.Train,
 			JourneyRef:         "Service1",
-			AimedDepartureTime: test_helpers.AdjustTime(now, "2m").Truncate(time.Minute).Format(time.RFC3339),
+			AimedDepartureTime: test_helpers.AdjustTime(now, "2m").Truncate(time.Minute),
 			DepartureStatus:    aws.String("On time"),
 			LocationAtcocode:   locationAtcocode,
 			Stand:              aws.String("14"),
@@ -275,10 +279,10 @@ func TestRailngester_Handler(t *testing.T) {
 		}
 
 		seed2, err := json.Marshal(model.Departure{
-			RecordedAtTime:     now.Format(time.RFC3339),
+			RecordedAtTime:     now,
 			JourneyType:        model.Train,
 			JourneyRef:         "Service2",
-			AimedDepartureTime: test_helpers.AdjustTime(now, "8m").Truncate(time.Minute).Format(time.RFC3339),
+			AimedDepartureTime: test_helpers.AdjustTime(now, "8m").Truncate(time.Minute),
 			DepartureStatus:    aws.String("Delayed"),
 			Stand:              aws.String("13"),
 			LocationAtcocode:   locationAtcocode,
@@ -289,11 +293,11 @@ func TestRailngester_Handler(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		expectation1, err := json.Marshal(model.Departure{
-			RecordedAtTime:     now.Format(time.RFC3339),
+		expectation1, err := model.EncodeCachedDeparture(cacheEnvelope, model.Departure{
+			RecordedAtTime:     now,
 			JourneyType:        model.Train,
 			JourneyRef:         "Service1",
-			AimedDepartureTime: test_helpers.AdjustTime(now, "2m").Truncate(time.Minute).Format(time.RFC3339),
+			AimedDepartureTime: test_helpers.AdjustTime(now, "2m").Truncate(time.Minute),
 			DepartureStatus:    aws.String(test_helpers.AdjustTime(now, "5m").Format("15:04")),
 			LocationAtcocode:   locationAtcocode,
 			Stand:              aws.String("14"),
@@ -304,11 +308,11 @@ func TestRailngester_Handler(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		expectation2, err := json.Marshal(model.Departure{
-			RecordedAtTime:     now.Format(time.RFC3339),
+		expectation2, err := model.EncodeCachedDeparture(cacheEnvelope, model.Departure{
+			RecordedAtTime:     now,
 			JourneyType:        model.Train,
 			JourneyRef:         "Service2",
-			AimedDepartureTime: test_helpers.AdjustTime(now, "8m").Truncate(time.Minute).Format(time.RFC3339),
+			AimedDepartureTime: test_helpers.AdjustTime(now, "8m").Truncate(time.Minute),
 			DepartureStatus:    aws.String("Cancelled"),
 			LocationAtcocode:   locationAtcocode,
 			Destination:        "Minas Tirith + Isengard via Hobbiton",
@@ -338,6 +342,7 @@ func TestRailngester_Handler(t *testing.T) {
 				}),
 			}...),
 			TimeLocation: locLondon,
+			Clock:        func() time.Time { return now },
 		}
 
 		event := buildSnsEvent(t, &stationBoard)
@@ -383,10 +388,10 @@ func TestRailngester_Handler(t *testing.T) {
 		}
 
 		seed1, err := json.Marshal(model.Departure{
-			RecordedAtTime:     now.Format(time.RFC3339),
+			RecordedAtTime:     now,
 			JourneyType:        model.Train,
 			JourneyRef:         "Service0",
-			AimedDepartureTime: test_helpers.AdjustTime(now, "-2m").Truncate(time.Minute).Format(time.RFC3339),
+			AimedDepartureTime: test_helpers.AdjustTime(now, "-2m").Truncate(time.Minute),
 			DepartureStatus:    aws.String("On time"),
 			LocationAtcocode:   locationAtcocode,
 			Stand:              aws.String("13"),
@@ -397,11 +402,11 @@ func TestRailngester_Handler(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		expectation1, err := json.Marshal(model.Departure{
-			RecordedAtTime:     now.Format(time.RFC3339),
+		expectation1, err := model.EncodeCachedDeparture(cacheEnvelope, model.Departure{
+			RecordedAtTime:     now,
 			JourneyType:        model.Train,
 			JourneyRef:         "Service1",
-			AimedDepartureTime: test_helpers.AdjustTime(now, "2m").Truncate(time.Minute).Format(time.RFC3339),
+			AimedDepartureTime: test_helpers.AdjustTime(now, "2m").Truncate(time.Minute),
 			DepartureStatus:    aws.String("On time"),
 			LocationAtcocode:   locationAtcocode,
 			Stand:              aws.String("14"),
@@ -432,6 +437,7 @@ func TestRailngester_Handler(t *testing.T) {
 				}),
 			}...),
 			TimeLocation: locLondon,
+			Clock:        func() time.Time { return now },
 		}
 
 		event := buildSnsEvent(t, &stationBoard)
@@ -499,11 +505,11 @@ func TestRailngester_Handler(t *testing.T) {
 			},
 		}
 
-		expectation1, err := json.Marshal(model.Departure{
-			RecordedAtTime:     now.Format(time.RFC3339),
+		expectation1, err := model.EncodeCachedDeparture(cacheEnvelope, model.Departure{
+			RecordedAtTime:     now,
 			JourneyType:        model.Train,
 			JourneyRef:         "Service2",
-			AimedDepartureTime: test_helpers.AdjustTime(now, "8m").Truncate(time.Minute).Format(time.RFC3339),
+			AimedDepartureTime: test_helpers.AdjustTime(now, "8m").Truncate(time.Minute),
 			DepartureStatus:    aws.String("Delayed"),
 			LocationAtcocode:   locationAtcocode,
 			Stand:              aws.String("13"),
@@ -530,6 +536,7 @@ func TestRailngester_Handler(t *testing.T) {
 				}),
 			}...),
 			TimeLocation: locLondon,
+			Clock:        func() time.Time { return now },
 		}
 
 		event := buildSnsEvent(t, &stationBoard)
@@ -590,6 +597,7 @@ func TestRailngester_Handler(t *testing.T) {
 				}),
 			}...),
 			TimeLocation: locLondon,
+			Clock:        func() time.Time { return now },
 		}
 
 		event := buildSnsEvent(t, &stationBoard)
@@ -624,6 +632,227 @@ func TestRailngester_Handler(t *testing.T) {
 				}),
 			}...),
 			TimeLocation: locLondon,
+			Clock:        func() time.Time { return now },
+		}
+
+		event := buildSnsEvent(t, &stationBoard)
+
+		if err := in.Handler(event); err != nil {
+			t.Error(err)
+			return
+		}
+	})
+
+	t.Run("quarantines malformed services without failing the board", func(t *testing.T) {
+		stationBoard := nationalrail.StationBoard{
+			BaseStationBoard: &nationalrail.BaseStationBoard{
+				GeneratedAt:       now,
+				Crs:               createCRSType("MAN"),
+				PlatformAvailable: true,
+			},
+			TrainServices: &nationalrail.ArrayOfServiceItems{
+				Service: []*nationalrail.ServiceItem{
+					{
+						BaseServiceItem: &nationalrail.BaseServiceItem{
+							Std:          createTimeType(test_helpers.AdjustTime(now, "2m").Format("15:04")),
+							Platform:     createPlatformType("14"),
+							Operator:     createTOCName("Sauron Rail"),
+							OperatorCode: createTOCCode("SR"),
+							ServiceID:    createServiceIDType("Service1"),
+						},
+						Destination: &nationalrail.ArrayOfServiceLocations{
+							Location: []*nationalrail.ServiceLocation{
+								{
+									LocationName: createLocationNameType("Mordor"),
+									Crs:          createCRSType("MDR"),
+								},
+							},
+						},
+					},
+					{
+						BaseServiceItem: &nationalrail.BaseServiceItem{
+							Std:          createTimeType(test_helpers.AdjustTime(now, "8m").Format("15:04")),
+							Etd:          createTimeType("On time"),
+							Platform:     createPlatformType("13"),
+							Operator:     createTOCName("Sauron Rail"),
+							OperatorCode: createTOCCode("SR"),
+							ServiceID:    createServiceIDType("Service2"),
+						},
+						Destination: &nationalrail.ArrayOfServiceLocations{
+							Location: []*nationalrail.ServiceLocation{
+								{
+									LocationName: createLocationNameType("Minas Tirith"),
+									Crs:          createCRSType("MNT"),
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+
+		expectation, err := model.EncodeCachedDeparture(cacheEnvelope, model.Departure{
+			RecordedAtTime:     now,
+			JourneyType:        model.Train,
+			JourneyRef:         "Service2",
+			AimedDepartureTime: test_helpers.AdjustTime(now, "8m").Truncate(time.Minute),
+			DepartureStatus:    aws.String("On time"),
+			LocationAtcocode:   locationAtcocode,
+			Stand:              aws.String("13"),
+			Destination:        "Minas Tirith",
+			OperatorCode:       "SR",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		departuresDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer departuresDB.Close()
+
+		in := RailIngester{
+			Logger: dlog.NewLogger([]dlog.LoggerOption{
+				dlog.LoggerSetOutput(ioutil.Discard),
+			}...),
+			DeparturesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", departuresDB.Addr())
+				}),
+			}...),
+			TimeLocation: locLondon,
+			Clock:        func() time.Time { return now },
+		}
+
+		event := buildSnsEvent(t, &stationBoard)
+
+		if err := in.Handler(event); err != nil {
+			t.Error(err)
+			return
+		}
+
+		departuresDB.CheckList(t, locationAtcocode, string(expectation))
+	})
+
+	t.Run("caches arrivals under a separate key", func(t *testing.T) {
+		stationBoard := nationalrail.StationBoard{
+			BaseStationBoard: &nationalrail.BaseStationBoard{
+				GeneratedAt:       now,
+				Crs:               createCRSType("MAN"),
+				PlatformAvailable: true,
+			},
+			TrainServices: &nationalrail.ArrayOfServiceItems{
+				Service: []*nationalrail.ServiceItem{
+					{
+						BaseServiceItem: &nationalrail.BaseServiceItem{
+							Sta:          createTimeType(test_helpers.AdjustTime(now, "5m").Format("15:04")),
+							Eta:          createTimeType("On time"),
+							Platform:     createPlatformType("14"),
+							Operator:     createTOCName("Sauron Rail"),
+							OperatorCode: createTOCCode("SR"),
+							ServiceID:    createServiceIDType("Service1"),
+						},
+						Origin: &nationalrail.ArrayOfServiceLocations{
+							Location: []*nationalrail.ServiceLocation{
+								{
+									LocationName: createLocationNameType("Rivendell"),
+									Crs:          createCRSType("RVD"),
+								},
+							},
+						},
+						Destination: &nationalrail.ArrayOfServiceLocations{
+							Location: []*nationalrail.ServiceLocation{
+								{
+									LocationName: createLocationNameType("Manchester Piccadilly"),
+									Crs:          createCRSType("MAN"),
+								},
+							},
+						},
+					},
+					{
+						BaseServiceItem: &nationalrail.BaseServiceItem{
+							Sta:          createTimeType(test_helpers.AdjustTime(now, "2m").Format("15:04")),
+							Eta:          createTimeType("On time"),
+							Std:          createTimeType(test_helpers.AdjustTime(now, "4m").Format("15:04")),
+							Etd:          createTimeType("Delayed"),
+							Platform:     createPlatformType("13"),
+							Operator:     createTOCName("Sauron Rail"),
+							OperatorCode: createTOCCode("SR"),
+							ServiceID:    createServiceIDType("Service2"),
+						},
+						Origin: &nationalrail.ArrayOfServiceLocations{
+							Location: []*nationalrail.ServiceLocation{
+								{
+									LocationName: createLocationNameType("Bree"),
+									Crs:          createCRSType("BRE"),
+								},
+							},
+						},
+						Destination: &nationalrail.ArrayOfServiceLocations{
+							Location: []*nationalrail.ServiceLocation{
+								{
+									LocationName: createLocationNameType("Mordor"),
+									Crs:          createCRSType("MDR"),
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+
+		terminatingExpectation, err := model.EncodeCachedDeparture(cacheEnvelope, model.Departure{
+			RecordedAtTime:   now,
+			JourneyType:      model.Train,
+			JourneyRef:       "Service1",
+			AimedArrivalTime: test_helpers.AdjustTime(now, "5m").Truncate(time.Minute),
+			ArrivalStatus:    aws.String("On time"),
+			LocationAtcocode: locationAtcocode,
+			Stand:            aws.String("14"),
+			Origin:           "Rivendell",
+			Destination:      "Manchester Piccadilly",
+			OperatorCode:     "SR",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		callingAtExpectation, err := model.EncodeCachedDeparture(cacheEnvelope, model.Departure{
+			RecordedAtTime:     now,
+			JourneyType:        model.Train,
+			JourneyRef:         "Service2",
+			AimedDepartureTime: test_helpers.AdjustTime(now, "4m").Truncate(time.Minute),
+			DepartureStatus:    aws.String("Delayed"),
+			AimedArrivalTime:   test_helpers.AdjustTime(now, "2m").Truncate(time.Minute),
+			ArrivalStatus:      aws.String("On time"),
+			LocationAtcocode:   locationAtcocode,
+			Stand:              aws.String("13"),
+			Origin:             "Bree",
+			Destination:        "Mordor",
+			OperatorCode:       "SR",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		departuresDB, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer departuresDB.Close()
+
+		in := RailIngester{
+			Logger: dlog.NewLogger([]dlog.LoggerOption{
+				dlog.LoggerSetOutput(ioutil.Discard),
+			}...),
+			DeparturesPool: repository.NewRedisPool([]repository.RedisPoolOption{
+				repository.RedisPoolDial(func() (redis.Conn, error) {
+					return redis.Dial("tcp", departuresDB.Addr())
+				}),
+			}...),
+			TimeLocation: locLondon,
+			Clock:        func() time.Time { return now },
 		}
 
 		event := buildSnsEvent(t, &stationBoard)
@@ -632,6 +861,9 @@ func TestRailngester_Handler(t *testing.T) {
 			t.Error(err)
 			return
 		}
+
+		departuresDB.CheckList(t, locationAtcocode, string(callingAtExpectation))
+		departuresDB.CheckList(t, model.ArrivalsKeyPrefix+locationAtcocode, string(callingAtExpectation), string(terminatingExpectation))
 	})
 }
 
@@ -770,30 +1002,30 @@ func TestNREPoller_removeExpiredDepartures(t *testing.T) {
 		departures := model.Internal{
 			Departures: []model.Departure{
 				{
-					RecordedAtTime:     now.Format(time.RFC3339),
+					RecordedAtTime:     now,
 					JourneyType:        model.Train,
 					JourneyRef:         "Service1",
-					AimedDepartureTime: test_helpers.AdjustTime(now, "-1m").Truncate(time.Minute).Format(time.RFC3339),
+					AimedDepartureTime: test_helpers.AdjustTime(now, "-1m").Truncate(time.Minute),
 					DepartureStatus:    aws.String("On time"),
 				},
 				{
-					RecordedAtTime:     now.Format(time.RFC3339),
+					RecordedAtTime:     now,
 					JourneyType:        model.Train,
 					JourneyRef:         "Service2",
-					AimedDepartureTime: now.Truncate(time.Minute).Format(time.RFC3339),
+					AimedDepartureTime: now.Truncate(time.Minute),
 					DepartureStatus:    aws.String("On time"),
 				},
 				{
-					RecordedAtTime:     now.Format(time.RFC3339),
+					RecordedAtTime:     now,
 					JourneyType:        model.Train,
 					JourneyRef:         "Service3",
-					AimedDepartureTime: test_helpers.AdjustTime(now, "2m").Truncate(time.Minute).Format(time.RFC3339),
+					AimedDepartureTime: test_helpers.AdjustTime(now, "2m").Truncate(time.Minute),
 					DepartureStatus:    aws.String("On time"),
 				},
 			},
 		}
 
-		err := in.removeExpiredDepartures(now, &departures)
+		err := in.removeExpiredDepartures(now, &departures, model.DeparturesBoard)
 		if err != nil {
 			t.Error(err)
 			return
@@ -819,30 +1051,30 @@ func TestNREPoller_removeExpiredDepartures(t *testing.T) {
 		departures := model.Internal{
 			Departures: []model.Departure{
 				{
-					RecordedAtTime:     now.Format(time.RFC3339),
+					RecordedAtTime:     now,
 					JourneyType:        model.Train,
 					JourneyRef:         "Service1",
-					AimedDepartureTime: test_helpers.AdjustTime(now, "-1m").Truncate(time.Minute).Format(time.RFC3339),
+					AimedDepartureTime: test_helpers.AdjustTime(now, "-1m").Truncate(time.Minute),
 					DepartureStatus:    aws.String("Cancelled"),
 				},
 				{
-					RecordedAtTime:     now.Format(time.RFC3339),
+					RecordedAtTime:     now,
 					JourneyType:        model.Train,
 					JourneyRef:         "Service2",
-					AimedDepartureTime: now.Truncate(time.Minute).Format(time.RFC3339),
+					AimedDepartureTime: now.Truncate(time.Minute),
 					DepartureStatus:    aws.String("Cancelled"),
 				},
 				{
-					RecordedAtTime:     now.Format(time.RFC3339),
+					RecordedAtTime:     now,
 					JourneyType:        model.Train,
 					JourneyRef:         "Service3",
-					AimedDepartureTime: test_helpers.AdjustTime(now, "1m").Truncate(time.Minute).Format(time.RFC3339),
+					AimedDepartureTime: test_helpers.AdjustTime(now, "1m").Truncate(time.Minute),
 					DepartureStatus:    aws.String("Cancelled"),
 				},
 			},
 		}
 
-		err := in.removeExpiredDepartures(now, &departures)
+		err := in.removeExpiredDepartures(now, &departures, model.DeparturesBoard)
 		if err != nil {
 			t.Error(err)
 			return
@@ -868,30 +1100,30 @@ func TestNREPoller_removeExpiredDepartures(t *testing.T) {
 		departures := model.Internal{
 			Departures: []model.Departure{
 				{
-					RecordedAtTime:     now.Format(time.RFC3339),
+					RecordedAtTime:     now,
 					JourneyType:        model.Train,
 					JourneyRef:         "Service1",
-					AimedDepartureTime: test_helpers.AdjustTime(now, "-1m").Truncate(time.Minute).Format(time.RFC3339),
+					AimedDepartureTime: test_helpers.AdjustTime(now, "-1m").Truncate(time.Minute),
 					DepartureStatus:    aws.String("Delayed"),
 				},
 				{
-					RecordedAtTime:     now.Format(time.RFC3339),
+					RecordedAtTime:     now,
 					JourneyType:        model.Train,
 					JourneyRef:         "Service2",
-					AimedDepartureTime: now.Truncate(time.Minute).Format(time.RFC3339),
+					AimedDepartureTime: now.Truncate(time.Minute),
 					DepartureStatus:    aws.String("Delayed"),
 				},
 				{
-					RecordedAtTime:     now.Format(time.RFC3339),
+					RecordedAtTime:     now,
 					JourneyType:        model.Train,
 					JourneyRef:         "Service3",
-					AimedDepartureTime: test_helpers.AdjustTime(now, "1m").Truncate(time.Minute).Format(time.RFC3339),
+					AimedDepartureTime: test_helpers.AdjustTime(now, "1m").Truncate(time.Minute),
 					DepartureStatus:    aws.String("Delayed"),
 				},
 			},
 		}
 
-		err := in.removeExpiredDepartures(now, &departures)
+		err := in.removeExpiredDepartures(now, &departures, model.DeparturesBoard)
 		if err != nil {
 			t.Error(err)
 			return
@@ -922,30 +1154,30 @@ func TestNREPoller_removeExpiredDepartures(t *testing.T) {
 		departures := model.Internal{
 			Departures: []model.Departure{
 				{
-					RecordedAtTime:     now.Format(time.RFC3339),
+					RecordedAtTime:     now,
 					JourneyType:        model.Train,
 					JourneyRef:         "Service1",
-					AimedDepartureTime: test_helpers.AdjustTime(now, "-2m").Truncate(time.Minute).Format(time.RFC3339),
+					AimedDepartureTime: test_helpers.AdjustTime(now, "-2m").Truncate(time.Minute),
 					DepartureStatus:    aws.String(test_helpers.AdjustTime(now, "-1m").Format("15:04")),
 				},
 				{
-					RecordedAtTime:     now.Format(time.RFC3339),
+					RecordedAtTime:     now,
 					JourneyType:        model.Train,
 					JourneyRef:         "Service2",
-					AimedDepartureTime: test_helpers.AdjustTime(now, "-2m").Truncate(time.Minute).Format(time.RFC3339),
+					AimedDepartureTime: test_helpers.AdjustTime(now, "-2m").Truncate(time.Minute),
 					DepartureStatus:    aws.String(now.Format("15:04")),
 				},
 				{
-					RecordedAtTime:     now.Format(time.RFC3339),
+					RecordedAtTime:     now,
 					JourneyType:        model.Train,
 					JourneyRef:         "Service3",
-					AimedDepartureTime: test_helpers.AdjustTime(now, "-2m").Truncate(time.Minute).Format(time.RFC3339),
+					AimedDepartureTime: test_helpers.AdjustTime(now, "-2m").Truncate(time.Minute),
 					DepartureStatus:    aws.String(test_helpers.AdjustTime(now, "1m").Format("15:04")),
 				},
 			},
 		}
 
-		err := in.removeExpiredDepartures(now, &departures)
+		err := in.removeExpiredDepartures(now, &departures, model.DeparturesBoard)
 		if err != nil {
 			t.Error(err)
 			return
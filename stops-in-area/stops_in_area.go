@@ -5,6 +5,7 @@ import (
 	"encoding/csv"
 	"fmt"
 	"github.com/TfGMEnterprise/departures-service/dlog"
+	"github.com/TfGMEnterprise/departures-service/model"
 	"github.com/TfGMEnterprise/departures-service/naptan"
 	"github.com/TfGMEnterprise/departures-service/repository"
 	"github.com/aws/aws-lambda-go/lambda"
@@ -20,7 +21,10 @@ import (
 )
 
 type StopsInArea struct {
-	Filename      string
+	Filename string
+	// StopsFilename is the file containing the NaPTAN Indicator of each stop;
+	// indicators are not loaded if it is not set
+	StopsFilename string
 	Logger        *dlog.Logger
 	NaptanClient  *naptan.Naptan
 	RedisPipeline *repository.RedisPipeline
@@ -61,6 +65,11 @@ func main() {
 		stopsInAreaFileName = "StopsInArea.csv"
 	}
 
+	stopsFileName, exists := os.LookupEnv("NAPTAN_CSV_STOPS_FILENAME")
+	if !exists || stopsFileName == "" {
+		stopsFileName = "Stops.csv"
+	}
+
 	redisHost, exists := os.LookupEnv("STOPS_IN_AREA_REDIS_HOST")
 	if !exists || redisHost == "" {
 		logger.Fatal("STOPS_IN_AREA_REDIS_HOST not set in environment")
@@ -95,8 +104,9 @@ func main() {
 	}
 
 	sia := StopsInArea{
-		Filename: stopsInAreaFileName,
-		Logger:   logger,
+		Filename:      stopsInAreaFileName,
+		StopsFilename: stopsFileName,
+		Logger:        logger,
 		NaptanClient: &naptan.Naptan{
 			Client: &http.Client{
 				Timeout: time.Second * time.Duration(naptanCSVTimeout),
@@ -171,17 +181,15 @@ func (sia *StopsInArea) waitForRedisPipeline(done <-chan struct{}, errs chan err
 	close(errs)
 }
 
-// channelFileInZip reads the compressed StopsInArea.csv file and adds commands
-// to set the data in a Redis cache
-func (sia *StopsInArea) channelFileInZip(exitImmediately <-chan struct{}, zf *zip.File, send chan repository.RedisCommand, errs chan error) {
-	// Close the send channel when the function exits
-	defer close(send)
-
+// channelFileInZip reads a compressed CSV file and adds the command returned
+// by commandForRow for each row to the send channel. It returns false if the
+// file could not be read.
+func (sia *StopsInArea) channelFileInZip(exitImmediately <-chan struct{}, zf *zip.File, send chan repository.RedisCommand, errs chan error, commandForRow func(columns map[string]int, row []string) *repository.RedisCommand) bool {
 	sia.Logger.Debugf("open file in ZIP: %s", zf.Name)
 	f, err := zf.Open()
 	if err != nil {
 		errs <- errors.Wrapf(err, "cannot open zipped file %s", zf.Name)
-		return
+		return false
 	}
 
 	defer func() {
@@ -194,13 +202,19 @@ func (sia *StopsInArea) channelFileInZip(exitImmediately <-chan struct{}, zf *zi
 
 	r := csv.NewReader(f)
 
-	// Skip the header row
-	if _, err := r.Read(); err != nil {
-		errs <- errors.Wrapf(err, "cannot skip header row in file %s", zf.Name)
-		return
+	// Read the column names from the header row
+	header, err := r.Read()
+	if err != nil {
+		errs <- errors.Wrapf(err, "cannot read header row in file %s", zf.Name)
+		return false
 	}
 
-	// Loop through the rows in the CSV and add a command to set the in a
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(name)] = i
+	}
+
+	// Loop through the rows in the CSV and add a command to set the data in a
 	// Redis database to the send channel
 	for {
 		row, err := r.Read()
@@ -209,43 +223,91 @@ func (sia *StopsInArea) channelFileInZip(exitImmediately <-chan struct{}, zf *zi
 		}
 		if err != nil {
 			errs <- errors.Wrapf(err, "cannot read row in file %s", zf.Name)
-			return
+			return false
 		}
+
+		command := commandForRow(columns, row)
+		if command == nil {
+			continue
+		}
+
 		select {
-		case send <- repository.RedisCommand{
-			Name:   "SET",
-			Args:   []interface{}{row[1], row[0]},
-			Result: make(chan repository.RedisResult, 1),
-		}:
+		case send <- *command:
 		case <-exitImmediately:
 			errs <- errors.New("channelFileInZip cancelled")
-			return
+			return false
 		}
 	}
+
+	return true
+}
+
+// stopAreaCommand sets the stop area for the stop in the row of the
+// StopsInArea.csv file
+func (sia *StopsInArea) stopAreaCommand(columns map[string]int, row []string) *repository.RedisCommand {
+	return &repository.RedisCommand{
+		Name:   "SET",
+		Args:   []interface{}{row[1], row[0]},
+		Result: make(chan repository.RedisResult, 1),
+	}
+}
+
+// indicatorCommand sets the NaPTAN Indicator for the stop in the row of the
+// Stops.csv file, if it has one
+func (sia *StopsInArea) indicatorCommand(columns map[string]int, row []string) *repository.RedisCommand {
+	atcocodeColumn, exists := columns["atcocode"]
+	if !exists {
+		return nil
+	}
+
+	indicatorColumn, exists := columns["indicator"]
+	if !exists || indicatorColumn >= len(row) || row[indicatorColumn] == "" {
+		return nil
+	}
+
+	return &repository.RedisCommand{
+		Name:   "SET",
+		Args:   []interface{}{model.StandIndicatorKeyPrefix + row[atcocodeColumn], row[indicatorColumn]},
+		Result: make(chan repository.RedisResult, 1),
+	}
 }
 
 // processZipFile loops through the NaPTANcsv.zip file and looks for the
-// file that matches the configured target filename.
-// If the file is found, it is passed to an extractor function which returns
-// a "send" channel containing the commands to put the contents of the file in
-// a Redis cache.
-// If the file is not found, an error is created on the error channel and
-// the send channel is immediately closed.
+// files that match the configured target filenames.
+// Each file found is passed to channelFileInZip, which adds the commands to
+// put the contents of the file in a Redis cache to the send channel.
+// If a file is not found, an error is created on the error channel. The send
+// channel is closed once all of the files have been processed.
 func (sia *StopsInArea) processZipFile(exitImmediately <-chan struct{}, zipReader *zip.Reader, send chan repository.RedisCommand, errs chan error) {
 	sia.Logger.Debug("processZipFile")
 
+	defer close(send)
+
+	if !sia.processFileInZip(exitImmediately, zipReader, sia.Filename, send, errs, sia.stopAreaCommand) {
+		return
+	}
+
+	if sia.StopsFilename == "" {
+		return
+	}
+
+	sia.processFileInZip(exitImmediately, zipReader, sia.StopsFilename, send, errs, sia.indicatorCommand)
+}
+
+// processFileInZip finds the named file in the ZIP and passes it to
+// channelFileInZip. It returns false if the file was not found or could not be
+// read.
+func (sia *StopsInArea) processFileInZip(exitImmediately <-chan struct{}, zipReader *zip.Reader, filename string, send chan repository.RedisCommand, errs chan error, commandForRow func(columns map[string]int, row []string) *repository.RedisCommand) bool {
 	for _, zf := range zipReader.File {
-		if strings.ToLower(zf.Name) != strings.ToLower(sia.Filename) {
+		if strings.ToLower(zf.Name) != strings.ToLower(filename) {
 			sia.Logger.Debugf("skip file in ZIP: %s", zf.Name)
 			continue
 		}
 
-		go sia.channelFileInZip(exitImmediately, zf, send, errs)
-
-		return
+		return sia.channelFileInZip(exitImmediately, zf, send, errs, commandForRow)
 	}
 
 	// File not found - nothing will get published to the send channel
-	errs <- fmt.Errorf("file %s not found in ZIP", sia.Filename)
-	close(send)
+	errs <- fmt.Errorf("file %s not found in ZIP", filename)
+	return false
 }
@@ -51,8 +51,9 @@ func TestStopsInArea_Handler(t *testing.T) {
 		defer s.Close()
 
 		sia := StopsInArea{
-			Filename: "StopsInArea.csv",
-			Logger:   logger,
+			Filename:      "StopsInArea.csv",
+			StopsFilename: "Stops.csv",
+			Logger:        logger,
 			NaptanClient: &naptan.Naptan{
 				Client: naptanStub.Client(),
 				Logger: logger,
@@ -82,6 +83,50 @@ func TestStopsInArea_Handler(t *testing.T) {
 		s.CheckGet(t, "1800SHIC0B1", "180GSHIC")
 		s.CheckGet(t, "1800TCBS031", "180GTCBS")
 		s.CheckGet(t, "1800WEIC0B1", "180GWEIC")
+
+		s.CheckGet(t, "indicator:1800ANBS0G1", "Stand G")
+		s.CheckGet(t, "indicator:1800BNINM1", "Stand M")
+		s.CheckGet(t, "indicator:1800EB01741", "opp")
+	})
+
+	t.Run("stops file not found in zip", func(t *testing.T) {
+		naptanStub := createNaptanSourceStub(t)
+		defer naptanStub.Close()
+
+		logger := dlog.NewLogger([]dlog.LoggerOption{
+			dlog.LoggerSetOutput(ioutil.Discard),
+		}...)
+
+		s, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+
+		sia := StopsInArea{
+			Filename:      "StopsInArea.csv",
+			StopsFilename: "NonExistant.csv",
+			Logger:        logger,
+			NaptanClient: &naptan.Naptan{
+				Client: naptanStub.Client(),
+				Logger: logger,
+				URL:    naptanStub.URL,
+			},
+			RedisPipeline: &repository.RedisPipeline{
+				FlushAfter: 3,
+				Pool: repository.NewRedisPool([]repository.RedisPoolOption{
+					repository.RedisPoolDial(func() (redis.Conn, error) {
+						return redis.Dial("tcp", s.Addr())
+					}),
+					repository.RedisPoolMaxActive(10),
+				}...),
+			},
+		}
+
+		if err := sia.Handler(); err == nil {
+			t.Error("an error should have occurred")
+			return
+		}
 	})
 
 	t.Run("file not found in zip", func(t *testing.T) {
@@ -0,0 +1,146 @@
+package test_helpers
+
+import (
+	"encoding/json"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"testing"
+)
+
+// gtfsRealtimeDescriptor describes the messages of gtfs-realtime.proto that
+// are used for trip updates, with the field numbers from the specification
+const gtfsRealtimeDescriptor = `
+name: "gtfs-realtime.proto"
+package: "transit_realtime"
+syntax: "proto2"
+message_type: {
+  name: "FeedMessage"
+  field: { name: "header" number: 1 label: LABEL_REQUIRED type: TYPE_MESSAGE type_name: ".transit_realtime.FeedHeader" }
+  field: { name: "entity" number: 2 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".transit_realtime.FeedEntity" }
+}
+message_type: {
+  name: "FeedHeader"
+  field: { name: "gtfs_realtime_version" number: 1 label: LABEL_REQUIRED type: TYPE_STRING }
+  field: { name: "incrementality" number: 2 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".transit_realtime.FeedHeader.Incrementality" }
+  field: { name: "timestamp" number: 3 label: LABEL_OPTIONAL type: TYPE_UINT64 }
+  enum_type: {
+    name: "Incrementality"
+    value: { name: "FULL_DATASET" number: 0 }
+    value: { name: "DIFFERENTIAL" number: 1 }
+  }
+}
+message_type: {
+  name: "FeedEntity"
+  field: { name: "id" number: 1 label: LABEL_REQUIRED type: TYPE_STRING }
+  field: { name: "is_deleted" number: 2 label: LABEL_OPTIONAL type: TYPE_BOOL }
+  field: { name: "trip_update" number: 3 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".transit_realtime.TripUpdate" }
+}
+message_type: {
+  name: "TripUpdate"
+  field: { name: "trip" number: 1 label: LABEL_REQUIRED type: TYPE_MESSAGE type_name: ".transit_realtime.TripDescriptor" }
+  field: { name: "stop_time_update" number: 2 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".transit_realtime.TripUpdate.StopTimeUpdate" }
+  field: { name: "timestamp" number: 4 label: LABEL_OPTIONAL type: TYPE_UINT64 }
+  field: { name: "delay" number: 5 label: LABEL_OPTIONAL type: TYPE_INT32 }
+  nested_type: {
+    name: "StopTimeEvent"
+    field: { name: "delay" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 }
+    field: { name: "time" number: 2 label: LABEL_OPTIONAL type: TYPE_INT64 }
+    field: { name: "uncertainty" number: 3 label: LABEL_OPTIONAL type: TYPE_INT32 }
+  }
+  nested_type: {
+    name: "StopTimeUpdate"
+    field: { name: "stop_sequence" number: 1 label: LABEL_OPTIONAL type: TYPE_UINT32 }
+    field: { name: "stop_id" number: 4 label: LABEL_OPTIONAL type: TYPE_STRING }
+    field: { name: "arrival" number: 2 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".transit_realtime.TripUpdate.StopTimeEvent" }
+    field: { name: "departure" number: 3 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".transit_realtime.TripUpdate.StopTimeEvent" }
+    field: { name: "schedule_relationship" number: 5 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".transit_realtime.TripUpdate.StopTimeUpdate.ScheduleRelationship" }
+    enum_type: {
+      name: "ScheduleRelationship"
+      value: { name: "SCHEDULED" number: 0 }
+      value: { name: "SKIPPED" number: 1 }
+      value: { name: "NO_DATA" number: 2 }
+    }
+  }
+}
+message_type: {
+  name: "TripDescriptor"
+  field: { name: "trip_id" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+  field: { name: "start_time" number: 2 label: LABEL_OPTIONAL type: TYPE_STRING }
+  field: { name: "start_date" number: 3 label: LABEL_OPTIONAL type: TYPE_STRING }
+  field: { name: "route_id" number: 5 label: LABEL_OPTIONAL type: TYPE_STRING }
+  field: { name: "direction_id" number: 6 label: LABEL_OPTIONAL type: TYPE_UINT32 }
+}
+`
+
+// DecodeGTFSRealtimeFeed decodes a GTFS Realtime FeedMessage with the
+// reference protocol buffer parser and returns it as JSON, keyed by the JSON
+// names of its fields, so that it can be unmarshalled into a model.FeedMessage.
+// The test fails if the feed is not valid or has fields that are not known.
+func DecodeGTFSRealtimeFeed(t *testing.T, b []byte) []byte {
+	t.Helper()
+
+	fileDescriptorProto := &descriptorpb.FileDescriptorProto{}
+	if err := prototext.Unmarshal([]byte(gtfsRealtimeDescriptor), fileDescriptorProto); err != nil {
+		t.Fatal(err)
+	}
+
+	fileDescriptor, err := protodesc.NewFile(fileDescriptorProto, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	feedMessage := dynamicpb.NewMessage(fileDescriptor.Messages().ByName("FeedMessage"))
+	if err := proto.Unmarshal(b, feedMessage); err != nil {
+		t.Fatal(err)
+	}
+
+	feedMessageJSON, err := json.Marshal(protoMessageToMap(t, feedMessage))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return feedMessageJSON
+}
+
+func protoMessageToMap(t *testing.T, m protoreflect.Message) map[string]interface{} {
+	t.Helper()
+
+	if unknown := m.GetUnknown(); len(unknown) > 0 {
+		t.Errorf("%s has unknown fields: %v", m.Descriptor().FullName(), unknown)
+	}
+
+	fields := make(map[string]interface{})
+
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.IsList() {
+			var values []interface{}
+			for i := 0; i < v.List().Len(); i++ {
+				values = append(values, protoValue(t, fd, v.List().Get(i)))
+			}
+			fields[fd.JSONName()] = values
+			return true
+		}
+
+		fields[fd.JSONName()] = protoValue(t, fd, v)
+		return true
+	})
+
+	return fields
+}
+
+func protoValue(t *testing.T, fd protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+	t.Helper()
+
+	switch fd.Kind() {
+	case protoreflect.MessageKind:
+		return protoMessageToMap(t, v.Message())
+	case protoreflect.EnumKind:
+		return int32(v.Enum())
+	}
+
+	return v.Interface()
+}
@@ -70,3 +70,12 @@ func AdjustTime(now time.Time, d string) time.Time {
 	duration, _ := time.ParseDuration(d)
 	return now.Add(duration)
 }
+
+func ParseTime(t *testing.T, value string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t.Fatalf("cannot parse time `%s`: %s\n", value, err.Error())
+	}
+	return parsed
+}